@@ -1,9 +1,18 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
+
+	"ESP-data/internal/logging"
+	"ESP-data/internal/metrics"
 )
 
 // validAssetID matches the Asset ID format defined in the schema (e.g. "A00012").
@@ -62,3 +71,120 @@ func extractMitigationID(urlPath string, segmentIndex int) (string, error) {
 
 	return mitigationID, nil
 }
+
+// ============================================================
+// Request IDs
+// ============================================================
+
+// RequestIDHeader carries the request ID in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID bounds a client-supplied request ID to a safe, short token
+// so it can be logged and stored in calc_sessions.request_id as is.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// WithRequestID gives every request an ID — the client's X-Request-ID when
+// valid, otherwise a new one — returns it in the X-Request-ID response header
+// and puts it on the request context, so every log record of the request,
+// its ComputeTTB calls and its queued FlushBatch carry it.
+func WithRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// ============================================================
+// Request deadline and cancellation
+// ============================================================
+
+// WithRequestDeadline bounds every request's context by timeout, so graph
+// and store work stops between round trips once it passes. Job routes are
+// exempt: their SSE streams stay open for the life of the job. A timeout of
+// zero or less disables the deadline.
+func WithRequestDeadline(timeout time.Duration, next http.Handler) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/jobs/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestAborted reports whether r's context is done — the client went away
+// or the request deadline passed — in which case results may be partial and
+// must not be written. A passed deadline is answered with 504.
+func requestAborted(w http.ResponseWriter, r *http.Request) bool {
+	err := r.Context().Err()
+	if err == nil {
+		return false
+	}
+	slog.WarnContext(r.Context(), "api: request abandoned", "method", r.Method, "path", r.URL.Path, "err", err)
+	if errors.Is(err, context.DeadlineExceeded) {
+		http.Error(w, "Request deadline exceeded", http.StatusGatewayTimeout)
+	}
+	return true
+}
+
+// ============================================================
+// Request metrics
+// ============================================================
+
+// WithMetrics times every request served by mux in
+// esp_http_request_duration_seconds, labelled with the registered route
+// pattern (not the raw path, so asset IDs do not multiply series), the
+// method and the status code.
+func WithMetrics(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		metrics.HTTPRequestSeconds.Since(start, route, r.Method, strconv.Itoa(rec.status))
+	})
+}
+
+// statusRecorder captures the status code written by a handler. It keeps
+// http.Flusher working for the job event stream.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if !s.wroteHeader {
+		s.status = code
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
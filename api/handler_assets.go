@@ -2,41 +2,39 @@ package api
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
 	"ESP-data/config"
 	"ESP-data/internal/graph"
-	"ESP-data/internal/nebula"
+	"ESP-data/internal/graphstore"
 	"ESP-data/internal/store"
-
-	nebulago "github.com/vesoft-inc/nebula-go/v3"
 )
 
 // This satisfies REQ-122 (JSON output) and REQ-131 (JSON format for API responses).
-func GraphHandler(pool *nebulago.ConnectionPool, cfg *config.Config) http.HandlerFunc {
+func GraphHandler(gs graphstore.GraphStore, cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		requestStart := time.Now()
-		log.Printf("[%s] api: received request from %s %s", requestStart.Format("15:04:05.000"), r.Method, r.URL.Path)
+		slog.DebugContext(r.Context(), "api: /api/graph request")
 
 		// Query Nebula for asset connectivity
-		rows, err := nebula.QueryAssets(pool, cfg)
+		rows, err := gs.QueryAssets(r.Context())
 		if err != nil {
-			log.Printf("[%s] api: query failed: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(r.Context(), "api: query failed", "err", err)
 			http.Error(w, "Failed to query database", http.StatusInternalServerError)
 			return
 		}
 
 		// Build Cytoscape graph from query results
 		cyGraph := graph.BuildGraph(rows)
-		log.Printf("[%s] api: built graph with %d nodes, %d edges", time.Now().Format("15:04:05.000"), len(cyGraph.Nodes), len(cyGraph.Edges))
+		slog.DebugContext(r.Context(), "api: built graph", "nodes", len(cyGraph.Nodes), "edges", len(cyGraph.Edges))
 
 		// Marshal to JSON
 		jsonData, err := json.Marshal(cyGraph)
 		if err != nil {
-			log.Printf("[%s] api: JSON marshal failed: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(r.Context(), "api: JSON marshal failed", "err", err)
 			http.Error(w, "Failed to generate JSON", http.StatusInternalServerError)
 			return
 		}
@@ -45,23 +43,24 @@ func GraphHandler(pool *nebulago.ConnectionPool, cfg *config.Config) http.Handle
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		if _, err := w.Write(jsonData); err != nil {
-			log.Printf("[%s] api: failed to write response: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(r.Context(), "api: failed to write response", "err", err)
 		}
 
 		requestDuration := time.Since(requestStart)
-		log.Printf("[%s] api: response sent successfully (%d bytes) in %.3f seconds", time.Now().Format("15:04:05.000"), len(jsonData), requestDuration.Seconds())
+		slog.InfoContext(r.Context(), "api: returned graph", "nodes", len(cyGraph.Nodes),
+			"edges", len(cyGraph.Edges), "bytes", len(jsonData), "elapsed", requestDuration)
 	}
 }
 
 // AssetsHandler returns asset list with details for sidebar (REQ-021).
-func AssetsHandler(pool *nebulago.ConnectionPool, cfg *config.Config) http.HandlerFunc {
+func AssetsHandler(gs graphstore.GraphStore, cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		requestStart := time.Now()
-		log.Printf("[%s] api: /api/assets request", requestStart.Format("15:04:05.000"))
+		slog.DebugContext(r.Context(), "api: /api/assets request")
 
-		assets, err := nebula.QueryAssetsWithDetails(pool, cfg)
+		assets, err := gs.QueryAssetsWithDetails(r.Context())
 		if err != nil {
-			log.Printf("[%s] api: QueryAssetsWithDetails failed: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(r.Context(), "api: QueryAssetsWithDetails failed", "err", err)
 			http.Error(w, "Failed to query assets", http.StatusInternalServerError)
 			return
 		}
@@ -70,42 +69,74 @@ func AssetsHandler(pool *nebulago.ConnectionPool, cfg *config.Config) http.Handl
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(response); err != nil {
-			log.Printf("[%s] api: JSON encode failed: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
 		}
 
 		requestDuration := time.Since(requestStart)
-		log.Printf("[%s] api: returned %d assets in %.3f seconds", time.Now().Format("15:04:05.000"), len(assets), requestDuration.Seconds())
+		slog.InfoContext(r.Context(), "api: returned assets", "assets", len(assets), "elapsed", requestDuration)
 	}
 }
 
-// AssetHandler dispatches /api/asset/{id}[/mitigations[/{mid}]] requests.
-// It routes to asset detail (REQ-022) or mitigations CRUD (REQ-034/035/036)
-// based on the URL path structure.
-func AssetHandler(pool *nebulago.ConnectionPool, cfg *config.Config, auditStore *store.Store) http.HandlerFunc {
+// AssetHandler dispatches /api/asset/{id}[/mitigations[/{mid}] |
+// /detections[/{cid}] | /ttb-detail] requests. It routes to asset detail
+// (REQ-022), mitigations CRUD (REQ-034/035/036), detection controls CRUD
+// or the cached TTB breakdown (ADR-REQ-052) based on the URL path structure.
+func AssetHandler(gs graphstore.GraphStore, cfg *config.Config, auditStore *store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		parts := strings.Split(strings.TrimRight(r.URL.Path, "/"), "/")
 		// /api/asset/{id}                       → len 4
 		// /api/asset/{id}/mitigations           → len 5
 		// /api/asset/{id}/mitigations/{mid}     → len 6
+		// /api/asset/{id}/detections            → len 5
+		// /api/asset/{id}/detections/{cid}      → len 6
+		// /api/asset/{id}/ttb-detail            → len 5
+		// /api/asset/{id}/chains                → len 5
 
 		switch {
 		case len(parts) == 4:
-			handleAssetDetail(pool, cfg, w, r)
+			handleAssetDetail(gs, cfg, w, r)
 		case len(parts) >= 5 && parts[4] == "mitigations":
 			switch r.Method {
 			case http.MethodGet:
-				handleGetAssetMitigations(pool, cfg, w, r)
+				handleGetAssetMitigations(gs, cfg, w, r)
 			case http.MethodPut:
-				handleUpsertAssetMitigation(pool, cfg, auditStore, w, r)
+				handleUpsertAssetMitigation(gs, cfg, auditStore, w, r)
 			case http.MethodDelete:
 				if len(parts) < 6 {
 					http.Error(w, "Missing mitigation ID for DELETE", http.StatusBadRequest)
 					return
 				}
-				handleDeleteAssetMitigation(pool, cfg, auditStore, w, r)
+				handleDeleteAssetMitigation(gs, cfg, auditStore, w, r)
 			default:
 				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			}
+		case len(parts) >= 5 && parts[4] == "detections":
+			switch r.Method {
+			case http.MethodGet:
+				handleGetAssetDetections(gs, w, r)
+			case http.MethodPut:
+				handleUpsertAssetDetection(gs, w, r)
+			case http.MethodDelete:
+				if len(parts) < 6 {
+					http.Error(w, "Missing detection control ID for DELETE", http.StatusBadRequest)
+					return
+				}
+				handleDeleteAssetDetection(gs, w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case len(parts) == 5 && parts[4] == "chains":
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			handleGetAssetChains(gs, w, r)
+		case len(parts) == 5 && parts[4] == "ttb-detail":
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			handleAssetTTBDetail(auditStore, w, r)
 		default:
 			http.Error(w, "Not found", http.StatusNotFound)
 		}
@@ -113,22 +144,22 @@ func AssetHandler(pool *nebulago.ConnectionPool, cfg *config.Config, auditStore
 }
 
 // handleAssetDetail returns detail for single asset (REQ-022).
-func handleAssetDetail(pool *nebulago.ConnectionPool, cfg *config.Config, w http.ResponseWriter, r *http.Request) {
+func handleAssetDetail(gs graphstore.GraphStore, cfg *config.Config, w http.ResponseWriter, r *http.Request) {
 	requestStart := time.Now()
 
 	// Extract and validate asset ID from URL path: /api/asset/{id}
 	assetID, err := extractAssetID(r.URL.Path, 3)
 	if err != nil {
-		log.Printf("[%s] api: /api/asset/ bad request: %v", requestStart.Format("15:04:05.000"), err)
+		slog.WarnContext(r.Context(), "api: /api/asset/ bad request", "err", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("[%s] api: /api/asset/%s request", requestStart.Format("15:04:05.000"), assetID)
+	slog.DebugContext(r.Context(), "api: /api/asset/{id} request", "asset", assetID)
 
-	detail, err := nebula.QueryAssetDetail(pool, cfg, assetID)
+	detail, err := gs.QueryAssetDetail(r.Context(), assetID)
 	if err != nil {
-		log.Printf("[%s] api: QueryAssetDetail failed: %v", time.Now().Format("15:04:05.000"), err)
+		slog.ErrorContext(r.Context(), "api: QueryAssetDetail failed", "err", err)
 		http.Error(w, "Asset not found", http.StatusNotFound)
 		return
 	}
@@ -137,31 +168,31 @@ func handleAssetDetail(pool *nebulago.ConnectionPool, cfg *config.Config, w http
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("[%s] api: JSON encode failed: %v", time.Now().Format("15:04:05.000"), err)
+		slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
 	}
 
 	requestDuration := time.Since(requestStart)
-	log.Printf("[%s] api: returned detail for %s in %.3f seconds", time.Now().Format("15:04:05.000"), assetID, requestDuration.Seconds())
+	slog.InfoContext(r.Context(), "api: returned asset detail", "asset", assetID, "elapsed", requestDuration)
 }
 
 // NeighborsHandler returns neighbors for inspector panel (REQ-023).
-func NeighborsHandler(pool *nebulago.ConnectionPool, cfg *config.Config) http.HandlerFunc {
+func NeighborsHandler(gs graphstore.GraphStore, cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		requestStart := time.Now()
 
 		// Extract and validate asset ID from URL path: /api/neighbors/{id}
 		assetID, err := extractAssetID(r.URL.Path, 3)
 		if err != nil {
-			log.Printf("[%s] api: /api/neighbors/ bad request: %v", requestStart.Format("15:04:05.000"), err)
+			slog.WarnContext(r.Context(), "api: /api/neighbors/ bad request", "err", err)
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		log.Printf("[%s] api: /api/neighbors/%s request", requestStart.Format("15:04:05.000"), assetID)
+		slog.DebugContext(r.Context(), "api: /api/neighbors/{id} request", "asset", assetID)
 
-		neighbors, err := nebula.QueryNeighbors(pool, cfg, assetID)
+		neighbors, err := gs.QueryNeighbors(r.Context(), assetID)
 		if err != nil {
-			log.Printf("[%s] api: QueryNeighbors failed: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(r.Context(), "api: QueryNeighbors failed", "err", err)
 			http.Error(w, "Failed to query neighbors", http.StatusInternalServerError)
 			return
 		}
@@ -170,23 +201,24 @@ func NeighborsHandler(pool *nebulago.ConnectionPool, cfg *config.Config) http.Ha
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(response); err != nil {
-			log.Printf("[%s] api: JSON encode failed: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
 		}
 
 		requestDuration := time.Since(requestStart)
-		log.Printf("[%s] api: returned %d neighbors for %s in %.3f seconds", time.Now().Format("15:04:05.000"), len(neighbors), assetID, requestDuration.Seconds())
+		slog.InfoContext(r.Context(), "api: returned neighbors", "asset", assetID,
+			"neighbors", len(neighbors), "elapsed", requestDuration)
 	}
 }
 
 // AssetTypesHandler returns asset types for filter dropdown (REQ-024).
-func AssetTypesHandler(pool *nebulago.ConnectionPool, cfg *config.Config) http.HandlerFunc {
+func AssetTypesHandler(gs graphstore.GraphStore, cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		requestStart := time.Now()
-		log.Printf("[%s] api: /api/asset-types request", requestStart.Format("15:04:05.000"))
+		slog.DebugContext(r.Context(), "api: /api/asset-types request")
 
-		types, err := nebula.QueryAssetTypes(pool, cfg)
+		types, err := gs.QueryAssetTypes(r.Context())
 		if err != nil {
-			log.Printf("[%s] api: QueryAssetTypes failed: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(r.Context(), "api: QueryAssetTypes failed", "err", err)
 			http.Error(w, "Failed to query asset types", http.StatusInternalServerError)
 			return
 		}
@@ -195,17 +227,18 @@ func AssetTypesHandler(pool *nebulago.ConnectionPool, cfg *config.Config) http.H
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(response); err != nil {
-			log.Printf("[%s] api: JSON encode failed: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
 		}
 
 		requestDuration := time.Since(requestStart)
-		log.Printf("[%s] api: returned %d asset types in %.3f seconds", time.Now().Format("15:04:05.000"), len(types), requestDuration.Seconds())
+		slog.InfoContext(r.Context(), "api: returned asset types", "asset_types", len(types),
+			"elapsed", requestDuration)
 	}
 }
 
 // EdgesHandler returns all connects_to edge properties between two assets
 // for the edge inspector panel (REQ-026, UI-REQ-212).
-func EdgesHandler(pool *nebulago.ConnectionPool, cfg *config.Config) http.HandlerFunc {
+func EdgesHandler(gs graphstore.GraphStore, cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		requestStart := time.Now()
 
@@ -213,36 +246,36 @@ func EdgesHandler(pool *nebulago.ConnectionPool, cfg *config.Config) http.Handle
 		// REQ-025: validate before query execution
 		sourceID, err := extractAssetID(r.URL.Path, 3)
 		if err != nil {
-			log.Printf("[%s] api: /api/edges/ bad source: %v", requestStart.Format("15:04:05.000"), err)
+			slog.WarnContext(r.Context(), "api: /api/edges/ bad source", "err", err)
 			http.Error(w, "Invalid source asset ID: "+err.Error(), http.StatusBadRequest)
 			return
 		}
 		targetID, err := extractAssetID(r.URL.Path, 4)
 		if err != nil {
-			log.Printf("[%s] api: /api/edges/ bad target: %v", requestStart.Format("15:04:05.000"), err)
+			slog.WarnContext(r.Context(), "api: /api/edges/ bad target", "err", err)
 			http.Error(w, "Invalid target asset ID: "+err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		log.Printf("[%s] api: /api/edges/%s/%s request", requestStart.Format("15:04:05.000"), sourceID, targetID)
+		slog.DebugContext(r.Context(), "api: /api/edges/{src}/{dst} request", "src", sourceID, "dst", targetID)
 
 		// Fetch edge connections and both asset details
-		connections, err := nebula.QueryEdgeConnections(pool, cfg, sourceID, targetID)
+		connections, err := gs.QueryEdgeConnections(r.Context(), sourceID, targetID)
 		if err != nil {
-			log.Printf("[%s] api: QueryEdgeConnections failed: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(r.Context(), "api: QueryEdgeConnections failed", "err", err)
 			http.Error(w, "Failed to query edge connections", http.StatusInternalServerError)
 			return
 		}
 
-		srcDetail, err := nebula.QueryAssetDetail(pool, cfg, sourceID)
+		srcDetail, err := gs.QueryAssetDetail(r.Context(), sourceID)
 		if err != nil {
-			log.Printf("[%s] api: QueryAssetDetail (source) failed: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(r.Context(), "api: QueryAssetDetail (source) failed", "err", err)
 			http.Error(w, "Failed to query source asset", http.StatusInternalServerError)
 			return
 		}
-		dstDetail, err := nebula.QueryAssetDetail(pool, cfg, targetID)
+		dstDetail, err := gs.QueryAssetDetail(r.Context(), targetID)
 		if err != nil {
-			log.Printf("[%s] api: QueryAssetDetail (target) failed: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(r.Context(), "api: QueryAssetDetail (target) failed", "err", err)
 			http.Error(w, "Failed to query target asset", http.StatusInternalServerError)
 			return
 		}
@@ -251,12 +284,12 @@ func EdgesHandler(pool *nebulago.ConnectionPool, cfg *config.Config) http.Handle
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(response); err != nil {
-			log.Printf("[%s] api: JSON encode failed: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
 		}
 
 		requestDuration := time.Since(requestStart)
-		log.Printf("[%s] api: returned edge detail for %s->%s (%d connections) in %.3f seconds",
-			time.Now().Format("15:04:05.000"), sourceID, targetID, len(connections), requestDuration.Seconds())
+		slog.InfoContext(r.Context(), "api: returned edge detail", "src", sourceID, "dst", targetID,
+			"connections", len(connections), "elapsed", requestDuration)
 	}
 }
 
@@ -0,0 +1,542 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"ESP-data/config"
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/nebula"
+	"ESP-data/internal/ttbcache"
+)
+
+// ============================================================
+// Tactic chain API handlers (TA010, TA013, ED013; ALG-REQ-051)
+// ============================================================
+
+// validChainID matches the TacticChain ID format (e.g. "CHAIN_PIVOT").
+var validChainID = regexp.MustCompile(`^CHAIN_[A-Z0-9_]{1,58}$`)
+
+// validChainRuleID matches the ChainRule ID format (e.g. "CR0001").
+var validChainRuleID = regexp.MustCompile(`^CR\d{4}$`)
+
+// chainAssignments returns the chain resolution for one request. The asset
+// inventory is read only when a rule matches on asset type or segment. If
+// the rules cannot be read, every asset resolves to the default chain of
+// its position.
+func chainAssignments(ctx context.Context, gs graphstore.GraphStore) *nebula.ChainAssignments {
+	rules, err := gs.QueryChainRules(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "api: QueryChainRules failed, using default chains", "err", err)
+		return nil
+	}
+	var assets []nebula.AssetRecord
+	if nebula.NeedsAssets(rules) {
+		assets, err = gs.QueryInventory(ctx)
+		if err != nil {
+			slog.WarnContext(ctx, "api: QueryInventory failed, using default chains", "err", err)
+			return nil
+		}
+	}
+	return nebula.NewChainAssignments(rules, assets)
+}
+
+// invalidateChainTTBs makes stale the TTBs a chain or rule change affects.
+// The TTB cache is keyed by chain position, not chain, so all of it is
+// purged. The stored TTB of each asset of ids — those whose intermediate
+// chain changed — has its hash invalidated and cleared: the hash does not
+// cover the chain, so the bulk recalculation (REQ-040) would otherwise keep
+// the TTB as unchanged.
+func invalidateChainTTBs(ctx context.Context, gs graphstore.GraphStore, ttbCache *ttbcache.Cache, ids []string) {
+	ttbCache.Purge(ctx)
+	if len(ids) == 0 {
+		return
+	}
+	topo, err := gs.QueryTopology(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "api: QueryTopology failed, stored TTBs not invalidated", "assets", len(ids), "err", err)
+		return
+	}
+	alreadyStale := 0
+	for _, id := range ids {
+		ttb, ok := topo.TTB[id]
+		if !ok {
+			continue
+		}
+		if !topo.HashValid[id] {
+			alreadyStale++
+		}
+		if err := gs.UpdateAssetTTBAndHash(ctx, id, ttb, ""); err != nil {
+			slog.ErrorContext(ctx, "api: clearing asset hash failed", "asset", id, "err", err)
+			continue
+		}
+		gs.InvalidateAssetHash(ctx, id)
+	}
+	// InvalidateAssetHash counted the already stale assets a second time
+	gs.DecrementStaleCount(ctx, alreadyStale)
+	slog.InfoContext(ctx, "api: stored TTBs invalidated after chain change", "assets", len(ids))
+}
+
+// intermediateChanges returns, sorted, the assets whose intermediate chain
+// differs between before and after, or is one of chainIDs.
+func intermediateChanges(assets []nebula.AssetRecord, before, after *nebula.ChainAssignments, chainIDs ...string) []string {
+	var ids []string
+	for _, a := range assets {
+		chain := after.Chain(a.AssetID, nebula.PositionIntermediate)
+		changed := chain != before.Chain(a.AssetID, nebula.PositionIntermediate)
+		for _, c := range chainIDs {
+			changed = changed || chain == c
+		}
+		if changed {
+			ids = append(ids, a.AssetID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// chainRulesAndAssets reads what the chain write handlers resolve chains
+// from, writing a 500 response on failure.
+func chainRulesAndAssets(gs graphstore.GraphStore, w http.ResponseWriter, r *http.Request) ([]nebula.ChainRule, []nebula.AssetRecord, bool) {
+	rules, err := gs.QueryChainRules(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "api: QueryChainRules failed", "err", err)
+		http.Error(w, "Failed to query chain rules", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	assets, err := gs.QueryInventory(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "api: QueryInventory failed", "err", err)
+		http.Error(w, "Failed to query assets", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return rules, assets, true
+}
+
+// findTacticChain returns the chain with chainID among all chains.
+func findTacticChain(ctx context.Context, gs graphstore.GraphStore, chainID string) (*nebula.TacticChain, error) {
+	chains, err := gs.QueryTacticChains(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range chains {
+		if chains[i].ChainID == chainID {
+			return &chains[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// writeChainError writes a graph write failure as a JSON 500 response.
+func writeChainError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// ------------------------------------------------------------
+// TacticChain
+// ------------------------------------------------------------
+
+// TacticChainRequest is the JSON body for PUT /api/tactic-chains/{id}.
+// Tactics lists tMitreTactic IDs in execution order; it replaces the
+// chain's previous tactics.
+type TacticChainRequest struct {
+	ChainName   string   `json:"chain_name"`
+	Description string   `json:"description"`
+	Tactics     []string `json:"tactics"`
+}
+
+// TacticChainsHandler serves /api/tactic-chains: GET lists every chain with
+// its tactics, PUT /api/tactic-chains/{id} creates or replaces one and
+// DELETE /api/tactic-chains/{id} removes one no rule uses.
+func TacticChainsHandler(gs graphstore.GraphStore, cfg *config.Config, ttbCache *ttbcache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimRight(r.URL.Path, "/"), "/")
+		// /api/tactic-chains          → len 3
+		// /api/tactic-chains/{id}     → len 4
+		switch {
+		case len(parts) == 3 && r.Method == http.MethodGet:
+			handleListTacticChains(gs, w, r)
+		case len(parts) == 4 && r.Method == http.MethodPut:
+			handleUpsertTacticChain(gs, ttbCache, parts[3], w, r)
+		case len(parts) == 4 && r.Method == http.MethodDelete:
+			handleDeleteTacticChain(gs, parts[3], w, r)
+		case len(parts) == 3 || len(parts) == 4:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		default:
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	}
+}
+
+// handleListTacticChains returns every tactic chain.
+func handleListTacticChains(gs graphstore.GraphStore, w http.ResponseWriter, r *http.Request) {
+	requestStart := time.Now()
+
+	chains, err := gs.QueryTacticChains(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "api: QueryTacticChains failed", "err", err)
+		http.Error(w, "Failed to query tactic chains", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"chains": chains, "total": len(chains)}); err != nil {
+		slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
+	}
+
+	slog.InfoContext(r.Context(), "api: returned tactic chains", "chains", len(chains),
+		"elapsed", time.Since(requestStart))
+}
+
+// handleUpsertTacticChain creates or replaces a tactic chain. Every tactic
+// must exist in the ATT&CK catalog, at most once. Cached TTBs, and the
+// stored TTB of assets using the chain as their intermediate chain, are
+// invalidated.
+func handleUpsertTacticChain(gs graphstore.GraphStore, ttbCache *ttbcache.Cache, chainID string, w http.ResponseWriter, r *http.Request) {
+	requestStart := time.Now()
+
+	if !validChainID.MatchString(chainID) {
+		http.Error(w, fmt.Sprintf("Invalid tactic chain ID format: %q (expected pattern like CHAIN_PIVOT)", chainID), http.StatusBadRequest)
+		return
+	}
+	var req TacticChainRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.ChainName) == "" {
+		http.Error(w, "chain_name is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Tactics) == 0 {
+		http.Error(w, "tactics must list at least one tactic", http.StatusBadRequest)
+		return
+	}
+
+	inv, err := gs.QueryAttackInventory(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "api: QueryAttackInventory failed", "err", err)
+		http.Error(w, "Failed to query ATT&CK catalog", http.StatusInternalServerError)
+		return
+	}
+	seen := make(map[string]bool, len(req.Tactics))
+	for _, tactic := range req.Tactics {
+		if !inv.TacticIDs[tactic] {
+			http.Error(w, fmt.Sprintf("Unknown tactic: %q", tactic), http.StatusBadRequest)
+			return
+		}
+		if seen[tactic] {
+			http.Error(w, fmt.Sprintf("Tactic listed twice: %q", tactic), http.StatusBadRequest)
+			return
+		}
+		seen[tactic] = true
+	}
+
+	rules, assets, ok := chainRulesAndAssets(gs, w, r)
+	if !ok {
+		return
+	}
+
+	chain := nebula.TacticChain{
+		ChainID:     chainID,
+		ChainName:   req.ChainName,
+		Description: req.Description,
+		Tactics:     req.Tactics,
+	}
+	if err := gs.UpsertTacticChain(r.Context(), chain); err != nil {
+		slog.ErrorContext(r.Context(), "api: UpsertTacticChain failed", "err", err)
+		writeChainError(w, err)
+		return
+	}
+
+	// The chain is written: its invalidations must land even after cancellation.
+	persistCtx := context.WithoutCancel(r.Context())
+	assignments := nebula.NewChainAssignments(rules, assets)
+	stale := intermediateChanges(assets, assignments, assignments, chainID)
+	invalidateChainTTBs(persistCtx, gs, ttbCache, stale)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "invalidated_assets": len(stale)})
+
+	slog.InfoContext(r.Context(), "api: tactic chain upserted", "chain", chainID, "tactics", len(req.Tactics),
+		"invalidated_assets", len(stale), "elapsed", time.Since(requestStart))
+}
+
+// handleDeleteTacticChain removes a tactic chain. The default chains and
+// chains a rule selects cannot be removed; no TTB uses any other chain.
+func handleDeleteTacticChain(gs graphstore.GraphStore, chainID string, w http.ResponseWriter, r *http.Request) {
+	requestStart := time.Now()
+
+	if !validChainID.MatchString(chainID) {
+		http.Error(w, fmt.Sprintf("Invalid tactic chain ID format: %q (expected pattern like CHAIN_PIVOT)", chainID), http.StatusBadRequest)
+		return
+	}
+	if nebula.IsDefaultChain(chainID) {
+		http.Error(w, fmt.Sprintf("Tactic chain %s is a default chain", chainID), http.StatusConflict)
+		return
+	}
+	chain, err := findTacticChain(r.Context(), gs, chainID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "api: QueryTacticChains failed", "err", err)
+		http.Error(w, "Failed to query tactic chains", http.StatusInternalServerError)
+		return
+	}
+	if chain == nil {
+		http.Error(w, fmt.Sprintf("Unknown tactic chain: %q", chainID), http.StatusNotFound)
+		return
+	}
+	rules, err := gs.QueryChainRules(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "api: QueryChainRules failed", "err", err)
+		http.Error(w, "Failed to query chain rules", http.StatusInternalServerError)
+		return
+	}
+	for _, rule := range rules {
+		if rule.ChainID == chainID {
+			http.Error(w, fmt.Sprintf("Tactic chain %s is used by chain rule %s", chainID, rule.RuleID), http.StatusConflict)
+			return
+		}
+	}
+
+	if err := gs.DeleteTacticChain(r.Context(), chainID); err != nil {
+		slog.ErrorContext(r.Context(), "api: DeleteTacticChain failed", "err", err)
+		writeChainError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+	slog.InfoContext(r.Context(), "api: tactic chain deleted", "chain", chainID, "elapsed", time.Since(requestStart))
+}
+
+// ------------------------------------------------------------
+// ChainRule
+// ------------------------------------------------------------
+
+// ChainRuleRequest is the JSON body for PUT /api/chain-rules/{id}. Empty
+// criteria match any asset; of the matching rules the one with the most
+// criteria applies, then the one with the lowest priority.
+type ChainRuleRequest struct {
+	ChainID   string `json:"chain_id"`
+	Position  string `json:"position"`
+	TypeID    string `json:"type_id"`
+	SegmentID string `json:"segment_id"`
+	Priority  int    `json:"priority"`
+}
+
+// ChainRulesHandler serves /api/chain-rules: GET lists every rule, PUT
+// /api/chain-rules/{id} creates or replaces one and DELETE
+// /api/chain-rules/{id} removes one.
+func ChainRulesHandler(gs graphstore.GraphStore, cfg *config.Config, ttbCache *ttbcache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimRight(r.URL.Path, "/"), "/")
+		// /api/chain-rules          → len 3
+		// /api/chain-rules/{id}     → len 4
+		switch {
+		case len(parts) == 3 && r.Method == http.MethodGet:
+			handleListChainRules(gs, w, r)
+		case len(parts) == 4 && r.Method == http.MethodPut:
+			handleUpsertChainRule(gs, ttbCache, parts[3], w, r)
+		case len(parts) == 4 && r.Method == http.MethodDelete:
+			handleDeleteChainRule(gs, ttbCache, parts[3], w, r)
+		case len(parts) == 3 || len(parts) == 4:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		default:
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	}
+}
+
+// handleListChainRules returns every chain rule.
+func handleListChainRules(gs graphstore.GraphStore, w http.ResponseWriter, r *http.Request) {
+	requestStart := time.Now()
+
+	rules, err := gs.QueryChainRules(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "api: QueryChainRules failed", "err", err)
+		http.Error(w, "Failed to query chain rules", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"rules": rules, "total": len(rules)}); err != nil {
+		slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
+	}
+
+	slog.InfoContext(r.Context(), "api: returned chain rules", "rules", len(rules),
+		"elapsed", time.Since(requestStart))
+}
+
+// handleUpsertChainRule creates or replaces a chain rule. The chain, asset
+// type and segment must exist. Cached TTBs, and the stored TTB of assets
+// whose intermediate chain changes, are invalidated.
+func handleUpsertChainRule(gs graphstore.GraphStore, ttbCache *ttbcache.Cache, ruleID string, w http.ResponseWriter, r *http.Request) {
+	requestStart := time.Now()
+
+	if !validChainRuleID.MatchString(ruleID) {
+		http.Error(w, fmt.Sprintf("Invalid chain rule ID format: %q (expected pattern like CR0001)", ruleID), http.StatusBadRequest)
+		return
+	}
+	var req ChainRuleRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Position != "" && !nebula.ValidPosition(req.Position) {
+		http.Error(w, fmt.Sprintf("Invalid position: %q (allowed: %s, %s, %s)", req.Position,
+			nebula.PositionEntrance, nebula.PositionIntermediate, nebula.PositionTarget), http.StatusBadRequest)
+		return
+	}
+	if req.Priority < 0 {
+		http.Error(w, "priority must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	chain, err := findTacticChain(r.Context(), gs, req.ChainID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "api: QueryTacticChains failed", "err", err)
+		http.Error(w, "Failed to query tactic chains", http.StatusInternalServerError)
+		return
+	}
+	if chain == nil {
+		http.Error(w, fmt.Sprintf("Unknown tactic chain: %q", req.ChainID), http.StatusBadRequest)
+		return
+	}
+	if req.TypeID != "" || req.SegmentID != "" {
+		catalog, err := gs.QueryInventoryCatalog(r.Context())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "api: QueryInventoryCatalog failed", "err", err)
+			http.Error(w, "Failed to query asset catalog", http.StatusInternalServerError)
+			return
+		}
+		if req.TypeID != "" && !catalogHasVID(catalog.AssetTypes, req.TypeID) {
+			http.Error(w, fmt.Sprintf("Unknown asset type: %q", req.TypeID), http.StatusBadRequest)
+			return
+		}
+		if req.SegmentID != "" && !catalogHasVID(catalog.Segments, req.SegmentID) {
+			http.Error(w, fmt.Sprintf("Unknown network segment: %q", req.SegmentID), http.StatusBadRequest)
+			return
+		}
+	}
+
+	rules, assets, ok := chainRulesAndAssets(gs, w, r)
+	if !ok {
+		return
+	}
+
+	rule := nebula.ChainRule{
+		RuleID:    ruleID,
+		ChainID:   req.ChainID,
+		Position:  req.Position,
+		TypeID:    req.TypeID,
+		SegmentID: req.SegmentID,
+		Priority:  req.Priority,
+	}
+	if err := gs.UpsertChainRule(r.Context(), rule); err != nil {
+		slog.ErrorContext(r.Context(), "api: UpsertChainRule failed", "err", err)
+		writeChainError(w, err)
+		return
+	}
+
+	persistCtx := context.WithoutCancel(r.Context())
+	updated := append(withoutRule(rules, ruleID), rule)
+	stale := intermediateChanges(assets, nebula.NewChainAssignments(rules, assets), nebula.NewChainAssignments(updated, assets))
+	invalidateChainTTBs(persistCtx, gs, ttbCache, stale)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "invalidated_assets": len(stale)})
+
+	slog.InfoContext(r.Context(), "api: chain rule upserted", "rule", ruleID, "chain", req.ChainID,
+		"invalidated_assets", len(stale), "elapsed", time.Since(requestStart))
+}
+
+// handleDeleteChainRule removes a chain rule, invalidating TTBs as
+// handleUpsertChainRule does.
+func handleDeleteChainRule(gs graphstore.GraphStore, ttbCache *ttbcache.Cache, ruleID string, w http.ResponseWriter, r *http.Request) {
+	requestStart := time.Now()
+
+	if !validChainRuleID.MatchString(ruleID) {
+		http.Error(w, fmt.Sprintf("Invalid chain rule ID format: %q (expected pattern like CR0001)", ruleID), http.StatusBadRequest)
+		return
+	}
+	rules, assets, ok := chainRulesAndAssets(gs, w, r)
+	if !ok {
+		return
+	}
+	remaining := withoutRule(rules, ruleID)
+	if len(remaining) == len(rules) {
+		http.Error(w, fmt.Sprintf("Unknown chain rule: %q", ruleID), http.StatusNotFound)
+		return
+	}
+
+	if err := gs.DeleteChainRule(r.Context(), ruleID); err != nil {
+		slog.ErrorContext(r.Context(), "api: DeleteChainRule failed", "err", err)
+		writeChainError(w, err)
+		return
+	}
+
+	persistCtx := context.WithoutCancel(r.Context())
+	stale := intermediateChanges(assets, nebula.NewChainAssignments(rules, assets), nebula.NewChainAssignments(remaining, assets))
+	invalidateChainTTBs(persistCtx, gs, ttbCache, stale)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "invalidated_assets": len(stale)})
+
+	slog.InfoContext(r.Context(), "api: chain rule deleted", "rule", ruleID,
+		"invalidated_assets", len(stale), "elapsed", time.Since(requestStart))
+}
+
+// withoutRule returns a copy of rules without the rule ruleID.
+func withoutRule(rules []nebula.ChainRule, ruleID string) []nebula.ChainRule {
+	kept := make([]nebula.ChainRule, 0, len(rules))
+	for _, r := range rules {
+		if r.RuleID != ruleID {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// catalogHasVID reports whether vid is a value of an InventoryCatalog map.
+func catalogHasVID(names map[string]string, vid string) bool {
+	for _, v := range names {
+		if v == vid {
+			return true
+		}
+	}
+	return false
+}
+
+// handleGetAssetChains returns the tactic chain an asset uses at each
+// position under the current chain rules.
+func handleGetAssetChains(gs graphstore.GraphStore, w http.ResponseWriter, r *http.Request) {
+	// URL: /api/asset/{id}/chains — asset ID is segment 3
+	assetID, err := extractAssetID(r.URL.Path, 3)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	chains := chainAssignments(r.Context(), gs)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"asset_id": assetID,
+		"chains": map[string]string{
+			nebula.PositionEntrance:     chains.Chain(assetID, nebula.PositionEntrance),
+			nebula.PositionIntermediate: chains.Chain(assetID, nebula.PositionIntermediate),
+			nebula.PositionTarget:       chains.Chain(assetID, nebula.PositionTarget),
+		},
+	}); err != nil {
+		slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
+	}
+}
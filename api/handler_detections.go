@@ -0,0 +1,262 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"ESP-data/config"
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/nebula"
+)
+
+// ============================================================
+// Detection controls API handlers (TA012, ED015, ED016)
+// ============================================================
+
+// validControlID matches the DetectionControl ID format, that of MITRE
+// data components (e.g. "DC0001").
+var validControlID = regexp.MustCompile(`^DC\d{4}$`)
+
+// validTechniqueID matches a technique or sub-technique ID (e.g. "T1059",
+// "T1059.001").
+var validTechniqueID = regexp.MustCompile(`^T\d{4}(\.\d{3})?$`)
+
+// DetectionControlRequest is the JSON body for PUT /api/detection-controls/{id}.
+// Coverage maps technique IDs to the percent (1-100) of executions the
+// control detects; it replaces the control's previous coverage.
+type DetectionControlRequest struct {
+	ControlName   string         `json:"control_name"`
+	Description   string         `json:"description"`
+	DetectionTime float64        `json:"detection_time"`
+	Coverage      map[string]int `json:"coverage"`
+}
+
+// DetectionControlsHandler serves /api/detection-controls: GET lists every
+// control with its coverage, PUT /api/detection-controls/{id} creates or
+// replaces one. Coverage does not enter the TTB, so no hash or TTB cache
+// is invalidated.
+func DetectionControlsHandler(gs graphstore.GraphStore, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimRight(r.URL.Path, "/"), "/")
+		// /api/detection-controls          → len 3
+		// /api/detection-controls/{id}     → len 4
+		switch {
+		case len(parts) == 3 && r.Method == http.MethodGet:
+			handleListDetectionControls(gs, w, r)
+		case len(parts) == 4 && r.Method == http.MethodPut:
+			handleUpsertDetectionControl(gs, parts[3], w, r)
+		case len(parts) == 3 || len(parts) == 4:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		default:
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	}
+}
+
+// handleListDetectionControls returns every detection control.
+func handleListDetectionControls(gs graphstore.GraphStore, w http.ResponseWriter, r *http.Request) {
+	requestStart := time.Now()
+
+	controls, err := gs.QueryDetectionControls(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "api: QueryDetectionControls failed", "err", err)
+		http.Error(w, "Failed to query detection controls", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"controls": controls, "total": len(controls)}); err != nil {
+		slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
+	}
+
+	slog.InfoContext(r.Context(), "api: returned detection controls", "controls", len(controls),
+		"elapsed", time.Since(requestStart))
+}
+
+// handleUpsertDetectionControl creates or replaces a detection control.
+// Every covered technique must exist in the ATT&CK catalog.
+func handleUpsertDetectionControl(gs graphstore.GraphStore, controlID string, w http.ResponseWriter, r *http.Request) {
+	requestStart := time.Now()
+
+	if !validControlID.MatchString(controlID) {
+		http.Error(w, fmt.Sprintf("Invalid detection control ID format: %q (expected pattern like DC0001)", controlID), http.StatusBadRequest)
+		return
+	}
+	var req DetectionControlRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.ControlName) == "" {
+		http.Error(w, "control_name is required", http.StatusBadRequest)
+		return
+	}
+	if req.DetectionTime < 0 {
+		http.Error(w, "detection_time must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	inv, err := gs.QueryAttackInventory(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "api: QueryAttackInventory failed", "err", err)
+		http.Error(w, "Failed to query ATT&CK catalog", http.StatusInternalServerError)
+		return
+	}
+	for tech, pct := range req.Coverage {
+		if !validTechniqueID.MatchString(tech) {
+			http.Error(w, fmt.Sprintf("Invalid technique ID format: %q (expected pattern like T1059 or T1059.001)", tech), http.StatusBadRequest)
+			return
+		}
+		if !inv.TechniqueIDs[tech] {
+			http.Error(w, fmt.Sprintf("Unknown technique: %q", tech), http.StatusBadRequest)
+			return
+		}
+		if pct < 1 || pct > 100 {
+			http.Error(w, fmt.Sprintf("Invalid coverage for %s: %d (allowed: 1-100)", tech, pct), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctl := nebula.DetectionControl{
+		ControlID:     controlID,
+		ControlName:   req.ControlName,
+		Description:   req.Description,
+		DetectionTime: req.DetectionTime,
+		Coverage:      req.Coverage,
+	}
+	if err := gs.UpsertDetectionControl(r.Context(), ctl); err != nil {
+		slog.ErrorContext(r.Context(), "api: UpsertDetectionControl failed", "err", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+	slog.InfoContext(r.Context(), "api: detection control upserted", "control", controlID,
+		"techniques", len(req.Coverage), "elapsed", time.Since(requestStart))
+}
+
+// handleGetAssetDetections returns the detection controls deployed on an asset.
+func handleGetAssetDetections(gs graphstore.GraphStore, w http.ResponseWriter, r *http.Request) {
+	requestStart := time.Now()
+
+	// URL: /api/asset/{id}/detections — asset ID is segment 3
+	assetID, err := extractAssetID(r.URL.Path, 3)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	detections, err := gs.QueryAssetDetections(r.Context(), assetID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "api: QueryAssetDetections failed", "err", err)
+		http.Error(w, "Failed to query asset detections", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"asset_id": assetID, "detections": detections}); err != nil {
+		slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
+	}
+
+	slog.InfoContext(r.Context(), "api: returned asset detections", "asset", assetID,
+		"detections", len(detections), "elapsed", time.Since(requestStart))
+}
+
+// AssetDetectionUpsertRequest is the JSON body for PUT /api/asset/{id}/detections.
+type AssetDetectionUpsertRequest struct {
+	ControlID string `json:"control_id"`
+	Active    bool   `json:"active"`
+}
+
+// handleUpsertAssetDetection deploys a detection control on an asset, or
+// changes whether it is active.
+func handleUpsertAssetDetection(gs graphstore.GraphStore, w http.ResponseWriter, r *http.Request) {
+	requestStart := time.Now()
+
+	assetID, err := extractAssetID(r.URL.Path, 3)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req AssetDetectionUpsertRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !validControlID.MatchString(req.ControlID) {
+		http.Error(w, fmt.Sprintf("Invalid detection control ID format: %q (expected pattern like DC0001)", req.ControlID), http.StatusBadRequest)
+		return
+	}
+
+	controls, err := gs.QueryDetectionControls(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "api: QueryDetectionControls failed", "err", err)
+		http.Error(w, "Failed to query detection controls", http.StatusInternalServerError)
+		return
+	}
+	known := false
+	for _, c := range controls {
+		if c.ControlID == req.ControlID {
+			known = true
+			break
+		}
+	}
+	if !known {
+		http.Error(w, fmt.Sprintf("Unknown detection control: %q", req.ControlID), http.StatusNotFound)
+		return
+	}
+
+	if err := gs.UpsertAssetDetection(r.Context(), req.ControlID, assetID, req.Active); err != nil {
+		slog.ErrorContext(r.Context(), "api: UpsertAssetDetection failed", "err", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+	slog.InfoContext(r.Context(), "api: asset detection upserted", "control", req.ControlID, "asset", assetID,
+		"active", req.Active, "elapsed", time.Since(requestStart))
+}
+
+// handleDeleteAssetDetection removes a detection control from an asset.
+func handleDeleteAssetDetection(gs graphstore.GraphStore, w http.ResponseWriter, r *http.Request) {
+	requestStart := time.Now()
+
+	// URL: /api/asset/{id}/detections/{cid}
+	assetID, err := extractAssetID(r.URL.Path, 3)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	controlID := strings.Split(r.URL.Path, "/")[5]
+	if !validControlID.MatchString(controlID) {
+		http.Error(w, fmt.Sprintf("Invalid detection control ID format: %q (expected pattern like DC0001)", controlID), http.StatusBadRequest)
+		return
+	}
+
+	if err := gs.DeleteAssetDetection(r.Context(), controlID, assetID); err != nil {
+		slog.ErrorContext(r.Context(), "api: DeleteAssetDetection failed", "err", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+
+	slog.InfoContext(r.Context(), "api: asset detection deleted", "control", controlID, "asset", assetID,
+		"elapsed", time.Since(requestStart))
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"ESP-data/config"
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/store"
+)
+
+// ============================================================
+// Liveness and readiness probes
+// ============================================================
+
+// readinessCheckTimeout bounds each dependency check of /readyz.
+const readinessCheckTimeout = 5 * time.Second
+
+// Component statuses reported by /readyz.
+const (
+	componentUp       = "up"
+	componentDown     = "down"
+	componentDisabled = "disabled"
+)
+
+// ComponentStatus is the outcome of one dependency check.
+type ComponentStatus struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// ReadinessResponse is the /readyz response body. Ready is false when any
+// enabled component is down.
+type ReadinessResponse struct {
+	Ready      bool                       `json:"ready"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+// HealthzHandler reports that the process is alive; it touches no dependency.
+func HealthzHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"ok"}` + "\n"))
+	}
+}
+
+// ReadyzHandler checks every dependency and answers 200 when all enabled ones
+// are up, 503 otherwise:
+//   - graph: a session with USE space (nebula) or the in-memory store
+//   - system_state: SystemState SYS001 can be read (ALG-REQ-048)
+//   - mariadb: ping, or "disabled" when MARIA_ENABLED is false (ADR-REQ-033);
+//     down while the store is still connecting, up once it reaches MariaDB
+func ReadyzHandler(gs graphstore.GraphStore, cfg *config.Config, auditStore *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		response := ReadinessResponse{Ready: true, Components: make(map[string]ComponentStatus)}
+
+		response.Components["graph"] = checkComponent(ctx, gs.Ping)
+		response.Components["system_state"] = checkComponent(ctx, func(ctx context.Context) error {
+			_, err := gs.QuerySystemState(ctx)
+			return err
+		})
+		switch {
+		case !cfg.MariaEnabled:
+			response.Components["mariadb"] = ComponentStatus{Status: componentDisabled}
+		case !auditStore.Enabled():
+			response.Components["mariadb"] = ComponentStatus{Status: componentDown, Error: "setup failed at startup"}
+		default:
+			response.Components["mariadb"] = checkComponent(ctx, auditStore.Ping)
+		}
+
+		status := http.StatusOK
+		for name, c := range response.Components {
+			if c.Status == componentDown {
+				response.Ready = false
+				status = http.StatusServiceUnavailable
+				slog.WarnContext(ctx, "api: readiness check failed", "component", name, "err", c.Error)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			slog.ErrorContext(ctx, "api: JSON encode failed", "err", err)
+		}
+	}
+}
+
+// checkComponent runs check under readinessCheckTimeout and times it.
+func checkComponent(ctx context.Context, check func(ctx context.Context) error) ComponentStatus {
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	c := ComponentStatus{Status: componentUp, LatencyMs: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		c.Status = componentDown
+		c.Error = err.Error()
+	}
+	return c
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ESP-data/config"
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/store"
+)
+
+// ============================================================
+// Audit trail and TTB cache read endpoints (ADR-REQ-050 through ADR-REQ-052)
+// ============================================================
+
+// Calculation history limits (ADR-REQ-051).
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 500
+)
+
+// CalcHistoryHandler lists recent calculation sessions (ADR-REQ-051).
+// GET /api/calc-history?limit={n}
+func CalcHistoryHandler(gs graphstore.GraphStore, cfg *config.Config, auditStore *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestStart := time.Now()
+
+		if !auditStore.Enabled() {
+			http.Error(w, "Audit store is disabled", http.StatusServiceUnavailable)
+			return
+		}
+
+		limit := defaultHistoryLimit
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxHistoryLimit {
+				http.Error(w, "limit must be an integer between 1 and 500", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		slog.DebugContext(r.Context(), "api: /api/calc-history request", "limit", limit)
+
+		sessions, err := auditStore.CalcHistory(r.Context(), limit)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "api: CalcHistory failed", "err", err)
+			http.Error(w, "Failed to query calculation history", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{"sessions": sessions}); err != nil {
+			slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
+		}
+
+		requestDuration := time.Since(requestStart)
+		slog.InfoContext(r.Context(), "api: returned calc history", "sessions", len(sessions),
+			"elapsed", requestDuration)
+	}
+}
+
+// PathDetailHandler returns the hop-by-hop TTB breakdown of one recorded path
+// (ADR-REQ-050). Hops without audit or cache data carry the asset's stored
+// TTB with "source":"unavailable".
+// GET /api/path-detail?session={sessionId}&path={pathSeq}
+func PathDetailHandler(gs graphstore.GraphStore, cfg *config.Config, auditStore *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestStart := time.Now()
+
+		if !auditStore.Enabled() {
+			http.Error(w, "Audit store is disabled", http.StatusServiceUnavailable)
+			return
+		}
+
+		sessionID, err := strconv.ParseInt(r.URL.Query().Get("session"), 10, 64)
+		if err != nil || sessionID < 1 {
+			http.Error(w, "session must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		pathSeq, err := strconv.Atoi(r.URL.Query().Get("path"))
+		if err != nil || pathSeq < 1 {
+			http.Error(w, "path must be a positive integer", http.StatusBadRequest)
+			return
+		}
+
+		slog.DebugContext(r.Context(), "api: /api/path-detail request", "session", sessionID, "path", pathSeq)
+
+		detail, err := auditStore.PathDetail(r.Context(), sessionID, pathSeq)
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "Path not found in calculation history", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "api: PathDetail failed", "err", err)
+			http.Error(w, "Failed to query path detail", http.StatusInternalServerError)
+			return
+		}
+
+		// Asset names and, for unavailable hops, the stored TTB come from the graph.
+		names := make(map[string]string)
+		if assets, err := gs.QueryAssetsWithDetails(r.Context()); err != nil {
+			slog.ErrorContext(r.Context(), "api: QueryAssetsWithDetails failed", "err", err)
+		} else {
+			for _, a := range assets {
+				id, _ := a["asset_id"].(string)
+				names[id], _ = a["asset_name"].(string)
+			}
+		}
+		var unavailable []string
+		for _, hop := range detail.Hops {
+			if hop.Source == store.SourceUnavailable {
+				unavailable = append(unavailable, hop.AssetVid)
+			}
+		}
+		var storedTTB map[string]float64
+		if len(unavailable) > 0 {
+			if _, ttbs, err := gs.QueryAssetHashValidity(r.Context(), unavailable); err != nil {
+				slog.ErrorContext(r.Context(), "api: QueryAssetHashValidity failed", "err", err)
+			} else {
+				storedTTB = ttbs
+			}
+		}
+		for i := range detail.Hops {
+			hop := &detail.Hops[i]
+			hop.AssetName = names[hop.AssetVid]
+			if hop.Source == store.SourceUnavailable {
+				hop.TTBHours = storedTTB[hop.AssetVid]
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(detail); err != nil {
+			slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
+		}
+
+		requestDuration := time.Since(requestStart)
+		slog.InfoContext(r.Context(), "api: returned path detail", "session", sessionID, "path", pathSeq,
+			"hops", len(detail.Hops), "unavailable", len(unavailable), "elapsed", requestDuration)
+	}
+}
+
+// handleAssetTTBDetail returns the cached TTB breakdown of one asset at a chain
+// position from asset_ttb_cache, without querying the graph (ADR-REQ-052).
+// GET /api/asset/{id}/ttb-detail?position={entrance|intermediate|target}
+func handleAssetTTBDetail(auditStore *store.Store, w http.ResponseWriter, r *http.Request) {
+	requestStart := time.Now()
+
+	assetID, err := extractAssetID(r.URL.Path, 3)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	position := r.URL.Query().Get("position")
+	if position != "entrance" && position != "intermediate" && position != "target" {
+		http.Error(w, "position must be entrance, intermediate or target", http.StatusBadRequest)
+		return
+	}
+	if !auditStore.Enabled() {
+		http.Error(w, "Audit store is disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	slog.DebugContext(r.Context(), "api: /api/asset/{id}/ttb-detail request", "asset", assetID, "position", position)
+
+	detail, err := auditStore.AssetTTBDetail(r.Context(), assetID, position)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "No cached TTB breakdown for this asset and position", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "api: AssetTTBDetail failed", "err", err)
+		http.Error(w, "Failed to query TTB cache", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(detail); err != nil {
+		slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
+	}
+
+	requestDuration := time.Since(requestStart)
+	slog.InfoContext(r.Context(), "api: returned cached TTB breakdown", "asset", assetID,
+		"position", position, "tactics", len(detail.Breakdown), "elapsed", requestDuration)
+}
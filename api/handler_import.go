@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"ESP-data/config"
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/importer"
+)
+
+// ============================================================
+// Import handlers (source files → ESP01 graph)
+// ============================================================
+
+// maxImportBody caps the size of an uploaded source file.
+const maxImportBody = 8 << 20
+
+// ImportNetworkHandler loads a network CSV (sources/network1.csv format)
+// posted as the raw request body into connects_to edges (SCHEMA ED006).
+func ImportNetworkHandler(gs graphstore.GraphStore, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		requestStart := time.Now()
+		slog.DebugContext(r.Context(), "api: POST /api/import/network request")
+
+		body := http.MaxBytesReader(w, r.Body, maxImportBody)
+		result, err := importer.ImportNetwork(r.Context(), gs, body)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "api: ImportNetwork failed", "err", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
+		}
+
+		requestDuration := time.Since(requestStart)
+		slog.InfoContext(r.Context(), "api: network import completed", "edges_written", result.EdgesWritten,
+			"elapsed", requestDuration)
+	}
+}
+
+// ImportAssetsHandler loads a CMDB workbook (sources/assets.xlsx format)
+// posted as the raw request body into Asset vertices with their has_type,
+// belongs_to and runs_on edges. ?dry_run=true returns the diff only.
+func ImportAssetsHandler(gs graphstore.GraphStore, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		requestStart := time.Now()
+		dryRun := r.URL.Query().Get("dry_run") == "true"
+		slog.DebugContext(r.Context(), "api: POST /api/import/assets request", "dry_run", dryRun)
+
+		// The XLSX container is a zip archive and needs random access.
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportBody))
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+
+		result, err := importer.ImportAssets(r.Context(), gs, bytes.NewReader(body), int64(len(body)), dryRun)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "api: ImportAssets failed", "err", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
+		}
+
+		requestDuration := time.Since(requestStart)
+		slog.InfoContext(r.Context(), "api: asset import completed", "dry_run", dryRun,
+			"assets_written", result.AssetsWritten, "elapsed", requestDuration)
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ESP-data/internal/jobs"
+)
+
+// ============================================================
+// Background job status, progress stream and cancellation (REQ-040)
+// ============================================================
+
+// sseKeepAlive is the interval of SSE comment lines that keep idle
+// connections open through proxies.
+const sseKeepAlive = 15 * time.Second
+
+// JobsHandler serves /api/jobs/{id} (GET status, DELETE cancel) and
+// /api/jobs/{id}/events (GET Server-Sent Events progress stream).
+func JobsHandler(jobMgr *jobs.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimRight(r.URL.Path, "/"), "/")
+		// /api/jobs/{id}         → len 4
+		// /api/jobs/{id}/events  → len 5
+		if len(parts) < 4 || len(parts) > 5 || (len(parts) == 5 && parts[4] != "events") {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+
+		job, ok := jobMgr.Get(parts[3])
+		if !ok {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+
+		switch {
+		case len(parts) == 5 && r.Method == http.MethodGet:
+			streamJobEvents(job, w, r)
+		case len(parts) == 4 && r.Method == http.MethodGet:
+			writeJobSnapshot(w, r, http.StatusOK, job.Snapshot())
+		case len(parts) == 4 && r.Method == http.MethodDelete:
+			if !job.Cancel() {
+				http.Error(w, "Job has already finished", http.StatusConflict)
+				return
+			}
+			slog.InfoContext(r.Context(), "api: job cancellation requested", "job", job.ID)
+			writeJobSnapshot(w, r, http.StatusAccepted, job.Snapshot())
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// writeJobSnapshot writes a job snapshot as JSON with the given status code.
+func writeJobSnapshot(w http.ResponseWriter, r *http.Request, status int, s jobs.Snapshot) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(s); err != nil {
+		slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
+	}
+}
+
+// streamJobEvents pushes one "asset" event per processed asset, then a final
+// "done" event carrying the job snapshot, and closes the stream. A reconnecting
+// client resumes after its Last-Event-ID.
+func streamJobEvents(job *jobs.Job, w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	seq := 0
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			seq = n
+		}
+	}
+
+	slog.DebugContext(r.Context(), "api: job event stream opened", "job", job.ID, "after_event", seq)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		events, finished, changed := job.EventsSince(seq)
+		for _, ev := range events {
+			if err := writeSSE(w, strconv.Itoa(ev.Seq), "asset", ev); err != nil {
+				return
+			}
+			seq = ev.Seq
+		}
+		if finished {
+			writeSSE(w, "", "done", job.Snapshot())
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeSSE writes one Server-Sent Event with a JSON data line.
+func writeSSE(w http.ResponseWriter, id, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
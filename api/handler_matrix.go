@@ -0,0 +1,233 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ESP-data/config"
+	"ESP-data/internal/graph"
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/nebula"
+	"ESP-data/internal/ttbexec"
+)
+
+// maxMatrixPairs bounds the number of (entry, target) pairs per request.
+const maxMatrixPairs = 2500
+
+// PathMatrixHandler computes the minimum TTA for every (entry, target) pair
+// in one request (ALG-REQ-001 matrix). entries and targets are optional
+// comma-separated asset IDs and default to all is_entrance / is_target
+// assets. The topology is loaded once, stale intermediates are refreshed once
+// for the union of all pair regions, and entry and target TTB are computed
+// once per asset rather than per pair.
+func PathMatrixHandler(gs graphstore.GraphStore, cfg *config.Config, ttbExec *ttbexec.Executor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestStart := time.Now()
+		ctx := r.Context()
+
+		entryIDs, err := matrixAssetIDs(r.URL.Query().Get("entries"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		targetIDs, err := matrixAssetIDs(r.URL.Query().Get("targets"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if entryIDs == nil {
+			entries, err := gs.QueryEntryPoints(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "api: QueryEntryPoints failed", "err", err)
+				http.Error(w, "Failed to query entry points", http.StatusInternalServerError)
+				return
+			}
+			entryIDs = sortedAssetIDs(entries)
+		}
+		if targetIDs == nil {
+			targets, err := gs.QueryTargets(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "api: QueryTargets failed", "err", err)
+				http.Error(w, "Failed to query targets", http.StatusInternalServerError)
+				return
+			}
+			targetIDs = sortedAssetIDs(targets)
+		}
+		if len(entryIDs)*len(targetIDs) > maxMatrixPairs {
+			http.Error(w, fmt.Sprintf("at most %d (entry, target) pairs per request", maxMatrixPairs), http.StatusBadRequest)
+			return
+		}
+
+		maxHops := 6
+		if hopsStr := r.URL.Query().Get("hops"); hopsStr != "" {
+			n, err := strconv.Atoi(hopsStr)
+			if err != nil || n < 2 || n > 9 {
+				http.Error(w, "hops must be an integer between 2 and 9", http.StatusBadRequest)
+				return
+			}
+			maxHops = n
+		}
+		ttbParams := ttbParamsFromQuery(r, cfg)
+
+		slog.DebugContext(ctx, "api: /api/paths/matrix request", "entries", len(entryIDs), "targets", len(targetIDs), "hops", maxHops,
+			"orientation_time", ttbParams.OrientationTime, "switchover_time", ttbParams.SwitchoverTime, "priority_tolerance", ttbParams.PriorityTolerance)
+
+		topo, err := gs.QueryTopology(ctx)
+		if requestAborted(w, r) {
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "api: QueryTopology failed", "err", err)
+			http.Error(w, "Failed to load topology", http.StatusInternalServerError)
+			return
+		}
+
+		chains := chainAssignments(ctx, gs)
+
+		// Stale intermediates of any pair are refreshed once (ALG-REQ-046 steps 3-4)
+		staleSet := make(map[string]bool)
+		for _, from := range entryIDs {
+			for _, to := range targetIDs {
+				if from == to {
+					continue
+				}
+				for id := range graph.PathRegion(topo.Adjacency, from, to, maxHops) {
+					if id != from && id != to && !topo.HashValid[id] {
+						staleSet[id] = true
+					}
+				}
+			}
+		}
+		staleIDs := make([]string, 0, len(staleSet))
+		for id := range staleSet {
+			staleIDs = append(staleIDs, id)
+		}
+		sort.Strings(staleIDs)
+
+		recalcStart := time.Now()
+		var recalculatedAssets []string
+		if len(staleIDs) > 0 {
+			var recalculated map[string]float64
+			recalculatedAssets, recalculated = recalcStaleIntermediates(ctx, gs, ttbExec, chains, staleIDs, ttbParams, nil)
+			for id, ttb := range recalculated {
+				topo.TTB[id] = ttb
+			}
+		}
+		recalcDuration := time.Since(recalcStart)
+
+		// Position-aware entry and target TTB, once per asset (ALG-REQ-070)
+		ttbStart := time.Now()
+		entryTTB := positionTTBs(ctx, gs, ttbExec, chains, entryIDs, nebula.PositionEntrance, ttbParams, topo.TTB)
+		targetTTB := positionTTBs(ctx, gs, ttbExec, chains, targetIDs, nebula.PositionTarget, ttbParams, topo.TTB)
+		ttbDuration := time.Since(ttbStart)
+		if requestAborted(w, r) {
+			return
+		}
+
+		searchStart := time.Now()
+		cells := make([]graph.PathMatrixCell, 0, len(entryIDs)*len(targetIDs))
+		fastest := make(map[string]graph.PathMatrixTarget)
+		for _, from := range entryIDs {
+			for _, to := range targetIDs {
+				cell := graph.PathMatrixCell{EntryPoint: from, Target: to}
+				if from != to {
+					weight := func(id string) float64 {
+						if id == from || id == to {
+							return 0
+						}
+						if ttb, ok := topo.TTB[id]; ok {
+							return ttb
+						}
+						return 10.0
+					}
+					if found := graph.KShortestPaths(topo.Adjacency, weight, from, to, 1, maxHops); len(found) > 0 {
+						cell.Reachable = true
+						cell.Hosts = strings.Join(found[0].Nodes, " -> ")
+						cell.HopCount = found[0].Hops()
+						cell.TTA = entryTTB[from] + found[0].Cost + targetTTB[to]
+						if f, ok := fastest[to]; !ok || cell.TTA < f.MinTTA {
+							fastest[to] = graph.PathMatrixTarget{Target: to, FastestEntry: from, MinTTA: cell.TTA}
+						}
+					}
+				}
+				cells = append(cells, cell)
+			}
+		}
+		searchDuration := time.Since(searchStart)
+
+		byTarget := make([]graph.PathMatrixTarget, 0, len(fastest))
+		for _, f := range fastest {
+			byTarget = append(byTarget, f)
+		}
+		sort.Slice(byTarget, func(i, j int) bool {
+			if byTarget[i].MinTTA != byTarget[j].MinTTA {
+				return byTarget[i].MinTTA < byTarget[j].MinTTA
+			}
+			return byTarget[i].Target < byTarget[j].Target
+		})
+
+		if recalculatedAssets == nil {
+			recalculatedAssets = []string{}
+		}
+		response := graph.PathMatrixResponse{
+			EntryPoints:        entryIDs,
+			Targets:            targetIDs,
+			Hops:               maxHops,
+			Cells:              cells,
+			ByTarget:           byTarget,
+			EntryTTB:           entryTTB,
+			TargetTTB:          targetTTB,
+			RecalculatedAssets: recalculatedAssets,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			slog.ErrorContext(ctx, "api: JSON encode failed", "err", err)
+		}
+
+		slog.InfoContext(ctx, "api: returned path matrix", "entries", len(entryIDs), "targets", len(targetIDs), "reachable_targets", len(byTarget),
+			"recalculated", len(recalculatedAssets), "elapsed", time.Since(requestStart),
+			"recalc", recalcDuration, "ttb", ttbDuration, "search", searchDuration)
+	}
+}
+
+// matrixAssetIDs parses a comma-separated asset ID list into sorted unique
+// IDs. An empty parameter yields nil, meaning "all".
+func matrixAssetIDs(param string) ([]string, error) {
+	if param == "" {
+		return nil, nil
+	}
+	set := make(map[string]bool)
+	for _, id := range strings.Split(param, ",") {
+		id = strings.TrimSpace(id)
+		if !validAssetID.MatchString(id) {
+			return nil, fmt.Errorf("Invalid asset ID: %q", id)
+		}
+		set[id] = true
+	}
+	ids := make([]string, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// sortedAssetIDs extracts the asset_id values of QueryEntryPoints or
+// QueryTargets rows.
+func sortedAssetIDs(items []map[string]interface{}) []string {
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		if id, ok := item["asset_id"].(string); ok && id != "" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -1,18 +1,17 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"ESP-data/config"
 	"ESP-data/internal/graph"
-	"ESP-data/internal/nebula"
+	"ESP-data/internal/graphstore"
 	"ESP-data/internal/store"
-
-	nebulago "github.com/vesoft-inc/nebula-go/v3"
 )
 
 // ============================================================
@@ -20,14 +19,14 @@ import (
 // ============================================================
 
 // MitigationsListHandler returns all MITRE mitigations for the editor dropdown (REQ-033).
-func MitigationsListHandler(pool *nebulago.ConnectionPool, cfg *config.Config) http.HandlerFunc {
+func MitigationsListHandler(gs graphstore.GraphStore, cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		requestStart := time.Now()
-		log.Printf("[%s] api: /api/mitigations request", requestStart.Format("15:04:05.000"))
+		slog.DebugContext(r.Context(), "api: /api/mitigations request")
 
-		mitigations, err := nebula.QueryMitigations(pool, cfg)
+		mitigations, err := gs.QueryMitigations(r.Context())
 		if err != nil {
-			log.Printf("[%s] api: QueryMitigations failed: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(r.Context(), "api: QueryMitigations failed", "err", err)
 			http.Error(w, "Failed to query mitigations", http.StatusInternalServerError)
 			return
 		}
@@ -36,16 +35,17 @@ func MitigationsListHandler(pool *nebulago.ConnectionPool, cfg *config.Config) h
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(response); err != nil {
-			log.Printf("[%s] api: JSON encode failed: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
 		}
 
 		requestDuration := time.Since(requestStart)
-		log.Printf("[%s] api: returned %d mitigations in %.3f seconds", time.Now().Format("15:04:05.000"), len(mitigations), requestDuration.Seconds())
+		slog.InfoContext(r.Context(), "api: returned mitigations", "mitigations", len(mitigations),
+			"elapsed", requestDuration)
 	}
 }
 
 // handleGetAssetMitigations returns mitigations applied to an asset (REQ-034).
-func handleGetAssetMitigations(pool *nebulago.ConnectionPool, cfg *config.Config, w http.ResponseWriter, r *http.Request) {
+func handleGetAssetMitigations(gs graphstore.GraphStore, cfg *config.Config, w http.ResponseWriter, r *http.Request) {
 	requestStart := time.Now()
 
 	// URL: /api/asset/{id}/mitigations — asset ID is segment 3
@@ -55,11 +55,11 @@ func handleGetAssetMitigations(pool *nebulago.ConnectionPool, cfg *config.Config
 		return
 	}
 
-	log.Printf("[%s] api: GET /api/asset/%s/mitigations request", requestStart.Format("15:04:05.000"), assetID)
+	slog.DebugContext(r.Context(), "api: GET /api/asset/{id}/mitigations request", "asset", assetID)
 
-	mitigations, err := nebula.QueryAssetMitigations(pool, cfg, assetID)
+	mitigations, err := gs.QueryAssetMitigations(r.Context(), assetID)
 	if err != nil {
-		log.Printf("[%s] api: QueryAssetMitigations failed: %v", time.Now().Format("15:04:05.000"), err)
+		slog.ErrorContext(r.Context(), "api: QueryAssetMitigations failed", "err", err)
 		http.Error(w, "Failed to query asset mitigations", http.StatusInternalServerError)
 		return
 	}
@@ -68,12 +68,12 @@ func handleGetAssetMitigations(pool *nebulago.ConnectionPool, cfg *config.Config
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("[%s] api: JSON encode failed: %v", time.Now().Format("15:04:05.000"), err)
+		slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
 	}
 
 	requestDuration := time.Since(requestStart)
-	log.Printf("[%s] api: returned %d mitigations for asset %s in %.3f seconds",
-		time.Now().Format("15:04:05.000"), len(mitigations), assetID, requestDuration.Seconds())
+	slog.InfoContext(r.Context(), "api: returned asset mitigations", "asset", assetID,
+		"mitigations", len(mitigations), "elapsed", requestDuration)
 }
 
 // MitigationUpsertRequest is the JSON body for PUT /api/asset/{id}/mitigations (REQ-035).
@@ -84,7 +84,7 @@ type MitigationUpsertRequest struct {
 }
 
 // handleUpsertAssetMitigation adds or updates an applied_to edge (REQ-035).
-func handleUpsertAssetMitigation(pool *nebulago.ConnectionPool, cfg *config.Config, auditStore *store.Store, w http.ResponseWriter, r *http.Request) {
+func handleUpsertAssetMitigation(gs graphstore.GraphStore, cfg *config.Config, auditStore *store.Store, w http.ResponseWriter, r *http.Request) {
 	requestStart := time.Now()
 
 	assetID, err := extractAssetID(r.URL.Path, 3)
@@ -111,33 +111,35 @@ func handleUpsertAssetMitigation(pool *nebulago.ConnectionPool, cfg *config.Conf
 		return
 	}
 
-	log.Printf("[%s] api: PUT /api/asset/%s/mitigations {%s, maturity=%d, active=%v}",
-		requestStart.Format("15:04:05.000"), assetID, req.MitigationID, req.Maturity, req.Active)
+	slog.DebugContext(r.Context(), "api: PUT /api/asset/{id}/mitigations request", "asset", assetID,
+		"mitigation", req.MitigationID, "maturity", req.Maturity, "active", req.Active)
 
-	err = nebula.UpsertMitigation(pool, cfg, req.MitigationID, assetID, req.Maturity, req.Active)
+	err = gs.UpsertMitigation(r.Context(), req.MitigationID, assetID, req.Maturity, req.Active)
 	if err != nil {
-		log.Printf("[%s] api: UpsertMitigation failed: %v", time.Now().Format("15:04:05.000"), err)
+		slog.ErrorContext(r.Context(), "api: UpsertMitigation failed", "err", err)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
+	// The edge is written: invalidate even if the client has gone away.
+	persistCtx := context.WithoutCancel(r.Context())
 	// REQ-042: invalidate asset hash after mitigation change (ALG-REQ-043)
-	nebula.InvalidateAssetHash(pool, cfg, assetID)
+	gs.InvalidateAssetHash(persistCtx, assetID)
 	// ADR-REQ-021: invalidate TTB cache for this asset
-	auditStore.InvalidateCache(assetID)
+	auditStore.InvalidateCache(persistCtx, assetID)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 
 	requestDuration := time.Since(requestStart)
-	log.Printf("[%s] api: UPSERT %s -> %s completed in %.3f seconds",
-		time.Now().Format("15:04:05.000"), req.MitigationID, assetID, requestDuration.Seconds())
+	slog.InfoContext(r.Context(), "api: mitigation upserted", "mitigation", req.MitigationID,
+		"asset", assetID, "elapsed", requestDuration)
 }
 
 // handleDeleteAssetMitigation removes an applied_to edge (REQ-036).
-func handleDeleteAssetMitigation(pool *nebulago.ConnectionPool, cfg *config.Config, auditStore *store.Store, w http.ResponseWriter, r *http.Request) {
+func handleDeleteAssetMitigation(gs graphstore.GraphStore, cfg *config.Config, auditStore *store.Store, w http.ResponseWriter, r *http.Request) {
 	requestStart := time.Now()
 
 	// URL: /api/asset/{id}/mitigations/{mid}
@@ -153,27 +155,29 @@ func handleDeleteAssetMitigation(pool *nebulago.ConnectionPool, cfg *config.Conf
 		return
 	}
 
-	log.Printf("[%s] api: DELETE /api/asset/%s/mitigations/%s request",
-		requestStart.Format("15:04:05.000"), assetID, mitigationID)
+	slog.DebugContext(r.Context(), "api: DELETE /api/asset/{id}/mitigations/{mid} request", "asset", assetID,
+		"mitigation", mitigationID)
 
-	err = nebula.DeleteMitigation(pool, cfg, mitigationID, assetID)
+	err = gs.DeleteMitigation(r.Context(), mitigationID, assetID)
 	if err != nil {
-		log.Printf("[%s] api: DeleteMitigation failed: %v", time.Now().Format("15:04:05.000"), err)
+		slog.ErrorContext(r.Context(), "api: DeleteMitigation failed", "err", err)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
 
+	// The edge is written: invalidate even if the client has gone away.
+	persistCtx := context.WithoutCancel(r.Context())
 	// REQ-042: invalidate asset hash after mitigation removal (ALG-REQ-043)
-	nebula.InvalidateAssetHash(pool, cfg, assetID)
+	gs.InvalidateAssetHash(persistCtx, assetID)
 	// ADR-REQ-021: invalidate TTB cache for this asset
-	auditStore.InvalidateCache(assetID)
+	auditStore.InvalidateCache(persistCtx, assetID)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 
 	requestDuration := time.Since(requestStart)
-	log.Printf("[%s] api: DELETE %s -> %s completed in %.3f seconds",
-		time.Now().Format("15:04:05.000"), mitigationID, assetID, requestDuration.Seconds())
+	slog.InfoContext(r.Context(), "api: mitigation deleted", "mitigation", mitigationID, "asset", assetID,
+		"elapsed", requestDuration)
 }
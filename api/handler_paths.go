@@ -1,9 +1,12 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"math"
+	"math/rand/v2"
 	"net/http"
 	"sort"
 	"strconv"
@@ -11,21 +14,25 @@ import (
 	"time"
 
 	"ESP-data/config"
+	"ESP-data/internal/detection"
 	"ESP-data/internal/graph"
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/logging"
+	"ESP-data/internal/metrics"
+	"ESP-data/internal/montecarlo"
 	"ESP-data/internal/nebula"
 	"ESP-data/internal/store"
-
-	nebulago "github.com/vesoft-inc/nebula-go/v3"
+	"ESP-data/internal/ttbexec"
 )
 
-func EntryPointsHandler(pool *nebulago.ConnectionPool, cfg *config.Config) http.HandlerFunc {
+func EntryPointsHandler(gs graphstore.GraphStore, cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		requestStart := time.Now()
-		log.Printf("[%s] api: /api/entry-points request", requestStart.Format("15:04:05.000"))
+		slog.DebugContext(r.Context(), "api: /api/entry-points request")
 
-		entries, err := nebula.QueryEntryPoints(pool, cfg)
+		entries, err := gs.QueryEntryPoints(r.Context())
 		if err != nil {
-			log.Printf("[%s] api: QueryEntryPoints failed: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(r.Context(), "api: QueryEntryPoints failed", "err", err)
 			http.Error(w, "Failed to query entry points", http.StatusInternalServerError)
 			return
 		}
@@ -34,23 +41,24 @@ func EntryPointsHandler(pool *nebulago.ConnectionPool, cfg *config.Config) http.
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(response); err != nil {
-			log.Printf("[%s] api: JSON encode failed: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
 		}
 
 		requestDuration := time.Since(requestStart)
-		log.Printf("[%s] api: returned %d entry points in %.3f seconds", time.Now().Format("15:04:05.000"), len(entries), requestDuration.Seconds())
+		slog.InfoContext(r.Context(), "api: returned entry points", "entry_points", len(entries),
+			"elapsed", requestDuration)
 	}
 }
 
 // TargetsHandler returns targets for Path Inspector dropdown (ALG-REQ-003, migrated from REQ-031).
-func TargetsHandler(pool *nebulago.ConnectionPool, cfg *config.Config) http.HandlerFunc {
+func TargetsHandler(gs graphstore.GraphStore, cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		requestStart := time.Now()
-		log.Printf("[%s] api: /api/targets request", requestStart.Format("15:04:05.000"))
+		slog.DebugContext(r.Context(), "api: /api/targets request")
 
-		targets, err := nebula.QueryTargets(pool, cfg)
+		targets, err := gs.QueryTargets(r.Context())
 		if err != nil {
-			log.Printf("[%s] api: QueryTargets failed: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(r.Context(), "api: QueryTargets failed", "err", err)
 			http.Error(w, "Failed to query targets", http.StatusInternalServerError)
 			return
 		}
@@ -59,19 +67,20 @@ func TargetsHandler(pool *nebulago.ConnectionPool, cfg *config.Config) http.Hand
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(response); err != nil {
-			log.Printf("[%s] api: JSON encode failed: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
 		}
 
 		requestDuration := time.Since(requestStart)
-		log.Printf("[%s] api: returned %d targets in %.3f seconds", time.Now().Format("15:04:05.000"), len(targets), requestDuration.Seconds())
+		slog.InfoContext(r.Context(), "api: returned targets", "targets", len(targets), "elapsed", requestDuration)
 	}
 }
 
 // PathsHandler calculates loop-free paths with position-aware TTB
 // (ALG-REQ-001, ALG-REQ-010, ALG-REQ-046, ALG-REQ-070..080 v1.5).
-func PathsHandler(pool *nebulago.ConnectionPool, cfg *config.Config, auditStore *store.Store) http.HandlerFunc {
+func PathsHandler(gs graphstore.GraphStore, cfg *config.Config, auditStore *store.Store, ttbExec *ttbexec.Executor) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		requestStart := time.Now()
+		ctx := r.Context()
 
 		// ADR-REQ-030: create per-request audit buffer (nil if store disabled)
 		var auditBuf *store.AuditBuffer
@@ -102,214 +111,300 @@ func PathsHandler(pool *nebulago.ConnectionPool, cfg *config.Config, auditStore
 			maxHops = n
 		}
 
-		// A5: Parse optional TTB calculation parameters (ALG-REQ-071, 072, 075; UI-REQ-2091)
-		orientationTime := cfg.OrientationTime
-		if v := r.URL.Query().Get("orientationTime"); v != "" {
-			if parsed, err := strconv.ParseFloat(v, 64); err == nil && parsed >= 0 {
-				orientationTime = parsed
-			}
-		}
-		switchoverTime := cfg.SwitchoverTime
-		if v := r.URL.Query().Get("switchoverTime"); v != "" {
-			if parsed, err := strconv.ParseFloat(v, 64); err == nil && parsed >= 0 {
-				switchoverTime = parsed
-			}
+		// mode=shortest: Yen's k shortest paths on the in-process topology
+		// instead of enumerating every simple path (ALG-REQ-001 shortest mode)
+		mode := r.URL.Query().Get("mode")
+		if mode != "" && mode != pathModeAll && mode != pathModeShortest {
+			http.Error(w, fmt.Sprintf("mode must be %q or %q", pathModeAll, pathModeShortest), http.StatusBadRequest)
+			return
 		}
-		priorityTolerance := cfg.PriorityTolerance
-		if v := r.URL.Query().Get("priorityTolerance"); v != "" {
-			if parsed, err := strconv.Atoi(v); err == nil && parsed >= 0 {
-				priorityTolerance = parsed
+		k := defaultShortestK
+		if v := r.URL.Query().Get("k"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxShortestK {
+				http.Error(w, fmt.Sprintf("k must be an integer between 1 and %d", maxShortestK), http.StatusBadRequest)
+				return
 			}
+			k = n
 		}
 
-		log.Printf("[%s] api: /api/paths?from=%s&to=%s&hops=%d (orient=%.4f switch=%.4f priTol=%d)",
-			requestStart.Format("15:04:05.000"), fromID, toID, maxHops,
-			orientationTime, switchoverTime, priorityTolerance)
-
+		// A5: Parse optional TTB calculation parameters (ALG-REQ-071, 072, 075; UI-REQ-2091)
 		// Build TTBParams once — used by all ComputeTTB calls in this handler
-		ttbParams := nebula.TTBParams{
-			OrientationTime:   orientationTime,
-			SwitchoverTime:    switchoverTime,
-			PriorityTolerance: priorityTolerance,
+		ttbParams := ttbParamsFromQuery(r, cfg)
+		// ttbSelection=weighted: expected TTB over pattern-weighted technique
+		// choices instead of the fastest one; ttbDistribution=true adds each
+		// computed asset's TTB distribution (ALG-REQ-076 design note 4)
+		if err := ttbSelectionFromQuery(r, &ttbParams); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// trials=N: Monte Carlo TTA with TTT sampled per technique;
+		// tttDistribution and seed select how (nil when not requested)
+		simulation, err := simulationFromQuery(r, cfg, ttbParams)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
+		// detection=true: time-to-detect per path from the detection
+		// controls on its assets; sort=race ranks paths by the attacker's
+		// chance to reach the target before an alert
+		detect, sortRace, err := detectionFromQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		orientationTime := ttbParams.OrientationTime
+		switchoverTime := ttbParams.SwitchoverTime
+		priorityTolerance := ttbParams.PriorityTolerance
+
+		slog.DebugContext(ctx, "api: /api/paths request", "from", fromID, "to", toID, "hops", maxHops, "mode", mode,
+			"orientation_time", orientationTime, "switchover_time", switchoverTime, "priority_tolerance", priorityTolerance,
+			"ttb_selection", ttbSelectionLabel(ttbParams))
 
 		// Timing buckets for /api/paths phase observability.
 		var queryPathsDuration time.Duration
 		var ttbRecalcDuration time.Duration
-		var ttbEntryDuration time.Duration
-		var ttbTargetDuration time.Duration
+		var ttbEndpointsDuration time.Duration
 		var jsonEncodeDuration time.Duration
 
-		// Step 1: Find paths — returns per-node IDs and stored TTBs (ALG-REQ-001 v1.3)
-		qpStart := time.Now()
-		pathResults, err := nebula.QueryPaths(pool, cfg, fromID, toID, maxHops)
-		queryPathsDuration = time.Since(qpStart)
-		if err != nil {
-			log.Printf("[%s] api: QueryPaths failed: %v", time.Now().Format("15:04:05.000"), err)
-			http.Error(w, "Failed to calculate paths", http.StatusInternalServerError)
-			return
+		// Tactic chain of each asset per position: the ChainRules, or the
+		// default entrance, intermediate and target chains (ALG-REQ-051)
+		chains := chainAssignments(ctx, gs)
+
+		// Steps 5-6 start first: the entry and target chains do not depend on
+		// path length (ALG-REQ-051), so their TTBs are computed in parallel
+		// with the path query. Results are ephemeral — NOT written to the
+		// database — and their audit records are merged after the
+		// intermediates' to keep the audit order fixed.
+		endpointTasks := []ttbexec.Task{
+			{AssetID: fromID, ChainVID: chains.Chain(fromID, nebula.PositionEntrance), Position: nebula.PositionEntrance, Cached: true},
+			{AssetID: toID, ChainVID: chains.Chain(toID, nebula.PositionTarget), Position: nebula.PositionTarget, Cached: true},
 		}
-
-		// Step 2: Extract unique asset IDs from all paths (ALG-REQ-046 step 2)
-		assetIDSet := make(map[string]bool)
-		for _, p := range pathResults {
-			for _, id := range p.IDs {
-				assetIDSet[id] = true
-			}
-		}
-		uniqueIDs := make([]string, 0, len(assetIDSet))
-		for id := range assetIDSet {
-			uniqueIDs = append(uniqueIDs, id)
+		var endpointAudit *store.AuditBuffer
+		if auditBuf != nil {
+			endpointAudit = &store.AuditBuffer{}
 		}
-
-		// Step 3-4: Check hash validity and recalculate stale intermediates (ALG-REQ-046)
+		endpointDone := make(chan []ttbexec.Result, 1)
+		go func() {
+			endpointStart := time.Now()
+			results := ttbExec.Run(ctx, gs, endpointTasks, ttbParams, endpointAudit, nil)
+			ttbEndpointsDuration = time.Since(endpointStart)
+			endpointDone <- results
+		}()
+
+		var pathResults []nebula.PathResult
 		var recalculatedAssets []string
+		var intermediateDistributions []graph.TTBDistribution
 		freshTTBs := make(map[string]float64)
 
-		if len(uniqueIDs) > 0 {
-			validity, fetchedTTBs, err := nebula.QueryAssetHashValidity(pool, cfg, uniqueIDs)
+		if mode == pathModeShortest {
+			// Steps 1-4 in shortest mode: topology load, scoped recalc and Yen search
+			qpStart := time.Now()
+			var err error
+			pathResults, recalculatedAssets, freshTTBs, intermediateDistributions, ttbRecalcDuration, err = shortestPaths(ctx, gs, ttbExec, chains,
+				fromID, toID, maxHops, k, ttbParams, auditBuf)
+			queryPathsDuration = time.Since(qpStart) - ttbRecalcDuration
+			if requestAborted(w, r) {
+				return
+			}
 			if err != nil {
-				log.Printf("[%s] api: QueryAssetHashValidity failed: %v",
-					time.Now().Format("15:04:05.000"), err)
-			} else {
-				freshTTBs = fetchedTTBs
+				slog.ErrorContext(ctx, "api: shortest path search failed", "err", err)
+				http.Error(w, "Failed to calculate paths", http.StatusInternalServerError)
+				return
+			}
+			if err := simulationWithinBudget(cfg, simulation, len(pathResults)); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		} else {
+			// Step 1: Find paths — returns per-node IDs and stored TTBs (ALG-REQ-001 v1.3)
+			qpStart := time.Now()
+			var err error
+			pathResults, err = gs.QueryPaths(ctx, fromID, toID, maxHops)
+			queryPathsDuration = time.Since(qpStart)
+			if requestAborted(w, r) {
+				return
+			}
+			if err != nil {
+				slog.ErrorContext(ctx, "api: QueryPaths failed", "err", err)
+				http.Error(w, "Failed to calculate paths", http.StatusInternalServerError)
+				return
+			}
+			if err := simulationWithinBudget(cfg, simulation, len(pathResults)); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 
-				// Collect stale IDs — exclude entry and target (they get ephemeral TTB)
-				var staleIDs []string
-				for _, id := range uniqueIDs {
-					if !validity[id] && id != fromID && id != toID {
-						staleIDs = append(staleIDs, id)
-					}
+			// Step 2: Extract unique asset IDs from all paths (ALG-REQ-046 step 2)
+			assetIDSet := make(map[string]bool)
+			for _, p := range pathResults {
+				for _, id := range p.IDs {
+					assetIDSet[id] = true
 				}
+			}
+			uniqueIDs := make([]string, 0, len(assetIDSet))
+			for id := range assetIDSet {
+				uniqueIDs = append(uniqueIDs, id)
+			}
 
-				if len(staleIDs) > 0 {
-					log.Printf("[%s] api: %d intermediate(s) have stale hashes, recalculating",
-						requestStart.Format("15:04:05.000"), len(staleIDs))
+			// Step 3-4: Check hash validity and recalculate stale intermediates (ALG-REQ-046)
+			if len(uniqueIDs) > 0 {
+				validity, fetchedTTBs, err := gs.QueryAssetHashValidity(ctx, uniqueIDs)
+				if err != nil {
+					slog.ErrorContext(ctx, "api: QueryAssetHashValidity failed", "err", err)
+				} else {
+					freshTTBs = fetchedTTBs
+
+					// Collect stale IDs — exclude entry and target (they get ephemeral TTB)
+					var staleIDs []string
+					for _, id := range uniqueIDs {
+						if !validity[id] && id != fromID && id != toID {
+							staleIDs = append(staleIDs, id)
+						}
+					}
 
-					ttbRecalcStart := time.Now()
-					staleHashes, err := nebula.QueryScopedStaleHashes(pool, cfg, staleIDs)
-					if err != nil {
-						log.Printf("[%s] api: QueryScopedStaleHashes failed: %v",
-							time.Now().Format("15:04:05.000"), err)
-					} else {
-						for _, asset := range staleHashes {
-							hashStr := fmt.Sprintf("%d", asset.ComputedHash)
-							chainVID := nebula.ChainVIDForPosition(1, 3) // intermediate position
-							ttbResult, err := nebula.ComputeTTB(pool, cfg, asset.AssetID, chainVID, ttbParams, auditBuf)
-							if auditBuf != nil && len(auditBuf.Breakdowns) > 0 {
-								auditBuf.Breakdowns[len(auditBuf.Breakdowns)-1].ChainPosition = "intermediate"
-							}
-							if err != nil {
-								log.Printf("[%s] api: ComputeTTB failed for %s: %v",
-									time.Now().Format("15:04:05.000"), asset.AssetID, err)
-								continue
-							}
-							if err := nebula.UpdateAssetTTBAndHash(pool, cfg, asset.AssetID, ttbResult.TTB, hashStr); err != nil {
-								log.Printf("[%s] api: UpdateAssetTTBAndHash failed for %s: %v",
-									time.Now().Format("15:04:05.000"), asset.AssetID, err)
-								continue
-							}
-							freshTTBs[asset.AssetID] = ttbResult.TTB
-							recalculatedAssets = append(recalculatedAssets, asset.AssetID)
-							log.Printf("[%s] api: path-scoped recalc %s: TTB %.4f -> %.4f",
-								time.Now().Format("15:04:05.000"), asset.AssetID, asset.CurrentTTB, ttbResult.TTB)
+					if len(staleIDs) > 0 {
+						ttbRecalcStart := time.Now()
+						var recalculated map[string]float64
+						recalculatedAssets, recalculated = recalcStaleIntermediates(ctx, gs, ttbExec, chains, staleIDs, ttbParams, auditBuf)
+						for id, ttb := range recalculated {
+							freshTTBs[id] = ttb
 						}
 						ttbRecalcDuration = time.Since(ttbRecalcStart)
 					}
-					// Decrement stale_count to reflect path-scoped recalculations (UI-REQ-112A)
-					if len(recalculatedAssets) > 0 {
-						nebula.DecrementStaleCount(pool, cfg, len(recalculatedAssets))
+				}
+			}
+
+			// Weighted selection: Asset.TTB holds the fastest-selection TTB,
+			// so the intermediates' expected TTBs are computed per request.
+			if ttbParams.Weighted() {
+				weightedStart := time.Now()
+				var intermediates []string
+				for _, id := range uniqueIDs {
+					if id != fromID && id != toID {
+						intermediates = append(intermediates, id)
 					}
 				}
+				sort.Strings(intermediates)
+				var weighted map[string]float64
+				weighted, intermediateDistributions = weightedIntermediates(ctx, gs, ttbExec, chains, intermediates, ttbParams, auditBuf)
+				if freshTTBs == nil {
+					freshTTBs = make(map[string]float64, len(weighted))
+				}
+				for id, ttb := range weighted {
+					freshTTBs[id] = ttb
+				}
+				ttbRecalcDuration += time.Since(weightedStart)
 			}
 		}
 
-		// Step 5-6: Compute entry and target TTB with position-specific chains (ALG-REQ-046, ALG-REQ-070)
-		// These are ephemeral — NOT written to the database.
-		var allTTBLog []nebula.TTBLogEntry
-
-		// Determine path length for chain selection (ALG-REQ-051)
-		// Use the first path's length as representative; all paths share the same entry/target.
-		pathLen := 2 // minimum: entry + target
-		if len(pathResults) > 0 && len(pathResults[0].IDs) > pathLen {
-			pathLen = len(pathResults[0].IDs)
+		// Step 5-6: Collect entry and target TTB with position-specific chains (ALG-REQ-046, ALG-REQ-070)
+		endpointResults := <-endpointDone
+		if requestAborted(w, r) {
+			return
 		}
-
-		entryChainVID := nebula.ChainVIDForPosition(0, pathLen) // entry position
-		entryStart := time.Now()
-		entryResult, err := nebula.ComputeTTB(pool, cfg, fromID, entryChainVID, ttbParams, auditBuf)
-		if auditBuf != nil && len(auditBuf.Breakdowns) > 0 {
-			auditBuf.Breakdowns[len(auditBuf.Breakdowns)-1].ChainPosition = "entrance"
+		if auditBuf != nil {
+			auditBuf.Merge(endpointAudit)
 		}
-		ttbEntryDuration = time.Since(entryStart)
-		var entryTTB float64
-		if err != nil {
-			log.Printf("[%s] api: ComputeTTB (entry %s) failed: %v, using fallback",
-				time.Now().Format("15:04:05.000"), fromID, err)
-			if ttb, ok := freshTTBs[fromID]; ok {
-				entryTTB = ttb
-			} else {
-				entryTTB = 10.0
-			}
-		} else {
-			entryTTB = entryResult.TTB
-			allTTBLog = append(allTTBLog, entryResult.Log...)
+		var allTTBLog []nebula.TTBLogEntry
+		entryTTB, entryLog := positionTTB(ctx, endpointTasks[0], endpointResults[0], freshTTBs)
+		allTTBLog = append(allTTBLog, entryLog...)
+		targetTTB, targetLog := positionTTB(ctx, endpointTasks[1], endpointResults[1], freshTTBs)
+		allTTBLog = append(allTTBLog, targetLog...)
+
+		var distributions []graph.TTBDistribution
+		if ttbParams.Distribution {
+			distributions = appendDistribution(distributions, endpointTasks[0], endpointResults[0])
+			distributions = append(distributions, intermediateDistributions...)
+			distributions = appendDistribution(distributions, endpointTasks[1], endpointResults[1])
 		}
 
-		targetChainVID := nebula.ChainVIDForPosition(pathLen-1, pathLen) // target position
-		targetStart := time.Now()
-		targetResult, err := nebula.ComputeTTB(pool, cfg, toID, targetChainVID, ttbParams, auditBuf)
-		if auditBuf != nil && len(auditBuf.Breakdowns) > 0 {
-			auditBuf.Breakdowns[len(auditBuf.Breakdowns)-1].ChainPosition = "target"
-		}
-		ttbTargetDuration = time.Since(targetStart)
-		var targetTTB float64
-		if err != nil {
-			log.Printf("[%s] api: ComputeTTB (target %s) failed: %v, using fallback",
-				time.Now().Format("15:04:05.000"), toID, err)
-			if ttb, ok := freshTTBs[toID]; ok {
-				targetTTB = ttb
+		slog.DebugContext(ctx, "api: position-aware TTB", "entry", fromID, "entry_ttb", entryTTB,
+			"target", toID, "target_ttb", targetTTB)
+
+		// Selected techniques of the intermediates, for the simulation and
+		// the time-to-detect; coverage of the path assets by detection controls
+		var intermediateLogs map[string][]nebula.TTBLogEntry
+		var coverage map[string][]nebula.DetectionCoverage
+		var simulationDuration, detectionDuration time.Duration
+		if simulation != nil || detect {
+			logsStart := time.Now()
+			intermediateLogs = pathIntermediateLogs(ctx, gs, ttbExec, chains, pathResults, fromID, toID, ttbParams)
+			if simulation != nil {
+				simulationDuration = time.Since(logsStart)
 			} else {
-				targetTTB = 10.0
+				detectionDuration = time.Since(logsStart)
 			}
-		} else {
-			targetTTB = targetResult.TTB
-			allTTBLog = append(allTTBLog, targetResult.Log...)
 		}
-
-		log.Printf("[%s] api: position-aware TTB — entry %s=%.4f, target %s=%.4f",
-			time.Now().Format("15:04:05.000"), fromID, entryTTB, toID, targetTTB)
+		if detect {
+			detectStart := time.Now()
+			coverage = detectionCoverage(ctx, gs, pathResults)
+			detectionDuration += time.Since(detectStart)
+		}
 
 		// Step 7: Compute TTA per path (ALG-REQ-010, ALG-REQ-078)
 		pathItems := make([]graph.PathItem, 0, len(pathResults))
 		for i, p := range pathResults {
+			if requestAborted(w, r) {
+				return
+			}
 			hosts := strings.Join(p.IDs, " -> ")
+			ttbs := make([]float64, len(p.IDs))
+			logs := make([][]nebula.TTBLogEntry, len(p.IDs))
 			var tta float64
 			for j, id := range p.IDs {
 				switch {
 				case j == 0:
-					tta += entryTTB
+					ttbs[j], logs[j] = entryTTB, entryLog
 				case j == len(p.IDs)-1:
-					tta += targetTTB
+					ttbs[j], logs[j] = targetTTB, targetLog
 				default:
+					logs[j] = intermediateLogs[id]
 					if ttb, ok := freshTTBs[id]; ok {
-						tta += ttb
+						ttbs[j] = ttb
 					} else if j < len(p.TTBs) {
-						tta += p.TTBs[j]
+						ttbs[j] = p.TTBs[j]
 					} else {
-						tta += 10.0
+						ttbs[j] = 10.0
 					}
 				}
+				tta += ttbs[j]
 			}
-			pathItems = append(pathItems, graph.PathItem{
+			item := graph.PathItem{
 				PathID: fmt.Sprintf("P%05d", i+1),
 				Hosts:  hosts,
 				TTA:    tta,
-			})
+			}
+			if simulation != nil {
+				simStart := time.Now()
+				var techniques []montecarlo.Technique
+				for _, log := range logs {
+					techniques = append(techniques, logTechniques(log)...)
+				}
+				q := simulation.PathTTA(hosts, tta, techniques)
+				item.TTAP10, item.TTAP50, item.TTAP90 = &q.P10, &q.P50, &q.P90
+				simulationDuration += time.Since(simStart)
+			}
+			if detect {
+				// Each asset's chain starts when the previous asset is compromised
+				var steps []detection.Step
+				var start float64
+				for j, id := range p.IDs {
+					steps = append(steps, detection.Steps(id, start, logs[j], ttbParams)...)
+					start += ttbs[j]
+				}
+				race := detection.Evaluate(steps, coverage, tta)
+				item.DetectionProbability, item.TTD, item.AttackerWins = &race.Probability, race.TTD, &race.AttackerWins
+			}
+			pathItems = append(pathItems, item)
 		}
 
-		// Sort by TTA ascending (ALG-REQ-001: response ordered by TTA)
-		sort.Slice(pathItems, func(i, j int) bool {
+		// Sort by TTA ascending (ALG-REQ-001: response ordered by TTA);
+		// sort=race puts the paths the attacker most likely wins first
+		sort.SliceStable(pathItems, func(i, j int) bool {
+			if sortRace && *pathItems[i].AttackerWins != *pathItems[j].AttackerWins {
+				return *pathItems[i].AttackerWins > *pathItems[j].AttackerWins
+			}
 			return pathItems[i].TTA < pathItems[j].TTA
 		})
 
@@ -328,50 +423,538 @@ func PathsHandler(pool *nebulago.ConnectionPool, cfg *config.Config, auditStore
 			EntryPoint:         fromID,
 			Target:             toID,
 			Hops:               maxHops,
+			Mode:               mode,
 			Total:              len(pathItems),
 			RecalculatedAssets: recalculatedAssets,
 			TTBLog:             allTTBLog,
+			TTBSelection:       ttbSelectionLabel(ttbParams),
+			TTBDistributions:   distributions,
+		}
+		if simulation != nil {
+			response.Simulation = &graph.Simulation{
+				Distribution: simulation.Distribution,
+				Trials:       simulation.Trials,
+				Seed:         int64(simulation.Seed),
+			}
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		jsonStart := time.Now()
 		if err := json.NewEncoder(w).Encode(response); err != nil {
-			log.Printf("[%s] api: JSON encode failed: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(ctx, "api: JSON encode failed", "err", err)
 		}
 		jsonEncodeDuration = time.Since(jsonStart)
 
-		// ADR-REQ-031: populate session record and flush audit buffer async after response is sent
+		// ADR-REQ-031: populate session record and flush audit buffer async after response is sent.
+		// The flush outlives the request, so it must not inherit its cancellation.
 		if auditBuf != nil {
 			totalMs := int(time.Since(requestStart).Milliseconds())
 			auditBuf.Session = store.SessionRecord{
+				RequestID:          logging.RequestID(ctx),
 				EntryAssetID:       fromID,
 				TargetAssetID:      toID,
 				MaxHops:            maxHops,
 				OrientationTime:    orientationTime,
 				SwitchoverTime:     switchoverTime,
 				PriorityTolerance:  priorityTolerance,
+				TTBSelection:       ttbSelectionLabel(ttbParams),
 				PathsFound:         len(pathItems),
 				AssetsRecalculated: len(recalculatedAssets),
 				QueryTimeMs:        int(queryPathsDuration.Milliseconds()),
 				TotalTimeMs:        totalMs,
 			}
+			if simulation != nil {
+				auditBuf.Session.SimDistribution = simulation.Distribution
+				auditBuf.Session.SimTrials = simulation.Trials
+				auditBuf.Session.SimSeed = int64(simulation.Seed)
+			}
+			// pathItems is sorted by TTA (or race), so the cap keeps the top N;
+			// path_seq still matches the response.
 			for idx, p := range pathItems {
+				if cfg.AuditMaxPaths > 0 && idx >= cfg.AuditMaxPaths {
+					break
+				}
 				hopCount := len(strings.Split(p.Hosts, " -> "))
 				auditBuf.Paths = append(auditBuf.Paths, store.PathRecord{
 					PathSeq:   idx + 1,
 					HostChain: p.Hosts,
 					HopCount:  hopCount,
 					TTAHours:  p.TTA,
+					TTAP10:    p.TTAP10,
+					TTAP50:    p.TTAP50,
+					TTAP90:    p.TTAP90,
+
+					DetectionProbability: p.DetectionProbability,
+					TTDHours:             p.TTD,
+					AttackerWins:         p.AttackerWins,
 				})
 			}
-			go auditStore.FlushBatch(auditBuf)
+			auditStore.Enqueue(context.WithoutCancel(ctx), auditBuf)
+		}
+
+		modeLabel := mode
+		if modeLabel == "" {
+			modeLabel = pathModeAll
+		}
+		metrics.PathsReturned.Add(float64(len(pathItems)), modeLabel)
+		metrics.PathPhaseSeconds.Observe(queryPathsDuration.Seconds(), "query")
+		metrics.PathPhaseSeconds.Observe(ttbRecalcDuration.Seconds(), "recalc")
+		metrics.PathPhaseSeconds.Observe(ttbEndpointsDuration.Seconds(), "ttb_endpoints")
+		metrics.PathPhaseSeconds.Observe(jsonEncodeDuration.Seconds(), "json")
+		if simulation != nil {
+			metrics.PathPhaseSeconds.Observe(simulationDuration.Seconds(), "simulation")
+		}
+		if detect {
+			metrics.PathPhaseSeconds.Observe(detectionDuration.Seconds(), "detection")
 		}
 
 		requestDuration := time.Since(requestStart)
-		log.Printf("[%s] api: returned %d paths for %s -> %s in %.3f seconds (recalculated: %d, qp=%.3f, recalc=%.3f, ttbEntry=%.3f, ttbTarget=%.3f, json=%.3f)",
-			time.Now().Format("15:04:05.000"), len(pathItems), fromID, toID,
-			requestDuration.Seconds(), len(recalculatedAssets),
-			queryPathsDuration.Seconds(), ttbRecalcDuration.Seconds(),
-			ttbEntryDuration.Seconds(), ttbTargetDuration.Seconds(), jsonEncodeDuration.Seconds())
+		slog.InfoContext(ctx, "api: returned paths", "paths", len(pathItems), "from", fromID, "to", toID,
+			"recalculated", len(recalculatedAssets), "elapsed", requestDuration, "query", queryPathsDuration,
+			"recalc", ttbRecalcDuration, "ttb_endpoints", ttbEndpointsDuration, "json", jsonEncodeDuration,
+			"simulation", simulationDuration, "detection", detectionDuration)
+	}
+}
+
+// ttbParamsFromQuery reads the optional orientationTime, switchoverTime and
+// priorityTolerance overrides; invalid or negative values keep the config
+// defaults (ALG-REQ-071, 072, 075; UI-REQ-2091).
+func ttbParamsFromQuery(r *http.Request, cfg *config.Config) nebula.TTBParams {
+	params := nebula.TTBParams{
+		OrientationTime:   cfg.OrientationTime,
+		SwitchoverTime:    cfg.SwitchoverTime,
+		PriorityTolerance: cfg.PriorityTolerance,
+	}
+	if v := r.URL.Query().Get("orientationTime"); v != "" {
+		if parsed, err := strconv.ParseFloat(v, 64); err == nil && parsed >= 0 {
+			params.OrientationTime = parsed
+		}
+	}
+	if v := r.URL.Query().Get("switchoverTime"); v != "" {
+		if parsed, err := strconv.ParseFloat(v, 64); err == nil && parsed >= 0 {
+			params.SwitchoverTime = parsed
+		}
+	}
+	if v := r.URL.Query().Get("priorityTolerance"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed >= 0 {
+			params.PriorityTolerance = parsed
+		}
+	}
+	return params
+}
+
+// ttbSelectionFromQuery reads the optional ttbSelection ("fastest" or
+// "weighted") and ttbDistribution overrides into params. Unlike the numeric
+// overrides, invalid values are rejected: they change what TTA means.
+func ttbSelectionFromQuery(r *http.Request, params *nebula.TTBParams) error {
+	switch v := r.URL.Query().Get("ttbSelection"); v {
+	case "", nebula.TTBSelectionFastest:
+	case nebula.TTBSelectionWeighted:
+		params.Selection = v
+	default:
+		return fmt.Errorf("ttbSelection must be %q or %q", nebula.TTBSelectionFastest, nebula.TTBSelectionWeighted)
+	}
+	if v := r.URL.Query().Get("ttbDistribution"); v != "" {
+		distribution, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("ttbDistribution must be true or false")
+		}
+		if distribution && !params.Weighted() {
+			return fmt.Errorf("ttbDistribution requires ttbSelection=%s", nebula.TTBSelectionWeighted)
+		}
+		params.Distribution = distribution
+	}
+	return nil
+}
+
+// simulationWithinBudget rejects a simulation of paths paths whose trials
+// summed over all of them exceed MONTE_CARLO_MAX_PATH_TRIALS; every path is
+// sampled in full, so an unbounded all-paths search would be too.
+func simulationWithinBudget(cfg *config.Config, sim *montecarlo.Config, paths int) error {
+	if sim == nil || paths <= cfg.MonteCarloMaxPathTrials/sim.Trials {
+		return nil
+	}
+	return fmt.Errorf("trials=%d over %d paths exceeds %d simulated path trials; lower trials or use mode=%s with a smaller k",
+		sim.Trials, paths, cfg.MonteCarloMaxPathTrials, pathModeShortest)
+}
+
+// simulationFromQuery reads the Monte Carlo TTA parameters: trials (absent
+// or 0 turns the simulation off, at most MONTE_CARLO_MAX_TRIALS),
+// tttDistribution (default MONTE_CARLO_DISTRIBUTION) and seed (random when
+// absent; the response echoes it so the run can be repeated). The
+// simulation samples the techniques of the fastest selection, so weighted
+// selection is rejected.
+func simulationFromQuery(r *http.Request, cfg *config.Config, params nebula.TTBParams) (*montecarlo.Config, error) {
+	q := r.URL.Query()
+	trials := 0
+	if v := q.Get("trials"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > cfg.MonteCarloMaxTrials {
+			return nil, fmt.Errorf("trials must be an integer between 0 and %d", cfg.MonteCarloMaxTrials)
+		}
+		trials = n
+	}
+	if trials == 0 {
+		if q.Get("tttDistribution") != "" || q.Get("seed") != "" {
+			return nil, fmt.Errorf("tttDistribution and seed require trials")
+		}
+		return nil, nil
+	}
+	if params.Weighted() {
+		return nil, fmt.Errorf("trials requires ttbSelection=%s", nebula.TTBSelectionFastest)
+	}
+
+	sim := &montecarlo.Config{Distribution: cfg.MonteCarloDistribution, Trials: trials}
+	if v := q.Get("tttDistribution"); v != "" {
+		sim.Distribution = v
+	}
+	if v := q.Get("seed"); v != "" {
+		seed, err := strconv.ParseUint(v, 10, 63)
+		if err != nil {
+			return nil, fmt.Errorf("seed must be an integer between 0 and %d", uint64(math.MaxInt64))
+		}
+		sim.Seed = seed
+	} else {
+		sim.Seed = rand.Uint64() >> 1 // fits calc_sessions.sim_seed and JSON readers of int64
+	}
+	if err := sim.Validate(); err != nil {
+		return nil, err
+	}
+	return sim, nil
+}
+
+// pathIntermediateLogs returns the TTB log of every intermediate asset on
+// pathResults, computed with its intermediate chain on the TTB executor.
+// Cached tasks reuse the logs behind the stored TTBs; an asset whose
+// computation fails has no log: the simulation keeps its TTB fixed and the
+// time-to-detect sees no technique on it.
+func pathIntermediateLogs(ctx context.Context, gs graphstore.GraphStore, ttbExec *ttbexec.Executor, chains *nebula.ChainAssignments, pathResults []nebula.PathResult,
+	fromID, toID string, params nebula.TTBParams) map[string][]nebula.TTBLogEntry {
+
+	idSet := make(map[string]bool)
+	for _, p := range pathResults {
+		for _, id := range p.IDs {
+			if id != fromID && id != toID {
+				idSet[id] = true
+			}
+		}
+	}
+	ids := make([]string, 0, len(idSet))
+	for id := range idSet {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	tasks := make([]ttbexec.Task, len(ids))
+	for i, id := range ids {
+		tasks[i] = ttbexec.Task{AssetID: id, ChainVID: chains.Chain(id, nebula.PositionIntermediate), Position: nebula.PositionIntermediate, Cached: true}
+	}
+	results := ttbExec.Run(ctx, gs, tasks, params, nil, nil)
+
+	logs := make(map[string][]nebula.TTBLogEntry, len(ids))
+	for i, task := range tasks {
+		if results[i].Err != nil {
+			slog.WarnContext(ctx, "api: intermediate ComputeTTB failed, no technique log", "asset", task.AssetID,
+				"err", results[i].Err)
+			continue
+		}
+		logs[task.AssetID] = results[i].TTB.Log
+	}
+	return logs
+}
+
+// detectionCoverage returns the detection controls covering the assets of
+// pathResults. On failure paths are reported as undetectable.
+func detectionCoverage(ctx context.Context, gs graphstore.GraphStore, pathResults []nebula.PathResult) map[string][]nebula.DetectionCoverage {
+	idSet := make(map[string]bool)
+	for _, p := range pathResults {
+		for _, id := range p.IDs {
+			idSet[id] = true
+		}
+	}
+	ids := make([]string, 0, len(idSet))
+	for id := range idSet {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	coverage, err := gs.QueryDetectionCoverage(ctx, ids)
+	if err != nil {
+		slog.ErrorContext(ctx, "api: QueryDetectionCoverage failed", "err", err)
+		return nil
+	}
+	return coverage
+}
+
+// logTechniques returns the selected techniques of a TTB log with their
+// execution bounds and TTT.
+func logTechniques(log []nebula.TTBLogEntry) []montecarlo.Technique {
+	var techniques []montecarlo.Technique
+	for _, e := range log {
+		if e.TechniqueID == nil {
+			continue
+		}
+		techniques = append(techniques, montecarlo.Technique{ExecMin: e.ExecMin, ExecMax: e.ExecMax, TTT: e.TTT})
+	}
+	return techniques
+}
+
+// Path orders of /api/paths.
+const (
+	pathSortTTA  = "tta"
+	pathSortRace = "race"
+)
+
+// detectionFromQuery reads detection (true adds the time-to-detect) and
+// sort ("tta" or "race"); sort=race implies detection.
+func detectionFromQuery(r *http.Request) (detect, race bool, err error) {
+	if v := r.URL.Query().Get("detection"); v != "" {
+		detect, err = strconv.ParseBool(v)
+		if err != nil {
+			return false, false, fmt.Errorf("detection must be true or false")
+		}
+	}
+	switch r.URL.Query().Get("sort") {
+	case "", pathSortTTA:
+	case pathSortRace:
+		detect, race = true, true
+	default:
+		return false, false, fmt.Errorf("sort must be %q or %q", pathSortTTA, pathSortRace)
+	}
+	return detect, race, nil
+}
+
+// ttbSelectionLabel names the technique selection of params for responses
+// and calc_sessions.
+func ttbSelectionLabel(params nebula.TTBParams) string {
+	if params.Weighted() {
+		return nebula.TTBSelectionWeighted
+	}
+	return nebula.TTBSelectionFastest
+}
+
+// storedTTBParams returns params with fastest selection: Asset.TTB and
+// asset_ttb_cache always hold the ALG-REQ-077 value, whatever a request asked for.
+func storedTTBParams(params nebula.TTBParams) nebula.TTBParams {
+	params.Selection, params.Distribution = "", false
+	return params
+}
+
+// weightedIntermediates computes the weighted TTB of intermediate assets on
+// the TTB executor (ALG-REQ-076 design note 4). Nothing is persisted; assets
+// whose computation fails are left out, so the caller keeps their stored
+// TTB. With params.Distribution it also returns their distributions.
+func weightedIntermediates(ctx context.Context, gs graphstore.GraphStore, ttbExec *ttbexec.Executor, chains *nebula.ChainAssignments, ids []string, params nebula.TTBParams,
+	auditBuf *store.AuditBuffer) (map[string]float64, []graph.TTBDistribution) {
+
+	tasks := make([]ttbexec.Task, len(ids))
+	for i, id := range ids {
+		tasks[i] = ttbexec.Task{AssetID: id, ChainVID: chains.Chain(id, nebula.PositionIntermediate), Position: nebula.PositionIntermediate, Cached: true}
+	}
+	results := ttbExec.Run(ctx, gs, tasks, params, auditBuf, nil)
+
+	ttbs := make(map[string]float64, len(ids))
+	var distributions []graph.TTBDistribution
+	for i, task := range tasks {
+		if results[i].Err != nil {
+			slog.WarnContext(ctx, "api: weighted ComputeTTB failed, using stored TTB", "asset", task.AssetID,
+				"err", results[i].Err)
+			continue
+		}
+		ttbs[task.AssetID] = results[i].TTB.TTB
+		if params.Distribution {
+			distributions = appendDistribution(distributions, task, results[i])
+		}
+	}
+	return ttbs, distributions
+}
+
+// appendDistribution adds the weighted TTB distribution of a task's result,
+// if it has one.
+func appendDistribution(distributions []graph.TTBDistribution, task ttbexec.Task, result ttbexec.Result) []graph.TTBDistribution {
+	if result.Err != nil || result.TTB == nil || len(result.TTB.Distribution) == 0 {
+		return distributions
+	}
+	return append(distributions, graph.TTBDistribution{
+		AssetID:  task.AssetID,
+		Position: task.Position,
+		Expected: result.TTB.TTB,
+		Outcomes: result.TTB.Distribution,
+	})
+}
+
+// positionTTB returns the ephemeral TTB of a position task run by the TTB
+// executor (ALG-REQ-046 steps 5-6, ALG-REQ-070); cached tasks reuse a result
+// while the asset's hash is unchanged (ALG-REQ-053). On failure it falls back
+// to the stored TTB in freshTTBs, then to 10.0.
+func positionTTB(ctx context.Context, task ttbexec.Task, result ttbexec.Result, freshTTBs map[string]float64) (float64, []nebula.TTBLogEntry) {
+	if result.CacheHit {
+		slog.DebugContext(ctx, "api: TTB cache hit", "position", task.Position, "asset", task.AssetID)
+	}
+	if result.Err != nil {
+		slog.WarnContext(ctx, "api: ComputeTTB failed, using fallback", "position", task.Position,
+			"asset", task.AssetID, "err", result.Err)
+		if ttb, ok := freshTTBs[task.AssetID]; ok {
+			return ttb, nil
+		}
+		return 10.0, nil
+	}
+	return result.TTB.TTB, result.TTB.Log
+}
+
+// positionTTBs computes the TTB of every asset of ids at a chain position on
+// the TTB executor and resolves each with positionTTB. fallback supplies the
+// stored TTB of assets whose computation fails.
+func positionTTBs(ctx context.Context, gs graphstore.GraphStore, ttbExec *ttbexec.Executor, chains *nebula.ChainAssignments, ids []string, position string,
+	ttbParams nebula.TTBParams, fallback map[string]float64) map[string]float64 {
+
+	tasks := make([]ttbexec.Task, len(ids))
+	for i, id := range ids {
+		tasks[i] = ttbexec.Task{AssetID: id, ChainVID: chains.Chain(id, position), Position: position, Cached: true}
+	}
+	results := ttbExec.Run(ctx, gs, tasks, ttbParams, nil, nil)
+	ttbs := make(map[string]float64, len(ids))
+	for i, task := range tasks {
+		ttbs[task.AssetID], _ = positionTTB(ctx, task, results[i], fallback)
 	}
+	return ttbs
+}
+
+// Path search modes of /api/paths.
+const (
+	pathModeAll      = "all"
+	pathModeShortest = "shortest"
+	defaultShortestK = 10
+	maxShortestK     = 100
+)
+
+// recalcStaleIntermediates recomputes the TTB of stale intermediate assets
+// with their intermediate chain on the TTB executor, persists TTB and hash, and
+// decrements stale_count (ALG-REQ-046 steps 3-4, UI-REQ-112A). Each result is
+// recorded in the TTB cache under its new hash (ADR-REQ-022). Computed TTBs
+// are persisted even if ctx is cancelled meanwhile.
+func recalcStaleIntermediates(ctx context.Context, gs graphstore.GraphStore, ttbExec *ttbexec.Executor, chains *nebula.ChainAssignments, staleIDs []string, ttbParams nebula.TTBParams, auditBuf *store.AuditBuffer) ([]string, map[string]float64) {
+	slog.InfoContext(ctx, "api: recalculating stale intermediates", "stale", len(staleIDs))
+	ttbParams = storedTTBParams(ttbParams)
+
+	var recalculatedAssets []string
+	freshTTBs := make(map[string]float64)
+
+	staleHashes, err := gs.QueryScopedStaleHashes(ctx, staleIDs)
+	if err != nil {
+		slog.ErrorContext(ctx, "api: QueryScopedStaleHashes failed", "err", err)
+		return recalculatedAssets, freshTTBs
+	}
+	tasks := make([]ttbexec.Task, len(staleHashes))
+	for i, asset := range staleHashes {
+		tasks[i] = ttbexec.Task{
+			AssetID:  asset.AssetID,
+			ChainVID: chains.Chain(asset.AssetID, nebula.PositionIntermediate),
+			Position: nebula.PositionIntermediate,
+			Hash:     fmt.Sprintf("%d", asset.ComputedHash),
+		}
+	}
+	results := ttbExec.Run(ctx, gs, tasks, ttbParams, auditBuf, nil)
+
+	persistCtx := context.WithoutCancel(ctx)
+	for i, asset := range staleHashes {
+		ttbResult, err := results[i].TTB, results[i].Err
+		if err != nil {
+			slog.ErrorContext(ctx, "api: ComputeTTB failed", "asset", asset.AssetID, "err", err)
+			continue
+		}
+		if err := gs.UpdateAssetTTBAndHash(persistCtx, asset.AssetID, ttbResult.TTB, tasks[i].Hash); err != nil {
+			slog.ErrorContext(ctx, "api: UpdateAssetTTBAndHash failed", "asset", asset.AssetID, "err", err)
+			continue
+		}
+		freshTTBs[asset.AssetID] = ttbResult.TTB
+		recalculatedAssets = append(recalculatedAssets, asset.AssetID)
+		metrics.AssetsRecalculated.Inc("path")
+		slog.InfoContext(ctx, "api: path-scoped recalc", "asset", asset.AssetID,
+			"ttb_before", asset.CurrentTTB, "ttb_after", ttbResult.TTB)
+	}
+	// Decrement stale_count to reflect path-scoped recalculations (UI-REQ-112A)
+	if len(recalculatedAssets) > 0 {
+		gs.DecrementStaleCount(persistCtx, len(recalculatedAssets))
+	}
+	return recalculatedAssets, freshTTBs
+}
+
+// shortestPaths loads the topology once, refreshes stale intermediates that
+// can lie on a path within maxHops, and returns the k paths with the lowest
+// sum of intermediate TTB. Entry and target TTB are position-aware and equal
+// for every path (ALG-REQ-051), so they do not affect the ranking and are
+// added by the caller. Cost no longer depends on the raw path count. With
+// weighted selection the region's intermediates are ranked by their
+// expected TTB, computed per request, whose distributions are returned too.
+func shortestPaths(ctx context.Context, gs graphstore.GraphStore, ttbExec *ttbexec.Executor, chains *nebula.ChainAssignments, fromID, toID string, maxHops, k int, ttbParams nebula.TTBParams,
+	auditBuf *store.AuditBuffer) ([]nebula.PathResult, []string, map[string]float64, []graph.TTBDistribution, time.Duration, error) {
+
+	topo, err := gs.QueryTopology(ctx)
+	if err != nil {
+		return nil, nil, nil, nil, 0, err
+	}
+
+	region := graph.PathRegion(topo.Adjacency, fromID, toID, maxHops)
+	var staleIDs []string
+	for id := range region {
+		if id != fromID && id != toID && !topo.HashValid[id] {
+			staleIDs = append(staleIDs, id)
+		}
+	}
+	sort.Strings(staleIDs)
+
+	var recalculatedAssets []string
+	var recalcDuration time.Duration
+	if len(staleIDs) > 0 {
+		recalcStart := time.Now()
+		var recalculated map[string]float64
+		recalculatedAssets, recalculated = recalcStaleIntermediates(ctx, gs, ttbExec, chains, staleIDs, ttbParams, auditBuf)
+		for id, ttb := range recalculated {
+			topo.TTB[id] = ttb
+		}
+		recalcDuration = time.Since(recalcStart)
+	}
+
+	var distributions []graph.TTBDistribution
+	if ttbParams.Weighted() {
+		weightedStart := time.Now()
+		var intermediates []string
+		for id := range region {
+			if id != fromID && id != toID {
+				intermediates = append(intermediates, id)
+			}
+		}
+		sort.Strings(intermediates)
+		var weighted map[string]float64
+		weighted, distributions = weightedIntermediates(ctx, gs, ttbExec, chains, intermediates, ttbParams, auditBuf)
+		for id, ttb := range weighted {
+			topo.TTB[id] = ttb
+		}
+		recalcDuration += time.Since(weightedStart)
+	}
+
+	weight := func(id string) float64 {
+		if id == fromID || id == toID {
+			return 0
+		}
+		if ttb, ok := topo.TTB[id]; ok {
+			return ttb
+		}
+		return 10.0
+	}
+	found := graph.KShortestPaths(topo.Adjacency, weight, fromID, toID, k, maxHops)
+
+	pathResults := make([]nebula.PathResult, 0, len(found))
+	for _, p := range found {
+		ttbs := make([]float64, len(p.Nodes))
+		for i, id := range p.Nodes {
+			ttbs[i] = topo.TTB[id]
+		}
+		pathResults = append(pathResults, nebula.PathResult{IDs: p.Nodes, TTBs: ttbs})
+	}
+
+	slog.DebugContext(ctx, "api: shortest mode search", "paths", len(pathResults), "k", k, "from", fromID,
+		"to", toID, "region", len(region))
+	return pathResults, recalculatedAssets, topo.TTB, distributions, recalcDuration, nil
 }
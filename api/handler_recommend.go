@@ -0,0 +1,214 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"ESP-data/config"
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/recommend"
+)
+
+// ============================================================
+// Mitigation recommender (ALG-REQ-060 planning) — read-only
+// ============================================================
+
+// Recommender request limits.
+const (
+	maxRecommendPairs       = 400
+	maxRecommendMitigations = 20
+)
+
+// RecommendRequest is the JSON body for POST /api/recommend. Pairs, or
+// else Entries × Targets, select the pairs; all three empty means every
+// is_entrance × is_target combination. Maturities default to {100}.
+type RecommendRequest struct {
+	Pairs      []recommend.Pair `json:"pairs"`
+	Entries    []string         `json:"entries"`
+	Targets    []string         `json:"targets"`
+	Hops       int              `json:"hops"`
+	Budget     recommend.Budget `json:"budget"`
+	Maturities []int            `json:"maturities"`
+	Strategy   string           `json:"strategy"`
+}
+
+// RecommendHandler returns a ranked plan of applied_to additions that raises
+// the minimum TTA over the selected pairs within the budget. Every candidate
+// is scored with GraphStore.SimulateTTB, so the graph is never modified.
+// TTB overrides are read from the query string as for /api/paths.
+func RecommendHandler(gs graphstore.GraphStore, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestStart := time.Now()
+		ctx := r.Context()
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req RecommendRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.Hops == 0 {
+			req.Hops = 6
+		}
+		if req.Hops < 2 || req.Hops > 9 {
+			http.Error(w, "hops must be an integer between 2 and 9", http.StatusBadRequest)
+			return
+		}
+		if req.Strategy == "" {
+			req.Strategy = recommend.StrategyGreedy
+		}
+		if req.Strategy != recommend.StrategyGreedy && req.Strategy != recommend.StrategyExact {
+			http.Error(w, fmt.Sprintf("strategy must be %q or %q", recommend.StrategyGreedy, recommend.StrategyExact), http.StatusBadRequest)
+			return
+		}
+
+		b := req.Budget
+		if b.MaxMitigations <= 0 && b.MaxCost <= 0 {
+			http.Error(w, "budget needs max_mitigations or max_cost", http.StatusBadRequest)
+			return
+		}
+		if b.MaxMitigations < 0 || b.MaxMitigations > maxRecommendMitigations {
+			http.Error(w, fmt.Sprintf("max_mitigations must be between 1 and %d", maxRecommendMitigations), http.StatusBadRequest)
+			return
+		}
+		if b.MaxCost < 0 {
+			http.Error(w, "max_cost must not be negative", http.StatusBadRequest)
+			return
+		}
+		if b.MaxMitigations == 0 {
+			// A cost-only budget still needs a step bound.
+			b.MaxMitigations = maxRecommendMitigations
+		}
+		for id, c := range b.Costs {
+			if !validMitigationID.MatchString(id) {
+				http.Error(w, fmt.Sprintf("Invalid mitigation ID format in costs: %q", id), http.StatusBadRequest)
+				return
+			}
+			if c <= 0 {
+				http.Error(w, fmt.Sprintf("cost of %s must be positive", id), http.StatusBadRequest)
+				return
+			}
+		}
+		req.Budget = b
+
+		if len(req.Maturities) == 0 {
+			req.Maturities = []int{100}
+		}
+		for _, m := range req.Maturities {
+			if !validMaturity[m] {
+				http.Error(w, fmt.Sprintf("Invalid maturity value: %d (allowed: 25, 50, 80, 100)", m), http.StatusBadRequest)
+				return
+			}
+		}
+		sort.Ints(req.Maturities)
+
+		pairs, status, err := recommendPairs(ctx, gs, req)
+		if requestAborted(w, r) {
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		ttbParams := ttbParamsFromQuery(r, cfg)
+		slog.DebugContext(ctx, "api: POST /api/recommend request", "pairs", len(pairs), "hops", req.Hops, "strategy", req.Strategy,
+			"max_mitigations", req.Budget.MaxMitigations, "max_cost", req.Budget.MaxCost, "maturities", req.Maturities)
+
+		plan, err := recommend.Recommend(ctx, gs, recommend.Request{
+			Pairs:      pairs,
+			MaxHops:    req.Hops,
+			Budget:     req.Budget,
+			Maturities: req.Maturities,
+			Strategy:   req.Strategy,
+			Params:     ttbParams,
+			Chains:     chainAssignments(ctx, gs),
+		})
+		if requestAborted(w, r) {
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "api: Recommend failed", "err", err)
+			if errors.Is(err, recommend.ErrNoPaths) {
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				return
+			}
+			http.Error(w, "Failed to compute recommendation: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(plan); err != nil {
+			slog.ErrorContext(ctx, "api: JSON encode failed", "err", err)
+		}
+
+		requestDuration := time.Since(requestStart)
+		slog.InfoContext(ctx, "api: returned recommendation", "steps", len(plan.Steps), "min_tta_before", plan.BaselineMinTTA,
+			"min_tta_after", plan.FinalMinTTA, "elapsed", requestDuration)
+	}
+}
+
+// recommendPairs resolves the pair selection of a RecommendRequest and
+// returns the HTTP status to use on error.
+func recommendPairs(ctx context.Context, gs graphstore.GraphStore, req RecommendRequest) ([]recommend.Pair, int, error) {
+	var pairs []recommend.Pair
+	if len(req.Pairs) > 0 {
+		seen := make(map[recommend.Pair]bool, len(req.Pairs))
+		for _, p := range req.Pairs {
+			if !validAssetID.MatchString(p.From) || !validAssetID.MatchString(p.To) {
+				return nil, http.StatusBadRequest, fmt.Errorf("Invalid pair: %q -> %q", p.From, p.To)
+			}
+			if p.From != p.To && !seen[p] {
+				seen[p] = true
+				pairs = append(pairs, p)
+			}
+		}
+	} else {
+		entries := req.Entries
+		targets := req.Targets
+		for _, id := range append(append([]string{}, entries...), targets...) {
+			if !validAssetID.MatchString(id) {
+				return nil, http.StatusBadRequest, fmt.Errorf("Invalid asset ID: %q", id)
+			}
+		}
+		if len(entries) == 0 {
+			items, err := gs.QueryEntryPoints(ctx)
+			if err != nil {
+				return nil, http.StatusInternalServerError, fmt.Errorf("Failed to query entry points")
+			}
+			entries = sortedAssetIDs(items)
+		}
+		if len(targets) == 0 {
+			items, err := gs.QueryTargets(ctx)
+			if err != nil {
+				return nil, http.StatusInternalServerError, fmt.Errorf("Failed to query targets")
+			}
+			targets = sortedAssetIDs(items)
+		}
+		for _, from := range entries {
+			for _, to := range targets {
+				if from != to {
+					pairs = append(pairs, recommend.Pair{From: from, To: to})
+				}
+			}
+		}
+	}
+	if len(pairs) == 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("no entry/target pairs selected")
+	}
+	if len(pairs) > maxRecommendPairs {
+		return nil, http.StatusBadRequest, fmt.Errorf("at most %d entry/target pairs per request", maxRecommendPairs)
+	}
+	return pairs, http.StatusOK, nil
+}
@@ -0,0 +1,347 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"ESP-data/config"
+	"ESP-data/internal/graph"
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/nebula"
+	"ESP-data/internal/ttbexec"
+)
+
+// ============================================================
+// Mitigation what-if simulation (REQ-035 what-if) — read-only
+// ============================================================
+
+// Simulation change actions.
+const (
+	simulateAdd    = "add"
+	simulateRemove = "remove"
+	simulateUpdate = "update"
+)
+
+// maxSimulateChanges bounds the number of changes per request.
+const maxSimulateChanges = 200
+
+// SimulateChangeRequest is one hypothetical applied_to change. For "add"
+// maturity is required and active defaults to true; for "update" omitted
+// fields keep the stored edge values; "remove" needs neither.
+type SimulateChangeRequest struct {
+	Action       string `json:"action"`
+	AssetID      string `json:"asset_id"`
+	MitigationID string `json:"mitigation_id"`
+	Maturity     *int   `json:"maturity"`
+	Active       *bool  `json:"active"`
+}
+
+// SimulateRequest is the JSON body for POST /api/simulate.
+type SimulateRequest struct {
+	From    string                  `json:"from"`
+	To      string                  `json:"to"`
+	Hops    int                     `json:"hops"`
+	Changes []SimulateChangeRequest `json:"changes"`
+}
+
+// SimulateHandler evaluates hypothetical applied_to changes for one
+// entry/target pair. Every asset on the paths gets a TTB before and after
+// the changes from the same position-aware chain (ALG-REQ-070), the "after"
+// TTB coming from GraphStore.SimulateTTB over a MitigationOverlay. Nothing
+// is written: applied_to edges, Asset.TTB, hashes and the audit trail stay
+// as they are. TTB overrides are read from the query string as for /api/paths.
+func SimulateHandler(gs graphstore.GraphStore, cfg *config.Config, ttbExec *ttbexec.Executor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestStart := time.Now()
+		ctx := r.Context()
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req SimulateRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !validAssetID.MatchString(req.From) {
+			http.Error(w, fmt.Sprintf("Invalid entry point ID: %q", req.From), http.StatusBadRequest)
+			return
+		}
+		if !validAssetID.MatchString(req.To) {
+			http.Error(w, fmt.Sprintf("Invalid target ID: %q", req.To), http.StatusBadRequest)
+			return
+		}
+		if req.Hops == 0 {
+			req.Hops = 6
+		}
+		if req.Hops < 2 || req.Hops > 9 {
+			http.Error(w, "hops must be an integer between 2 and 9", http.StatusBadRequest)
+			return
+		}
+		if len(req.Changes) == 0 || len(req.Changes) > maxSimulateChanges {
+			http.Error(w, fmt.Sprintf("changes must list between 1 and %d entries", maxSimulateChanges), http.StatusBadRequest)
+			return
+		}
+		ttbParams := ttbParamsFromQuery(r, cfg)
+
+		slog.DebugContext(ctx, "api: POST /api/simulate request", "from", req.From, "to", req.To, "hops", req.Hops, "changes", len(req.Changes),
+			"orientation_time", ttbParams.OrientationTime, "switchover_time", ttbParams.SwitchoverTime, "priority_tolerance", ttbParams.PriorityTolerance)
+
+		overlay, changes, err := buildMitigationOverlay(ctx, gs, req.Changes)
+		if requestAborted(w, r) {
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		pathResults, err := gs.QueryPaths(ctx, req.From, req.To, req.Hops)
+		if requestAborted(w, r) {
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "api: QueryPaths failed", "err", err)
+			http.Error(w, "Failed to calculate paths", http.StatusInternalServerError)
+			return
+		}
+
+		// Parallel connects_to edges repeat a host chain; keep one of each.
+		seenChain := make(map[string]bool, len(pathResults))
+		storedTTB := make(map[string]float64)
+		var chains [][]string
+		for _, p := range pathResults {
+			key := strings.Join(p.IDs, " -> ")
+			if seenChain[key] {
+				continue
+			}
+			seenChain[key] = true
+			chains = append(chains, p.IDs)
+			for j, id := range p.IDs {
+				if j < len(p.TTBs) {
+					storedTTB[id] = p.TTBs[j]
+				}
+			}
+		}
+
+		// Before and after TTB per asset and position (ALG-REQ-051)
+		tacticChains := chainAssignments(ctx, gs)
+		position := func(id string) (string, string) {
+			pos := nebula.PositionIntermediate
+			switch id {
+			case req.From:
+				pos = nebula.PositionEntrance
+			case req.To:
+				pos = nebula.PositionTarget
+			}
+			return pos, tacticChains.Chain(id, pos)
+		}
+		var tasks []ttbexec.Task
+		seen := make(map[string]bool)
+		for _, ids := range chains {
+			for _, id := range ids {
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+				pos, chainVID := position(id)
+				tasks = append(tasks, ttbexec.Task{AssetID: id, ChainVID: chainVID, Position: pos, Cached: true})
+			}
+		}
+		results := ttbExec.Run(ctx, gs, tasks, ttbParams, nil, nil)
+
+		before := make(map[string]float64)
+		after := make(map[string]float64)
+		var deltas []graph.AssetTTBDelta
+		for i, task := range tasks {
+			id, pos, chainVID := task.AssetID, task.Position, task.ChainVID
+			before[id], _ = positionTTB(ctx, task, results[i], storedTTB)
+			after[id] = before[id]
+			if _, touched := overlay[id]; !touched {
+				continue
+			}
+			result, err := gs.SimulateTTB(ctx, id, chainVID, ttbParams, overlay)
+			if err != nil {
+				slog.WarnContext(ctx, "api: SimulateTTB failed, keeping current TTB", "position", pos,
+					"asset", id, "err", err)
+			} else {
+				after[id] = result.TTB
+			}
+			deltas = append(deltas, graph.AssetTTBDelta{
+				AssetID:   id,
+				Position:  pos,
+				TTBBefore: before[id],
+				TTBAfter:  after[id],
+				Delta:     after[id] - before[id],
+			})
+		}
+		if requestAborted(w, r) {
+			return
+		}
+		sort.Slice(deltas, func(i, j int) bool { return deltas[i].AssetID < deltas[j].AssetID })
+
+		paths := make([]graph.SimulatedPath, 0, len(chains))
+		for _, ids := range chains {
+			var ttaBefore, ttaAfter float64
+			for _, id := range ids {
+				ttaBefore += before[id]
+				ttaAfter += after[id]
+			}
+			paths = append(paths, graph.SimulatedPath{
+				Hosts:     strings.Join(ids, " -> "),
+				TTABefore: ttaBefore,
+				TTAAfter:  ttaAfter,
+				Delta:     ttaAfter - ttaBefore,
+			})
+		}
+		sort.SliceStable(paths, func(i, j int) bool { return paths[i].TTAAfter < paths[j].TTAAfter })
+		for i := range paths {
+			paths[i].PathID = fmt.Sprintf("P%05d", i+1)
+		}
+
+		if deltas == nil {
+			deltas = []graph.AssetTTBDelta{}
+		}
+		response := graph.SimulationResponse{
+			EntryPoint:  req.From,
+			Target:      req.To,
+			Hops:        req.Hops,
+			Changes:     changes,
+			Paths:       paths,
+			AssetDeltas: deltas,
+			Total:       len(paths),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			slog.ErrorContext(ctx, "api: JSON encode failed", "err", err)
+		}
+
+		requestDuration := time.Since(requestStart)
+		slog.InfoContext(ctx, "api: returned simulation", "changes", len(changes), "paths", len(paths), "from", req.From, "to", req.To,
+			"assets_affected", len(deltas), "elapsed", requestDuration)
+	}
+}
+
+// buildMitigationOverlay validates the requested changes against the stored
+// applied_to edges (REQ-038, REQ-039) and folds them, in order, into a
+// MitigationOverlay.
+func buildMitigationOverlay(ctx context.Context, gs graphstore.GraphStore, reqs []SimulateChangeRequest) (nebula.MitigationOverlay, []graph.SimulatedChange, error) {
+	catalog, err := gs.QueryMitigations(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query mitigations: %v", err)
+	}
+	known := make(map[string]bool, len(catalog))
+	for _, m := range catalog {
+		if id, ok := m["mitigation_id"].(string); ok {
+			known[id] = true
+		}
+	}
+
+	// Edge states per asset, loaded once and then updated by each change.
+	edges := make(map[string]map[string]*nebula.AppliedState)
+	current := func(assetID string) (map[string]*nebula.AppliedState, error) {
+		if e, ok := edges[assetID]; ok {
+			return e, nil
+		}
+		stored, err := gs.QueryAssetMitigations(ctx, assetID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query mitigations of %s: %v", assetID, err)
+		}
+		e := make(map[string]*nebula.AppliedState, len(stored))
+		for _, m := range stored {
+			id, _ := m["mitigation_id"].(string)
+			maturity, _ := m["maturity"].(int)
+			active, _ := m["active"].(bool)
+			e[id] = &nebula.AppliedState{Maturity: maturity, Active: active}
+		}
+		edges[assetID] = e
+		return e, nil
+	}
+
+	overlay := make(nebula.MitigationOverlay)
+	changes := make([]graph.SimulatedChange, 0, len(reqs))
+	for i, c := range reqs {
+		if !validAssetID.MatchString(c.AssetID) {
+			return nil, nil, fmt.Errorf("change %d: invalid asset ID %q", i+1, c.AssetID)
+		}
+		if !validMitigationID.MatchString(c.MitigationID) {
+			return nil, nil, fmt.Errorf("change %d: invalid mitigation ID format %q (expected pattern like M1020)", i+1, c.MitigationID)
+		}
+		if !known[c.MitigationID] {
+			return nil, nil, fmt.Errorf("change %d: mitigation %s not found", i+1, c.MitigationID)
+		}
+		if c.Maturity != nil && !validMaturity[*c.Maturity] {
+			return nil, nil, fmt.Errorf("change %d: invalid maturity value %d (allowed: 25, 50, 80, 100)", i+1, *c.Maturity)
+		}
+
+		assetEdges, err := current(c.AssetID)
+		if err != nil {
+			return nil, nil, err
+		}
+		old := assetEdges[c.MitigationID]
+
+		var next *nebula.AppliedState
+		switch c.Action {
+		case simulateAdd:
+			if c.Maturity == nil {
+				return nil, nil, fmt.Errorf("change %d: add requires maturity", i+1)
+			}
+			next = &nebula.AppliedState{Maturity: *c.Maturity, Active: true}
+			if c.Active != nil {
+				next.Active = *c.Active
+			}
+		case simulateUpdate:
+			if old == nil {
+				return nil, nil, fmt.Errorf("change %d: %s is not applied to %s", i+1, c.MitigationID, c.AssetID)
+			}
+			next = &nebula.AppliedState{Maturity: old.Maturity, Active: old.Active}
+			if c.Maturity != nil {
+				next.Maturity = *c.Maturity
+			}
+			if c.Active != nil {
+				next.Active = *c.Active
+			}
+		case simulateRemove:
+			if old == nil {
+				return nil, nil, fmt.Errorf("change %d: %s is not applied to %s", i+1, c.MitigationID, c.AssetID)
+			}
+		default:
+			return nil, nil, fmt.Errorf("change %d: action must be %q, %q or %q", i+1, simulateAdd, simulateUpdate, simulateRemove)
+		}
+
+		if next == nil {
+			delete(assetEdges, c.MitigationID)
+		} else {
+			assetEdges[c.MitigationID] = next
+		}
+		if overlay[c.AssetID] == nil {
+			overlay[c.AssetID] = make(map[string]*nebula.AppliedState)
+		}
+		overlay[c.AssetID][c.MitigationID] = next
+
+		changes = append(changes, graph.SimulatedChange{
+			Action:       c.Action,
+			AssetID:      c.AssetID,
+			MitigationID: c.MitigationID,
+			Before:       edgeState(old),
+			After:        edgeState(next),
+		})
+	}
+	return overlay, changes, nil
+}
+
+func edgeState(s *nebula.AppliedState) *graph.SimulatedEdgeState {
+	if s == nil {
+		return nil
+	}
+	return &graph.SimulatedEdgeState{Maturity: s.Maturity, Active: s.Active}
+}
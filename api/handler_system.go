@@ -1,115 +1,183 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"ESP-data/config"
 	"ESP-data/internal/graph"
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/jobs"
+	"ESP-data/internal/metrics"
 	"ESP-data/internal/nebula"
-
-	nebulago "github.com/vesoft-inc/nebula-go/v3"
+	"ESP-data/internal/ttbexec"
 )
 
 // ============================================================
 // Hash and TTB recalculation handlers (REQ-040, REQ-041)
 // ============================================================
 
-// RecalculateTTBHandler triggers bulk TTB recalculation for stale assets
-// (REQ-040, ALG-REQ-045, ALG-REQ-070).
-func RecalculateTTBHandler(pool *nebulago.ConnectionPool, cfg *config.Config) http.HandlerFunc {
+// recalculateTTBJob is the job kind of bulk TTB recalculation; only one runs
+// at a time.
+const recalculateTTBJob = "recalculate-ttb"
+
+// RecalculateTTBHandler starts bulk TTB recalculation for stale assets as a
+// background job (REQ-040, ALG-REQ-045, ALG-REQ-070) and returns 202 with the
+// job ID. Progress is read from /api/jobs/{id} and /api/jobs/{id}/events.
+// While a recalculation runs, it returns 409 with the running job's ID.
+func RecalculateTTBHandler(gs graphstore.GraphStore, cfg *config.Config, jobMgr *jobs.Manager, ttbExec *ttbexec.Executor) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		requestStart := time.Now()
-		log.Printf("[%s] api: POST /api/recalculate-ttb request", requestStart.Format("15:04:05.000"))
+		slog.DebugContext(r.Context(), "api: POST /api/recalculate-ttb request")
+
+		job, err := jobMgr.Start(r.Context(), recalculateTTBJob, func(ctx context.Context, j *jobs.Job) (interface{}, error) {
+			response, err := recalculateStaleTTBs(ctx, gs, cfg, ttbExec, j)
+			if response == nil {
+				return nil, err
+			}
+			return response, err
+		})
 
-		staleAssets, err := nebula.QueryStaleHashes(pool, cfg)
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, jobs.ErrBusy) {
+			slog.InfoContext(r.Context(), "api: recalculation already running", "job", job.ID)
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error":  "A TTB recalculation is already running",
+				"job_id": job.ID,
+			})
+			return
+		}
 		if err != nil {
-			log.Printf("[%s] api: QueryStaleHashes failed: %v", time.Now().Format("15:04:05.000"), err)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to compute hashes"})
+			slog.WarnContext(r.Context(), "api: recalculation not started", "err", err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Server is shutting down"})
 			return
 		}
 
-		ttbParams := nebula.TTBParams{
-			OrientationTime:   cfg.OrientationTime,
-			SwitchoverTime:    cfg.SwitchoverTime,
-			PriorityTolerance: cfg.PriorityTolerance,
+		statusURL := "/api/jobs/" + job.ID
+		w.Header().Set("Location", statusURL)
+		w.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(w).Encode(map[string]string{
+			"job_id":     job.ID,
+			"status_url": statusURL,
+			"events_url": statusURL + "/events",
+		}); err != nil {
+			slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
 		}
+	}
+}
 
-		recalculated := 0
-		for _, asset := range staleAssets {
-			hashStr := fmt.Sprintf("%d", asset.ComputedHash)
-			if hashStr == asset.StoredHash {
-				if err := nebula.UpdateAssetTTBAndHash(pool, cfg, asset.AssetID, asset.CurrentTTB, hashStr); err != nil {
-					log.Printf("[%s] api: UpdateAssetTTBAndHash (unchanged) failed for %s: %v",
-						time.Now().Format("15:04:05.000"), asset.AssetID, err)
-				}
-				continue
-			}
+// recalculateStaleTTBs recomputes, on the TTB executor, the TTB of every
+// asset whose hash changed, persisting and reporting each asset to j as it
+// completes, then refreshes SystemState. On cancellation no further assets
+// start and running computations stop at their next tactic; SystemState is
+// still refreshed for the assets already written and the partial result is
+// returned with ctx.Err().
+func recalculateStaleTTBs(ctx context.Context, gs graphstore.GraphStore, cfg *config.Config, ttbExec *ttbexec.Executor, j *jobs.Job) (*graph.RecalculateResponse, error) {
+	staleAssets, err := gs.QueryStaleHashes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute hashes: %w", err)
+	}
+	j.SetTotal(len(staleAssets))
 
-			// ALG-REQ-070: real TTB computation replaces stub
-			chainVID := nebula.ChainVIDForPosition(1, 3) // default intermediate
-			ttbResult, err := nebula.ComputeTTB(pool, cfg, asset.AssetID, chainVID, ttbParams, nil)
-			if err != nil {
-				log.Printf("[%s] api: ComputeTTB failed for %s: %v",
-					time.Now().Format("15:04:05.000"), asset.AssetID, err)
-				continue
-			}
+	ttbParams := nebula.TTBParams{
+		OrientationTime:   cfg.OrientationTime,
+		SwitchoverTime:    cfg.SwitchoverTime,
+		PriorityTolerance: cfg.PriorityTolerance,
+	}
+
+	chains := chainAssignments(ctx, gs)
 
-			if err := nebula.UpdateAssetTTBAndHash(pool, cfg, asset.AssetID, ttbResult.TTB, hashStr); err != nil {
-				log.Printf("[%s] api: UpdateAssetTTBAndHash failed for %s: %v",
-					time.Now().Format("15:04:05.000"), asset.AssetID, err)
-				continue
+	// Writes of completed work must land even after cancellation.
+	persistCtx := context.WithoutCancel(ctx)
+
+	response := &graph.RecalculateResponse{}
+	var tasks []ttbexec.Task
+	var changed []nebula.StaleAssetHash
+	for _, asset := range staleAssets {
+		hashStr := fmt.Sprintf("%d", asset.ComputedHash)
+		if hashStr == asset.StoredHash {
+			if err := gs.UpdateAssetTTBAndHash(persistCtx, asset.AssetID, asset.CurrentTTB, hashStr); err != nil {
+				slog.ErrorContext(ctx, "api: UpdateAssetTTBAndHash (unchanged) failed",
+					"asset", asset.AssetID, "err", err)
 			}
-			recalculated++
-			log.Printf("[%s] api: recalculated TTB for %s: %.4f -> %.4f (%d log entries)",
-				time.Now().Format("15:04:05.000"), asset.AssetID, asset.CurrentTTB, ttbResult.TTB, len(ttbResult.Log))
+			response.Unchanged++
+			ttb := asset.CurrentTTB
+			j.Report(asset.AssetID, jobs.StatusUnchanged, &ttb, nil)
+			continue
 		}
 
-		merkleRoot, totalAssets, err := nebula.ComputeMerkleRoot(pool, cfg)
-		if err != nil {
-			log.Printf("[%s] api: ComputeMerkleRoot failed: %v", time.Now().Format("15:04:05.000"), err)
-		}
-		if err := nebula.UpdateSystemState(pool, cfg, merkleRoot, totalAssets); err != nil {
-			log.Printf("[%s] api: UpdateSystemState failed: %v", time.Now().Format("15:04:05.000"), err)
-		}
+		// ALG-REQ-070: real TTB computation replaces stub
+		tasks = append(tasks, ttbexec.Task{
+			AssetID:  asset.AssetID,
+			ChainVID: chains.Chain(asset.AssetID, nebula.PositionIntermediate),
+			Position: nebula.PositionIntermediate,
+			Hash:     hashStr,
+		})
+		changed = append(changed, asset)
+	}
 
-		response := graph.RecalculateResponse{
-			Recalculated: recalculated,
-			Unchanged:    len(staleAssets) - recalculated,
-			Total:        totalAssets,
-			MerkleRoot:   fmt.Sprintf("%d", merkleRoot),
+	ttbExec.Run(ctx, gs, tasks, ttbParams, nil, func(i int, r ttbexec.Result) {
+		asset := changed[i]
+		if ctx.Err() != nil && errors.Is(r.Err, ctx.Err()) {
+			// Interrupted by cancellation: neither failed nor recalculated.
+			return
 		}
-
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(response); err != nil {
-			log.Printf("[%s] api: JSON encode failed: %v", time.Now().Format("15:04:05.000"), err)
+		if r.Err != nil {
+			slog.ErrorContext(ctx, "api: ComputeTTB failed", "asset", asset.AssetID, "err", r.Err)
+			response.Failed++
+			j.Report(asset.AssetID, jobs.StatusFailed, nil, r.Err)
+			return
 		}
 
-		requestDuration := time.Since(requestStart)
-		log.Printf("[%s] api: recalculated %d/%d assets in %.3f seconds",
-			time.Now().Format("15:04:05.000"), recalculated, len(staleAssets), requestDuration.Seconds())
+		if err := gs.UpdateAssetTTBAndHash(persistCtx, asset.AssetID, r.TTB.TTB, tasks[i].Hash); err != nil {
+			slog.ErrorContext(ctx, "api: UpdateAssetTTBAndHash failed", "asset", asset.AssetID, "err", err)
+			response.Failed++
+			j.Report(asset.AssetID, jobs.StatusFailed, nil, err)
+			return
+		}
+		response.Recalculated++
+		metrics.AssetsRecalculated.Inc("bulk")
+		ttb := r.TTB.TTB
+		j.Report(asset.AssetID, jobs.StatusRecalculated, &ttb, nil)
+		slog.DebugContext(ctx, "api: recalculated TTB", "asset", asset.AssetID,
+			"ttb_before", asset.CurrentTTB, "ttb_after", r.TTB.TTB, "log_entries", len(r.TTB.Log))
+	})
+
+	merkleRoot, totalAssets, err := gs.ComputeMerkleRoot(persistCtx)
+	if err != nil {
+		slog.ErrorContext(ctx, "api: ComputeMerkleRoot failed", "err", err)
+	}
+	if err := gs.UpdateSystemState(persistCtx, merkleRoot, totalAssets); err != nil {
+		slog.ErrorContext(ctx, "api: UpdateSystemState failed", "err", err)
 	}
+	response.Total = totalAssets
+	response.MerkleRoot = fmt.Sprintf("%d", merkleRoot)
+
+	slog.InfoContext(ctx, "api: recalculation completed", "recalculated", response.Recalculated,
+		"stale", len(staleAssets), "failed", response.Failed)
+	return response, ctx.Err()
 }
 
 // SystemStateHandler returns the current SystemState (REQ-041, ALG-REQ-048).
-func SystemStateHandler(pool *nebulago.ConnectionPool, cfg *config.Config) http.HandlerFunc {
+func SystemStateHandler(gs graphstore.GraphStore, cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		requestStart := time.Now()
-		log.Printf("[%s] api: GET /api/system-state request", requestStart.Format("15:04:05.000"))
+		slog.DebugContext(r.Context(), "api: GET /api/system-state request")
 
-		data, err := nebula.QuerySystemState(pool, cfg)
+		data, err := gs.QuerySystemState(r.Context())
 		if err != nil {
-			log.Printf("[%s] api: QuerySystemState failed: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(r.Context(), "api: QuerySystemState failed", "err", err)
 			http.Error(w, "Failed to query system state", http.StatusInternalServerError)
 			return
 		}
@@ -118,11 +186,10 @@ func SystemStateHandler(pool *nebulago.ConnectionPool, cfg *config.Config) http.
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(response); err != nil {
-			log.Printf("[%s] api: JSON encode failed: %v", time.Now().Format("15:04:05.000"), err)
+			slog.ErrorContext(r.Context(), "api: JSON encode failed", "err", err)
 		}
 
 		requestDuration := time.Since(requestStart)
-		log.Printf("[%s] api: returned system state in %.3f seconds",
-			time.Now().Format("15:04:05.000"), requestDuration.Seconds())
+		slog.InfoContext(r.Context(), "api: returned system state", "elapsed", requestDuration)
 	}
 }
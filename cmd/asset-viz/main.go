@@ -1,85 +1,182 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"ESP-data/api"
 	"ESP-data/config"
+	"ESP-data/internal/graph"
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/jobs"
+	"ESP-data/internal/metrics"
 	"ESP-data/internal/nebula"
 	"ESP-data/internal/store"
+	"ESP-data/internal/ttbcache"
+	"ESP-data/internal/ttbexec"
 )
 
 func main() {
 	// Load configuration from environment variables (REQ-002, ADR-REQ-002)
 	cfg := config.Load()
 
-	// Initialize Nebula connection pool (REQ-121)
-	pool := nebula.NewPool(cfg)
-	defer pool.Close()
+	// Initialize the graph backend — Nebula connection pool (REQ-121) or in-memory store.
+	// An unreachable Nebula does not stop startup; the pool connects on first use.
+	gs, closeGraph, err := graphstore.New(cfg)
+	if err != nil {
+		slog.Error("graphstore: backend unavailable", "err", err)
+		os.Exit(1)
+	}
 
 	// Initialize MariaDB store (ADR-REQ-003, ADR-REQ-081)
-	// Graceful degradation: if disabled or connection fails, auditStore is nil (ADR-REQ-033)
+	// Graceful degradation: if disabled or the store cannot be set up, auditStore is nil (ADR-REQ-033);
+	// an unreachable MariaDB is retried in the background by the store itself
 	var auditStore *store.Store
 	if cfg.MariaEnabled {
-		var err error
-		auditStore, err = store.New(cfg.MariaHost, cfg.MariaPort, cfg.MariaUser, cfg.MariaPass, cfg.MariaDB)
+		auditStore, err = store.New(context.Background(), cfg.MariaHost, cfg.MariaPort, cfg.MariaUser, cfg.MariaPass, cfg.MariaDB,
+			store.QueueConfig{
+				Size:        cfg.AuditQueueSize,
+				MaxAttempts: cfg.AuditMaxAttempts,
+				JournalPath: cfg.AuditJournalPath,
+			})
 		if err != nil {
-			log.Printf("WARNING: MariaDB store unavailable — audit/cache disabled: %v", err)
+			slog.Warn("store: MariaDB unavailable — audit/cache disabled", "err", err)
 			auditStore = nil
-		} else {
-			defer auditStore.Close()
 		}
 	} else {
-		log.Printf("store: MariaDB disabled (MARIA_ENABLED=false)")
+		slog.Info("store: MariaDB disabled (MARIA_ENABLED=false)")
 	}
 
 	// Log store status for operator awareness
 	if auditStore != nil && auditStore.Enabled() {
-		log.Printf("store: audit trail and TTB cache active")
+		slog.Info("store: audit trail and TTB cache active")
 	} else {
-		log.Printf("store: running without RDBMS — no audit trail or TTB cache")
+		slog.Info("store: running without RDBMS — no audit trail or TTB cache")
+	}
+
+	// Entry/target TTB cache: in-process LRU in front of asset_ttb_cache (ALG-REQ-053)
+	ttbCache := ttbcache.New(cfg.TTBCacheSize, auditStore, nebula.TTBParams{
+		OrientationTime:   cfg.OrientationTime,
+		SwitchoverTime:    cfg.SwitchoverTime,
+		PriorityTolerance: cfg.PriorityTolerance,
+	})
+
+	// Cached TTBs are keyed by asset hash, which an ATT&CK release does not
+	// change: drop them when the MITRE snapshot reloads with a new version.
+	if ns, ok := gs.(*graphstore.NebulaStore); ok {
+		ns.OnMitreVersionChange(func(ctx context.Context, version string) {
+			slog.InfoContext(ctx, "ttbcache: MITRE version changed", "version", version)
+			ttbCache.Purge(ctx)
+		})
 	}
 
+	// Parallel TTB computation, at most cfg.TTBWorkers at a time across all requests
+	ttbExec := ttbexec.New(cfg.TTBWorkers, ttbCache)
+
+	// Background jobs: bulk TTB recalculation runs outside the request (REQ-040)
+	jobMgr := jobs.NewManager()
+
 	// Register API endpoints
 
 	// REQ-020: Enriched graph data for Cytoscape visualization
-	http.HandleFunc("/api/graph", api.GraphHandler(pool, cfg))
+	http.HandleFunc("/api/graph", api.GraphHandler(gs, cfg))
 
 	// REQ-021: Asset list for sidebar entity browser
-	http.HandleFunc("/api/assets", api.AssetsHandler(pool, cfg))
+	http.HandleFunc("/api/assets", api.AssetsHandler(gs, cfg))
 
 	// REQ-022: Single asset detail for inspector panel
 	// REQ-034 (GET), REQ-035 (PUT), REQ-036 (DELETE): Asset mitigations CRUD
+	// Detection controls deployed on the asset (/api/asset/{id}/detections)
+	// Tactic chain per position under the chain rules (/api/asset/{id}/chains)
+	// ADR-REQ-052: Cached TTB breakdown (/api/asset/{id}/ttb-detail)
 	// AssetHandler dispatches based on URL path depth and HTTP method
-	http.HandleFunc("/api/asset/", api.AssetHandler(pool, cfg, auditStore))
+	http.HandleFunc("/api/asset/", api.AssetHandler(gs, cfg, auditStore))
 
 	// REQ-023: Neighbor list for inspector connections summary
-	http.HandleFunc("/api/neighbors/", api.NeighborsHandler(pool, cfg))
+	http.HandleFunc("/api/neighbors/", api.NeighborsHandler(gs, cfg))
 
 	// REQ-024: Asset types for filter checkboxes
-	http.HandleFunc("/api/asset-types", api.AssetTypesHandler(pool, cfg))
+	http.HandleFunc("/api/asset-types", api.AssetTypesHandler(gs, cfg))
 
 	// REQ-026: Edge connections for edge inspector panel
-	http.HandleFunc("/api/edges/", api.EdgesHandler(pool, cfg))
+	http.HandleFunc("/api/edges/", api.EdgesHandler(gs, cfg))
 
 	// REQ-029: Path calculation for Path Inspector
-	http.HandleFunc("/api/paths", api.PathsHandler(pool, cfg, auditStore))
+	http.HandleFunc("/api/paths", api.PathsHandler(gs, cfg, auditStore, ttbExec))
+
+	// Attack matrix: min TTA per (entry, target) pair (ALG-REQ-001 matrix)
+	http.HandleFunc("/api/paths/matrix", api.PathMatrixHandler(gs, cfg, ttbExec))
+
+	// Mitigation what-if: TTA before/after hypothetical applied_to changes, read-only
+	http.HandleFunc("/api/simulate", api.SimulateHandler(gs, cfg, ttbExec))
+
+	// Mitigation recommender: budget-constrained plan maximising min TTA, read-only
+	http.HandleFunc("/api/recommend", api.RecommendHandler(gs, cfg))
+
+	// ADR-REQ-050, ADR-REQ-051: audit trail reads
+	http.HandleFunc("/api/path-detail", api.PathDetailHandler(gs, cfg, auditStore))
+	http.HandleFunc("/api/calc-history", api.CalcHistoryHandler(gs, cfg, auditStore))
 
 	// REQ-030: Entry points for Path Inspector dropdown
-	http.HandleFunc("/api/entry-points", api.EntryPointsHandler(pool, cfg))
+	http.HandleFunc("/api/entry-points", api.EntryPointsHandler(gs, cfg))
 
 	// REQ-031: Targets for Path Inspector dropdown
-	http.HandleFunc("/api/targets", api.TargetsHandler(pool, cfg))
+	http.HandleFunc("/api/targets", api.TargetsHandler(gs, cfg))
 
 	// REQ-033: All MITRE mitigations for editor dropdown
-	http.HandleFunc("/api/mitigations", api.MitigationsListHandler(pool, cfg))
+	http.HandleFunc("/api/mitigations", api.MitigationsListHandler(gs, cfg))
+
+	// Detection controls with per-technique coverage, for time-to-detect on /api/paths
+	http.HandleFunc("/api/detection-controls", api.DetectionControlsHandler(gs, cfg))
+	http.HandleFunc("/api/detection-controls/", api.DetectionControlsHandler(gs, cfg))
+
+	// Tactic chains and the rules selecting an asset's chain per position (ALG-REQ-051)
+	http.HandleFunc("/api/tactic-chains", api.TacticChainsHandler(gs, cfg, ttbCache))
+	http.HandleFunc("/api/tactic-chains/", api.TacticChainsHandler(gs, cfg, ttbCache))
+	http.HandleFunc("/api/chain-rules", api.ChainRulesHandler(gs, cfg, ttbCache))
+	http.HandleFunc("/api/chain-rules/", api.ChainRulesHandler(gs, cfg, ttbCache))
 
-	// REQ-040: Bulk TTB recalculation
-	http.HandleFunc("/api/recalculate-ttb", api.RecalculateTTBHandler(pool, cfg))
+	// REQ-040: Bulk TTB recalculation as a background job, with progress and cancellation
+	http.HandleFunc("/api/recalculate-ttb", api.RecalculateTTBHandler(gs, cfg, jobMgr, ttbExec))
+	http.HandleFunc("/api/jobs/", api.JobsHandler(jobMgr))
 
 	// REQ-041: SystemState for UI badge
-	http.HandleFunc("/api/system-state", api.SystemStateHandler(pool, cfg))
+	http.HandleFunc("/api/system-state", api.SystemStateHandler(gs, cfg))
+
+	// Prometheus metrics: nGQL and HTTP latency, TTB computations, cache hit rates.
+	// stale_count is read from SystemState on each scrape (ALG-REQ-043), audit queue
+	// and journal depth from the store.
+	metrics.Default.NewGaugeFunc("esp_stale_count", "SystemState.stale_count: assets whose hash is invalid.",
+		func(ctx context.Context) (float64, error) {
+			data, err := gs.QuerySystemState(ctx)
+			if err != nil {
+				return 0, err
+			}
+			return float64(graph.BuildSystemStateResponse(data).StaleCount), nil
+		})
+	if auditStore.Enabled() {
+		metrics.Default.NewGaugeFunc("esp_audit_queue_depth", "Audit batches waiting in the write-behind queue.",
+			func(ctx context.Context) (float64, error) { return float64(auditStore.QueueDepth()), nil })
+		metrics.Default.NewGaugeFunc("esp_audit_journal_depth", "Audit batches waiting in the spill journal.",
+			func(ctx context.Context) (float64, error) { return float64(auditStore.JournalDepth()), nil })
+	}
+	http.Handle("/metrics", metrics.Default.Handler())
+
+	// Liveness and readiness probes: graph session + USE space, SystemState SYS001, MariaDB ping
+	http.HandleFunc("/healthz", api.HealthzHandler())
+	http.HandleFunc("/readyz", api.ReadyzHandler(gs, cfg, auditStore))
+
+	// Network topology import (sources/network1.csv → connects_to)
+	http.HandleFunc("/api/import/network", api.ImportNetworkHandler(gs, cfg))
+
+	// Asset inventory import (sources/assets.xlsx → Asset, has_type, belongs_to, runs_on)
+	http.HandleFunc("/api/import/assets", api.ImportAssetsHandler(gs, cfg))
 
 	// Serve static files (HTML, CSS, JS) from /static directory
 	// This serves the VIS layer (REQ-123, UI-Requirements.MD)
@@ -87,24 +184,95 @@ func main() {
 
 	// Start HTTP server (REQ-130)
 	addr := ":8080"
-	log.Printf("ESP PoC starting on %s", addr)
-	log.Printf("Configured Nebula: %s:%d, Space: %s", cfg.NebulaHost, cfg.NebulaPort, cfg.Space)
-	log.Printf("API endpoints available:")
-	log.Printf("  GET /api/graph         - Graph nodes and edges (REQ-020)")
-	log.Printf("  GET /api/assets        - Asset list (REQ-021)")
-	log.Printf("  GET /api/asset/{id}    - Asset detail (REQ-022)")
-	log.Printf("  GET /api/neighbors/{id} - Neighbor list (REQ-023)")
-	log.Printf("  GET /api/asset-types   - Asset types (REQ-024)")
-	log.Printf("  GET /api/edges/{src}/{dst} - Edge connections (REQ-026)")
-	log.Printf("  GET /api/paths         - Path calculation (REQ-029)")
-	log.Printf("  GET /api/entry-points  - Entry points (REQ-030)")
-	log.Printf("  GET /api/targets       - Targets (REQ-031)")
-	log.Printf("  GET /api/mitigations   - All mitigations (REQ-033)")
-	log.Printf("  GET /api/asset/{id}/mitigations    - Asset mitigations (REQ-034)")
-	log.Printf("  PUT /api/asset/{id}/mitigations    - Upsert mitigation (REQ-035)")
-	log.Printf("  DELETE /api/asset/{id}/mitigations/{mid} - Delete mitigation (REQ-036)")
-	log.Printf("  POST /api/recalculate-ttb              - Bulk TTB recalculation (REQ-040)")
-	log.Printf("  GET /api/system-state                   - System state (REQ-041)")
-	log.Printf("Static files served from ./static/")
-	log.Fatal(http.ListenAndServe(addr, nil))
+	slog.Info("ESP PoC starting", "addr", addr)
+	if cfg.GraphBackend == graphstore.BackendMemory {
+		slog.Info("Configured graph: in-memory", "seed", cfg.GraphSeedFile)
+	} else {
+		slog.Info("Configured Nebula", "host", cfg.NebulaHost, "port", cfg.NebulaPort, "space", cfg.Space)
+	}
+	slog.Info("API endpoints available:")
+	slog.Info("  GET /api/graph         - Graph nodes and edges (REQ-020)")
+	slog.Info("  GET /api/assets        - Asset list (REQ-021)")
+	slog.Info("  GET /api/asset/{id}    - Asset detail (REQ-022)")
+	slog.Info("  GET /api/neighbors/{id} - Neighbor list (REQ-023)")
+	slog.Info("  GET /api/asset-types   - Asset types (REQ-024)")
+	slog.Info("  GET /api/edges/{src}/{dst} - Edge connections (REQ-026)")
+	slog.Info("  GET /api/paths         - Path calculation (REQ-029)")
+	slog.Info("  GET /api/paths/matrix  - Min TTA per entry/target pair")
+	slog.Info("  POST /api/simulate     - Mitigation what-if TTA (read-only)")
+	slog.Info("  POST /api/recommend    - Mitigation plan for max min-TTA (read-only)")
+	slog.Info("  GET /api/path-detail?session=&path= - Path TTB breakdown (ADR-REQ-050)")
+	slog.Info("  GET /api/calc-history?limit=        - Calculation history (ADR-REQ-051)")
+	slog.Info("  GET /api/asset/{id}/ttb-detail?position= - Cached TTB breakdown (ADR-REQ-052)")
+	slog.Info("  GET /api/entry-points  - Entry points (REQ-030)")
+	slog.Info("  GET /api/targets       - Targets (REQ-031)")
+	slog.Info("  GET /api/mitigations   - All mitigations (REQ-033)")
+	slog.Info("  GET /api/asset/{id}/mitigations    - Asset mitigations (REQ-034)")
+	slog.Info("  PUT /api/asset/{id}/mitigations    - Upsert mitigation (REQ-035)")
+	slog.Info("  DELETE /api/asset/{id}/mitigations/{mid} - Delete mitigation (REQ-036)")
+	slog.Info("  POST /api/recalculate-ttb              - Start bulk TTB recalculation job (REQ-040)")
+	slog.Info("  GET /api/jobs/{id}                     - Job progress")
+	slog.Info("  GET /api/jobs/{id}/events              - Job progress stream (SSE)")
+	slog.Info("  DELETE /api/jobs/{id}                  - Cancel job")
+	slog.Info("  GET /api/system-state                   - System state (REQ-041)")
+	slog.Info("  GET /metrics                           - Prometheus metrics")
+	slog.Info("  GET /healthz                           - Liveness probe")
+	slog.Info("  GET /readyz                            - Readiness and dependency status")
+	slog.Info("  POST /api/import/network               - Network CSV import (ED006)")
+	slog.Info("  POST /api/import/assets?dry_run=       - Asset inventory XLSX import (DI-01..03)")
+	slog.Info("Static files served from ./static/")
+	if cfg.RequestTimeout > 0 {
+		slog.Info("Requests time out (REQUEST_TIMEOUT_SECONDS); job streams are exempt", "timeout", cfg.RequestTimeout)
+	}
+	handler := api.WithRequestDeadline(cfg.RequestTimeout, http.DefaultServeMux)
+	handler = api.WithMetrics(http.DefaultServeMux, handler)
+	handler = api.WithRequestID(handler)
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// Graceful shutdown: SIGINT/SIGTERM stops accepting connections and drains
+	// in-flight requests and jobs, then the audit queue, before the MariaDB
+	// and Nebula pools close, so a redeploy loses no audit sessions.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.ListenAndServe() }()
+
+	select {
+	case err := <-serveErr:
+		slog.Error("http server stopped", "err", err)
+		os.Exit(1)
+	case <-ctx.Done():
+		stop() // a second signal terminates immediately
+	}
+
+	slog.Info("shutdown: signal received, draining", "timeout", cfg.ShutdownTimeout,
+		"audit_drain_timeout", cfg.AuditDrainTimeout)
+	shutdownStart := time.Now()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	// Jobs first: cancelling them ends their event streams, which would
+	// otherwise keep Shutdown waiting.
+	if err := jobMgr.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("shutdown: jobs still running", "err", err)
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("shutdown: in-flight requests not drained, closing connections", "err", err)
+		srv.Close()
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("http server stopped", "err", err)
+	}
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.AuditDrainTimeout)
+	defer cancelDrain()
+	auditStore.Close(drainCtx)
+	closeGraph()
+
+	slog.Info("shutdown: complete", "elapsed", time.Since(shutdownStart))
 }
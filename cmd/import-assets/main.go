@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"ESP-data/config"
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/importer"
+)
+
+// import-assets loads the Assets sheet of sources/assets.xlsx into Asset
+// vertices with has_type, belongs_to and runs_on edges (DI-01..DI-03) using the
+// graph backend selected by GRAPH_BACKEND. -dry-run prints the diff only.
+func main() {
+	file := flag.String("file", "sources/assets.xlsx", "CMDB workbook to import")
+	dryRun := flag.Bool("dry-run", false, "report added/changed/removed assets without writing")
+	snapshotOut := flag.String("snapshot-out", "", "memory backend only: write the resulting graph snapshot to this file")
+	flag.Parse()
+
+	// Load configuration from environment variables (REQ-002, ADR-REQ-002)
+	cfg := config.Load()
+
+	gs, closeGraph, err := graphstore.New(cfg)
+	if err != nil {
+		log.Fatalf("graphstore: %v", err)
+	}
+	defer closeGraph()
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatalf("import-assets: %v", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		log.Fatalf("import-assets: %v", err)
+	}
+
+	result, err := importer.ImportAssets(context.Background(), gs, f, info.Size(), *dryRun)
+	if err != nil {
+		log.Fatalf("import-assets: %v", err)
+	}
+
+	if *snapshotOut != "" {
+		ms, ok := gs.(*graphstore.MemoryStore)
+		if !ok {
+			log.Fatalf("import-assets: -snapshot-out requires GRAPH_BACKEND=%s", graphstore.BackendMemory)
+		}
+		out, err := os.Create(*snapshotOut)
+		if err != nil {
+			log.Fatalf("import-assets: %v", err)
+		}
+		if err := ms.WriteSnapshot(out); err != nil {
+			out.Close()
+			log.Fatalf("import-assets: write snapshot: %v", err)
+		}
+		if err := out.Close(); err != nil {
+			log.Fatalf("import-assets: write snapshot: %v", err)
+		}
+		log.Printf("import-assets: snapshot written to %s", *snapshotOut)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		log.Fatalf("import-assets: %v", err)
+	}
+}
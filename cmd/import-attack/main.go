@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"ESP-data/config"
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/importer"
+	"ESP-data/internal/store"
+)
+
+// import-attack loads an enterprise-attack STIX 2.1 bundle into the MITRE
+// tags and edges (SCHEMA TA005, TA007, TA008, TA011; ED003, ED005, ED009,
+// ED010) using the graph backend selected by GRAPH_BACKEND.
+func main() {
+	file := flag.String("file", "enterprise-attack.json", "ATT&CK STIX 2.1 bundle to import")
+	version := flag.String("version", "", "Mitre_Attack_Version to stamp (default: version of the bundle's x-mitre-collection)")
+	snapshotOut := flag.String("snapshot-out", "", "memory backend only: write the resulting graph snapshot to this file")
+	flag.Parse()
+
+	// Load configuration from environment variables (REQ-002, ADR-REQ-002)
+	cfg := config.Load()
+
+	gs, closeGraph, err := graphstore.New(cfg)
+	if err != nil {
+		log.Fatalf("graphstore: %v", err)
+	}
+	defer closeGraph()
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatalf("import-attack: %v", err)
+	}
+	defer f.Close()
+
+	result, err := importer.ImportAttack(context.Background(), gs, f, *version)
+	if err != nil {
+		log.Fatalf("import-attack: %v", err)
+	}
+
+	// Asset hashes do not cover the ATT&CK data, so TTBs cached under the
+	// previous release would still match (ADR-REQ-021).
+	if cfg.MariaEnabled {
+		db, err := store.New(context.Background(), cfg.MariaHost, cfg.MariaPort, cfg.MariaUser, cfg.MariaPass, cfg.MariaDB,
+			store.QueueConfig{Size: cfg.AuditQueueSize, MaxAttempts: cfg.AuditMaxAttempts})
+		if err != nil {
+			log.Printf("import-attack: TTB cache not invalidated: %v", err)
+		} else {
+			db.InvalidateAllCache(context.Background())
+			db.Close(context.Background())
+		}
+	}
+
+	if *snapshotOut != "" {
+		ms, ok := gs.(*graphstore.MemoryStore)
+		if !ok {
+			log.Fatalf("import-attack: -snapshot-out requires GRAPH_BACKEND=%s", graphstore.BackendMemory)
+		}
+		out, err := os.Create(*snapshotOut)
+		if err != nil {
+			log.Fatalf("import-attack: %v", err)
+		}
+		if err := ms.WriteSnapshot(out); err != nil {
+			out.Close()
+			log.Fatalf("import-attack: write snapshot: %v", err)
+		}
+		if err := out.Close(); err != nil {
+			log.Fatalf("import-attack: write snapshot: %v", err)
+		}
+		log.Printf("import-attack: snapshot written to %s", *snapshotOut)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		log.Fatalf("import-attack: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"ESP-data/config"
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/importer"
+)
+
+// import-network loads sources/network1.csv into connects_to edges (SCHEMA ED006)
+// using the graph backend selected by GRAPH_BACKEND.
+func main() {
+	file := flag.String("file", "sources/network1.csv", "network CSV to import")
+	snapshotOut := flag.String("snapshot-out", "", "memory backend only: write the resulting graph snapshot to this file")
+	flag.Parse()
+
+	// Load configuration from environment variables (REQ-002, ADR-REQ-002)
+	cfg := config.Load()
+
+	gs, closeGraph, err := graphstore.New(cfg)
+	if err != nil {
+		log.Fatalf("graphstore: %v", err)
+	}
+	defer closeGraph()
+
+	f, err := os.Open(*file)
+	if err != nil {
+		log.Fatalf("import-network: %v", err)
+	}
+	defer f.Close()
+
+	result, err := importer.ImportNetwork(context.Background(), gs, f)
+	if err != nil {
+		log.Fatalf("import-network: %v", err)
+	}
+
+	if *snapshotOut != "" {
+		ms, ok := gs.(*graphstore.MemoryStore)
+		if !ok {
+			log.Fatalf("import-network: -snapshot-out requires GRAPH_BACKEND=%s", graphstore.BackendMemory)
+		}
+		out, err := os.Create(*snapshotOut)
+		if err != nil {
+			log.Fatalf("import-network: %v", err)
+		}
+		if err := ms.WriteSnapshot(out); err != nil {
+			out.Close()
+			log.Fatalf("import-network: write snapshot: %v", err)
+		}
+		if err := out.Close(); err != nil {
+			log.Fatalf("import-network: write snapshot: %v", err)
+		}
+		log.Printf("import-network: snapshot written to %s", *snapshotOut)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		log.Fatalf("import-network: %v", err)
+	}
+}
@@ -1,9 +1,12 @@
 package config
 
 import (
-	"log"
+	"log/slog"
 	"os"
 	"strconv"
+	"time"
+
+	"ESP-data/internal/logging"
 )
 
 type Config struct {
@@ -14,11 +17,46 @@ type Config struct {
 	Space      string
 	AppPort    int
 
+	// Log output: "text" (default) or "json", at LogLevel and above.
+	LogFormat string
+	LogLevel  slog.Level
+
+	// Deadline of each API request's graph and store work; 0 disables it.
+	RequestTimeout time.Duration
+
+	// On SIGINT/SIGTERM: how long in-flight requests and jobs may take to
+	// finish, then how long queued audit batches may take to flush.
+	ShutdownTimeout   time.Duration
+	AuditDrainTimeout time.Duration
+
+	// Graph backend selection: "nebula" (default) or "memory".
+	// The memory backend is seeded from GraphSeedFile (JSON snapshot) when set.
+	GraphBackend  string
+	GraphSeedFile string
+
 	// TTB calculation parameters (ALG-REQ-071, ALG-REQ-072, ALG-REQ-075)
 	OrientationTime   float64 // hours; default 0.25 (15 min). ALG-REQ-071.
 	SwitchoverTime    float64 // hours; default 0.1667 (10 min). ALG-REQ-072.
 	PriorityTolerance int     // levels below top; default 1. ALG-REQ-075.
 
+	// In-process LRU of entry/target TTB results (ALG-REQ-053); 0 disables it.
+	TTBCacheSize int
+
+	// Concurrent ComputeTTB calls, and Nebula sessions reserved for them.
+	TTBWorkers int
+
+	// In-memory MITRE snapshot for ComputeTTB, and how often its data
+	// version is re-checked; with it off every TTB reads the graph.
+	MitreSnapshot      bool
+	MitreSnapshotCheck time.Duration
+
+	// Monte Carlo TTA on /api/paths (trials=N): the TTT distribution used
+	// when a request names none, the most trials a request may ask for and
+	// the most trials summed over all returned paths.
+	MonteCarloDistribution  string
+	MonteCarloMaxTrials     int
+	MonteCarloMaxPathTrials int
+
 	// MariaDB (RDBMS) parameters (ADR-REQ-002)
 	MariaHost    string
 	MariaPort    int
@@ -26,13 +64,29 @@ type Config struct {
 	MariaPass    string
 	MariaDB      string
 	MariaEnabled bool
+
+	// Audit write-behind queue: batches held in memory, FlushBatch attempts
+	// per batch, and the spill journal used while MariaDB is down ("" = none).
+	AuditQueueSize   int
+	AuditMaxAttempts int
+	AuditJournalPath string
+
+	// Paths persisted to calc_paths per session, lowest TTA first; 0 keeps all.
+	AuditMaxPaths int
 }
 
 // Load reads configuration from environment variables with sensible defaults.
 // This satisfies REQ-002: NEBULA_HOST, NEBULA_PORT, NEBULA_USER, NEBULA_PASS, NEBULA_SPACE.
 // MariaDB parameters added per ADR-REQ-002.
+// The slog default logger is configured first (LOG_FORMAT, LOG_LEVEL) so the
+// remaining settings are logged in the chosen format.
 func Load() *Config {
+	logFormat, logLevel := loadLogging()
+
 	cfg := &Config{
+		LogFormat: logFormat,
+		LogLevel:  logLevel,
+
 		// Defaults taken from SRS 2.5.1 GrDB
 		NebulaHost: getEnv("NEBULA_HOST", "nebbie.m82"),
 		NebulaPort: getEnvInt("NEBULA_PORT", 9669),
@@ -41,11 +95,29 @@ func Load() *Config {
 		Space:      getEnv("NEBULA_SPACE", "ESP01"),
 		// App port: main.go currently hardcodes :8080 in ListenAndServe
 		AppPort: getEnvInt("APP_PORT", 8080),
+		// Per-request deadline (REQUEST_TIMEOUT_SECONDS, fractional allowed)
+		RequestTimeout: time.Duration(getEnvFloat("REQUEST_TIMEOUT_SECONDS", 120) * float64(time.Second)),
+		// Graceful shutdown drain limits (SHUTDOWN_TIMEOUT_SECONDS, AUDIT_DRAIN_TIMEOUT_SECONDS)
+		ShutdownTimeout:   time.Duration(getEnvFloat("SHUTDOWN_TIMEOUT_SECONDS", 30) * float64(time.Second)),
+		AuditDrainTimeout: time.Duration(getEnvFloat("AUDIT_DRAIN_TIMEOUT_SECONDS", 10) * float64(time.Second)),
+
+		// Graph backend (GRAPH_BACKEND=nebula|memory)
+		GraphBackend:  getEnv("GRAPH_BACKEND", "nebula"),
+		GraphSeedFile: getEnv("GRAPH_SEED_FILE", ""),
 
 		// TTB calculation defaults (ALG-REQ-071, ALG-REQ-072, ALG-REQ-075)
 		OrientationTime:   getEnvFloat("TTB_ORIENTATION_TIME", 0.25),
 		SwitchoverTime:    getEnvFloat("TTB_SWITCHOVER_TIME", 0.1667),
 		PriorityTolerance: getEnvInt("TTB_PRIORITY_TOLERANCE", 1),
+		TTBCacheSize:      getEnvInt("TTB_CACHE_SIZE", 1024),
+		TTBWorkers:        getEnvInt("TTB_WORKERS", 4),
+
+		MitreSnapshot:      getEnvBool("MITRE_SNAPSHOT", true),
+		MitreSnapshotCheck: time.Duration(getEnvFloat("MITRE_SNAPSHOT_CHECK_SECONDS", 60) * float64(time.Second)),
+
+		MonteCarloDistribution:  getEnv("MONTE_CARLO_DISTRIBUTION", "pert"),
+		MonteCarloMaxTrials:     getEnvInt("MONTE_CARLO_MAX_TRIALS", 100000),
+		MonteCarloMaxPathTrials: getEnvInt("MONTE_CARLO_MAX_PATH_TRIALS", 10000000),
 
 		// MariaDB defaults (ADR-REQ-002)
 		MariaHost:    getEnv("MARIA_HOST", "nebbie.m82"),
@@ -54,18 +126,49 @@ func Load() *Config {
 		MariaPass:    getEnv("MARIA_PASS", "nebula1"),
 		MariaDB:      getEnv("MARIA_DB", "ESP01"),
 		MariaEnabled: getEnvBool("MARIA_ENABLED", false),
+
+		// Audit write-behind queue (AUDIT_QUEUE_SIZE, AUDIT_MAX_ATTEMPTS, AUDIT_JOURNAL_PATH)
+		AuditQueueSize:   getEnvInt("AUDIT_QUEUE_SIZE", 256),
+		AuditMaxAttempts: getEnvInt("AUDIT_MAX_ATTEMPTS", 5),
+		AuditJournalPath: getEnv("AUDIT_JOURNAL_PATH", ""),
+		AuditMaxPaths:    getEnvInt("AUDIT_MAX_PATHS", 0),
 	}
 
-	log.Printf("config: Nebula %s:%d space=%s user=%s appPort=%d",
-		cfg.NebulaHost, cfg.NebulaPort, cfg.Space, cfg.NebulaUser, cfg.AppPort)
-	log.Printf("config: TTB params — orientationTime=%.4fh switchoverTime=%.4fh priorityTolerance=%d",
-		cfg.OrientationTime, cfg.SwitchoverTime, cfg.PriorityTolerance)
-	log.Printf("config: MariaDB enabled=%v host=%s:%d db=%s",
-		cfg.MariaEnabled, cfg.MariaHost, cfg.MariaPort, cfg.MariaDB)
+	slog.Info("config: Nebula", "host", cfg.NebulaHost, "port", cfg.NebulaPort,
+		"space", cfg.Space, "user", cfg.NebulaUser, "app_port", cfg.AppPort)
+	slog.Info("config: graph backend", "backend", cfg.GraphBackend, "seed", cfg.GraphSeedFile)
+	slog.Info("config: request timeout", "timeout", cfg.RequestTimeout)
+	slog.Info("config: shutdown", "timeout", cfg.ShutdownTimeout, "audit_drain_timeout", cfg.AuditDrainTimeout)
+	slog.Info("config: TTB params", "orientation_time_h", cfg.OrientationTime, "switchover_time_h", cfg.SwitchoverTime,
+		"priority_tolerance", cfg.PriorityTolerance, "cache_size", cfg.TTBCacheSize, "workers", cfg.TTBWorkers)
+	slog.Info("config: MITRE snapshot", "enabled", cfg.MitreSnapshot, "check_interval", cfg.MitreSnapshotCheck)
+	slog.Info("config: Monte Carlo", "distribution", cfg.MonteCarloDistribution, "max_trials", cfg.MonteCarloMaxTrials,
+		"max_path_trials", cfg.MonteCarloMaxPathTrials)
+	slog.Info("config: MariaDB", "enabled", cfg.MariaEnabled, "host", cfg.MariaHost,
+		"port", cfg.MariaPort, "db", cfg.MariaDB)
+	slog.Info("config: audit queue", "size", cfg.AuditQueueSize, "max_attempts", cfg.AuditMaxAttempts,
+		"journal", cfg.AuditJournalPath, "max_paths", cfg.AuditMaxPaths)
+	slog.Info("config: logging", "format", cfg.LogFormat, "level", cfg.LogLevel)
 
 	return cfg
 }
 
+// loadLogging reads LOG_FORMAT (text|json) and LOG_LEVEL (debug|info|warn|error)
+// and installs the slog default logger. Invalid values fall back to text/info.
+func loadLogging() (string, slog.Level) {
+	format := getEnv("LOG_FORMAT", logging.FormatText)
+	level, levelErr := logging.ParseLevel(getEnv("LOG_LEVEL", "info"))
+	if err := logging.Setup(os.Stderr, format, level); err != nil {
+		format = logging.FormatText
+		logging.Setup(os.Stderr, format, level)
+		slog.Warn("config: invalid LOG_FORMAT, using default", "value", os.Getenv("LOG_FORMAT"), "default", format)
+	}
+	if levelErr != nil {
+		slog.Warn("config: invalid LOG_LEVEL, using default", "value", os.Getenv("LOG_LEVEL"), "default", level)
+	}
+	return format, level
+}
+
 func getEnv(key, def string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -77,7 +180,7 @@ func getEnvInt(key string, def int) int {
 	if v := os.Getenv(key); v != "" {
 		n, err := strconv.Atoi(v)
 		if err != nil {
-			log.Printf("config: invalid int for %s=%q, using default %d", key, v, def)
+			slog.Warn("config: invalid int, using default", "key", key, "value", v, "default", def)
 			return def
 		}
 		return n
@@ -89,7 +192,7 @@ func getEnvFloat(key string, def float64) float64 {
 	if v := os.Getenv(key); v != "" {
 		f, err := strconv.ParseFloat(v, 64)
 		if err != nil {
-			log.Printf("config: invalid float for %s=%q, using default %.4f", key, v, def)
+			slog.Warn("config: invalid float, using default", "key", key, "value", v, "default", def)
 			return def
 		}
 		return f
@@ -101,7 +204,7 @@ func getEnvBool(key string, def bool) bool {
 	if v := os.Getenv(key); v != "" {
 		b, err := strconv.ParseBool(v)
 		if err != nil {
-			log.Printf("config: invalid bool for %s=%q, using default %v", key, v, def)
+			slog.Warn("config: invalid bool, using default", "key", key, "value", v, "default", def)
 			return def
 		}
 		return b
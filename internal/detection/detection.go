@@ -0,0 +1,114 @@
+package detection
+
+import (
+	"sort"
+	"strings"
+
+	"ESP-data/internal/nebula"
+)
+
+// ============================================================
+// Time-to-detect — the techniques ComputeTTB selects along a path, laid
+// on the attack clock, against the detection controls of each asset:
+// how likely the path is detected, when, and whether the attacker
+// reaches the target first
+// ============================================================
+
+// Step is one selected technique of a path. Done is the hour, counted
+// from the start of the attack, at which its execution ends.
+type Step struct {
+	AssetID     string
+	TechniqueID string
+	Done        float64
+}
+
+// Race is the detection outcome of one path.
+type Race struct {
+	// Probability that at least one execution on the path is detected.
+	Probability float64
+	// TTD is the median time to detect: the hour by which detection is
+	// more likely than not. Nil when Probability is below one half.
+	TTD *float64
+	// AttackerWins is the probability that no alert is raised before the
+	// attacker completes the target, at hour tta.
+	AttackerWins float64
+}
+
+// event is one chance of detection: a control covering a step.
+type event struct {
+	at float64
+	p  float64
+}
+
+// Evaluate races the steps of a path against the controls in coverage
+// (per asset, as returned by QueryDetectionCoverage). A control detects an
+// execution with its coverage, independently of other controls and
+// executions, and alerts DetectionTime hours after the execution ends.
+// Coverage of a technique applies to its sub-techniques unless they are
+// listed themselves.
+func Evaluate(steps []Step, coverage map[string][]nebula.DetectionCoverage, tta float64) Race {
+	var events []event
+	for _, s := range steps {
+		for _, c := range matching(coverage[s.AssetID], s.TechniqueID) {
+			if c.Coverage <= 0 {
+				continue
+			}
+			events = append(events, event{at: s.Done + c.DetectionTime, p: min(float64(c.Coverage), 100) / 100})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].at < events[j].at })
+
+	race := Race{AttackerWins: 1}
+	undetected := 1.0
+	for _, e := range events {
+		undetected *= 1 - e.p
+		if e.at <= tta {
+			race.AttackerWins = undetected
+		}
+		if race.TTD == nil && undetected <= 0.5 {
+			at := e.at
+			race.TTD = &at
+		}
+	}
+	race.Probability = 1 - undetected
+	return race
+}
+
+// matching returns the coverage entries for technique: those naming it, or
+// if there are none, those naming its parent technique.
+func matching(coverage []nebula.DetectionCoverage, technique string) []nebula.DetectionCoverage {
+	var exact, parent []nebula.DetectionCoverage
+	base, _, isSub := strings.Cut(technique, ".")
+	for _, c := range coverage {
+		switch {
+		case c.TechniqueID == technique:
+			exact = append(exact, c)
+		case isSub && c.TechniqueID == base:
+			parent = append(parent, c)
+		}
+	}
+	if len(exact) > 0 {
+		return exact
+	}
+	return parent
+}
+
+// Steps lays the selected techniques of one asset's TTB log on the attack
+// clock, the asset's chain starting at hour start: the orientation time
+// first (ALG-REQ-071), then each technique, separated by the switchover
+// time (ALG-REQ-072).
+func Steps(assetID string, start float64, log []nebula.TTBLogEntry, params nebula.TTBParams) []Step {
+	var steps []Step
+	at := start + params.OrientationTime
+	for _, e := range log {
+		if e.TechniqueID == nil {
+			continue
+		}
+		if len(steps) > 0 {
+			at += params.SwitchoverTime
+		}
+		at += e.TTT
+		steps = append(steps, Step{AssetID: assetID, TechniqueID: *e.TechniqueID, Done: at})
+	}
+	return steps
+}
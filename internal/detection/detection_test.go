@@ -0,0 +1,128 @@
+package detection
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"ESP-data/internal/nebula"
+)
+
+func TestEvaluate(t *testing.T) {
+	ttd := func(v float64) *float64 { return &v }
+	steps := []Step{
+		{AssetID: "A1", TechniqueID: "T1190", Done: 2},
+		{AssetID: "A1", TechniqueID: "T1059.001", Done: 3},
+		{AssetID: "A2", TechniqueID: "T1078", Done: 6},
+	}
+	tests := []struct {
+		name     string
+		coverage map[string][]nebula.DetectionCoverage
+		tta      float64
+		want     Race
+	}{
+		{
+			name: "no controls",
+			tta:  6,
+			want: Race{AttackerWins: 1},
+		},
+		{
+			name: "one control alerts before the target",
+			coverage: map[string][]nebula.DetectionCoverage{
+				"A1": {{ControlID: "D1", TechniqueID: "T1190", Coverage: 60, DetectionTime: 1}},
+			},
+			tta:  6,
+			want: Race{Probability: 0.6, TTD: ttd(3), AttackerWins: 0.4},
+		},
+		{
+			name: "alert after the target does not stop the attacker",
+			coverage: map[string][]nebula.DetectionCoverage{
+				"A2": {{ControlID: "D1", TechniqueID: "T1078", Coverage: 80, DetectionTime: 2}},
+			},
+			tta:  6,
+			want: Race{Probability: 0.8, TTD: ttd(8), AttackerWins: 1},
+		},
+		{
+			name: "parent technique covers its sub-technique",
+			coverage: map[string][]nebula.DetectionCoverage{
+				"A1": {{ControlID: "D1", TechniqueID: "T1059", Coverage: 50}},
+			},
+			tta:  6,
+			want: Race{Probability: 0.5, TTD: ttd(3), AttackerWins: 0.5},
+		},
+		{
+			name: "sub-technique entry overrides its parent",
+			coverage: map[string][]nebula.DetectionCoverage{
+				"A1": {
+					{ControlID: "D1", TechniqueID: "T1059", Coverage: 90},
+					{ControlID: "D2", TechniqueID: "T1059.001", Coverage: 20},
+				},
+			},
+			tta:  6,
+			want: Race{Probability: 0.2, AttackerWins: 0.8},
+		},
+		{
+			name: "independent controls combine",
+			coverage: map[string][]nebula.DetectionCoverage{
+				"A1": {
+					{ControlID: "D1", TechniqueID: "T1190", Coverage: 30},
+					{ControlID: "D2", TechniqueID: "T1190", Coverage: 0},
+				},
+				"A2": {{ControlID: "D3", TechniqueID: "T1078", Coverage: 150, DetectionTime: 0.5}},
+			},
+			tta:  6,
+			want: Race{Probability: 1, TTD: ttd(6.5), AttackerWins: 0.7},
+		},
+		{
+			name: "coverage on another asset does not apply",
+			coverage: map[string][]nebula.DetectionCoverage{
+				"A3": {{ControlID: "D1", TechniqueID: "T1190", Coverage: 100}},
+			},
+			tta:  6,
+			want: Race{AttackerWins: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Evaluate(steps, tt.coverage, tt.tta)
+			if math.Abs(got.Probability-tt.want.Probability) > 1e-9 ||
+				math.Abs(got.AttackerWins-tt.want.AttackerWins) > 1e-9 ||
+				!reflect.DeepEqual(got.TTD, tt.want.TTD) {
+				t.Errorf("Evaluate = %+v (TTD %v), want %+v (TTD %v)", got, deref(got.TTD), tt.want, deref(tt.want.TTD))
+			}
+		})
+	}
+}
+
+func deref(v *float64) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func TestSteps(t *testing.T) {
+	id := func(s string) *string { return &s }
+	log := []nebula.TTBLogEntry{
+		{TechniqueID: id("T1190"), TTT: 2},
+		{TTT: 999999},
+		{TechniqueID: id("T1059"), TTT: 1.5},
+		{TechniqueID: id("T1078"), TTT: 0.5},
+	}
+	params := nebula.TTBParams{OrientationTime: 0.25, SwitchoverTime: 0.1}
+	want := []Step{
+		{AssetID: "A1", TechniqueID: "T1190", Done: 12.25},
+		{AssetID: "A1", TechniqueID: "T1059", Done: 13.85},
+		{AssetID: "A1", TechniqueID: "T1078", Done: 14.45},
+	}
+	got := Steps("A1", 10, log, params)
+	if len(got) != len(want) {
+		t.Fatalf("Steps = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].AssetID != want[i].AssetID || got[i].TechniqueID != want[i].TechniqueID ||
+			math.Abs(got[i].Done-want[i].Done) > 1e-9 {
+			t.Errorf("step %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
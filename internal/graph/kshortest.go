@@ -0,0 +1,255 @@
+package graph
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// ============================================================
+// Minimum-TTA path search — Yen's k shortest loopless paths with node
+// weights and a hop limit (ALG-REQ-001 shortest mode)
+// ============================================================
+
+// WeightedPath is one loop-free path with its accumulated node weight.
+type WeightedPath struct {
+	Nodes []string
+	Cost  float64
+}
+
+// Hops returns the number of edges of the path.
+func (p WeightedPath) Hops() int {
+	return len(p.Nodes) - 1
+}
+
+// PathRegion returns the nodes that lie on at least one walk from src to dst
+// with at most maxHops edges. Only these nodes can appear on a result of
+// KShortestPaths, so callers use it to scope TTB refreshes.
+func PathRegion(adj map[string][]string, src, dst string, maxHops int) map[string]bool {
+	fwd := bfsDepth(adj, src, maxHops)
+
+	rev := make(map[string][]string)
+	for from, tos := range adj {
+		for _, to := range tos {
+			rev[to] = append(rev[to], from)
+		}
+	}
+	back := bfsDepth(rev, dst, maxHops)
+
+	region := make(map[string]bool)
+	for n, d := range fwd {
+		if b, ok := back[n]; ok && d+b <= maxHops {
+			region[n] = true
+		}
+	}
+	return region
+}
+
+func bfsDepth(adj map[string][]string, start string, maxDepth int) map[string]int {
+	depth := map[string]int{start: 0}
+	frontier := []string{start}
+	for d := 1; d <= maxDepth && len(frontier) > 0; d++ {
+		var next []string
+		for _, n := range frontier {
+			for _, m := range adj[n] {
+				if _, seen := depth[m]; !seen {
+					depth[m] = d
+					next = append(next, m)
+				}
+			}
+		}
+		frontier = next
+	}
+	return depth
+}
+
+// KShortestPaths returns up to k loop-free paths from src to dst with at most
+// maxHops edges, ordered by ascending cost, where the cost of a path is the
+// sum of weight(n) over all of its nodes. Weights must be non-negative.
+// Ties are broken by hop count, then lexicographically by node IDs, so the
+// result is deterministic.
+func KShortestPaths(adj map[string][]string, weight func(string) float64, src, dst string, k, maxHops int) []WeightedPath {
+	if k <= 0 || maxHops <= 0 || src == dst {
+		return nil
+	}
+
+	first, ok := boundedShortestPath(adj, weight, src, dst, maxHops, nil, nil)
+	if !ok {
+		return nil
+	}
+	result := []WeightedPath{first}
+	var candidates []WeightedPath
+	seen := map[string]bool{pathKey(first.Nodes): true}
+
+	for len(result) < k {
+		last := result[len(result)-1]
+		for i := 0; i < len(last.Nodes)-1; i++ {
+			spur := last.Nodes[i]
+			root := last.Nodes[:i+1]
+
+			removedEdges := make(map[[2]string]bool)
+			for _, p := range result {
+				if len(p.Nodes) > i+1 && equalPrefix(p.Nodes, root) {
+					removedEdges[[2]string{p.Nodes[i], p.Nodes[i+1]}] = true
+				}
+			}
+			removedNodes := make(map[string]bool, i)
+			for _, n := range root[:i] {
+				removedNodes[n] = true
+			}
+
+			spurPath, ok := boundedShortestPath(adj, weight, spur, dst, maxHops-i, removedNodes, removedEdges)
+			if !ok {
+				continue
+			}
+			nodes := make([]string, 0, i+len(spurPath.Nodes))
+			nodes = append(nodes, root[:i]...)
+			nodes = append(nodes, spurPath.Nodes...)
+			key := pathKey(nodes)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			var cost float64
+			for _, n := range root[:i] {
+				cost += weight(n)
+			}
+			candidates = append(candidates, WeightedPath{Nodes: nodes, Cost: cost + spurPath.Cost})
+		}
+		if len(candidates) == 0 {
+			break
+		}
+		sort.Slice(candidates, func(a, b int) bool { return lessPath(candidates[a], candidates[b]) })
+		result = append(result, candidates[0])
+		candidates = candidates[1:]
+	}
+	return result
+}
+
+// boundedShortestPath runs Dijkstra over (node, hops used) states so that the
+// hop limit is honoured exactly. The cost includes weight(src).
+func boundedShortestPath(adj map[string][]string, weight func(string) float64, src, dst string, maxHops int,
+	removedNodes map[string]bool, removedEdges map[[2]string]bool) (WeightedPath, bool) {
+
+	type state struct {
+		node string
+		hops int
+	}
+	dist := map[state]float64{{src, 0}: weight(src)}
+	prev := make(map[state]state)
+	pq := &pathQueue{{node: src, hops: 0, cost: weight(src)}}
+
+	for pq.Len() > 0 {
+		cur := heap.Pop(pq).(pathQueueItem)
+		s := state{cur.node, cur.hops}
+		if cur.cost > dist[s] {
+			continue
+		}
+		if cur.node == dst {
+			nodes := []string{dst}
+			for at := s; at.hops > 0; {
+				at = prev[at]
+				nodes = append(nodes, at.node)
+			}
+			for l, r := 0, len(nodes)-1; l < r; l, r = l+1, r-1 {
+				nodes[l], nodes[r] = nodes[r], nodes[l]
+			}
+			nodes = removeLoops(nodes)
+			var cost float64
+			for _, n := range nodes {
+				cost += weight(n)
+			}
+			return WeightedPath{Nodes: nodes, Cost: cost}, true
+		}
+		if cur.hops == maxHops {
+			continue
+		}
+		for _, next := range adj[cur.node] {
+			if removedNodes[next] || removedEdges[[2]string{cur.node, next}] || next == src {
+				continue
+			}
+			ns := state{next, cur.hops + 1}
+			nc := cur.cost + weight(next)
+			if d, ok := dist[ns]; ok && d <= nc {
+				continue
+			}
+			dist[ns] = nc
+			prev[ns] = s
+			heap.Push(pq, pathQueueItem{node: next, hops: ns.hops, cost: nc})
+		}
+	}
+	return WeightedPath{}, false
+}
+
+// removeLoops cuts cycles out of a walk. With non-negative weights the
+// loop-free walk costs no more and uses fewer hops, so it is still optimal.
+func removeLoops(nodes []string) []string {
+	out := make([]string, 0, len(nodes))
+	pos := make(map[string]int, len(nodes))
+	for _, n := range nodes {
+		if i, ok := pos[n]; ok {
+			for _, dropped := range out[i+1:] {
+				delete(pos, dropped)
+			}
+			out = out[:i+1]
+			continue
+		}
+		pos[n] = len(out)
+		out = append(out, n)
+	}
+	return out
+}
+
+func equalPrefix(nodes, prefix []string) bool {
+	if len(nodes) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if nodes[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func pathKey(nodes []string) string {
+	key := ""
+	for _, n := range nodes {
+		key += n + "\x00"
+	}
+	return key
+}
+
+func lessPath(a, b WeightedPath) bool {
+	if a.Cost != b.Cost {
+		return a.Cost < b.Cost
+	}
+	if len(a.Nodes) != len(b.Nodes) {
+		return len(a.Nodes) < len(b.Nodes)
+	}
+	return pathKey(a.Nodes) < pathKey(b.Nodes)
+}
+
+type pathQueueItem struct {
+	node string
+	hops int
+	cost float64
+}
+
+type pathQueue []pathQueueItem
+
+func (q pathQueue) Len() int { return len(q) }
+func (q pathQueue) Less(i, j int) bool {
+	if q[i].cost != q[j].cost {
+		return q[i].cost < q[j].cost
+	}
+	return q[i].hops < q[j].hops
+}
+func (q pathQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *pathQueue) Push(x interface{}) { *q = append(*q, x.(pathQueueItem)) }
+func (q *pathQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,233 @@
+package graph
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// fixtureGraph is a small directed graph with a cycle (B <-> C), a long
+// cheap detour (A-E-F-G-D) and a dead end (H).
+var fixtureGraph = map[string][]string{
+	"A": {"B", "C", "E"},
+	"B": {"C", "D"},
+	"C": {"B", "D", "H"},
+	"E": {"F"},
+	"F": {"G"},
+	"G": {"D"},
+}
+
+var fixtureWeights = map[string]float64{
+	"A": 1, "B": 5, "C": 3, "D": 2, "E": 1, "F": 1, "G": 1, "H": 0,
+}
+
+func fixtureWeight(n string) float64 { return fixtureWeights[n] }
+
+func TestKShortestPathsFixture(t *testing.T) {
+	tests := []struct {
+		name    string
+		k       int
+		maxHops int
+		want    [][]string
+	}{
+		{
+			name:    "all paths within five hops",
+			k:       10,
+			maxHops: 5,
+			want: [][]string{
+				{"A", "C", "D"},           // 6
+				{"A", "E", "F", "G", "D"}, // 6, more hops
+				{"A", "B", "D"},           // 8
+				{"A", "B", "C", "D"},      // 11
+				{"A", "C", "B", "D"},      // 11, lexicographically after
+			},
+		},
+		{
+			name:    "hop bound drops the detour",
+			k:       10,
+			maxHops: 3,
+			want: [][]string{
+				{"A", "C", "D"},
+				{"A", "B", "D"},
+				{"A", "B", "C", "D"},
+				{"A", "C", "B", "D"},
+			},
+		},
+		{
+			name:    "k truncates",
+			k:       2,
+			maxHops: 5,
+			want: [][]string{
+				{"A", "C", "D"},
+				{"A", "E", "F", "G", "D"},
+			},
+		},
+		{
+			name:    "two hops",
+			k:       10,
+			maxHops: 2,
+			want: [][]string{
+				{"A", "C", "D"},
+				{"A", "B", "D"},
+			},
+		},
+		{
+			name:    "one hop finds nothing",
+			k:       10,
+			maxHops: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := KShortestPaths(fixtureGraph, fixtureWeight, "A", "D", tt.k, tt.maxHops)
+			var nodes [][]string
+			for _, p := range got {
+				nodes = append(nodes, p.Nodes)
+			}
+			if !reflect.DeepEqual(nodes, tt.want) {
+				t.Errorf("KShortestPaths(k=%d, maxHops=%d) = %v, want %v", tt.k, tt.maxHops, nodes, tt.want)
+			}
+		})
+	}
+}
+
+func TestKShortestPathsDegenerate(t *testing.T) {
+	tests := []struct {
+		name     string
+		src, dst string
+		k, hops  int
+	}{
+		{"same endpoints", "A", "A", 3, 5},
+		{"k zero", "A", "D", 0, 5},
+		{"no hops", "A", "D", 3, 0},
+		{"unreachable", "D", "A", 3, 5},
+		{"unknown node", "X", "D", 3, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := KShortestPaths(fixtureGraph, fixtureWeight, tt.src, tt.dst, tt.k, tt.hops); got != nil {
+				t.Errorf("KShortestPaths(%s, %s) = %v, want nil", tt.src, tt.dst, got)
+			}
+		})
+	}
+}
+
+// TestKShortestPathsMatchesEnumeration compares Yen's search with a
+// brute-force enumeration of every simple path on random graphs: the costs
+// must agree path by path, and every returned path must be a distinct
+// simple path within the hop bound.
+func TestKShortestPathsMatchesEnumeration(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for iter := 0; iter < 300; iter++ {
+		n := 4 + rng.Intn(5)
+		nodes := make([]string, n)
+		weights := make(map[string]float64, n)
+		for i := range nodes {
+			nodes[i] = fmt.Sprintf("N%d", i)
+			weights[nodes[i]] = float64(rng.Intn(10))
+		}
+		adj := make(map[string][]string)
+		for _, a := range nodes {
+			for _, b := range nodes {
+				if a != b && rng.Float64() < 0.35 {
+					adj[a] = append(adj[a], b)
+				}
+			}
+		}
+		weight := func(id string) float64 { return weights[id] }
+		k := 1 + rng.Intn(8)
+		maxHops := 1 + rng.Intn(n)
+		src, dst := nodes[0], nodes[n-1]
+
+		all := enumeratePaths(adj, weight, src, dst, maxHops)
+		want := all
+		if len(want) > k {
+			want = want[:k]
+		}
+		got := KShortestPaths(adj, weight, src, dst, k, maxHops)
+
+		if len(got) != len(want) {
+			t.Fatalf("iter %d: got %d paths, want %d\nadj=%v weights=%v k=%d maxHops=%d\ngot=%v\nwant=%v",
+				iter, len(got), len(want), adj, weights, k, maxHops, got, want)
+		}
+		seen := make(map[string]bool)
+		for i, p := range got {
+			if p.Cost != want[i].Cost {
+				t.Fatalf("iter %d: path %d costs %g, want %g\nadj=%v weights=%v k=%d maxHops=%d\ngot=%v\nwant=%v",
+					iter, i, p.Cost, want[i].Cost, adj, weights, k, maxHops, got, want)
+			}
+			if err := checkPath(adj, weight, p, src, dst, maxHops); err != nil {
+				t.Fatalf("iter %d: path %d %v: %v", iter, i, p.Nodes, err)
+			}
+			key := pathKey(p.Nodes)
+			if seen[key] {
+				t.Fatalf("iter %d: path %v returned twice", iter, p.Nodes)
+			}
+			seen[key] = true
+		}
+	}
+}
+
+// enumeratePaths lists every simple path from src to dst with at most
+// maxHops edges in KShortestPaths order.
+func enumeratePaths(adj map[string][]string, weight func(string) float64, src, dst string, maxHops int) []WeightedPath {
+	var paths []WeightedPath
+	onPath := map[string]bool{src: true}
+	var walk func(nodes []string, cost float64)
+	walk = func(nodes []string, cost float64) {
+		last := nodes[len(nodes)-1]
+		if last == dst {
+			paths = append(paths, WeightedPath{Nodes: append([]string(nil), nodes...), Cost: cost})
+			return
+		}
+		if len(nodes)-1 == maxHops {
+			return
+		}
+		for _, next := range adj[last] {
+			if onPath[next] {
+				continue
+			}
+			onPath[next] = true
+			walk(append(nodes, next), cost+weight(next))
+			onPath[next] = false
+		}
+	}
+	if src != dst {
+		walk([]string{src}, weight(src))
+	}
+	sort.Slice(paths, func(i, j int) bool { return lessPath(paths[i], paths[j]) })
+	return paths
+}
+
+func checkPath(adj map[string][]string, weight func(string) float64, p WeightedPath, src, dst string, maxHops int) error {
+	if len(p.Nodes) < 2 || p.Nodes[0] != src || p.Nodes[len(p.Nodes)-1] != dst {
+		return fmt.Errorf("does not run from %s to %s", src, dst)
+	}
+	if p.Hops() > maxHops {
+		return fmt.Errorf("%d hops, limit %d", p.Hops(), maxHops)
+	}
+	visited := make(map[string]bool)
+	var cost float64
+	for i, n := range p.Nodes {
+		if visited[n] {
+			return fmt.Errorf("revisits %s", n)
+		}
+		visited[n] = true
+		cost += weight(n)
+		if i > 0 {
+			found := false
+			for _, m := range adj[p.Nodes[i-1]] {
+				found = found || m == n
+			}
+			if !found {
+				return fmt.Errorf("no edge %s -> %s", p.Nodes[i-1], n)
+			}
+		}
+	}
+	if cost != p.Cost {
+		return fmt.Errorf("cost %g, nodes sum to %g", p.Cost, cost)
+	}
+	return nil
+}
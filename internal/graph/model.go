@@ -458,6 +458,19 @@ type PathItem struct {
 	PathID string  `json:"path_id"`
 	Hosts  string  `json:"hosts"`
 	TTA    float64 `json:"tta"`
+
+	// Monte Carlo TTA quantiles, with trials=N only
+	TTAP10 *float64 `json:"tta_p10,omitempty"`
+	TTAP50 *float64 `json:"tta_p50,omitempty"`
+	TTAP90 *float64 `json:"tta_p90,omitempty"`
+
+	// Time-to-detect, with detection=true only: the probability that the
+	// path is detected, the median hour of detection (absent when detection
+	// is less likely than not) and the probability that the attacker
+	// completes the target before any alert
+	DetectionProbability *float64 `json:"detection_probability,omitempty"`
+	TTD                  *float64 `json:"ttd,omitempty"`
+	AttackerWins         *float64 `json:"attacker_wins,omitempty"`
 }
 
 // BuildPathsResponse converts the raw query maps into the typed response.
@@ -587,6 +600,7 @@ func BuildSystemStateResponse(data map[string]interface{}) SystemStateResponse {
 type RecalculateResponse struct {
 	Recalculated int    `json:"recalculated"`
 	Unchanged    int    `json:"unchanged"`
+	Failed       int    `json:"failed"`
 	Total        int    `json:"total"`
 	MerkleRoot   string `json:"merkle_root"`
 }
@@ -601,9 +615,30 @@ type PathsResponseWithRecalc struct {
 	EntryPoint         string               `json:"entry_point"`
 	Target             string               `json:"target"`
 	Hops               int                  `json:"hops"`
+	Mode               string               `json:"mode,omitempty"`
 	Total              int                  `json:"total"`
 	RecalculatedAssets []string             `json:"recalculated_assets"`
 	TTBLog             []nebula.TTBLogEntry `json:"ttb_log,omitempty"`
+	TTBSelection       string               `json:"ttb_selection"`
+	TTBDistributions   []TTBDistribution    `json:"ttb_distributions,omitempty"`
+	Simulation         *Simulation          `json:"simulation,omitempty"`
+}
+
+// Simulation describes the Monte Carlo TTA run behind the paths' tta_p10,
+// tta_p50 and tta_p90; repeating the request with its seed reproduces them.
+type Simulation struct {
+	Distribution string `json:"distribution"`
+	Trials       int    `json:"trials"`
+	Seed         int64  `json:"seed"`
+}
+
+// TTBDistribution is the weighted TTB of one asset at a chain position:
+// its expected value and possible outcomes (ALG-REQ-076 design note 4).
+type TTBDistribution struct {
+	AssetID  string              `json:"asset_id"`
+	Position string              `json:"position"`
+	Expected float64             `json:"expected"`
+	Outcomes []nebula.TTBOutcome `json:"outcomes"`
 }
 
 // BuildPathsResponseWithRecalc converts raw query maps into a response.
@@ -638,3 +673,90 @@ func BuildPathsResponseWithRecalc(items []map[string]interface{}, entryID, targe
 		RecalculatedAssets: recalculated,
 	}
 }
+
+// ============================================================
+// Attack matrix response — min TTA per (entry, target) pair (ALG-REQ-001 matrix)
+// ============================================================
+
+// PathMatrixCell is the fastest path of one (entry, target) pair. Reachable
+// is false when no path within the hop limit exists; Hosts and TTA are then empty.
+type PathMatrixCell struct {
+	EntryPoint string  `json:"entry_point"`
+	Target     string  `json:"target"`
+	Reachable  bool    `json:"reachable"`
+	Hosts      string  `json:"hosts,omitempty"`
+	HopCount   int     `json:"hop_count,omitempty"`
+	TTA        float64 `json:"tta,omitempty"`
+}
+
+// PathMatrixTarget names the entry point from which a target falls first.
+type PathMatrixTarget struct {
+	Target       string  `json:"target"`
+	FastestEntry string  `json:"fastest_entry"`
+	MinTTA       float64 `json:"min_tta"`
+}
+
+// PathMatrixResponse is returned by /api/paths/matrix. Cells are in
+// entry-major order; ByTarget lists reachable targets by ascending MinTTA.
+type PathMatrixResponse struct {
+	EntryPoints        []string           `json:"entry_points"`
+	Targets            []string           `json:"targets"`
+	Hops               int                `json:"hops"`
+	Cells              []PathMatrixCell   `json:"cells"`
+	ByTarget           []PathMatrixTarget `json:"by_target"`
+	EntryTTB           map[string]float64 `json:"entry_ttb"`
+	TargetTTB          map[string]float64 `json:"target_ttb"`
+	RecalculatedAssets []string           `json:"recalculated_assets"`
+}
+
+// ============================================================
+// Mitigation what-if simulation response (REQ-035 what-if)
+// ============================================================
+
+// SimulatedChange is one applied_to change as simulated, with the edge
+// state before and after. Before is nil when the edge did not exist; After
+// is nil when the change removes it.
+type SimulatedChange struct {
+	Action       string              `json:"action"`
+	AssetID      string              `json:"asset_id"`
+	MitigationID string              `json:"mitigation_id"`
+	Before       *SimulatedEdgeState `json:"before"`
+	After        *SimulatedEdgeState `json:"after"`
+}
+
+// SimulatedEdgeState is the Maturity / Active pair of an applied_to edge.
+type SimulatedEdgeState struct {
+	Maturity int  `json:"maturity"`
+	Active   bool `json:"active"`
+}
+
+// SimulatedPath compares the TTA of one path before and after the changes.
+type SimulatedPath struct {
+	PathID    string  `json:"path_id"`
+	Hosts     string  `json:"hosts"`
+	TTABefore float64 `json:"tta_before"`
+	TTAAfter  float64 `json:"tta_after"`
+	Delta     float64 `json:"delta"`
+}
+
+// AssetTTBDelta is the TTB change of one asset at its position on the paths
+// ("entrance", "intermediate" or "target").
+type AssetTTBDelta struct {
+	AssetID   string  `json:"asset_id"`
+	Position  string  `json:"position"`
+	TTBBefore float64 `json:"ttb_before"`
+	TTBAfter  float64 `json:"ttb_after"`
+	Delta     float64 `json:"delta"`
+}
+
+// SimulationResponse is returned by POST /api/simulate. Paths are ordered
+// by TTAAfter ascending; AssetDeltas lists every changed asset on the paths.
+type SimulationResponse struct {
+	EntryPoint  string            `json:"entry_point"`
+	Target      string            `json:"target"`
+	Hops        int               `json:"hops"`
+	Changes     []SimulatedChange `json:"changes"`
+	Paths       []SimulatedPath   `json:"paths"`
+	AssetDeltas []AssetTTBDelta   `json:"asset_deltas"`
+	Total       int               `json:"total"`
+}
@@ -0,0 +1,367 @@
+package graphstore
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"ESP-data/config"
+	"ESP-data/internal/nebula"
+	"ESP-data/internal/store"
+)
+
+// ======================================================================================================
+// GraphStore — backend-neutral read/write surface of the ESP01 graph
+// ======================================================================================================
+
+// GraphStore covers every graph operation used by the api package and the
+// TTB engine. The Nebula backend forwards each call to the matching function
+// in internal/nebula; the memory backend answers the same calls from an
+// in-process copy of the ESP01 schema entities (SCHEMA TA001–TA011, ED001–ED014).
+// Result shapes (map keys, defaults, error texts) are identical across backends
+// so that the internal/graph Build* functions work unchanged.
+type GraphStore interface {
+	// Ping checks that the backend can serve queries (/readyz).
+	Ping(ctx context.Context) error
+	// Asset and topology reads (REQ-020 through REQ-026).
+	QueryAssets(ctx context.Context) ([]nebula.AssetRow, error)
+	QueryAssetsWithDetails(ctx context.Context) ([]map[string]interface{}, error)
+	QueryAssetDetail(ctx context.Context, assetID string) (map[string]interface{}, error)
+	QueryNeighbors(ctx context.Context, assetID string) ([]map[string]interface{}, error)
+	QueryAssetTypes(ctx context.Context) ([]map[string]interface{}, error)
+	QueryEdgeConnections(ctx context.Context, sourceID, targetID string) ([]map[string]interface{}, error)
+
+	// Path inspector reads (ALG-REQ-001 through ALG-REQ-003, ALG-REQ-010).
+	QueryEntryPoints(ctx context.Context) ([]map[string]interface{}, error)
+	QueryTargets(ctx context.Context) ([]map[string]interface{}, error)
+	QueryPaths(ctx context.Context, entryID, targetID string, maxHops int) ([]nebula.PathResult, error)
+	QueryAssetTTB(ctx context.Context, assetID string) (int, error)
+	QueryTopology(ctx context.Context) (*nebula.Topology, error)
+
+	// Topology writes (ED006).
+	ReplaceConnections(ctx context.Context, srcID, dstID string, conns []nebula.Connection) error
+
+	// Asset inventory (TA001, ED002, ED007, ED011; DI-01 through DI-03).
+	QueryInventory(ctx context.Context) ([]nebula.AssetRecord, error)
+	QueryInventoryCatalog(ctx context.Context) (*nebula.InventoryCatalog, error)
+	UpsertAsset(ctx context.Context, rec nebula.AssetRecord) error
+
+	// MITRE ATT&CK catalog (TA005, TA007, TA008, TA011; ED003, ED005, ED009, ED010).
+	QueryAttackInventory(ctx context.Context) (*nebula.AttackInventory, error)
+	UpsertAttackRelease(ctx context.Context, rel *nebula.AttackRelease) error
+
+	// Mitigations (REQ-033 through REQ-036).
+	QueryMitigations(ctx context.Context) ([]map[string]interface{}, error)
+	QueryAssetMitigations(ctx context.Context, assetID string) ([]map[string]interface{}, error)
+	UpsertMitigation(ctx context.Context, mitigationID, assetID string, maturity int, active bool) error
+	DeleteMitigation(ctx context.Context, mitigationID, assetID string) error
+	QueryTechniqueMitigations(ctx context.Context, techniqueIDs []string) (map[string][]string, error)
+
+	// Detection controls (TA012, ED015, ED016).
+	QueryDetectionControls(ctx context.Context) ([]nebula.DetectionControl, error)
+	UpsertDetectionControl(ctx context.Context, ctl nebula.DetectionControl) error
+	QueryAssetDetections(ctx context.Context, assetID string) ([]nebula.AssetDetection, error)
+	UpsertAssetDetection(ctx context.Context, controlID, assetID string, active bool) error
+	DeleteAssetDetection(ctx context.Context, controlID, assetID string) error
+	QueryDetectionCoverage(ctx context.Context, assetIDs []string) (map[string][]nebula.DetectionCoverage, error)
+
+	// Tactic chains and chain rules (TA010, TA013, ED013).
+	QueryTacticChains(ctx context.Context) ([]nebula.TacticChain, error)
+	UpsertTacticChain(ctx context.Context, chain nebula.TacticChain) error
+	DeleteTacticChain(ctx context.Context, chainID string) error
+	QueryChainRules(ctx context.Context) ([]nebula.ChainRule, error)
+	UpsertChainRule(ctx context.Context, rule nebula.ChainRule) error
+	DeleteChainRule(ctx context.Context, ruleID string) error
+
+	// Hash and SystemState (ALG-REQ-042 through ALG-REQ-048).
+	QueryStaleHashes(ctx context.Context) ([]nebula.StaleAssetHash, error)
+	QueryScopedStaleHashes(ctx context.Context, assetIDs []string) ([]nebula.StaleAssetHash, error)
+	UpdateAssetTTBAndHash(ctx context.Context, assetID string, newTTB float64, hashStr string) error
+	DecrementStaleCount(ctx context.Context, count int)
+	InvalidateAssetHash(ctx context.Context, assetID string)
+	QuerySystemState(ctx context.Context) (map[string]interface{}, error)
+	UpdateSystemState(ctx context.Context, merkleRoot int64, totalAssets int) error
+	ComputeMerkleRoot(ctx context.Context) (int64, int, error)
+	QueryAssetHashValidity(ctx context.Context, assetIDs []string) (map[string]bool, map[string]float64, error)
+	QueryAssetHashes(ctx context.Context, assetIDs []string) (map[string]string, error)
+
+	// TTB / TTT computation (ALG-REQ-060 through ALG-REQ-080).
+	// ComputeTTB is called concurrently, each call with its own audit buffer.
+	ComputeTTB(ctx context.Context, assetVid, chainVid string, params nebula.TTBParams, audit *store.AuditBuffer) (*nebula.TTBResult, error)
+	ComputeTTT(ctx context.Context, assetVid, techniqueVid string) (*nebula.TTTResult, error)
+	SimulateTTB(ctx context.Context, assetVid, chainVid string, params nebula.TTBParams, overlay nebula.MitigationOverlay) (*nebula.TTBResult, error)
+}
+
+// Backend names accepted by GRAPH_BACKEND.
+const (
+	BackendNebula = "nebula"
+	BackendMemory = "memory"
+)
+
+// New returns the GraphStore selected by cfg.GraphBackend. The Nebula pool is
+// only created for the nebula backend; the returned close function releases
+// whatever the backend holds and is safe to defer.
+func New(cfg *config.Config) (GraphStore, func(), error) {
+	switch cfg.GraphBackend {
+	case BackendNebula, "":
+		pool := nebula.NewPool(cfg)
+		ns := NewNebulaStore(pool, cfg)
+		return ns, func() {
+			ns.sessions.Close()
+			pool.Close()
+		}, nil
+	case BackendMemory:
+		ms := NewMemoryStore()
+		if cfg.GraphSeedFile != "" {
+			if err := ms.LoadFile(cfg.GraphSeedFile); err != nil {
+				return nil, nil, fmt.Errorf("graphstore: load seed %s: %w", cfg.GraphSeedFile, err)
+			}
+		}
+		slog.Info("graphstore: in-memory backend ready", "assets", ms.assetCount())
+		return ms, func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("graphstore: unknown backend %q (want %q or %q)",
+			cfg.GraphBackend, BackendNebula, BackendMemory)
+	}
+}
+
+// ======================================================================================================
+// Nebula backend
+// ======================================================================================================
+
+// NebulaStore is the GraphStore backed by a live NebulaGraph space.
+type NebulaStore struct {
+	pool     *nebula.Pool
+	cfg      *config.Config
+	sessions *nebula.SessionPool // reused by ComputeTTB, cfg.TTBWorkers sessions
+	mitre    *nebula.MitreCache  // nil when MITRE_SNAPSHOT is off
+}
+
+// NewNebulaStore wraps an existing connection pool.
+func NewNebulaStore(pool *nebula.Pool, cfg *config.Config) *NebulaStore {
+	n := &NebulaStore{pool: pool, cfg: cfg, sessions: nebula.NewSessionPool(pool, cfg, cfg.TTBWorkers)}
+	if cfg.MitreSnapshot {
+		n.mitre = nebula.NewMitreCache(cfg.MitreSnapshotCheck)
+	}
+	return n
+}
+
+// OnMitreVersionChange registers fn with the MITRE snapshot cache; see
+// nebula.MitreCache.OnVersionChange. It is a no-op when MITRE_SNAPSHOT is off.
+func (n *NebulaStore) OnMitreVersionChange(fn func(ctx context.Context, version string)) {
+	if n.mitre != nil {
+		n.mitre.OnVersionChange(fn)
+	}
+}
+
+func (n *NebulaStore) Ping(ctx context.Context) error {
+	return nebula.Ping(ctx, n.pool, n.cfg)
+}
+
+func (n *NebulaStore) QueryAssets(ctx context.Context) ([]nebula.AssetRow, error) {
+	return nebula.QueryAssets(ctx, n.pool, n.cfg)
+}
+
+func (n *NebulaStore) QueryAssetsWithDetails(ctx context.Context) ([]map[string]interface{}, error) {
+	return nebula.QueryAssetsWithDetails(ctx, n.pool, n.cfg)
+}
+
+func (n *NebulaStore) QueryAssetDetail(ctx context.Context, assetID string) (map[string]interface{}, error) {
+	return nebula.QueryAssetDetail(ctx, n.pool, n.cfg, assetID)
+}
+
+func (n *NebulaStore) QueryNeighbors(ctx context.Context, assetID string) ([]map[string]interface{}, error) {
+	return nebula.QueryNeighbors(ctx, n.pool, n.cfg, assetID)
+}
+
+func (n *NebulaStore) QueryAssetTypes(ctx context.Context) ([]map[string]interface{}, error) {
+	return nebula.QueryAssetTypes(ctx, n.pool, n.cfg)
+}
+
+func (n *NebulaStore) QueryEdgeConnections(ctx context.Context, sourceID, targetID string) ([]map[string]interface{}, error) {
+	return nebula.QueryEdgeConnections(ctx, n.pool, n.cfg, sourceID, targetID)
+}
+
+func (n *NebulaStore) QueryEntryPoints(ctx context.Context) ([]map[string]interface{}, error) {
+	return nebula.QueryEntryPoints(ctx, n.pool, n.cfg)
+}
+
+func (n *NebulaStore) QueryTargets(ctx context.Context) ([]map[string]interface{}, error) {
+	return nebula.QueryTargets(ctx, n.pool, n.cfg)
+}
+
+func (n *NebulaStore) QueryPaths(ctx context.Context, entryID, targetID string, maxHops int) ([]nebula.PathResult, error) {
+	return nebula.QueryPaths(ctx, n.pool, n.cfg, entryID, targetID, maxHops)
+}
+
+func (n *NebulaStore) QueryAssetTTB(ctx context.Context, assetID string) (int, error) {
+	return nebula.QueryAssetTTB(ctx, n.pool, n.cfg, assetID)
+}
+
+func (n *NebulaStore) QueryTopology(ctx context.Context) (*nebula.Topology, error) {
+	return nebula.QueryTopology(ctx, n.pool, n.cfg)
+}
+
+func (n *NebulaStore) ReplaceConnections(ctx context.Context, srcID, dstID string, conns []nebula.Connection) error {
+	return nebula.ReplaceConnections(ctx, n.pool, n.cfg, srcID, dstID, conns)
+}
+
+func (n *NebulaStore) QueryInventory(ctx context.Context) ([]nebula.AssetRecord, error) {
+	return nebula.QueryInventory(ctx, n.pool, n.cfg)
+}
+
+func (n *NebulaStore) QueryInventoryCatalog(ctx context.Context) (*nebula.InventoryCatalog, error) {
+	return nebula.QueryInventoryCatalog(ctx, n.pool, n.cfg)
+}
+
+func (n *NebulaStore) UpsertAsset(ctx context.Context, rec nebula.AssetRecord) error {
+	return nebula.UpsertAsset(ctx, n.pool, n.cfg, rec)
+}
+
+func (n *NebulaStore) QueryAttackInventory(ctx context.Context) (*nebula.AttackInventory, error) {
+	return nebula.QueryAttackInventory(ctx, n.pool, n.cfg)
+}
+
+func (n *NebulaStore) UpsertAttackRelease(ctx context.Context, rel *nebula.AttackRelease) error {
+	if err := nebula.UpsertAttackRelease(ctx, n.pool, n.cfg, rel); err != nil {
+		return err
+	}
+	if n.mitre != nil {
+		n.mitre.Invalidate()
+	}
+	return nil
+}
+
+func (n *NebulaStore) QueryMitigations(ctx context.Context) ([]map[string]interface{}, error) {
+	return nebula.QueryMitigations(ctx, n.pool, n.cfg)
+}
+
+func (n *NebulaStore) QueryAssetMitigations(ctx context.Context, assetID string) ([]map[string]interface{}, error) {
+	return nebula.QueryAssetMitigations(ctx, n.pool, n.cfg, assetID)
+}
+
+func (n *NebulaStore) UpsertMitigation(ctx context.Context, mitigationID, assetID string, maturity int, active bool) error {
+	return nebula.UpsertMitigation(ctx, n.pool, n.cfg, mitigationID, assetID, maturity, active)
+}
+
+func (n *NebulaStore) DeleteMitigation(ctx context.Context, mitigationID, assetID string) error {
+	return nebula.DeleteMitigation(ctx, n.pool, n.cfg, mitigationID, assetID)
+}
+
+func (n *NebulaStore) QueryTechniqueMitigations(ctx context.Context, techniqueIDs []string) (map[string][]string, error) {
+	return nebula.QueryTechniqueMitigations(ctx, n.pool, n.cfg, techniqueIDs)
+}
+
+func (n *NebulaStore) QueryDetectionControls(ctx context.Context) ([]nebula.DetectionControl, error) {
+	return nebula.QueryDetectionControls(ctx, n.pool, n.cfg)
+}
+
+func (n *NebulaStore) UpsertDetectionControl(ctx context.Context, ctl nebula.DetectionControl) error {
+	return nebula.UpsertDetectionControl(ctx, n.pool, n.cfg, ctl)
+}
+
+func (n *NebulaStore) QueryAssetDetections(ctx context.Context, assetID string) ([]nebula.AssetDetection, error) {
+	return nebula.QueryAssetDetections(ctx, n.pool, n.cfg, assetID)
+}
+
+func (n *NebulaStore) UpsertAssetDetection(ctx context.Context, controlID, assetID string, active bool) error {
+	return nebula.UpsertAssetDetection(ctx, n.pool, n.cfg, controlID, assetID, active)
+}
+
+func (n *NebulaStore) DeleteAssetDetection(ctx context.Context, controlID, assetID string) error {
+	return nebula.DeleteAssetDetection(ctx, n.pool, n.cfg, controlID, assetID)
+}
+
+func (n *NebulaStore) QueryDetectionCoverage(ctx context.Context, assetIDs []string) (map[string][]nebula.DetectionCoverage, error) {
+	return nebula.QueryDetectionCoverage(ctx, n.pool, n.cfg, assetIDs)
+}
+
+func (n *NebulaStore) QueryTacticChains(ctx context.Context) ([]nebula.TacticChain, error) {
+	return nebula.QueryTacticChains(ctx, n.pool, n.cfg)
+}
+
+// UpsertTacticChain also invalidates the MITRE snapshot, which holds the
+// chains' tactics.
+func (n *NebulaStore) UpsertTacticChain(ctx context.Context, chain nebula.TacticChain) error {
+	if err := nebula.UpsertTacticChain(ctx, n.pool, n.cfg, chain); err != nil {
+		return err
+	}
+	if n.mitre != nil {
+		n.mitre.Invalidate()
+	}
+	return nil
+}
+
+func (n *NebulaStore) DeleteTacticChain(ctx context.Context, chainID string) error {
+	if err := nebula.DeleteTacticChain(ctx, n.pool, n.cfg, chainID); err != nil {
+		return err
+	}
+	if n.mitre != nil {
+		n.mitre.Invalidate()
+	}
+	return nil
+}
+
+func (n *NebulaStore) QueryChainRules(ctx context.Context) ([]nebula.ChainRule, error) {
+	return nebula.QueryChainRules(ctx, n.pool, n.cfg)
+}
+
+func (n *NebulaStore) UpsertChainRule(ctx context.Context, rule nebula.ChainRule) error {
+	return nebula.UpsertChainRule(ctx, n.pool, n.cfg, rule)
+}
+
+func (n *NebulaStore) DeleteChainRule(ctx context.Context, ruleID string) error {
+	return nebula.DeleteChainRule(ctx, n.pool, n.cfg, ruleID)
+}
+
+func (n *NebulaStore) QueryStaleHashes(ctx context.Context) ([]nebula.StaleAssetHash, error) {
+	return nebula.QueryStaleHashes(ctx, n.pool, n.cfg)
+}
+
+func (n *NebulaStore) QueryScopedStaleHashes(ctx context.Context, assetIDs []string) ([]nebula.StaleAssetHash, error) {
+	return nebula.QueryScopedStaleHashes(ctx, n.pool, n.cfg, assetIDs)
+}
+
+func (n *NebulaStore) UpdateAssetTTBAndHash(ctx context.Context, assetID string, newTTB float64, hashStr string) error {
+	return nebula.UpdateAssetTTBAndHash(ctx, n.pool, n.cfg, assetID, newTTB, hashStr)
+}
+
+func (n *NebulaStore) DecrementStaleCount(ctx context.Context, count int) {
+	nebula.DecrementStaleCount(ctx, n.pool, n.cfg, count)
+}
+
+func (n *NebulaStore) InvalidateAssetHash(ctx context.Context, assetID string) {
+	nebula.InvalidateAssetHash(ctx, n.pool, n.cfg, assetID)
+}
+
+func (n *NebulaStore) QuerySystemState(ctx context.Context) (map[string]interface{}, error) {
+	return nebula.QuerySystemState(ctx, n.pool, n.cfg)
+}
+
+func (n *NebulaStore) UpdateSystemState(ctx context.Context, merkleRoot int64, totalAssets int) error {
+	return nebula.UpdateSystemState(ctx, n.pool, n.cfg, merkleRoot, totalAssets)
+}
+
+func (n *NebulaStore) ComputeMerkleRoot(ctx context.Context) (int64, int, error) {
+	return nebula.ComputeMerkleRoot(ctx, n.pool, n.cfg)
+}
+
+func (n *NebulaStore) QueryAssetHashValidity(ctx context.Context, assetIDs []string) (map[string]bool, map[string]float64, error) {
+	return nebula.QueryAssetHashValidity(ctx, n.pool, n.cfg, assetIDs)
+}
+
+func (n *NebulaStore) QueryAssetHashes(ctx context.Context, assetIDs []string) (map[string]string, error) {
+	return nebula.QueryAssetHashes(ctx, n.pool, n.cfg, assetIDs)
+}
+
+func (n *NebulaStore) ComputeTTB(ctx context.Context, assetVid, chainVid string, params nebula.TTBParams, audit *store.AuditBuffer) (*nebula.TTBResult, error) {
+	return nebula.ComputeTTB(ctx, n.sessions, n.mitre, assetVid, chainVid, params, audit)
+}
+
+func (n *NebulaStore) ComputeTTT(ctx context.Context, assetVid, techniqueVid string) (*nebula.TTTResult, error) {
+	return nebula.ComputeTTT(ctx, n.pool, n.cfg, assetVid, techniqueVid)
+}
+
+func (n *NebulaStore) SimulateTTB(ctx context.Context, assetVid, chainVid string, params nebula.TTBParams, overlay nebula.MitigationOverlay) (*nebula.TTBResult, error) {
+	return nebula.SimulateTTB(ctx, n.pool, n.cfg, n.mitre, assetVid, chainVid, params, overlay)
+}
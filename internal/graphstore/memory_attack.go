@@ -0,0 +1,217 @@
+package graphstore
+
+import (
+	"ESP-data/internal/nebula"
+	"context"
+)
+
+// ======================================================================================================
+// MITRE ATT&CK catalog (TA005, TA007, TA008, TA011; ED003, ED005, ED009, ED010)
+// ======================================================================================================
+
+// QueryAttackInventory mirrors nebula.QueryAttackInventory.
+func (m *MemoryStore) QueryAttackInventory(ctx context.Context) (*nebula.AttackInventory, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	inv := &nebula.AttackInventory{
+		TacticIDs:     make(map[string]bool, len(m.tactics)),
+		TechniqueIDs:  make(map[string]bool, len(m.techniques)),
+		MitigationIDs: make(map[string]bool, len(m.mitigations)),
+		Platforms:     make(map[string]string, len(m.data.Platforms)),
+	}
+	for id := range m.tactics {
+		inv.TacticIDs[id] = true
+	}
+	for id := range m.techniques {
+		inv.TechniqueIDs[id] = true
+	}
+	for id := range m.mitigations {
+		inv.MitigationIDs[id] = true
+	}
+	for _, p := range m.data.Platforms {
+		inv.Platforms[p.PlatformName] = p.PlatformID
+	}
+	return inv, nil
+}
+
+// UpsertAttackRelease mirrors nebula.UpsertAttackRelease: MITRE-sourced
+// properties are overwritten, curated technique fields are kept, new
+// techniques take the TA008 defaults, and edges are added once. Edges of
+// the release's techniques that it no longer lists are removed.
+func (m *MemoryStore) UpsertAttackRelease(ctx context.Context, rel *nebula.AttackRelease) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d := &m.data
+
+	platformIdx := make(map[string]int, len(d.Platforms))
+	for i, p := range d.Platforms {
+		platformIdx[p.PlatformID] = i
+	}
+	for _, p := range rel.Platforms {
+		if i, ok := platformIdx[p.PlatformID]; ok {
+			d.Platforms[i].PlatformName = p.PlatformName
+			continue
+		}
+		platformIdx[p.PlatformID] = len(d.Platforms)
+		d.Platforms = append(d.Platforms, Platform{PlatformID: p.PlatformID, PlatformName: p.PlatformName})
+	}
+
+	tacticIdx := make(map[string]int, len(d.Tactics))
+	for i, t := range d.Tactics {
+		tacticIdx[t.TacticID] = i
+	}
+	for _, t := range rel.Tactics {
+		i, ok := tacticIdx[t.TacticID]
+		if !ok {
+			i = len(d.Tactics)
+			tacticIdx[t.TacticID] = i
+			d.Tactics = append(d.Tactics, Tactic{TacticID: t.TacticID})
+		}
+		d.Tactics[i].TacticName = t.TacticName
+		d.Tactics[i].MitreAttackVersion = rel.Version
+	}
+
+	techniqueIdx := make(map[string]int, len(d.Techniques))
+	for i, t := range d.Techniques {
+		techniqueIdx[t.TechniqueID] = i
+	}
+	for _, t := range rel.Techniques {
+		i, ok := techniqueIdx[t.TechniqueID]
+		if !ok {
+			i = len(d.Techniques)
+			techniqueIdx[t.TechniqueID] = i
+			d.Techniques = append(d.Techniques, Technique{
+				TechniqueID:  t.TechniqueID,
+				Priority:     4,
+				ExecutionMin: 0.1667,
+				ExecutionMax: 120.0,
+			})
+		}
+		d.Techniques[i].TechniqueName = t.TechniqueName
+		d.Techniques[i].MitreAttackVersion = rel.Version
+	}
+
+	mitigationIdx := make(map[string]int, len(d.Mitigations))
+	for i, mit := range d.Mitigations {
+		mitigationIdx[mit.MitigationID] = i
+	}
+	for _, mit := range rel.Mitigations {
+		i, ok := mitigationIdx[mit.MitigationID]
+		if !ok {
+			i = len(d.Mitigations)
+			mitigationIdx[mit.MitigationID] = i
+			d.Mitigations = append(d.Mitigations, Mitigation{MitigationID: mit.MitigationID})
+		}
+		d.Mitigations[i].MitigationName = mit.MitigationName
+		d.Mitigations[i].Matrix = "Enterprise"
+		d.Mitigations[i].Description = mit.Description
+		d.Mitigations[i].MitigationVersion = mit.Version
+	}
+
+	partOf := edgeSet(d.PartOf)
+	canExec := edgeSet(d.CanBeExecutedOn)
+	subtech := edgeSet(d.HasSubtechnique)
+	for _, t := range rel.Techniques {
+		for _, tactic := range t.TacticIDs {
+			d.PartOf = addEdge(d.PartOf, partOf, t.TechniqueID, tactic)
+		}
+		for _, p := range t.PlatformIDs {
+			d.CanBeExecutedOn = addEdge(d.CanBeExecutedOn, canExec, t.TechniqueID, p)
+		}
+		if t.ParentID != "" {
+			d.HasSubtechnique = addEdge(d.HasSubtechnique, subtech, t.ParentID, t.TechniqueID)
+		}
+	}
+
+	mitigatesIdx := make(map[Edge]int, len(d.Mitigates))
+	for i, e := range d.Mitigates {
+		mitigatesIdx[e.Edge] = i
+	}
+	for _, mit := range rel.Mitigations {
+		for _, u := range mit.Uses {
+			e := Edge{Src: mit.MitigationID, Dst: u.TechniqueID}
+			if i, ok := mitigatesIdx[e]; ok {
+				d.Mitigates[i].UseDescription = u.UseDescription
+				d.Mitigates[i].Domain = "Enterprise"
+				continue
+			}
+			mitigatesIdx[e] = len(d.Mitigates)
+			d.Mitigates = append(d.Mitigates, Mitigates{Edge: e, UseDescription: u.UseDescription, Domain: "Enterprise"})
+		}
+	}
+
+	// Stale edges: outgoing part_of / can_be_executed_on and incoming
+	// has_subtechnique / mitigates of every technique in the release
+	inRelease := make(map[string]bool, len(rel.Techniques))
+	listed := make(map[string]map[[2]string]bool)
+	list := func(edgeType, src, dst string) {
+		if listed[edgeType] == nil {
+			listed[edgeType] = make(map[[2]string]bool)
+		}
+		listed[edgeType][[2]string{src, dst}] = true
+	}
+	for _, t := range rel.Techniques {
+		inRelease[t.TechniqueID] = true
+		for _, tactic := range t.TacticIDs {
+			list("part_of", t.TechniqueID, tactic)
+		}
+		for _, p := range t.PlatformIDs {
+			list("can_be_executed_on", t.TechniqueID, p)
+		}
+		if t.ParentID != "" {
+			list("has_subtechnique", t.ParentID, t.TechniqueID)
+		}
+	}
+	for _, mit := range rel.Mitigations {
+		for _, u := range mit.Uses {
+			list("mitigates", mit.MitigationID, u.TechniqueID)
+		}
+	}
+	keep := func(edgeType string, e Edge, technique string) bool {
+		return !inRelease[technique] || listed[edgeType][[2]string{e.Src, e.Dst}]
+	}
+	d.PartOf = filterEdges(d.PartOf, func(e Edge) bool { return keep("part_of", e, e.Src) })
+	d.CanBeExecutedOn = filterEdges(d.CanBeExecutedOn, func(e Edge) bool { return keep("can_be_executed_on", e, e.Src) })
+	d.HasSubtechnique = filterEdges(d.HasSubtechnique, func(e Edge) bool { return keep("has_subtechnique", e, e.Dst) })
+	kept := d.Mitigates[:0]
+	for _, e := range d.Mitigates {
+		if keep("mitigates", e.Edge, e.Dst) {
+			kept = append(kept, e)
+		}
+	}
+	d.Mitigates = kept
+
+	m.reindex()
+	return nil
+}
+
+// filterEdges keeps the edges for which keep returns true, in place.
+func filterEdges(edges []Edge, keep func(Edge) bool) []Edge {
+	kept := edges[:0]
+	for _, e := range edges {
+		if keep(e) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// edgeSet indexes rank-0 property-less edges for IF NOT EXISTS semantics.
+func edgeSet(edges []Edge) map[Edge]bool {
+	set := make(map[Edge]bool, len(edges))
+	for _, e := range edges {
+		set[e] = true
+	}
+	return set
+}
+
+func addEdge(edges []Edge, set map[Edge]bool, src, dst string) []Edge {
+	e := Edge{Src: src, Dst: dst}
+	if set[e] {
+		return edges
+	}
+	set[e] = true
+	return append(edges, e)
+}
@@ -0,0 +1,145 @@
+package graphstore
+
+import (
+	"context"
+	"sort"
+
+	"ESP-data/internal/nebula"
+)
+
+// ======================================================================================================
+// Tactic chains and chain rules (TA010, TA013; ED013)
+// ======================================================================================================
+
+// QueryTacticChains mirrors nebula.QueryTacticChains: chains sorted by ID,
+// tactics in rank order.
+func (m *MemoryStore) QueryTacticChains(ctx context.Context) ([]nebula.TacticChain, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	chains := make([]nebula.TacticChain, 0, len(m.data.Chains))
+	for _, tc := range m.data.Chains {
+		chain := nebula.TacticChain{
+			ChainID:     tc.ChainID,
+			ChainName:   tc.ChainName,
+			Description: tc.Description,
+			Tactics:     make([]string, 0, len(m.chainIncludes[tc.ChainID])),
+		}
+		for _, e := range m.chainIncludes[tc.ChainID] {
+			chain.Tactics = append(chain.Tactics, e.Dst)
+		}
+		chains = append(chains, chain)
+	}
+	sort.Slice(chains, func(i, j int) bool { return chains[i].ChainID < chains[j].ChainID })
+	return chains, nil
+}
+
+// UpsertTacticChain mirrors nebula.UpsertTacticChain.
+func (m *MemoryStore) UpsertTacticChain(ctx context.Context, chain nebula.TacticChain) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tc := TacticChain{
+		ChainID:     chain.ChainID,
+		ChainName:   chain.ChainName,
+		Description: chain.Description,
+	}
+	if existing, ok := m.chains[chain.ChainID]; ok {
+		*existing = tc
+	} else {
+		m.data.Chains = append(m.data.Chains, tc)
+	}
+
+	m.data.ChainIncludes = withoutSource(m.data.ChainIncludes, chain.ChainID)
+	for i, tactic := range chain.Tactics {
+		m.data.ChainIncludes = append(m.data.ChainIncludes, Edge{Src: chain.ChainID, Dst: tactic, Rank: int64(i)})
+	}
+	m.reindex()
+	return nil
+}
+
+// DeleteTacticChain mirrors nebula.DeleteTacticChain.
+func (m *MemoryStore) DeleteTacticChain(ctx context.Context, chainID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.data.Chains[:0]
+	for _, tc := range m.data.Chains {
+		if tc.ChainID != chainID {
+			kept = append(kept, tc)
+		}
+	}
+	m.data.Chains = kept
+	m.data.ChainIncludes = withoutSource(m.data.ChainIncludes, chainID)
+	m.reindex()
+	return nil
+}
+
+// withoutSource returns edges without those leaving src, reusing its array.
+func withoutSource(edges []Edge, src string) []Edge {
+	kept := edges[:0]
+	for _, e := range edges {
+		if e.Src != src {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// QueryChainRules mirrors nebula.QueryChainRules.
+func (m *MemoryStore) QueryChainRules(ctx context.Context) ([]nebula.ChainRule, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rules := make([]nebula.ChainRule, 0, len(m.data.ChainRules))
+	for _, r := range m.data.ChainRules {
+		rules = append(rules, nebula.ChainRule{
+			RuleID:    r.RuleID,
+			ChainID:   r.ChainID,
+			Position:  r.Position,
+			TypeID:    r.TypeID,
+			SegmentID: r.SegmentID,
+			Priority:  r.Priority,
+		})
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].RuleID < rules[j].RuleID })
+	return rules, nil
+}
+
+// UpsertChainRule mirrors nebula.UpsertChainRule.
+func (m *MemoryStore) UpsertChainRule(ctx context.Context, rule nebula.ChainRule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cr := ChainRule{
+		RuleID:    rule.RuleID,
+		ChainID:   rule.ChainID,
+		Position:  rule.Position,
+		TypeID:    rule.TypeID,
+		SegmentID: rule.SegmentID,
+		Priority:  rule.Priority,
+	}
+	if existing, ok := m.chainRules[rule.RuleID]; ok {
+		*existing = cr
+		return nil
+	}
+	m.data.ChainRules = append(m.data.ChainRules, cr)
+	m.reindex()
+	return nil
+}
+
+// DeleteChainRule mirrors nebula.DeleteChainRule.
+func (m *MemoryStore) DeleteChainRule(ctx context.Context, ruleID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.data.ChainRules[:0]
+	for _, r := range m.data.ChainRules {
+		if r.RuleID != ruleID {
+			kept = append(kept, r)
+		}
+	}
+	m.data.ChainRules = kept
+	m.reindex()
+	return nil
+}
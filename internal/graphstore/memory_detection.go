@@ -0,0 +1,178 @@
+package graphstore
+
+import (
+	"context"
+	"sort"
+
+	"ESP-data/internal/nebula"
+)
+
+// ======================================================================================================
+// Detection controls (TA012; ED015, ED016)
+// ======================================================================================================
+
+// QueryDetectionControls mirrors nebula.QueryDetectionControls: controls
+// sorted by ID, coverage for existing techniques only.
+func (m *MemoryStore) QueryDetectionControls(ctx context.Context) ([]nebula.DetectionControl, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	controls := make([]nebula.DetectionControl, 0, len(m.data.DetectionControls))
+	for _, dc := range m.data.DetectionControls {
+		ctl := nebula.DetectionControl{
+			ControlID:     dc.ControlID,
+			ControlName:   dc.ControlName,
+			Description:   dc.Description,
+			DetectionTime: dc.DetectionTime,
+			Coverage:      make(map[string]int),
+		}
+		for _, e := range m.detectsOut[dc.ControlID] {
+			if _, ok := m.techniques[e.Dst]; ok {
+				ctl.Coverage[e.Dst] = e.Coverage
+			}
+		}
+		controls = append(controls, ctl)
+	}
+	sort.Slice(controls, func(i, j int) bool { return controls[i].ControlID < controls[j].ControlID })
+	return controls, nil
+}
+
+// UpsertDetectionControl mirrors nebula.UpsertDetectionControl.
+func (m *MemoryStore) UpsertDetectionControl(ctx context.Context, ctl nebula.DetectionControl) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dc := DetectionControl{
+		ControlID:     ctl.ControlID,
+		ControlName:   ctl.ControlName,
+		Description:   ctl.Description,
+		DetectionTime: ctl.DetectionTime,
+	}
+	if existing, ok := m.detections[ctl.ControlID]; ok {
+		*existing = dc
+	} else {
+		m.data.DetectionControls = append(m.data.DetectionControls, dc)
+	}
+
+	kept := m.data.Detects[:0]
+	for _, e := range m.data.Detects {
+		if e.Src != ctl.ControlID {
+			kept = append(kept, e)
+		}
+	}
+	m.data.Detects = kept
+	techniques := make([]string, 0, len(ctl.Coverage))
+	for tech := range ctl.Coverage {
+		techniques = append(techniques, tech)
+	}
+	sort.Strings(techniques)
+	for _, tech := range techniques {
+		m.data.Detects = append(m.data.Detects, Detects{
+			Edge:     Edge{Src: ctl.ControlID, Dst: tech},
+			Coverage: ctl.Coverage[tech],
+		})
+	}
+	m.reindex()
+	return nil
+}
+
+// QueryAssetDetections mirrors nebula.QueryAssetDetections.
+func (m *MemoryStore) QueryAssetDetections(ctx context.Context, assetID string) ([]nebula.AssetDetection, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	detections := make([]nebula.AssetDetection, 0)
+	for _, e := range m.monitorsIn[assetID] {
+		dc, ok := m.detections[e.Src]
+		if !ok {
+			continue
+		}
+		detections = append(detections, nebula.AssetDetection{
+			ControlID:   dc.ControlID,
+			ControlName: dc.ControlName,
+			Active:      *e.Active,
+		})
+	}
+	sort.Slice(detections, func(i, j int) bool { return detections[i].ControlID < detections[j].ControlID })
+	return detections, nil
+}
+
+// UpsertAssetDetection mirrors nebula.UpsertAssetDetection (rank 0).
+func (m *MemoryStore) UpsertAssetDetection(ctx context.Context, controlID, assetID string, active bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.data.Monitors {
+		e := &m.data.Monitors[i]
+		if e.Src == controlID && e.Dst == assetID && e.Rank == 0 {
+			e.Active = &active
+			return nil
+		}
+	}
+	m.data.Monitors = append(m.data.Monitors, Monitors{
+		Edge:   Edge{Src: controlID, Dst: assetID},
+		Active: &active,
+	})
+	m.reindex()
+	return nil
+}
+
+// DeleteAssetDetection mirrors nebula.DeleteAssetDetection; only rank 0 is removed.
+func (m *MemoryStore) DeleteAssetDetection(ctx context.Context, controlID, assetID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.data.Monitors[:0]
+	for _, e := range m.data.Monitors {
+		if e.Src == controlID && e.Dst == assetID && e.Rank == 0 {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	m.data.Monitors = kept
+	m.reindex()
+	return nil
+}
+
+// QueryDetectionCoverage mirrors nebula.QueryDetectionCoverage: the
+// detects edges of every active control on each asset, for existing
+// controls and techniques, ordered by control and technique.
+func (m *MemoryStore) QueryDetectionCoverage(ctx context.Context, assetIDs []string) (map[string][]nebula.DetectionCoverage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(map[string][]nebula.DetectionCoverage)
+	for _, assetID := range assetIDs {
+		if _, ok := m.assets[assetID]; !ok {
+			continue
+		}
+		var coverage []nebula.DetectionCoverage
+		for _, mon := range m.monitorsIn[assetID] {
+			dc, ok := m.detections[mon.Src]
+			if !ok || !*mon.Active {
+				continue
+			}
+			for _, e := range m.detectsOut[dc.ControlID] {
+				if _, ok := m.techniques[e.Dst]; !ok {
+					continue
+				}
+				coverage = append(coverage, nebula.DetectionCoverage{
+					ControlID:     dc.ControlID,
+					TechniqueID:   e.Dst,
+					Coverage:      e.Coverage,
+					DetectionTime: dc.DetectionTime,
+				})
+			}
+		}
+		if len(coverage) > 0 {
+			sort.Slice(coverage, func(i, j int) bool {
+				if coverage[i].ControlID != coverage[j].ControlID {
+					return coverage[i].ControlID < coverage[j].ControlID
+				}
+				return coverage[i].TechniqueID < coverage[j].TechniqueID
+			})
+			result[assetID] = coverage
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,257 @@
+package graphstore
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ESP-data/internal/nebula"
+)
+
+// ======================================================================================================
+// Hash computation and SystemState (ALG-REQ-042 through ALG-REQ-048)
+// ======================================================================================================
+
+// hashString stands in for NebulaGraph's built-in hash(). Values differ from
+// the database, but each backend is only ever compared against its own hashes.
+func hashString(s string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return int64(h.Sum64())
+}
+
+// computeAssetHash builds the same concat_ws("##", …) input as the ALG-REQ-042
+// query. ok is false when the asset lacks runs_on or has_type (excluded by MATCH).
+// Caller must hold m.mu.
+func (m *MemoryStore) computeAssetHash(a *Asset) (int64, bool) {
+	osType, ok := m.osTypes[m.runsOn[a.AssetID]]
+	if !ok {
+		return 0, false
+	}
+	typeName, ok := m.assetTypeName(a.AssetID)
+	if !ok {
+		return 0, false
+	}
+
+	type connPart struct{ src, proto, port string }
+	var conns []connPart
+	for _, c := range m.connIn[a.AssetID] {
+		if _, ok := m.assets[c.Src]; !ok {
+			continue
+		}
+		conns = append(conns, connPart{c.Src, c.ConnectionProtocol, c.ConnectionPort})
+	}
+	sort.Slice(conns, func(i, j int) bool {
+		if conns[i].src != conns[j].src {
+			return conns[i].src < conns[j].src
+		}
+		if conns[i].proto != conns[j].proto {
+			return conns[i].proto < conns[j].proto
+		}
+		return conns[i].port < conns[j].port
+	})
+	var connStr strings.Builder
+	for _, c := range conns {
+		connStr.WriteString(c.src + "|" + c.proto + "|" + c.port + ";")
+	}
+
+	var mits []*AppliedTo
+	for _, e := range m.appliedIn[a.AssetID] {
+		if _, ok := m.mitigations[e.Src]; ok {
+			mits = append(mits, e)
+		}
+	}
+	sort.Slice(mits, func(i, j int) bool { return mits[i].Src < mits[j].Src })
+	var mitStr strings.Builder
+	for _, e := range mits {
+		mitStr.WriteString(e.Src + "|" + strconv.Itoa(e.Maturity) + "|" + strconv.FormatBool(*e.Active) + ";")
+	}
+
+	input := strings.Join([]string{
+		connStr.String(),
+		mitStr.String(),
+		strconv.FormatBool(a.HasVulnerability),
+		osType.OSName,
+		typeName,
+	}, "##")
+	return hashString(input), true
+}
+
+// staleHashes returns hash rows for stale assets, optionally restricted to
+// scope. Caller must hold m.mu.
+func (m *MemoryStore) staleHashes(scope map[string]bool) []nebula.StaleAssetHash {
+	results := make([]nebula.StaleAssetHash, 0)
+	for _, id := range m.sortedAssetIDs() {
+		if scope != nil && !scope[id] {
+			continue
+		}
+		a := m.assets[id]
+		if a.HashValid {
+			continue
+		}
+		computed, ok := m.computeAssetHash(a)
+		if !ok {
+			continue
+		}
+		results = append(results, nebula.StaleAssetHash{
+			AssetID:      a.AssetID,
+			CurrentTTB:   a.TTB,
+			StoredHash:   a.Hash,
+			ComputedHash: computed,
+		})
+	}
+	return results
+}
+
+// QueryStaleHashes mirrors nebula.QueryStaleHashes (ALG-REQ-042).
+func (m *MemoryStore) QueryStaleHashes(ctx context.Context) ([]nebula.StaleAssetHash, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.staleHashes(nil), nil
+}
+
+// QueryScopedStaleHashes mirrors nebula.QueryScopedStaleHashes (ALG-REQ-046 step 4).
+func (m *MemoryStore) QueryScopedStaleHashes(ctx context.Context, assetIDs []string) ([]nebula.StaleAssetHash, error) {
+	if len(assetIDs) == 0 {
+		return nil, nil
+	}
+	scope := make(map[string]bool, len(assetIDs))
+	for _, id := range assetIDs {
+		scope[id] = true
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.staleHashes(scope), nil
+}
+
+// UpdateAssetTTBAndHash mirrors nebula.UpdateAssetTTBAndHash (ALG-REQ-045 step 2b).
+func (m *MemoryStore) UpdateAssetTTBAndHash(ctx context.Context, assetID string, newTTB float64, hashStr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.assets[assetID]
+	if !ok {
+		return fmt.Errorf("update failed: asset %s not found", assetID)
+	}
+	a.TTB = newTTB
+	a.Hash = hashStr
+	a.HashValid = true
+	return nil
+}
+
+// DecrementStaleCount mirrors nebula.DecrementStaleCount (ALG-REQ-046 cleanup),
+// flooring stale_count at 0.
+func (m *MemoryStore) DecrementStaleCount(ctx context.Context, count int) {
+	if count <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sysState.StaleCount -= count
+	if m.sysState.StaleCount < 0 {
+		m.sysState.StaleCount = 0
+	}
+}
+
+// InvalidateAssetHash mirrors nebula.InvalidateAssetHash (ALG-REQ-043).
+func (m *MemoryStore) InvalidateAssetHash(ctx context.Context, assetID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.assets[assetID]
+	if !ok {
+		slog.ErrorContext(ctx, "graphstore: InvalidateAssetHash (asset) failed: not found", "asset", assetID)
+		return
+	}
+	a.HashValid = false
+	m.sysState.StaleCount++
+	slog.InfoContext(ctx, "graphstore: invalidated hash", "asset", assetID)
+}
+
+// QuerySystemState mirrors nebula.QuerySystemState (ALG-REQ-048).
+func (m *MemoryStore) QuerySystemState(ctx context.Context) (map[string]interface{}, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s := m.sysState
+	return map[string]interface{}{
+		"state_id":         s.StateID,
+		"merkle_root":      s.MerkleRoot,
+		"last_recalc_time": s.LastRecalcTime,
+		"total_assets":     s.TotalAssets,
+		"stale_count":      s.StaleCount,
+	}, nil
+}
+
+// UpdateSystemState mirrors nebula.UpdateSystemState (ALG-REQ-045 step 3).
+func (m *MemoryStore) UpdateSystemState(ctx context.Context, merkleRoot int64, totalAssets int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sysState.MerkleRoot = merkleRoot
+	m.sysState.LastRecalcTime = time.Now().UTC().Format("2006-01-02T15:04:05.000000")
+	m.sysState.TotalAssets = totalAssets
+	m.sysState.StaleCount = 0
+	return nil
+}
+
+// ComputeMerkleRoot mirrors nebula.ComputeMerkleRoot (ALG-REQ-047): the hash
+// of all asset hashes concatenated in Asset_ID order.
+func (m *MemoryStore) ComputeMerkleRoot(ctx context.Context) (int64, int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.assets) == 0 {
+		return 0, 0, nil
+	}
+	var sb strings.Builder
+	for _, id := range m.sortedAssetIDs() {
+		sb.WriteString(m.assets[id].Hash + ";")
+	}
+	return hashString(sb.String()), len(m.assets), nil
+}
+
+// QueryAssetHashValidity mirrors nebula.QueryAssetHashValidity (ALG-REQ-046 step 3).
+func (m *MemoryStore) QueryAssetHashValidity(ctx context.Context, assetIDs []string) (map[string]bool, map[string]float64, error) {
+	if len(assetIDs) == 0 {
+		return nil, nil, nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	validity := make(map[string]bool, len(assetIDs))
+	ttbs := make(map[string]float64, len(assetIDs))
+	for _, id := range assetIDs {
+		a, ok := m.assets[id]
+		if !ok {
+			continue
+		}
+		validity[id] = a.HashValid
+		ttbs[id] = a.TTB
+	}
+	return validity, ttbs, nil
+}
+
+// QueryAssetHashes mirrors nebula.QueryAssetHashes (ALG-REQ-053).
+func (m *MemoryStore) QueryAssetHashes(ctx context.Context, assetIDs []string) (map[string]string, error) {
+	if len(assetIDs) == 0 {
+		return nil, nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	hashes := make(map[string]string, len(assetIDs))
+	for _, id := range assetIDs {
+		if a, ok := m.assets[id]; ok && a.HashValid && a.Hash != "" {
+			hashes[id] = a.Hash
+		}
+	}
+	return hashes, nil
+}
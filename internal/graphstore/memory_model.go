@@ -0,0 +1,258 @@
+package graphstore
+
+// ======================================================================================================
+// In-memory ESP01 entities (SCHEMA TA001–TA013, ED001–ED016)
+// ======================================================================================================
+//
+// JSON field names follow the NebulaGraph property names so that a seed file
+// can be produced straight from the schema document or a Studio export.
+// Every vertex VID equals its ID property (SCHEMA TA001 notes).
+
+// Asset mirrors TA001.
+type Asset struct {
+	AssetID          string  `json:"Asset_ID"`
+	AssetName        string  `json:"Asset_Name"`
+	AssetDescription string  `json:"Asset_Description,omitempty"`
+	AssetNote        string  `json:"Asset_Note,omitempty"`
+	IsEntrance       bool    `json:"is_entrance"`
+	IsTarget         bool    `json:"is_target"`
+	Priority         int     `json:"priority,omitempty"`
+	HasVulnerability bool    `json:"has_vulnerability"`
+	TTB              float64 `json:"TTB,omitempty"`
+	Hash             string  `json:"hash,omitempty"`
+	HashValid        bool    `json:"hash_valid"`
+}
+
+// AssetType mirrors TA002.
+type AssetType struct {
+	TypeID          string `json:"Type_ID"`
+	TypeName        string `json:"Type_Name"`
+	TypeDescription string `json:"Type_Description,omitempty"`
+}
+
+// NetworkSegment mirrors TA003.
+type NetworkSegment struct {
+	SegmentID          string `json:"Segment_ID"`
+	SegmentName        string `json:"Segment_Name"`
+	SegmentDescription string `json:"Segment_Description,omitempty"`
+}
+
+// OSType mirrors TA004.
+type OSType struct {
+	OSID      string `json:"OS_ID"`
+	OSName    string `json:"OS_Name"`
+	OSVersion string `json:"OS_Version,omitempty"`
+	OSVendor  string `json:"OS_Vendor,omitempty"`
+}
+
+// Mitigation mirrors TA005.
+type Mitigation struct {
+	MitigationID      string `json:"Mitigation_ID"`
+	MitigationName    string `json:"Mitigation_Name"`
+	Matrix            string `json:"Matrix,omitempty"`
+	Description       string `json:"Description,omitempty"`
+	MitigationVersion string `json:"Mitigation_Version,omitempty"`
+}
+
+// State mirrors TA006; StateID has the form "TA0001|T1133".
+type State struct {
+	StateID string `json:"state_id"`
+}
+
+// Tactic mirrors TA007.
+type Tactic struct {
+	TacticID           string `json:"Tactic_ID"`
+	TacticName         string `json:"Tactic_Name"`
+	MitreAttackVersion string `json:"Mitre_Attack_Version,omitempty"`
+}
+
+// Technique mirrors TA008.
+type Technique struct {
+	TechniqueID        string  `json:"Technique_ID"`
+	TechniqueName      string  `json:"Technique_Name"`
+	MitreAttackVersion string  `json:"Mitre_Attack_Version,omitempty"`
+	Rcelpe             bool    `json:"rcelpe"`
+	Priority           int     `json:"priority,omitempty"`
+	ExecutionMin       float64 `json:"execution_min,omitempty"`
+	ExecutionMax       float64 `json:"execution_max,omitempty"`
+}
+
+// SystemState mirrors TA009.
+type SystemState struct {
+	StateID        string `json:"state_id"`
+	MerkleRoot     int64  `json:"merkle_root"`
+	LastRecalcTime string `json:"last_recalc_time,omitempty"`
+	TotalAssets    int    `json:"total_assets"`
+	StaleCount     int    `json:"stale_count"`
+}
+
+// TacticChain mirrors TA010.
+type TacticChain struct {
+	ChainID     string `json:"chain_id"`
+	ChainName   string `json:"chain_name"`
+	Description string `json:"description,omitempty"`
+}
+
+// Platform mirrors TA011.
+type Platform struct {
+	PlatformID          string `json:"platform_id"`
+	PlatformName        string `json:"platform_name"`
+	PlatformDescription string `json:"platform_description,omitempty"`
+}
+
+// DetectionControl mirrors TA012.
+type DetectionControl struct {
+	ControlID     string  `json:"Control_ID"`
+	ControlName   string  `json:"Control_Name"`
+	Description   string  `json:"Description,omitempty"`
+	DetectionTime float64 `json:"Detection_Time,omitempty"`
+}
+
+// ChainRule mirrors TA013.
+type ChainRule struct {
+	RuleID    string `json:"Rule_ID"`
+	ChainID   string `json:"Chain_ID"`
+	Position  string `json:"Position,omitempty"`
+	TypeID    string `json:"Type_ID,omitempty"`
+	SegmentID string `json:"Segment_ID,omitempty"`
+	Priority  int    `json:"Priority,omitempty"`
+}
+
+// Edge is a property-less edge; Rank follows the ED006 rank convention.
+type Edge struct {
+	Src  string `json:"src"`
+	Dst  string `json:"dst"`
+	Rank int64  `json:"rank,omitempty"`
+}
+
+// ConnectsTo mirrors ED006.
+type ConnectsTo struct {
+	Edge
+	ConnectionProtocol string `json:"Connection_Protocol"`
+	ConnectionPort     string `json:"Connection_Port"`
+}
+
+// AppliedTo mirrors ED001. Active is a pointer so that an omitted value
+// takes the schema default (true).
+type AppliedTo struct {
+	Edge
+	Version  string `json:"Version,omitempty"`
+	Maturity int    `json:"Maturity,omitempty"`
+	Active   *bool  `json:"Active,omitempty"`
+}
+
+// Mitigates mirrors ED009.
+type Mitigates struct {
+	Edge
+	UseDescription string `json:"Use_Description,omitempty"`
+	Domain         string `json:"Domain,omitempty"`
+}
+
+// PatternsTo mirrors ED012.
+type PatternsTo struct {
+	Edge
+	Probability   float64 `json:"probability,omitempty"`
+	ObservedCount int64   `json:"observed_count,omitempty"`
+}
+
+// Detects mirrors ED015.
+type Detects struct {
+	Edge
+	Coverage int `json:"Coverage,omitempty"`
+}
+
+// Monitors mirrors ED016. Active is a pointer as in AppliedTo.
+type Monitors struct {
+	Edge
+	Active *bool `json:"Active,omitempty"`
+}
+
+// Snapshot is the serialised content of a MemoryStore, keyed by tag and edge names.
+type Snapshot struct {
+	Assets      []Asset          `json:"Asset"`
+	AssetTypes  []AssetType      `json:"Asset_Type"`
+	Segments    []NetworkSegment `json:"Network_Segment"`
+	OSTypes     []OSType         `json:"OS_Type"`
+	Platforms   []Platform       `json:"MitrePlatform"`
+	Tactics     []Tactic         `json:"tMitreTactic"`
+	Techniques  []Technique      `json:"tMitreTechnique"`
+	Mitigations []Mitigation     `json:"tMitreMitigation"`
+	States      []State          `json:"tMitreState"`
+	Chains      []TacticChain    `json:"TacticChain"`
+	SystemState []SystemState    `json:"SystemState"`
+
+	DetectionControls []DetectionControl `json:"DetectionControl"`
+	ChainRules        []ChainRule        `json:"ChainRule"`
+
+	HasType         []Edge       `json:"has_type"`
+	BelongsTo       []Edge       `json:"belongs_to"`
+	RunsOn          []Edge       `json:"runs_on"`
+	Implements      []Edge       `json:"implements"`
+	Represents      []Edge       `json:"represents"`
+	ConnectsTo      []ConnectsTo `json:"connects_to"`
+	AppliedTo       []AppliedTo  `json:"applied_to"`
+	Mitigates       []Mitigates  `json:"mitigates"`
+	PartOf          []Edge       `json:"part_of"`
+	CanBeExecutedOn []Edge       `json:"can_be_executed_on"`
+	HasSubtechnique []Edge       `json:"has_subtechnique"`
+	PatternsTo      []PatternsTo `json:"patterns_to"`
+	ChainIncludes   []Edge       `json:"chain_includes"`
+	Detects         []Detects    `json:"detects"`
+	Monitors        []Monitors   `json:"monitors"`
+}
+
+// applyDefaults fills zero values with the schema defaults (TA001, TA008,
+// ED001, ED015, ED016).
+func (s *Snapshot) applyDefaults() {
+	for i := range s.Assets {
+		if s.Assets[i].Priority == 0 {
+			s.Assets[i].Priority = 4
+		}
+		if s.Assets[i].TTB == 0 {
+			s.Assets[i].TTB = 10
+		}
+	}
+	for i := range s.Techniques {
+		if s.Techniques[i].Priority == 0 {
+			s.Techniques[i].Priority = 4
+		}
+		if s.Techniques[i].ExecutionMin == 0 {
+			s.Techniques[i].ExecutionMin = 0.1667
+		}
+		if s.Techniques[i].ExecutionMax == 0 {
+			s.Techniques[i].ExecutionMax = 120.0
+		}
+	}
+	for i := range s.AppliedTo {
+		if s.AppliedTo[i].Version == "" {
+			s.AppliedTo[i].Version = "1.0"
+		}
+		if s.AppliedTo[i].Maturity == 0 {
+			s.AppliedTo[i].Maturity = 100
+		}
+		if s.AppliedTo[i].Active == nil {
+			active := true
+			s.AppliedTo[i].Active = &active
+		}
+	}
+	for i := range s.Detects {
+		if s.Detects[i].Coverage == 0 {
+			s.Detects[i].Coverage = 100
+		}
+	}
+	for i := range s.Monitors {
+		if s.Monitors[i].Active == nil {
+			active := true
+			s.Monitors[i].Active = &active
+		}
+	}
+	hasSys := false
+	for _, st := range s.SystemState {
+		if st.StateID == systemStateID {
+			hasSys = true
+		}
+	}
+	if !hasSys {
+		s.SystemState = append(s.SystemState, SystemState{StateID: systemStateID})
+	}
+}
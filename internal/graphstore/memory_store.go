@@ -0,0 +1,824 @@
+package graphstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"ESP-data/internal/nebula"
+)
+
+// systemStateID is the VID of the single SystemState vertex (TA009).
+const systemStateID = "SYS001"
+
+// MemoryStore is a pure-Go GraphStore holding the ESP01 entities in memory.
+// It mirrors the semantics of the nGQL queries in internal/nebula (MATCH
+// requirements, defaults, ordering-insensitive results) so that the HTTP API
+// and the TTB/TTA math run unchanged without a NebulaGraph instance.
+// Results that NebulaGraph returns in storage order are sorted by ID here to
+// keep responses deterministic.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data Snapshot
+
+	// Vertex indexes — pointers into data, rebuilt by reindex().
+	assets      map[string]*Asset
+	assetTypes  map[string]*AssetType
+	segments    map[string]*NetworkSegment
+	osTypes     map[string]*OSType
+	tactics     map[string]*Tactic
+	techniques  map[string]*Technique
+	mitigations map[string]*Mitigation
+	states      map[string]*State
+	sysState    *SystemState
+	detections  map[string]*DetectionControl
+	chains      map[string]*TacticChain
+	chainRules  map[string]*ChainRule
+
+	// Edge indexes.
+	hasType       map[string]string // asset -> Asset_Type (DI-01)
+	belongsTo     map[string]string // asset -> Network_Segment (DI-02)
+	runsOn        map[string]string // asset -> OS_Type (DI-03)
+	represents    map[string][]string
+	connOut       map[string][]*ConnectsTo
+	connIn        map[string][]*ConnectsTo
+	appliedIn     map[string][]*AppliedTo // asset -> applied_to edges
+	mitigatesIn   map[string][]string     // technique -> mitigation VIDs
+	partOf        map[string]map[string]bool
+	canExecOn     map[string]map[string]bool // technique -> platform set
+	patternsOut   map[string][]*PatternsTo
+	chainIncludes map[string][]Edge
+	detectsOut    map[string][]*Detects  // control -> detects edges
+	monitorsIn    map[string][]*Monitors // asset -> monitors edges
+}
+
+// NewMemoryStore returns an empty store containing only the SYS001 SystemState vertex.
+func NewMemoryStore() *MemoryStore {
+	m := &MemoryStore{}
+	m.data.applyDefaults()
+	m.reindex()
+	return m
+}
+
+// LoadFile replaces the store content with the JSON Snapshot in path.
+func (m *MemoryStore) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return m.Load(f)
+}
+
+// Load replaces the store content with a JSON Snapshot read from r.
+func (m *MemoryStore) Load(r io.Reader) error {
+	var snap Snapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+	snap.applyDefaults()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data = snap
+	m.reindex()
+
+	slog.Info("graphstore: loaded snapshot", "assets", len(snap.Assets), "connects_to", len(snap.ConnectsTo),
+		"techniques", len(snap.Techniques), "chains", len(snap.Chains))
+	return nil
+}
+
+// WriteSnapshot serialises the current store content as JSON.
+func (m *MemoryStore) WriteSnapshot(w io.Writer) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m.data)
+}
+
+func (m *MemoryStore) assetCount() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.assets)
+}
+
+// reindex rebuilds every index from m.data. Caller must hold m.mu for writing.
+func (m *MemoryStore) reindex() {
+	d := &m.data
+
+	m.assets = make(map[string]*Asset, len(d.Assets))
+	for i := range d.Assets {
+		m.assets[d.Assets[i].AssetID] = &d.Assets[i]
+	}
+	m.assetTypes = make(map[string]*AssetType, len(d.AssetTypes))
+	for i := range d.AssetTypes {
+		m.assetTypes[d.AssetTypes[i].TypeID] = &d.AssetTypes[i]
+	}
+	m.segments = make(map[string]*NetworkSegment, len(d.Segments))
+	for i := range d.Segments {
+		m.segments[d.Segments[i].SegmentID] = &d.Segments[i]
+	}
+	m.osTypes = make(map[string]*OSType, len(d.OSTypes))
+	for i := range d.OSTypes {
+		m.osTypes[d.OSTypes[i].OSID] = &d.OSTypes[i]
+	}
+	m.tactics = make(map[string]*Tactic, len(d.Tactics))
+	for i := range d.Tactics {
+		m.tactics[d.Tactics[i].TacticID] = &d.Tactics[i]
+	}
+	m.techniques = make(map[string]*Technique, len(d.Techniques))
+	for i := range d.Techniques {
+		m.techniques[d.Techniques[i].TechniqueID] = &d.Techniques[i]
+	}
+	m.mitigations = make(map[string]*Mitigation, len(d.Mitigations))
+	for i := range d.Mitigations {
+		m.mitigations[d.Mitigations[i].MitigationID] = &d.Mitigations[i]
+	}
+	m.states = make(map[string]*State, len(d.States))
+	for i := range d.States {
+		m.states[d.States[i].StateID] = &d.States[i]
+	}
+	m.detections = make(map[string]*DetectionControl, len(d.DetectionControls))
+	for i := range d.DetectionControls {
+		m.detections[d.DetectionControls[i].ControlID] = &d.DetectionControls[i]
+	}
+	m.chains = make(map[string]*TacticChain, len(d.Chains))
+	for i := range d.Chains {
+		m.chains[d.Chains[i].ChainID] = &d.Chains[i]
+	}
+	m.chainRules = make(map[string]*ChainRule, len(d.ChainRules))
+	for i := range d.ChainRules {
+		m.chainRules[d.ChainRules[i].RuleID] = &d.ChainRules[i]
+	}
+	m.sysState = nil
+	for i := range d.SystemState {
+		if d.SystemState[i].StateID == systemStateID {
+			m.sysState = &d.SystemState[i]
+		}
+	}
+
+	m.hasType = singleEdgeIndex(d.HasType)
+	m.belongsTo = singleEdgeIndex(d.BelongsTo)
+	m.runsOn = singleEdgeIndex(d.RunsOn)
+
+	m.represents = make(map[string][]string)
+	for _, e := range d.Represents {
+		m.represents[e.Src] = append(m.represents[e.Src], e.Dst)
+	}
+
+	m.connOut = make(map[string][]*ConnectsTo)
+	m.connIn = make(map[string][]*ConnectsTo)
+	for i := range d.ConnectsTo {
+		c := &d.ConnectsTo[i]
+		m.connOut[c.Src] = append(m.connOut[c.Src], c)
+		m.connIn[c.Dst] = append(m.connIn[c.Dst], c)
+	}
+	for _, list := range m.connOut {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Dst != list[j].Dst {
+				return list[i].Dst < list[j].Dst
+			}
+			return list[i].Rank < list[j].Rank
+		})
+	}
+
+	m.appliedIn = make(map[string][]*AppliedTo)
+	for i := range d.AppliedTo {
+		a := &d.AppliedTo[i]
+		m.appliedIn[a.Dst] = append(m.appliedIn[a.Dst], a)
+	}
+
+	m.mitigatesIn = make(map[string][]string)
+	for _, e := range d.Mitigates {
+		m.mitigatesIn[e.Dst] = append(m.mitigatesIn[e.Dst], e.Src)
+	}
+
+	m.partOf = setEdgeIndex(d.PartOf)
+	m.canExecOn = setEdgeIndex(d.CanBeExecutedOn)
+
+	m.patternsOut = make(map[string][]*PatternsTo)
+	for i := range d.PatternsTo {
+		e := &d.PatternsTo[i]
+		m.patternsOut[e.Src] = append(m.patternsOut[e.Src], e)
+	}
+
+	m.chainIncludes = make(map[string][]Edge)
+	for _, e := range d.ChainIncludes {
+		m.chainIncludes[e.Src] = append(m.chainIncludes[e.Src], e)
+	}
+	for _, list := range m.chainIncludes {
+		sort.Slice(list, func(i, j int) bool { return list[i].Rank < list[j].Rank })
+	}
+
+	m.detectsOut = make(map[string][]*Detects)
+	for i := range d.Detects {
+		e := &d.Detects[i]
+		m.detectsOut[e.Src] = append(m.detectsOut[e.Src], e)
+	}
+	m.monitorsIn = make(map[string][]*Monitors)
+	for i := range d.Monitors {
+		e := &d.Monitors[i]
+		m.monitorsIn[e.Dst] = append(m.monitorsIn[e.Dst], e)
+	}
+}
+
+func singleEdgeIndex(edges []Edge) map[string]string {
+	idx := make(map[string]string, len(edges))
+	for _, e := range edges {
+		if _, exists := idx[e.Src]; !exists {
+			idx[e.Src] = e.Dst
+		}
+	}
+	return idx
+}
+
+func setEdgeIndex(edges []Edge) map[string]map[string]bool {
+	idx := make(map[string]map[string]bool)
+	for _, e := range edges {
+		if idx[e.Src] == nil {
+			idx[e.Src] = make(map[string]bool)
+		}
+		idx[e.Src][e.Dst] = true
+	}
+	return idx
+}
+
+// sortedAssetIDs returns all Asset VIDs in ascending order.
+func (m *MemoryStore) sortedAssetIDs() []string {
+	ids := make([]string, 0, len(m.assets))
+	for id := range m.assets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// assetTypeName resolves the has_type target name; ok is false when the
+// asset has no has_type edge (DI-01 violation — excluded like a MATCH would).
+func (m *MemoryStore) assetTypeName(assetID string) (string, bool) {
+	tid, ok := m.hasType[assetID]
+	if !ok {
+		return "", false
+	}
+	t, ok := m.assetTypes[tid]
+	if !ok {
+		return "", false
+	}
+	return t.TypeName, true
+}
+
+// ======================================================================================================
+// Asset and topology reads (REQ-020 through REQ-026)
+// ======================================================================================================
+
+// Ping mirrors nebula.Ping; the in-memory store is always available.
+func (m *MemoryStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// QueryAssets mirrors nebula.QueryAssets (REQ-020): one row per connects_to
+// edge whose endpoints both have a type, capped at 300 rows.
+func (m *MemoryStore) QueryAssets(ctx context.Context) ([]nebula.AssetRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rows := make([]nebula.AssetRow, 0)
+	for _, srcID := range m.sortedAssetIDs() {
+		a := m.assets[srcID]
+		aType, ok := m.assetTypeName(srcID)
+		if !ok {
+			continue
+		}
+		for _, c := range m.connOut[srcID] {
+			b, ok := m.assets[c.Dst]
+			if !ok {
+				continue
+			}
+			bType, ok := m.assetTypeName(c.Dst)
+			if !ok {
+				continue
+			}
+			rows = append(rows, nebula.AssetRow{
+				SrcAssetID:          a.AssetID,
+				SrcAssetName:        a.AssetName,
+				SrcIsEntrance:       a.IsEntrance,
+				SrcIsTarget:         a.IsTarget,
+				SrcPriority:         a.Priority,
+				SrcHasVulnerability: a.HasVulnerability,
+				SrcAssetType:        aType,
+				DstAssetID:          b.AssetID,
+				DstAssetName:        b.AssetName,
+				DstIsEntrance:       b.IsEntrance,
+				DstIsTarget:         b.IsTarget,
+				DstPriority:         b.Priority,
+				DstHasVulnerability: b.HasVulnerability,
+				DstAssetType:        bType,
+			})
+			if len(rows) == 300 {
+				return rows, nil
+			}
+		}
+	}
+	return rows, nil
+}
+
+// QueryAssetsWithDetails mirrors nebula.QueryAssetsWithDetails (REQ-021).
+func (m *MemoryStore) QueryAssetsWithDetails(ctx context.Context) ([]map[string]interface{}, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	assets := make([]map[string]interface{}, 0, len(m.assets))
+	for _, id := range m.sortedAssetIDs() {
+		a := m.assets[id]
+		typeName, ok := m.assetTypeName(id)
+		if !ok {
+			continue
+		}
+		assets = append(assets, map[string]interface{}{
+			"asset_id":          a.AssetID,
+			"asset_name":        a.AssetName,
+			"is_entrance":       a.IsEntrance,
+			"is_target":         a.IsTarget,
+			"priority":          a.Priority,
+			"has_vulnerability": a.HasVulnerability,
+			"asset_type":        typeName,
+		})
+	}
+	return assets, nil
+}
+
+// QueryAssetDetail mirrors nebula.QueryAssetDetail (REQ-022); assets lacking
+// any of the DI-01/02/03 edges are reported as not found.
+func (m *MemoryStore) QueryAssetDetail(ctx context.Context, assetID string) (map[string]interface{}, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	a, ok := m.assets[assetID]
+	if !ok {
+		return nil, fmt.Errorf("asset not found")
+	}
+	typeName, ok := m.assetTypeName(assetID)
+	if !ok {
+		return nil, fmt.Errorf("asset not found")
+	}
+	seg, ok := m.segments[m.belongsTo[assetID]]
+	if !ok {
+		return nil, fmt.Errorf("asset not found")
+	}
+	osType, ok := m.osTypes[m.runsOn[assetID]]
+	if !ok {
+		return nil, fmt.Errorf("asset not found")
+	}
+
+	return map[string]interface{}{
+		"asset_id":          a.AssetID,
+		"asset_name":        a.AssetName,
+		"asset_description": a.AssetDescription,
+		"asset_note":        a.AssetNote,
+		"is_entrance":       a.IsEntrance,
+		"is_target":         a.IsTarget,
+		"priority":          a.Priority,
+		"has_vulnerability": a.HasVulnerability,
+		"ttb":               int(a.TTB),
+		"asset_type":        typeName,
+		"segment_name":      seg.SegmentName,
+		"os_name":           osType.OSName,
+	}, nil
+}
+
+// QueryNeighbors mirrors nebula.QueryNeighbors (REQ-023); UNION removes
+// duplicate (neighbor, direction) pairs.
+func (m *MemoryStore) QueryNeighbors(ctx context.Context, assetID string) ([]map[string]interface{}, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	neighbors := make([]map[string]interface{}, 0)
+	seen := make(map[string]bool)
+	add := func(id, direction string) {
+		key := id + "|" + direction
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		neighbors = append(neighbors, map[string]interface{}{
+			"neighbor_id": id,
+			"direction":   direction,
+		})
+	}
+
+	for _, c := range m.connOut[assetID] {
+		add(c.Dst, "outbound")
+	}
+	inbound := append([]*ConnectsTo(nil), m.connIn[assetID]...)
+	sort.Slice(inbound, func(i, j int) bool { return inbound[i].Src < inbound[j].Src })
+	for _, c := range inbound {
+		add(c.Src, "inbound")
+	}
+	return neighbors, nil
+}
+
+// QueryAssetTypes mirrors nebula.QueryAssetTypes (REQ-024).
+func (m *MemoryStore) QueryAssetTypes(ctx context.Context) ([]map[string]interface{}, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	types := make([]map[string]interface{}, 0, len(m.data.AssetTypes))
+	for _, t := range m.data.AssetTypes {
+		types = append(types, map[string]interface{}{
+			"type_id":   t.TypeID,
+			"type_name": t.TypeName,
+		})
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i]["type_id"].(string) < types[j]["type_id"].(string)
+	})
+	return types, nil
+}
+
+// QueryEdgeConnections mirrors nebula.QueryEdgeConnections (REQ-026).
+func (m *MemoryStore) QueryEdgeConnections(ctx context.Context, sourceID, targetID string) ([]map[string]interface{}, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	connections := make([]map[string]interface{}, 0)
+	for _, c := range m.connOut[sourceID] {
+		if c.Dst != targetID {
+			continue
+		}
+		connections = append(connections, map[string]interface{}{
+			"connection_protocol": c.ConnectionProtocol,
+			"connection_port":     c.ConnectionPort,
+		})
+	}
+	return connections, nil
+}
+
+// ======================================================================================================
+// Path inspector reads (ALG-REQ-001, ALG-REQ-002, ALG-REQ-003, ALG-REQ-010)
+// ======================================================================================================
+
+func (m *MemoryStore) flaggedAssets(flag func(*Asset) bool) []map[string]interface{} {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]map[string]interface{}, 0)
+	for _, id := range m.sortedAssetIDs() {
+		a := m.assets[id]
+		if !flag(a) {
+			continue
+		}
+		result = append(result, map[string]interface{}{
+			"asset_id":   a.AssetID,
+			"asset_name": a.AssetName,
+		})
+	}
+	return result
+}
+
+// QueryEntryPoints mirrors nebula.QueryEntryPoints (ALG-REQ-002).
+func (m *MemoryStore) QueryEntryPoints(ctx context.Context) ([]map[string]interface{}, error) {
+	return m.flaggedAssets(func(a *Asset) bool { return a.IsEntrance }), nil
+}
+
+// QueryTargets mirrors nebula.QueryTargets (ALG-REQ-003).
+func (m *MemoryStore) QueryTargets(ctx context.Context) ([]map[string]interface{}, error) {
+	return m.flaggedAssets(func(a *Asset) bool { return a.IsTarget }), nil
+}
+
+// QueryPaths mirrors nebula.QueryPaths (ALG-REQ-001 v1.3): every simple
+// connects_to path of 1..maxHops edges. Like the MATCH pattern, parallel
+// edges (different ranks) between the same pair yield separate paths.
+func (m *MemoryStore) QueryPaths(ctx context.Context, entryID, targetID string, maxHops int) ([]nebula.PathResult, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	paths := make([]nebula.PathResult, 0)
+	if _, ok := m.assets[entryID]; !ok {
+		return paths, nil
+	}
+	if _, ok := m.assets[targetID]; !ok {
+		return paths, nil
+	}
+
+	onPath := map[string]bool{entryID: true}
+	stack := []string{entryID}
+
+	var walk func(node string)
+	walk = func(node string) {
+		if len(stack)-1 >= maxHops || ctx.Err() != nil {
+			return
+		}
+		for _, c := range m.connOut[node] {
+			next := c.Dst
+			if onPath[next] {
+				continue
+			}
+			if _, ok := m.assets[next]; !ok {
+				continue
+			}
+			stack = append(stack, next)
+			if next == targetID {
+				ids := append([]string(nil), stack...)
+				ttbs := make([]float64, len(ids))
+				for i, id := range ids {
+					ttbs[i] = m.assets[id].TTB
+				}
+				paths = append(paths, nebula.PathResult{IDs: ids, TTBs: ttbs})
+			} else {
+				onPath[next] = true
+				walk(next)
+				delete(onPath, next)
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	walk(entryID)
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("QueryPaths: %w", err)
+	}
+
+	return paths, nil
+}
+
+// QueryAssetTTB mirrors nebula.QueryAssetTTB (ALG-REQ-010).
+func (m *MemoryStore) QueryAssetTTB(ctx context.Context, assetID string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	a, ok := m.assets[assetID]
+	if !ok {
+		return 10, nil // default TTB per schema TA001
+	}
+	return int(a.TTB), nil
+}
+
+// QueryTopology mirrors nebula.QueryTopology: one adjacency entry per
+// connected pair, sorted, plus stored TTB and hash validity of every asset.
+func (m *MemoryStore) QueryTopology(ctx context.Context) (*nebula.Topology, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	topo := &nebula.Topology{
+		Adjacency: make(map[string][]string),
+		TTB:       make(map[string]float64, len(m.assets)),
+		HashValid: make(map[string]bool, len(m.assets)),
+	}
+	for id, a := range m.assets {
+		topo.TTB[id] = a.TTB
+		topo.HashValid[id] = a.HashValid
+		var last string
+		for _, c := range m.connOut[id] {
+			if _, ok := m.assets[c.Dst]; !ok || c.Dst == last {
+				continue
+			}
+			last = c.Dst
+			topo.Adjacency[id] = append(topo.Adjacency[id], c.Dst)
+		}
+	}
+	return topo, nil
+}
+
+// ReplaceConnections mirrors nebula.ReplaceConnections (ED006): all ranks
+// between the pair are dropped and conns are stored with ranks 0..n-1.
+func (m *MemoryStore) ReplaceConnections(ctx context.Context, srcID, dstID string, conns []nebula.Connection) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.data.ConnectsTo[:0]
+	for _, c := range m.data.ConnectsTo {
+		if c.Src == srcID && c.Dst == dstID {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	for rank, c := range conns {
+		kept = append(kept, ConnectsTo{
+			Edge:               Edge{Src: srcID, Dst: dstID, Rank: int64(rank)},
+			ConnectionProtocol: c.Protocol,
+			ConnectionPort:     c.Port,
+		})
+	}
+	m.data.ConnectsTo = kept
+	m.reindex()
+	return nil
+}
+
+// ======================================================================================================
+// Asset inventory (TA001, ED002, ED007, ED011; DI-01 through DI-03)
+// ======================================================================================================
+
+// QueryInventory mirrors nebula.QueryInventory: every Asset, including those
+// violating DI-01..DI-03, with all has_type/belongs_to/runs_on targets.
+func (m *MemoryStore) QueryInventory(ctx context.Context) ([]nebula.AssetRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	targets := func(edges []Edge, assetID string) string {
+		var ids []string
+		for _, e := range edges {
+			if e.Src == assetID {
+				ids = append(ids, e.Dst)
+			}
+		}
+		sort.Strings(ids)
+		return strings.Join(ids, ",")
+	}
+
+	records := make([]nebula.AssetRecord, 0, len(m.assets))
+	for _, id := range m.sortedAssetIDs() {
+		a := m.assets[id]
+		records = append(records, nebula.AssetRecord{
+			AssetID:          a.AssetID,
+			AssetName:        a.AssetName,
+			Description:      a.AssetDescription,
+			Note:             a.AssetNote,
+			IsEntrance:       a.IsEntrance,
+			IsTarget:         a.IsTarget,
+			Priority:         a.Priority,
+			HasVulnerability: a.HasVulnerability,
+			TypeID:           targets(m.data.HasType, id),
+			SegmentID:        targets(m.data.BelongsTo, id),
+			OSID:             targets(m.data.RunsOn, id),
+		})
+	}
+	return records, nil
+}
+
+// QueryInventoryCatalog mirrors nebula.QueryInventoryCatalog.
+func (m *MemoryStore) QueryInventoryCatalog(ctx context.Context) (*nebula.InventoryCatalog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	catalog := &nebula.InventoryCatalog{
+		AssetTypes: make(map[string]string, len(m.assetTypes)),
+		Segments:   make(map[string]string, len(m.segments)),
+		OSTypes:    make(map[string]string, len(m.osTypes)),
+	}
+	for id, t := range m.assetTypes {
+		catalog.AssetTypes[t.TypeName] = id
+	}
+	for id, s := range m.segments {
+		catalog.Segments[s.SegmentName] = id
+	}
+	for id, o := range m.osTypes {
+		catalog.OSTypes[o.OSName] = id
+	}
+	return catalog, nil
+}
+
+// UpsertAsset mirrors nebula.UpsertAsset: properties are overwritten while
+// TTB and hash state are kept, and the three DI edges are replaced by
+// exactly one edge each.
+func (m *MemoryStore) UpsertAsset(ctx context.Context, rec nebula.AssetRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.assets[rec.AssetID]
+	if !ok {
+		m.data.Assets = append(m.data.Assets, Asset{AssetID: rec.AssetID, TTB: 10})
+		a = &m.data.Assets[len(m.data.Assets)-1]
+	}
+	a.AssetName = rec.AssetName
+	a.AssetDescription = rec.Description
+	a.AssetNote = rec.Note
+	a.IsEntrance = rec.IsEntrance
+	a.IsTarget = rec.IsTarget
+	a.Priority = rec.Priority
+	a.HasVulnerability = rec.HasVulnerability
+
+	replace := func(edges []Edge, dst string) []Edge {
+		kept := edges[:0]
+		for _, e := range edges {
+			if e.Src != rec.AssetID {
+				kept = append(kept, e)
+			}
+		}
+		return append(kept, Edge{Src: rec.AssetID, Dst: dst})
+	}
+	m.data.HasType = replace(m.data.HasType, rec.TypeID)
+	m.data.BelongsTo = replace(m.data.BelongsTo, rec.SegmentID)
+	m.data.RunsOn = replace(m.data.RunsOn, rec.OSID)
+
+	m.reindex()
+	return nil
+}
+
+// ======================================================================================================
+// Mitigations (REQ-033 through REQ-036)
+// ======================================================================================================
+
+// QueryMitigations mirrors nebula.QueryMitigations (REQ-033).
+func (m *MemoryStore) QueryMitigations(ctx context.Context) ([]map[string]interface{}, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	mitigations := make([]map[string]interface{}, 0, len(m.data.Mitigations))
+	for _, mit := range m.data.Mitigations {
+		mitigations = append(mitigations, map[string]interface{}{
+			"mitigation_id":   mit.MitigationID,
+			"mitigation_name": mit.MitigationName,
+		})
+	}
+	sort.Slice(mitigations, func(i, j int) bool {
+		return mitigations[i]["mitigation_id"].(string) < mitigations[j]["mitigation_id"].(string)
+	})
+	return mitigations, nil
+}
+
+// QueryAssetMitigations mirrors nebula.QueryAssetMitigations (REQ-034).
+func (m *MemoryStore) QueryAssetMitigations(ctx context.Context, assetID string) ([]map[string]interface{}, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	mitigations := make([]map[string]interface{}, 0)
+	for _, e := range m.appliedIn[assetID] {
+		mit, ok := m.mitigations[e.Src]
+		if !ok {
+			continue
+		}
+		mitigations = append(mitigations, map[string]interface{}{
+			"mitigation_id":   mit.MitigationID,
+			"mitigation_name": mit.MitigationName,
+			"maturity":        e.Maturity,
+			"active":          *e.Active,
+		})
+	}
+	sort.Slice(mitigations, func(i, j int) bool {
+		return mitigations[i]["mitigation_id"].(string) < mitigations[j]["mitigation_id"].(string)
+	})
+	return mitigations, nil
+}
+
+// UpsertMitigation mirrors nebula.UpsertMitigation (REQ-035): the rank-0
+// applied_to edge is created or overwritten with Version "1.0".
+func (m *MemoryStore) UpsertMitigation(ctx context.Context, mitigationID, assetID string, maturity int, active bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.data.AppliedTo {
+		e := &m.data.AppliedTo[i]
+		if e.Src == mitigationID && e.Dst == assetID && e.Rank == 0 {
+			e.Version = "1.0"
+			e.Maturity = maturity
+			e.Active = &active
+			return nil
+		}
+	}
+	m.data.AppliedTo = append(m.data.AppliedTo, AppliedTo{
+		Edge:     Edge{Src: mitigationID, Dst: assetID},
+		Version:  "1.0",
+		Maturity: maturity,
+		Active:   &active,
+	})
+	m.reindex()
+	return nil
+}
+
+// DeleteMitigation mirrors nebula.DeleteMitigation (REQ-036); only rank 0 is removed.
+func (m *MemoryStore) DeleteMitigation(ctx context.Context, mitigationID, assetID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.data.AppliedTo[:0]
+	for _, e := range m.data.AppliedTo {
+		if e.Src == mitigationID && e.Dst == assetID && e.Rank == 0 {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	m.data.AppliedTo = kept
+	m.reindex()
+	return nil
+}
+
+// QueryTechniqueMitigations mirrors nebula.QueryTechniqueMitigations: the
+// mitigates sources per technique, sorted, for existing mitigations only.
+func (m *MemoryStore) QueryTechniqueMitigations(ctx context.Context, techniqueIDs []string) (map[string][]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(map[string][]string)
+	for _, tech := range techniqueIDs {
+		if _, ok := m.techniques[tech]; !ok {
+			continue
+		}
+		var mits []string
+		for _, mv := range m.mitigatesIn[tech] {
+			if _, ok := m.mitigations[mv]; ok {
+				mits = append(mits, mv)
+			}
+		}
+		if len(mits) > 0 {
+			sort.Strings(mits)
+			result[tech] = mits
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,219 @@
+package graphstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"ESP-data/internal/nebula"
+	"ESP-data/internal/store"
+)
+
+// ======================================================================================================
+// TTB / TTT over the in-memory graph (ALG-REQ-060 through ALG-REQ-080)
+// ======================================================================================================
+
+// memSource implements nebula.TTBSource over a MemoryStore. The caller holds
+// m.mu for reading for the whole RunTTB traversal.
+type memSource struct {
+	m *MemoryStore
+}
+
+// executableTechniques returns the technique set reachable via
+// Asset-runs_on->OS_Type-represents->MitrePlatform<-can_be_executed_on- (ALG-REQ-062).
+func (s memSource) executableTechniques(assetVid string) map[string]bool {
+	platforms := make(map[string]bool)
+	for _, p := range s.m.represents[s.m.runsOn[assetVid]] {
+		platforms[p] = true
+	}
+	allowed := make(map[string]bool)
+	for tech, onPlatforms := range s.m.canExecOn {
+		for p := range onPlatforms {
+			if platforms[p] {
+				allowed[tech] = true
+				break
+			}
+		}
+	}
+	return allowed
+}
+
+func (s memSource) candidate(t *Technique) nebula.TechniqueCandidate {
+	return nebula.TechniqueCandidate{
+		TechniqueID:    t.TechniqueID,
+		TechniqueName:  t.TechniqueName,
+		Priority:       t.Priority,
+		VulnApplicable: t.Rcelpe,
+	}
+}
+
+// sortCandidates applies the ORDER BY technique_priority DESC, technique_id order.
+func sortCandidates(c []nebula.TechniqueCandidate) {
+	sort.SliceStable(c, func(i, j int) bool {
+		if c[i].Priority != c[j].Priority {
+			return c[i].Priority > c[j].Priority
+		}
+		return c[i].TechniqueID < c[j].TechniqueID
+	})
+}
+
+func (s memSource) OrderedTactics(ctx context.Context, chainVid string) ([]nebula.TacticRef, error) {
+	edges := s.m.chainIncludes[chainVid]
+	if len(edges) == 0 {
+		return nil, fmt.Errorf("getOrderedTactics: chain %s has no tactics", chainVid)
+	}
+	result := make([]nebula.TacticRef, 0, len(edges))
+	for _, e := range edges {
+		if t, ok := s.m.tactics[e.Dst]; ok {
+			result = append(result, nebula.TacticRef{VID: e.Dst, TacticID: t.TacticID, TacticName: t.TacticName})
+		} else {
+			result = append(result, nebula.TacticRef{VID: e.Dst, TacticID: e.Dst, TacticName: e.Dst})
+		}
+	}
+	return result, nil
+}
+
+func (s memSource) AssetHasVulnerability(ctx context.Context, assetVid string) (bool, error) {
+	a, ok := s.m.assets[assetVid]
+	if !ok {
+		return false, nil
+	}
+	return a.HasVulnerability, nil
+}
+
+func (s memSource) FirstTacticTechniques(ctx context.Context, assetVid, tacticVid string) ([]nebula.TechniqueCandidate, error) {
+	if _, ok := s.m.tactics[tacticVid]; !ok {
+		return nil, nil
+	}
+	var candidates []nebula.TechniqueCandidate
+	for tech := range s.executableTechniques(assetVid) {
+		t, ok := s.m.techniques[tech]
+		if !ok || !s.m.partOf[tech][tacticVid] {
+			continue
+		}
+		candidates = append(candidates, s.candidate(t))
+	}
+	sortCandidates(candidates)
+	return candidates, nil
+}
+
+func (s memSource) PatternTechniques(ctx context.Context, previousTacticID, fastestTechniqueID, currentTacticID string) ([]nebula.TechniqueCandidate, error) {
+	stateID := previousTacticID + "|" + fastestTechniqueID
+	if _, ok := s.m.states[stateID]; !ok {
+		return nil, nil
+	}
+	var candidates []nebula.TechniqueCandidate
+	for _, e := range s.m.patternsOut[stateID] {
+		if _, ok := s.m.states[e.Dst]; !ok {
+			continue
+		}
+		parts := strings.Split(e.Dst, "|")
+		if len(parts) != 2 || parts[0] != currentTacticID {
+			continue
+		}
+		if t, ok := s.m.techniques[parts[1]]; ok {
+			c := s.candidate(t)
+			c.Probability = e.Probability
+			candidates = append(candidates, c)
+		}
+	}
+	sortCandidates(candidates)
+	return candidates, nil
+}
+
+func (s memSource) FilterByOS(ctx context.Context, candidates []nebula.TechniqueCandidate, assetVid string) ([]nebula.TechniqueCandidate, error) {
+	if len(candidates) == 0 {
+		return candidates, nil
+	}
+	allowed := s.executableTechniques(assetVid)
+	var filtered []nebula.TechniqueCandidate
+	for _, c := range candidates {
+		if allowed[c.TechniqueID] {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered, nil
+}
+
+func (s memSource) TTTInputs(ctx context.Context, assetVid string, techniqueIDs []string) (map[string]nebula.TechniqueTTTInput, map[string]int, error) {
+	inputs := make(map[string]nebula.TechniqueTTTInput, len(techniqueIDs))
+	for _, id := range techniqueIDs {
+		t, ok := s.m.techniques[id]
+		if !ok {
+			continue
+		}
+		var mitVids []string
+		for _, mv := range s.m.mitigatesIn[id] {
+			if _, ok := s.m.mitigations[mv]; ok {
+				mitVids = append(mitVids, mv)
+			}
+		}
+		inputs[id] = nebula.TechniqueTTTInput{
+			ExecMin: t.ExecutionMin,
+			ExecMax: t.ExecutionMax,
+			P:       len(mitVids),
+			MitVids: mitVids,
+		}
+	}
+
+	activeMaturity := make(map[string]int)
+	for _, e := range s.m.appliedIn[assetVid] {
+		if *e.Active {
+			activeMaturity[e.Src] = e.Maturity
+		}
+	}
+	return inputs, activeMaturity, nil
+}
+
+// ComputeTTB runs the shared TTB algorithm (nebula.RunTTB) over the in-memory graph.
+func (m *MemoryStore) ComputeTTB(ctx context.Context, assetVid, chainVid string, params nebula.TTBParams, audit *store.AuditBuffer) (*nebula.TTBResult, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return nebula.RunTTB(ctx, memSource{m: m}, assetVid, chainVid, params, audit)
+}
+
+// SimulateTTB runs nebula.RunTTB over the in-memory graph with overlay
+// applied to the applied_to edges; the store itself is not modified.
+func (m *MemoryStore) SimulateTTB(ctx context.Context, assetVid, chainVid string, params nebula.TTBParams, overlay nebula.MitigationOverlay) (*nebula.TTBResult, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return nebula.RunTTB(ctx, nebula.WithOverlay(memSource{m: m}, overlay), assetVid, chainVid, params, nil)
+}
+
+// ComputeTTT mirrors nebula.ComputeTTT (ALG-REQ-060 through ALG-REQ-066),
+// including the OS platform pre-check (ALG-REQ-062).
+func (m *MemoryStore) ComputeTTT(ctx context.Context, assetVid, techniqueVid string) (*nebula.TTTResult, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	src := memSource{m: m}
+	if !src.executableTechniques(assetVid)[techniqueVid] {
+		return nil, nil
+	}
+	t, ok := m.techniques[techniqueVid]
+	if !ok {
+		return nil, fmt.Errorf("ComputeTTT: technique %s not found", techniqueVid)
+	}
+
+	inputs, activeMaturity, _ := src.TTTInputs(ctx, assetVid, []string{techniqueVid})
+	in := inputs[techniqueVid]
+	result := &nebula.TTTResult{
+		TechniqueID:   t.TechniqueID,
+		TechniqueName: t.TechniqueName,
+		ExecMin:       in.ExecMin,
+		ExecMax:       in.ExecMax,
+		P:             in.P,
+	}
+	for _, mv := range in.MitVids {
+		if mat, found := activeMaturity[mv]; found {
+			result.A++
+			result.SumMaturity += float64(mat)
+		}
+	}
+
+	candidates := []nebula.TechniqueCandidate{{TechniqueID: techniqueVid}}
+	nebula.ApplyTTTFormula(candidates, inputs, activeMaturity, nil, 0)
+	result.TTT = candidates[0].TTT
+	return result, nil
+}
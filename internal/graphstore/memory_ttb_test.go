@@ -0,0 +1,230 @@
+package graphstore
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"ESP-data/internal/nebula"
+)
+
+// ttbFixture is a small ESP01 graph for the TTB engine: two platforms, a
+// three-tactic chain, techniques with patterns_to between their states,
+// and assets that differ in OS, vulnerability and applied mitigations.
+const ttbFixture = `{
+  "Asset": [
+    {"Asset_ID": "A1", "Asset_Name": "web", "has_vulnerability": true},
+    {"Asset_ID": "A2", "Asset_Name": "db"},
+    {"Asset_ID": "A3", "Asset_Name": "ws"},
+    {"Asset_ID": "A4", "Asset_Name": "appliance", "has_vulnerability": true}
+  ],
+  "OS_Type": [
+    {"OS_ID": "OS1", "OS_Name": "Windows"},
+    {"OS_ID": "OS2", "OS_Name": "Linux"}
+  ],
+  "MitrePlatform": [
+    {"platform_id": "PLTF001", "platform_name": "Windows"},
+    {"platform_id": "PLTF002", "platform_name": "Linux"}
+  ],
+  "tMitreTactic": [
+    {"Tactic_ID": "TA0001", "Tactic_Name": "Initial Access"},
+    {"Tactic_ID": "TA0002", "Tactic_Name": "Execution"},
+    {"Tactic_ID": "TA0004", "Tactic_Name": "Privilege Escalation"}
+  ],
+  "tMitreTechnique": [
+    {"Technique_ID": "T1", "Technique_Name": "Exploit", "rcelpe": true, "priority": 1, "execution_min": 1, "execution_max": 4},
+    {"Technique_ID": "T2", "Technique_Name": "Phishing", "priority": 3, "execution_min": 2, "execution_max": 10},
+    {"Technique_ID": "T3", "Technique_Name": "PowerShell", "priority": 2, "execution_min": 0.5, "execution_max": 2},
+    {"Technique_ID": "T4", "Technique_Name": "Unix Shell", "priority": 2, "execution_min": 0.5, "execution_max": 3},
+    {"Technique_ID": "T5", "Technique_Name": "Token Theft", "priority": 1, "execution_min": 3, "execution_max": 30},
+    {"Technique_ID": "T6", "Technique_Name": "Sudo", "priority": 2, "execution_min": 1, "execution_max": 8}
+  ],
+  "tMitreMitigation": [
+    {"Mitigation_ID": "M1", "Mitigation_Name": "User Training"},
+    {"Mitigation_ID": "M2", "Mitigation_Name": "Privileged Account Management"}
+  ],
+  "tMitreState": [
+    {"state_id": "TA0001|T1"}, {"state_id": "TA0001|T2"},
+    {"state_id": "TA0002|T3"}, {"state_id": "TA0002|T4"},
+    {"state_id": "TA0004|T5"}, {"state_id": "TA0004|T6"}
+  ],
+  "TacticChain": [{"chain_id": "C1", "chain_name": "fixture"}],
+  "runs_on": [
+    {"src": "A1", "dst": "OS1"}, {"src": "A2", "dst": "OS2"}, {"src": "A3", "dst": "OS1"}
+  ],
+  "represents": [
+    {"src": "OS1", "dst": "PLTF001"}, {"src": "OS2", "dst": "PLTF002"}
+  ],
+  "part_of": [
+    {"src": "T1", "dst": "TA0001"}, {"src": "T2", "dst": "TA0001"},
+    {"src": "T3", "dst": "TA0002"}, {"src": "T4", "dst": "TA0002"},
+    {"src": "T5", "dst": "TA0004"}, {"src": "T6", "dst": "TA0004"}
+  ],
+  "can_be_executed_on": [
+    {"src": "T1", "dst": "PLTF001"},
+    {"src": "T2", "dst": "PLTF001"}, {"src": "T2", "dst": "PLTF002"},
+    {"src": "T3", "dst": "PLTF001"},
+    {"src": "T4", "dst": "PLTF002"},
+    {"src": "T5", "dst": "PLTF001"}, {"src": "T5", "dst": "PLTF002"},
+    {"src": "T6", "dst": "PLTF002"}
+  ],
+  "mitigates": [
+    {"src": "M1", "dst": "T2"}, {"src": "M1", "dst": "T3"}, {"src": "M2", "dst": "T5"}
+  ],
+  "applied_to": [
+    {"src": "M1", "dst": "A3", "Maturity": 80},
+    {"src": "M2", "dst": "A3", "Maturity": 60, "Active": false},
+    {"src": "M2", "dst": "A2", "Maturity": 100}
+  ],
+  "patterns_to": [
+    {"src": "TA0001|T1", "dst": "TA0002|T3", "probability": 0.6},
+    {"src": "TA0001|T1", "dst": "TA0002|T4", "probability": 0.4},
+    {"src": "TA0001|T2", "dst": "TA0002|T3", "probability": 0.7},
+    {"src": "TA0001|T2", "dst": "TA0002|T4", "probability": 0.3},
+    {"src": "TA0002|T3", "dst": "TA0004|T5", "probability": 1.0},
+    {"src": "TA0002|T4", "dst": "TA0004|T5", "probability": 0.5},
+    {"src": "TA0002|T4", "dst": "TA0004|T6", "probability": 0.5}
+  ],
+  "chain_includes": [
+    {"src": "C1", "dst": "TA0001"},
+    {"src": "C1", "dst": "TA0002", "rank": 1},
+    {"src": "C1", "dst": "TA0004", "rank": 2}
+  ]
+}`
+
+func loadFixture(t *testing.T, fixture string) *MemoryStore {
+	t.Helper()
+	m := NewMemoryStore()
+	if err := m.Load(strings.NewReader(fixture)); err != nil {
+		t.Fatalf("load fixture: %v", err)
+	}
+	return m
+}
+
+// mitreSnapshot builds the snapshot nebula.LoadMitreSnapshot reads from a
+// graph holding the content of m.
+func mitreSnapshot(m *MemoryStore) *nebula.MitreSnapshot {
+	snap := &nebula.MitreSnapshot{
+		Chains:     make(map[string][]nebula.TacticRef),
+		Techniques: make(map[string]*nebula.SnapshotTechnique),
+		Patterns:   make(map[string][]nebula.PatternEdge),
+	}
+	for id, t := range m.techniques {
+		st := &nebula.SnapshotTechnique{
+			TechniqueID:   t.TechniqueID,
+			TechniqueName: t.TechniqueName,
+			Priority:      t.Priority,
+			Rcelpe:        t.Rcelpe,
+			ExecMin:       t.ExecutionMin,
+			ExecMax:       t.ExecutionMax,
+			Tactics:       make(map[string]bool),
+			Platforms:     make(map[string]bool),
+		}
+		for tactic := range m.partOf[id] {
+			if _, ok := m.tactics[tactic]; ok {
+				st.Tactics[tactic] = true
+			}
+		}
+		for p := range m.canExecOn[id] {
+			st.Platforms[p] = true
+		}
+		for _, mv := range m.mitigatesIn[id] {
+			if _, ok := m.mitigations[mv]; ok {
+				st.Mitigations = append(st.Mitigations, mv)
+			}
+		}
+		sort.Strings(st.Mitigations)
+		snap.Techniques[id] = st
+	}
+	for chain, edges := range m.chainIncludes {
+		for _, e := range edges {
+			ref := nebula.TacticRef{VID: e.Dst, TacticID: e.Dst, TacticName: e.Dst}
+			if t, ok := m.tactics[e.Dst]; ok {
+				ref.TacticID, ref.TacticName = t.TacticID, t.TacticName
+			}
+			snap.Chains[chain] = append(snap.Chains[chain], ref)
+		}
+	}
+	for src, edges := range m.patternsOut {
+		if _, ok := m.states[src]; !ok {
+			continue
+		}
+		for _, e := range edges {
+			if _, ok := m.states[e.Dst]; ok {
+				snap.Patterns[src] = append(snap.Patterns[src], nebula.PatternEdge{State: e.Dst, Probability: e.Probability})
+			}
+		}
+	}
+	return snap
+}
+
+// assetProfile builds what nebula.QueryAssetProfile reads for assetID. As
+// with its MATCH, has_vulnerability is only seen for an asset with platforms.
+func assetProfile(m *MemoryStore, assetID string) *nebula.AssetProfile {
+	profile := &nebula.AssetProfile{Platforms: make(map[string]bool), ActiveMaturity: make(map[string]int)}
+	for _, p := range m.represents[m.runsOn[assetID]] {
+		profile.Platforms[p] = true
+	}
+	if a, ok := m.assets[assetID]; ok && len(profile.Platforms) > 0 {
+		profile.HasVulnerability = a.HasVulnerability
+	}
+	for _, e := range m.appliedIn[assetID] {
+		if *e.Active {
+			profile.ActiveMaturity[e.Src] = e.Maturity
+		}
+	}
+	return profile
+}
+
+// TestSnapshotTTBMatchesLiveReads runs nebula.RunTTB over the MITRE snapshot
+// and over the live reads of the memory store: every asset, selection and
+// parameter set must give the same TTB, log and distribution.
+func TestSnapshotTTBMatchesLiveReads(t *testing.T) {
+	m := loadFixture(t, ttbFixture)
+	snap := mitreSnapshot(m)
+	ctx := context.Background()
+
+	params := []struct {
+		name   string
+		params nebula.TTBParams
+	}{
+		{"fastest", nebula.TTBParams{OrientationTime: 0.25, SwitchoverTime: 0.1, PriorityTolerance: 1}},
+		{"fastest no tolerance", nebula.TTBParams{OrientationTime: 0.25, SwitchoverTime: 0.1}},
+		{"fastest wide tolerance", nebula.TTBParams{OrientationTime: 0.5, SwitchoverTime: 0.2, PriorityTolerance: 3}},
+		{"weighted", nebula.TTBParams{OrientationTime: 0.25, SwitchoverTime: 0.1, PriorityTolerance: 1,
+			Selection: nebula.TTBSelectionWeighted, Distribution: true}},
+	}
+	for _, assetID := range []string{"A1", "A2", "A3", "A4"} {
+		for _, p := range params {
+			t.Run(assetID+"/"+p.name, func(t *testing.T) {
+				live, liveErr := m.ComputeTTB(ctx, assetID, "C1", p.params, nil)
+				fromSnap, snapErr := nebula.RunTTB(ctx, nebula.NewSnapshotSource(snap, assetProfile(m, assetID)),
+					assetID, "C1", p.params, nil)
+				if (liveErr != nil) != (snapErr != nil) {
+					t.Fatalf("errors differ: live %v, snapshot %v", liveErr, snapErr)
+				}
+				if !reflect.DeepEqual(live, fromSnap) {
+					t.Errorf("results differ\nlive:     %+v\nsnapshot: %+v", live, fromSnap)
+				}
+			})
+		}
+	}
+}
+
+// TestSnapshotTTBUnknownChain checks that both sources reject a chain
+// without chain_includes edges.
+func TestSnapshotTTBUnknownChain(t *testing.T) {
+	m := loadFixture(t, ttbFixture)
+	ctx := context.Background()
+	params := nebula.TTBParams{OrientationTime: 0.25}
+
+	if _, err := m.ComputeTTB(ctx, "A1", "C9", params, nil); err == nil {
+		t.Error("live: no error for unknown chain")
+	}
+	src := nebula.NewSnapshotSource(mitreSnapshot(m), assetProfile(m, "A1"))
+	if _, err := nebula.RunTTB(ctx, src, "A1", "C9", params, nil); err == nil {
+		t.Error("snapshot: no error for unknown chain")
+	}
+}
@@ -0,0 +1,365 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/nebula"
+)
+
+// ============================================================
+// Asset inventory import — sources/assets.xlsx → Asset (TA001) with
+// has_type (ED007), belongs_to (ED002) and runs_on (ED011)
+// ============================================================
+
+// AssetsSheet is the worksheet holding the CMDB export.
+const AssetsSheet = "Assets"
+
+// assetColumns are the header cells the importer needs; the remaining
+// columns of the export (Implements, INSERT_* helpers) are ignored.
+var assetColumns = []string{"Asset_ID", "name", "type", "Belongs_To", "is_entrance", "is_target",
+	"priority", "has_vulnerabilities", "os_type", "Note"}
+
+// AssetSheetRow is one data row of the Assets sheet with reference
+// columns still in their human-readable form.
+type AssetSheetRow struct {
+	Row              int
+	AssetID          string
+	Name             string
+	TypeName         string
+	SegmentName      string
+	OSName           string
+	IsEntrance       bool
+	IsTarget         bool
+	Priority         int
+	HasVulnerability bool
+	Note             string
+}
+
+// AssetChange lists the fields of one asset that differ from the graph.
+type AssetChange struct {
+	AssetID string   `json:"asset_id"`
+	Fields  []string `json:"fields"`
+}
+
+// AssetImportResult summarises one inventory import run. Added, Changed and
+// Removed form the diff against the graph; in dry-run mode nothing is written.
+type AssetImportResult struct {
+	DryRun            bool          `json:"dry_run"`
+	RowsRead          int           `json:"rows_read"`
+	Added             []string      `json:"added"`
+	Changed           []AssetChange `json:"changed"`
+	Removed           []string      `json:"removed"`
+	Unchanged         int           `json:"unchanged"`
+	AssetsWritten     int           `json:"assets_written"`
+	InvalidatedAssets []string      `json:"invalidated_assets"`
+	Errors            []string      `json:"errors"`
+}
+
+// hashInputFields are the AssetRecord fields that feed the ALG-REQ-042 asset
+// hash; a change in any of them makes the stored TTB stale.
+var hashInputFields = map[string]bool{"has_vulnerability": true, "type": true, "os": true}
+
+// ParseAssetsXLSX reads the Assets sheet. The header row is located by its
+// "Asset_ID" cell (the export has title rows above it) and data rows end at
+// the first row without an Asset_ID. Rows with unparsable values are
+// reported and skipped.
+func ParseAssetsXLSX(r io.ReaderAt, size int64) ([]AssetSheetRow, []string, error) {
+	sheetRows, err := ReadXLSXSheet(r, size, AssetsSheet)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	headerIdx := -1
+	for i, row := range sheetRows {
+		if strings.TrimSpace(row.Cells[0]) == "Asset_ID" {
+			headerIdx = i
+			break
+		}
+	}
+	if headerIdx < 0 {
+		return nil, nil, fmt.Errorf("sheet %q: header row with Asset_ID not found", AssetsSheet)
+	}
+
+	col := make(map[string]int)
+	for i, name := range sheetRows[headerIdx].Cells {
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range assetColumns {
+		if _, ok := col[strings.ToLower(name)]; !ok {
+			return nil, nil, fmt.Errorf("sheet %q: column %q missing", AssetsSheet, name)
+		}
+	}
+	cell := func(row map[int]string, name string) string {
+		return strings.TrimSpace(row[col[strings.ToLower(name)]])
+	}
+
+	var rows []AssetSheetRow
+	var problems []string
+	for i := headerIdx + 1; i < len(sheetRows); i++ {
+		// An empty row — absent from sheetRows — ends the data as well.
+		if sheetRows[i].Index != sheetRows[i-1].Index+1 {
+			break
+		}
+		row := sheetRows[i].Cells
+		id := cell(row, "Asset_ID")
+		if id == "" {
+			break
+		}
+		line := sheetRows[i].Index + 1
+
+		priority, err := parseSheetInt(cell(row, "priority"), 4)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("row %d (%s): priority: %v", line, id, err))
+			continue
+		}
+		flags := make(map[string]bool, 3)
+		bad := false
+		for _, name := range []string{"is_entrance", "is_target", "has_vulnerabilities"} {
+			v, err := parseSheetBool(cell(row, name))
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("row %d (%s): %s: %v", line, id, name, err))
+				bad = true
+				break
+			}
+			flags[name] = v
+		}
+		if bad {
+			continue
+		}
+
+		rows = append(rows, AssetSheetRow{
+			Row:              line,
+			AssetID:          id,
+			Name:             cell(row, "name"),
+			TypeName:         cell(row, "type"),
+			SegmentName:      cell(row, "Belongs_To"),
+			OSName:           cell(row, "os_type"),
+			IsEntrance:       flags["is_entrance"],
+			IsTarget:         flags["is_target"],
+			Priority:         priority,
+			HasVulnerability: flags["has_vulnerabilities"],
+			Note:             cell(row, "Note"),
+		})
+	}
+	return rows, problems, nil
+}
+
+// parseSheetInt accepts integer cells, which SpreadsheetML may store as "4" or "4.0".
+func parseSheetInt(v string, def int) (int, error) {
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f != float64(int(f)) {
+		return 0, fmt.Errorf("invalid integer %q", v)
+	}
+	return int(f), nil
+}
+
+// parseSheetBool accepts the 0/1 flags of the export as well as TRUE/FALSE.
+func parseSheetBool(v string) (bool, error) {
+	switch strings.ToLower(v) {
+	case "", "0", "false", "no":
+		return false, nil
+	case "1", "true", "yes":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid flag %q", v)
+}
+
+// lookupName resolves a reference name case-insensitively.
+func lookupName(names map[string]string, name string) (string, bool) {
+	if id, ok := names[name]; ok {
+		return id, true
+	}
+	for n, id := range names {
+		if strings.EqualFold(strings.TrimSpace(n), name) {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// toRecord resolves the reference names of a sheet row to VIDs. The Note
+// column describes the asset, so it becomes Asset_Description as in the
+// INSERT helper columns of the export.
+func toRecord(row AssetSheetRow, catalog *nebula.InventoryCatalog) (nebula.AssetRecord, error) {
+	typeID, ok := lookupName(catalog.AssetTypes, row.TypeName)
+	if !ok {
+		return nebula.AssetRecord{}, fmt.Errorf("unknown asset type %q", row.TypeName)
+	}
+	segmentID, ok := lookupName(catalog.Segments, row.SegmentName)
+	if !ok {
+		return nebula.AssetRecord{}, fmt.Errorf("unknown network segment %q", row.SegmentName)
+	}
+	osID, ok := lookupName(catalog.OSTypes, row.OSName)
+	if !ok {
+		return nebula.AssetRecord{}, fmt.Errorf("unknown OS type %q", row.OSName)
+	}
+	return nebula.AssetRecord{
+		AssetID:          row.AssetID,
+		AssetName:        row.Name,
+		Description:      row.Note,
+		IsEntrance:       row.IsEntrance,
+		IsTarget:         row.IsTarget,
+		Priority:         row.Priority,
+		HasVulnerability: row.HasVulnerability,
+		TypeID:           typeID,
+		SegmentID:        segmentID,
+		OSID:             osID,
+	}, nil
+}
+
+// diffAsset names the fields in which want differs from have. Asset_Note is
+// not part of the export and is left untouched.
+func diffAsset(have, want nebula.AssetRecord) []string {
+	var fields []string
+	if have.AssetName != want.AssetName {
+		fields = append(fields, "name")
+	}
+	if have.Description != want.Description {
+		fields = append(fields, "description")
+	}
+	if have.IsEntrance != want.IsEntrance {
+		fields = append(fields, "is_entrance")
+	}
+	if have.IsTarget != want.IsTarget {
+		fields = append(fields, "is_target")
+	}
+	if have.Priority != want.Priority {
+		fields = append(fields, "priority")
+	}
+	if have.HasVulnerability != want.HasVulnerability {
+		fields = append(fields, "has_vulnerability")
+	}
+	if have.TypeID != want.TypeID {
+		fields = append(fields, "type")
+	}
+	if have.SegmentID != want.SegmentID {
+		fields = append(fields, "segment")
+	}
+	if have.OSID != want.OSID {
+		fields = append(fields, "os")
+	}
+	return fields
+}
+
+// ImportAssets diffs the Assets sheet against the graph and, unless dryRun
+// is set, upserts every added or changed asset with exactly one has_type,
+// belongs_to and runs_on edge (DI-01, DI-02, DI-03). Assets whose hash inputs
+// changed — new assets, or a different has_vulnerability, type or OS — get
+// InvalidateAssetHash (ALG-REQ-043). Assets present in the graph but absent
+// from the workbook are reported as removed and never deleted.
+func ImportAssets(ctx context.Context, gs graphstore.GraphStore, r io.ReaderAt, size int64, dryRun bool) (*AssetImportResult, error) {
+	importStart := time.Now()
+
+	rows, problems, err := ParseAssetsXLSX(r, size)
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := gs.QueryInventoryCatalog(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load catalog: %w", err)
+	}
+	current, err := gs.QueryInventory(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load inventory: %w", err)
+	}
+
+	result := &AssetImportResult{
+		DryRun:            dryRun,
+		RowsRead:          len(rows) + len(problems),
+		Added:             []string{},
+		Changed:           []AssetChange{},
+		Removed:           []string{},
+		InvalidatedAssets: []string{},
+		Errors:            problems,
+	}
+	if result.Errors == nil {
+		result.Errors = []string{}
+	}
+
+	existing := make(map[string]nebula.AssetRecord, len(current))
+	for _, rec := range current {
+		existing[rec.AssetID] = rec
+	}
+
+	seen := make(map[string]bool, len(rows))
+	var writes []nebula.AssetRecord
+	invalidate := make(map[string]bool)
+	for _, row := range rows {
+		if seen[row.AssetID] {
+			result.Errors = append(result.Errors, fmt.Sprintf("row %d: duplicate Asset_ID %s", row.Row, row.AssetID))
+			continue
+		}
+		seen[row.AssetID] = true
+
+		want, err := toRecord(row, catalog)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("row %d (%s): %v", row.Row, row.AssetID, err))
+			continue
+		}
+
+		have, ok := existing[row.AssetID]
+		if !ok {
+			result.Added = append(result.Added, want.AssetID)
+			writes = append(writes, want)
+			invalidate[want.AssetID] = true
+			continue
+		}
+		// Asset_Note is not exported by the CMDB; keep the graph value.
+		want.Note = have.Note
+
+		fields := diffAsset(have, want)
+		if len(fields) == 0 {
+			result.Unchanged++
+			continue
+		}
+		result.Changed = append(result.Changed, AssetChange{AssetID: want.AssetID, Fields: fields})
+		writes = append(writes, want)
+		for _, f := range fields {
+			if hashInputFields[f] {
+				invalidate[want.AssetID] = true
+			}
+		}
+	}
+
+	for _, rec := range current {
+		if !seen[rec.AssetID] {
+			result.Removed = append(result.Removed, rec.AssetID)
+		}
+	}
+	sort.Strings(result.Removed)
+
+	if !dryRun {
+		for _, rec := range writes {
+			if err := gs.UpsertAsset(ctx, rec); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", rec.AssetID, err))
+				delete(invalidate, rec.AssetID)
+				continue
+			}
+			result.AssetsWritten++
+		}
+		for id := range invalidate {
+			result.InvalidatedAssets = append(result.InvalidatedAssets, id)
+		}
+		sort.Strings(result.InvalidatedAssets)
+		for _, id := range result.InvalidatedAssets {
+			gs.InvalidateAssetHash(ctx, id)
+		}
+	}
+
+	slog.InfoContext(ctx, "importer: asset import completed", "dry_run", dryRun, "rows", result.RowsRead,
+		"added", len(result.Added), "changed", len(result.Changed), "removed", len(result.Removed),
+		"unchanged", result.Unchanged, "written", result.AssetsWritten, "errors", len(result.Errors),
+		"elapsed", time.Since(importStart))
+	return result, nil
+}
@@ -0,0 +1,319 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/nebula"
+)
+
+// ============================================================
+// MITRE ATT&CK import — enterprise-attack STIX 2.1 bundle → tMitreTactic,
+// tMitreTechnique, tMitreMitigation, MitrePlatform and their edges
+// ============================================================
+
+// stixBundle is the top level of an ATT&CK STIX 2.1 JSON file.
+type stixBundle struct {
+	Type    string       `json:"type"`
+	Objects []stixObject `json:"objects"`
+}
+
+// stixObject holds the union of the fields used from the object types
+// x-mitre-collection, x-mitre-tactic, attack-pattern, course-of-action
+// and relationship.
+type stixObject struct {
+	Type               string   `json:"type"`
+	ID                 string   `json:"id"`
+	Name               string   `json:"name"`
+	Description        string   `json:"description"`
+	Revoked            bool     `json:"revoked"`
+	Deprecated         bool     `json:"x_mitre_deprecated"`
+	Version            string   `json:"x_mitre_version"`
+	ShortName          string   `json:"x_mitre_shortname"`
+	IsSubtechnique     bool     `json:"x_mitre_is_subtechnique"`
+	Platforms          []string `json:"x_mitre_platforms"`
+	ExternalReferences []struct {
+		SourceName string `json:"source_name"`
+		ExternalID string `json:"external_id"`
+	} `json:"external_references"`
+	KillChainPhases []struct {
+		KillChainName string `json:"kill_chain_name"`
+		PhaseName     string `json:"phase_name"`
+	} `json:"kill_chain_phases"`
+	RelationshipType string `json:"relationship_type"`
+	SourceRef        string `json:"source_ref"`
+	TargetRef        string `json:"target_ref"`
+}
+
+// attackID returns the ATT&CK external ID (TA0001, T1059.001, M1036).
+func (o *stixObject) attackID() string {
+	for _, ref := range o.ExternalReferences {
+		if ref.SourceName == "mitre-attack" {
+			return ref.ExternalID
+		}
+	}
+	return ""
+}
+
+// RetiredObject is an ATT&CK object flagged deprecated or revoked in the
+// bundle. Such objects are not written; InGraph tells whether a previous
+// release left them in the graph, where they need a curator's attention.
+type RetiredObject struct {
+	Type      string `json:"type"`
+	AttackID  string `json:"attack_id"`
+	Name      string `json:"name"`
+	Reason    string `json:"reason"`
+	RevokedBy string `json:"revoked_by,omitempty"`
+	InGraph   bool   `json:"in_graph"`
+}
+
+// AttackImportResult summarises one ATT&CK import run.
+type AttackImportResult struct {
+	AttackVersion   string          `json:"attack_version"`
+	Tactics         int             `json:"tactics"`
+	Techniques      int             `json:"techniques"`
+	Subtechniques   int             `json:"subtechniques"`
+	NewTechniques   []string        `json:"new_techniques"`
+	Mitigations     int             `json:"mitigations"`
+	Platforms       int             `json:"platforms"`
+	NewPlatforms    []string        `json:"new_platforms"`
+	PartOf          int             `json:"part_of"`
+	CanBeExecutedOn int             `json:"can_be_executed_on"`
+	HasSubtechnique int             `json:"has_subtechnique"`
+	Mitigates       int             `json:"mitigates"`
+	Retired         []RetiredObject `json:"retired"`
+	Errors          []string        `json:"errors"`
+}
+
+// ImportAttack loads an enterprise-attack STIX 2.1 bundle. version stamps
+// Mitre_Attack_Version; when empty the x-mitre-collection version of the
+// bundle is used. Platforms are matched to MitrePlatform by name and new
+// ones get the next free PLTFnnn VID. Deprecated and revoked objects are
+// skipped and reported, as are relationships that touch them.
+func ImportAttack(ctx context.Context, gs graphstore.GraphStore, r io.Reader, version string) (*AttackImportResult, error) {
+	importStart := time.Now()
+
+	var bundle stixBundle
+	if err := json.NewDecoder(r).Decode(&bundle); err != nil {
+		return nil, fmt.Errorf("decode STIX bundle: %w", err)
+	}
+	if bundle.Type != "bundle" {
+		return nil, fmt.Errorf("not a STIX bundle (type %q)", bundle.Type)
+	}
+
+	inv, err := gs.QueryAttackInventory(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load ATT&CK inventory: %w", err)
+	}
+
+	result := &AttackImportResult{
+		NewTechniques: []string{},
+		NewPlatforms:  []string{},
+		Retired:       []RetiredObject{},
+		Errors:        []string{},
+	}
+
+	byRef := make(map[string]*stixObject, len(bundle.Objects))
+	for i := range bundle.Objects {
+		o := &bundle.Objects[i]
+		byRef[o.ID] = o
+		if o.Type == "x-mitre-collection" && version == "" {
+			version = o.Version
+		}
+	}
+	if version == "" {
+		return nil, fmt.Errorf("ATT&CK version not found in bundle; pass it explicitly")
+	}
+	result.AttackVersion = version
+
+	// revoked-by relationships name the replacement of a revoked object.
+	revokedBy := make(map[string]string)
+	for _, o := range bundle.Objects {
+		if o.Type == "relationship" && o.RelationshipType == "revoked-by" {
+			if target, ok := byRef[o.TargetRef]; ok {
+				revokedBy[o.SourceRef] = target.attackID()
+			}
+		}
+	}
+
+	inGraph := func(o *stixObject) bool {
+		id := o.attackID()
+		switch o.Type {
+		case "x-mitre-tactic":
+			return inv.TacticIDs[id]
+		case "attack-pattern":
+			return inv.TechniqueIDs[id]
+		case "course-of-action":
+			return inv.MitigationIDs[id]
+		}
+		return false
+	}
+	active := func(o *stixObject) bool {
+		return o != nil && !o.Revoked && !o.Deprecated && o.attackID() != ""
+	}
+
+	rel := &nebula.AttackRelease{Version: version}
+	tacticByShortName := make(map[string]string)
+	techniqueIdx := make(map[string]int)
+	mitigationIdx := make(map[string]int)
+
+	for i := range bundle.Objects {
+		o := &bundle.Objects[i]
+		switch o.Type {
+		case "x-mitre-tactic", "attack-pattern", "course-of-action":
+		default:
+			continue
+		}
+		if o.Revoked || o.Deprecated {
+			retired := RetiredObject{Type: o.Type, AttackID: o.attackID(), Name: o.Name, Reason: "deprecated", InGraph: inGraph(o)}
+			if o.Revoked {
+				retired.Reason = "revoked"
+				retired.RevokedBy = revokedBy[o.ID]
+			}
+			result.Retired = append(result.Retired, retired)
+			continue
+		}
+		id := o.attackID()
+		if id == "" {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s %s: no mitre-attack external_id", o.Type, o.ID))
+			continue
+		}
+
+		switch o.Type {
+		case "x-mitre-tactic":
+			rel.Tactics = append(rel.Tactics, nebula.AttackTactic{TacticID: id, TacticName: o.Name})
+			tacticByShortName[o.ShortName] = id
+		case "attack-pattern":
+			techniqueIdx[o.ID] = len(rel.Techniques)
+			rel.Techniques = append(rel.Techniques, nebula.AttackTechnique{TechniqueID: id, TechniqueName: o.Name})
+			if o.IsSubtechnique {
+				result.Subtechniques++
+			} else {
+				result.Techniques++
+			}
+			if !inv.TechniqueIDs[id] {
+				result.NewTechniques = append(result.NewTechniques, id)
+			}
+		case "course-of-action":
+			// Pre-2020 course-of-action objects mirror techniques (T-IDs);
+			// only M-IDs are mitigations in the TA005 sense.
+			if !strings.HasPrefix(id, "M") {
+				continue
+			}
+			mitigationIdx[o.ID] = len(rel.Mitigations)
+			rel.Mitigations = append(rel.Mitigations, nebula.AttackMitigation{
+				MitigationID:   id,
+				MitigationName: o.Name,
+				Description:    o.Description,
+				Version:        o.Version,
+			})
+		}
+	}
+	result.Tactics = len(rel.Tactics)
+	result.Mitigations = len(rel.Mitigations)
+
+	// Platforms and part_of come from the technique objects themselves.
+	nextPlatform := nextPlatformNumber(inv.Platforms)
+	platformIDs := make(map[string]string, len(inv.Platforms))
+	for name, id := range inv.Platforms {
+		platformIDs[name] = id
+	}
+	platformSeen := make(map[string]bool)
+	for i := range bundle.Objects {
+		o := &bundle.Objects[i]
+		idx, ok := techniqueIdx[o.ID]
+		if !ok {
+			continue
+		}
+		t := &rel.Techniques[idx]
+		for _, phase := range o.KillChainPhases {
+			if phase.KillChainName != "mitre-attack" {
+				continue
+			}
+			tacticID, ok := tacticByShortName[phase.PhaseName]
+			if !ok {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: unknown tactic %q", t.TechniqueID, phase.PhaseName))
+				continue
+			}
+			t.TacticIDs = append(t.TacticIDs, tacticID)
+		}
+		for _, name := range o.Platforms {
+			id, ok := platformIDs[name]
+			if !ok {
+				id = fmt.Sprintf("PLTF%03d", nextPlatform)
+				nextPlatform++
+				platformIDs[name] = id
+				result.NewPlatforms = append(result.NewPlatforms, name)
+			}
+			if !platformSeen[id] {
+				platformSeen[id] = true
+				rel.Platforms = append(rel.Platforms, nebula.AttackPlatform{PlatformID: id, PlatformName: name})
+			}
+			t.PlatformIDs = append(t.PlatformIDs, id)
+		}
+		result.PartOf += len(t.TacticIDs)
+		result.CanBeExecutedOn += len(t.PlatformIDs)
+	}
+	result.Platforms = len(rel.Platforms)
+
+	for _, o := range bundle.Objects {
+		if o.Type != "relationship" || o.Revoked || o.Deprecated {
+			continue
+		}
+		src, dst := byRef[o.SourceRef], byRef[o.TargetRef]
+		switch o.RelationshipType {
+		case "subtechnique-of":
+			subIdx, okSub := techniqueIdx[o.SourceRef]
+			if !okSub || !active(dst) || dst.Type != "attack-pattern" {
+				continue
+			}
+			rel.Techniques[subIdx].ParentID = dst.attackID()
+			result.HasSubtechnique++
+		case "mitigates":
+			mIdx, okMit := mitigationIdx[o.SourceRef]
+			if !okMit || !active(src) || !active(dst) || dst.Type != "attack-pattern" {
+				continue
+			}
+			rel.Mitigations[mIdx].Uses = append(rel.Mitigations[mIdx].Uses, nebula.AttackMitigationUse{
+				TechniqueID:    dst.attackID(),
+				UseDescription: o.Description,
+			})
+			result.Mitigates++
+		}
+	}
+
+	sort.Slice(rel.Techniques, func(i, j int) bool { return rel.Techniques[i].TechniqueID < rel.Techniques[j].TechniqueID })
+	sort.Slice(rel.Platforms, func(i, j int) bool { return rel.Platforms[i].PlatformID < rel.Platforms[j].PlatformID })
+	sort.Strings(result.NewTechniques)
+	sort.Strings(result.NewPlatforms)
+	sort.Slice(result.Retired, func(i, j int) bool { return result.Retired[i].AttackID < result.Retired[j].AttackID })
+
+	if err := gs.UpsertAttackRelease(ctx, rel); err != nil {
+		return nil, fmt.Errorf("write ATT&CK %s: %w", version, err)
+	}
+
+	slog.InfoContext(ctx, "importer: ATT&CK import completed", "version", version, "tactics", result.Tactics,
+		"techniques", result.Techniques, "subtechniques", result.Subtechniques, "new_techniques", len(result.NewTechniques),
+		"mitigations", result.Mitigations, "platforms", result.Platforms, "new_platforms", len(result.NewPlatforms),
+		"retired", len(result.Retired), "errors", len(result.Errors), "elapsed", time.Since(importStart))
+	return result, nil
+}
+
+// nextPlatformNumber returns the number following the highest PLTFnnn VID.
+func nextPlatformNumber(platforms map[string]string) int {
+	highest := 0
+	for _, id := range platforms {
+		if n, err := strconv.Atoi(strings.TrimPrefix(id, "PLTF")); err == nil && n > highest {
+			highest = n
+		}
+	}
+	return highest + 1
+}
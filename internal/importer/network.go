@@ -0,0 +1,373 @@
+package importer
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/nebula"
+)
+
+// ============================================================
+// Network topology import — sources/network1.csv → connects_to (SCHEMA ED006)
+// ============================================================
+
+// networkHeader is the expected column layout of the network CSV.
+var networkHeader = []string{"from", "to", "hostname_Zone_ID", "port/protocol", "has_connectivity"}
+
+// validProtocols lists the Connection_Protocol values allowed by ED006.
+var validProtocols = map[string]bool{"IP": true, "TCP": true, "UDP": true, "ICMP": true}
+
+// NetworkRow is one parsed line of the network CSV.
+type NetworkRow struct {
+	Line            int
+	FromHost        string
+	ToHost          string
+	Connections     []nebula.Connection
+	HasConnectivity bool
+}
+
+// NetworkImportResult summarises one network import run.
+type NetworkImportResult struct {
+	RowsRead          int      `json:"rows_read"`
+	RowsConnected     int      `json:"rows_connected"`
+	PairsWritten      int      `json:"pairs_written"`
+	PairsUnchanged    int      `json:"pairs_unchanged"`
+	PairsRemoved      int      `json:"pairs_removed"`
+	EdgesWritten      int      `json:"edges_written"`
+	InvalidatedAssets []string `json:"invalidated_assets"`
+	UnresolvedHosts   []string `json:"unresolved_hosts"`
+	Errors            []string `json:"errors"`
+}
+
+// ParsePortProtocol parses a port/protocol cell such as "ip/0-65535",
+// "tcp/443" or "tcp/25;tcp/443" into connects_to property pairs.
+// Protocols are upper-cased to match the ED006 convention ("TCP", "UDP").
+func ParsePortProtocol(cell string) ([]nebula.Connection, error) {
+	var conns []nebula.Connection
+	for _, token := range strings.Split(cell, ";") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		parts := strings.SplitN(token, "/", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("token %q: expected protocol/port", token)
+		}
+		proto := strings.ToUpper(strings.TrimSpace(parts[0]))
+		if !validProtocols[proto] {
+			return nil, fmt.Errorf("token %q: unknown protocol %q", token, parts[0])
+		}
+		port := strings.TrimSpace(parts[1])
+		if err := validatePort(port); err != nil {
+			return nil, fmt.Errorf("token %q: %w", token, err)
+		}
+		conns = append(conns, nebula.Connection{Protocol: proto, Port: port})
+	}
+	if len(conns) == 0 {
+		return nil, fmt.Errorf("empty port/protocol")
+	}
+	return conns, nil
+}
+
+// validatePort accepts a single port or an inclusive range within 0-65535.
+func validatePort(port string) error {
+	bounds := strings.SplitN(port, "-", 2)
+	prev := -1
+	for _, b := range bounds {
+		n, err := strconv.Atoi(b)
+		if err != nil || n < 0 || n > 65535 {
+			return fmt.Errorf("invalid port %q", port)
+		}
+		if n < prev {
+			return fmt.Errorf("invalid port range %q", port)
+		}
+		prev = n
+	}
+	return nil
+}
+
+// ParseNetworkCSV reads the `;`-separated network CSV. Rows that cannot be
+// parsed are reported in the returned error list and skipped; a missing or
+// malformed header is a fatal error.
+func ParseNetworkCSV(r io.Reader) ([]NetworkRow, []string, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = ';'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("read header: %w", err)
+	}
+	if len(header) < len(networkHeader) {
+		return nil, nil, fmt.Errorf("header has %d columns, want %d (%s)",
+			len(header), len(networkHeader), strings.Join(networkHeader, ";"))
+	}
+	for i, name := range networkHeader {
+		if !strings.EqualFold(strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff")), name) {
+			return nil, nil, fmt.Errorf("header column %d is %q, want %q", i+1, header[i], name)
+		}
+	}
+
+	var rows []NetworkRow
+	var problems []string
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: %v", line, err))
+			continue
+		}
+		if len(record) < len(networkHeader) {
+			problems = append(problems, fmt.Sprintf("line %d: %d columns, want %d", line, len(record), len(networkHeader)))
+			continue
+		}
+
+		conns, err := ParsePortProtocol(record[3])
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: %v", line, err))
+			continue
+		}
+
+		rows = append(rows, NetworkRow{
+			Line:            line,
+			FromHost:        strings.TrimSpace(record[0]),
+			ToHost:          strings.TrimSpace(record[1]),
+			Connections:     conns,
+			HasConnectivity: strings.TrimSpace(record[4]) == "1",
+		})
+	}
+	return rows, problems, nil
+}
+
+// hostResolver maps network hostnames to Asset_IDs. Hostnames carry a zone
+// prefix ("LAN_DC_FW2") while Asset_Name holds the bare name ("FW2"), so an
+// exact Asset_Name match is tried first, then the last "_" token.
+type hostResolver struct {
+	byName    map[string]string
+	ambiguous map[string]bool
+}
+
+func newHostResolver(assets []map[string]interface{}) *hostResolver {
+	h := &hostResolver{byName: make(map[string]string), ambiguous: make(map[string]bool)}
+	for _, a := range assets {
+		id, _ := a["asset_id"].(string)
+		name, _ := a["asset_name"].(string)
+		if id == "" || name == "" {
+			continue
+		}
+		if prev, exists := h.byName[name]; exists && prev != id {
+			h.ambiguous[name] = true
+			continue
+		}
+		h.byName[name] = id
+	}
+	return h
+}
+
+func (h *hostResolver) resolve(host string) (string, bool) {
+	candidates := []string{host}
+	if i := strings.LastIndex(host, "_"); i >= 0 && i < len(host)-1 {
+		candidates = append(candidates, host[i+1:])
+	}
+	for _, name := range candidates {
+		if h.ambiguous[name] {
+			return "", false
+		}
+		if id, ok := h.byName[name]; ok {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// ImportNetwork loads the network CSV into connects_to edges.
+// Only rows with has_connectivity == 1 produce edges. Rows are grouped per
+// (src, dst) pair in file order and ranks are assigned 0..n-1 per pair
+// (ED006 rank convention); a multi-token cell contributes one rank per token.
+// Pairs whose edge set differs from the graph are rewritten and the target
+// asset's hash is invalidated, which also increments SystemState.stale_count
+// (ALG-REQ-043). A pair the file lists with has_connectivity == 0 and never
+// with has_connectivity == 1 loses every rank and its target is invalidated.
+// Pairs the file does not list, or lists with an unresolved host, are left
+// as they are.
+func ImportNetwork(ctx context.Context, gs graphstore.GraphStore, r io.Reader) (*NetworkImportResult, error) {
+	importStart := time.Now()
+
+	rows, problems, err := ParseNetworkCSV(r)
+	if err != nil {
+		return nil, err
+	}
+
+	assets, err := gs.QueryAssetsWithDetails(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load assets: %w", err)
+	}
+	resolver := newHostResolver(assets)
+
+	result := &NetworkImportResult{
+		RowsRead:          len(rows) + len(problems),
+		InvalidatedAssets: []string{},
+		UnresolvedHosts:   []string{},
+		Errors:            problems,
+	}
+	if result.Errors == nil {
+		result.Errors = []string{}
+	}
+
+	type pairKey struct{ src, dst string }
+	pairConns := make(map[pairKey][]nebula.Connection)
+	var pairOrder []pairKey
+	disconnected := make(map[pairKey]bool)
+	unresolved := make(map[string]bool)
+
+	for _, row := range rows {
+		if row.HasConnectivity {
+			result.RowsConnected++
+		}
+
+		srcID, okSrc := resolver.resolve(row.FromHost)
+		dstID, okDst := resolver.resolve(row.ToHost)
+		if !okSrc {
+			unresolved[row.FromHost] = true
+		}
+		if !okDst {
+			unresolved[row.ToHost] = true
+		}
+		if !okSrc || !okDst {
+			continue
+		}
+		if srcID == dstID {
+			result.Errors = append(result.Errors, fmt.Sprintf("line %d: self-connection %s", row.Line, srcID))
+			continue
+		}
+
+		key := pairKey{srcID, dstID}
+		if !row.HasConnectivity {
+			disconnected[key] = true
+			continue
+		}
+		if _, seen := pairConns[key]; !seen {
+			pairOrder = append(pairOrder, key)
+		}
+		pairConns[key] = append(pairConns[key], row.Connections...)
+	}
+
+	// Pairs the file disconnects explicitly.
+	var removed []pairKey
+	for key := range disconnected {
+		if _, ok := pairConns[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool {
+		if removed[i].src != removed[j].src {
+			return removed[i].src < removed[j].src
+		}
+		return removed[i].dst < removed[j].dst
+	})
+
+	sort.SliceStable(pairOrder, func(i, j int) bool {
+		if pairOrder[i].src != pairOrder[j].src {
+			return pairOrder[i].src < pairOrder[j].src
+		}
+		return pairOrder[i].dst < pairOrder[j].dst
+	})
+
+	invalidate := make(map[string]bool)
+	for _, key := range pairOrder {
+		conns := pairConns[key]
+
+		existing, err := gs.QueryEdgeConnections(ctx, key.src, key.dst)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s -> %s: %v", key.src, key.dst, err))
+			continue
+		}
+		if sameConnections(existing, conns) {
+			result.PairsUnchanged++
+			continue
+		}
+
+		if err := gs.ReplaceConnections(ctx, key.src, key.dst, conns); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s -> %s: %v", key.src, key.dst, err))
+			continue
+		}
+		result.PairsWritten++
+		result.EdgesWritten += len(conns)
+		invalidate[key.dst] = true
+	}
+
+	for _, key := range removed {
+		existing, err := gs.QueryEdgeConnections(ctx, key.src, key.dst)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s -> %s: %v", key.src, key.dst, err))
+			continue
+		}
+		if len(existing) == 0 {
+			continue
+		}
+		if err := gs.ReplaceConnections(ctx, key.src, key.dst, nil); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s -> %s: %v", key.src, key.dst, err))
+			continue
+		}
+		result.PairsRemoved++
+		invalidate[key.dst] = true
+	}
+
+	for id := range invalidate {
+		result.InvalidatedAssets = append(result.InvalidatedAssets, id)
+	}
+	sort.Strings(result.InvalidatedAssets)
+	for _, id := range result.InvalidatedAssets {
+		gs.InvalidateAssetHash(ctx, id)
+	}
+
+	for host := range unresolved {
+		result.UnresolvedHosts = append(result.UnresolvedHosts, host)
+	}
+	sort.Strings(result.UnresolvedHosts)
+
+	slog.InfoContext(ctx, "importer: network import completed", "rows", result.RowsRead,
+		"pairs_written", result.PairsWritten, "pairs_unchanged", result.PairsUnchanged, "pairs_removed", result.PairsRemoved,
+		"invalidated_assets", len(result.InvalidatedAssets), "unresolved_hosts", len(result.UnresolvedHosts),
+		"errors", len(result.Errors), "elapsed", time.Since(importStart))
+	return result, nil
+}
+
+// sameConnections compares the stored connects_to properties of a pair with
+// the imported set, ignoring rank order.
+func sameConnections(existing []map[string]interface{}, conns []nebula.Connection) bool {
+	if len(existing) != len(conns) {
+		return false
+	}
+	a := make([]string, 0, len(existing))
+	for _, e := range existing {
+		proto, _ := e["connection_protocol"].(string)
+		port, _ := e["connection_port"].(string)
+		a = append(a, proto+"|"+port)
+	}
+	b := make([]string, 0, len(conns))
+	for _, c := range conns {
+		b = append(b, c.Protocol+"|"+c.Port)
+	}
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
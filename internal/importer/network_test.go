@@ -0,0 +1,165 @@
+package importer
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/nebula"
+)
+
+func TestParsePortProtocol(t *testing.T) {
+	tests := []struct {
+		cell    string
+		want    []nebula.Connection
+		wantErr bool
+	}{
+		{cell: "ip/0-65535", want: []nebula.Connection{{Protocol: "IP", Port: "0-65535"}}},
+		{cell: "tcp/443", want: []nebula.Connection{{Protocol: "TCP", Port: "443"}}},
+		{cell: " tcp/25; udp / 53 ;", want: []nebula.Connection{{Protocol: "TCP", Port: "25"}, {Protocol: "UDP", Port: "53"}}},
+		{cell: "ICMP/0", want: []nebula.Connection{{Protocol: "ICMP", Port: "0"}}},
+		{cell: "", wantErr: true},
+		{cell: " ; ", wantErr: true},
+		{cell: "tcp", wantErr: true},
+		{cell: "sctp/80", wantErr: true},
+		{cell: "tcp/http", wantErr: true},
+		{cell: "tcp/65536", wantErr: true},
+		{cell: "tcp/-1", wantErr: true},
+		{cell: "tcp/443-80", wantErr: true},
+		{cell: "tcp/443;bogus", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cell, func(t *testing.T) {
+			got, err := ParsePortProtocol(tt.cell)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePortProtocol(%q) error = %v, wantErr %v", tt.cell, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePortProtocol(%q) = %v, want %v", tt.cell, got, tt.want)
+			}
+		})
+	}
+}
+
+// networkFixture has four typed assets and four connects_to pairs.
+const networkFixture = `{
+  "Asset": [
+    {"Asset_ID": "A1", "Asset_Name": "FW1"},
+    {"Asset_ID": "A2", "Asset_Name": "WEB1"},
+    {"Asset_ID": "A3", "Asset_Name": "DB1"},
+    {"Asset_ID": "A4", "Asset_Name": "APP1"}
+  ],
+  "Asset_Type": [{"Type_ID": "DT001", "Type_Name": "Server"}],
+  "has_type": [
+    {"src": "A1", "dst": "DT001"}, {"src": "A2", "dst": "DT001"},
+    {"src": "A3", "dst": "DT001"}, {"src": "A4", "dst": "DT001"}
+  ],
+  "connects_to": [
+    {"src": "A1", "dst": "A2", "Connection_Protocol": "TCP", "Connection_Port": "443"},
+    {"src": "A2", "dst": "A3", "Connection_Protocol": "TCP", "Connection_Port": "5432"},
+    {"src": "A2", "dst": "A4", "Connection_Protocol": "TCP", "Connection_Port": "8080"},
+    {"src": "A3", "dst": "A4", "Connection_Protocol": "TCP", "Connection_Port": "22"}
+  ]
+}`
+
+const networkCSVHeader = "from;to;hostname_Zone_ID;port/protocol;has_connectivity\n"
+
+func TestImportNetworkRemovals(t *testing.T) {
+	unchanged := map[string]string{"A1>A2": "TCP/443", "A2>A3": "TCP/5432", "A2>A4": "TCP/8080", "A3>A4": "TCP/22"}
+	tests := []struct {
+		name           string
+		csv            string
+		want           map[string]string // pair -> protocol/port after the import
+		wantRemoved    int
+		wantUnresolved []string
+		wantInvalid    []string
+	}{
+		{
+			name:        "absent pairs are kept",
+			csv:         "DMZ_FW1;DMZ_WEB1;Z1;tcp/443;1\n",
+			want:        unchanged,
+			wantInvalid: []string{},
+		},
+		{
+			name:           "unresolved host keeps the pair",
+			csv:            "DMZ_FW1X;DMZ_WEB1;Z1;tcp/443;1\nDMZ_WEB1;LAN_DB1;Z1;tcp/5432;1\n",
+			want:           unchanged,
+			wantUnresolved: []string{"DMZ_FW1X"},
+			wantInvalid:    []string{},
+		},
+		{
+			name:           "unresolved host in a disconnected row removes nothing",
+			csv:            "DMZ_WEB1;LAN_DB2;Z1;tcp/5432;0\n",
+			want:           unchanged,
+			wantUnresolved: []string{"LAN_DB2"},
+			wantInvalid:    []string{},
+		},
+		{
+			name:        "self-connection removes nothing",
+			csv:         "DMZ_FW1;DMZ_FW1;Z1;tcp/22;0\n",
+			want:        unchanged,
+			wantInvalid: []string{},
+		},
+		{
+			name:        "disconnected pair is removed",
+			csv:         "DMZ_WEB1;LAN_DB1;Z1;tcp/5432;0\n",
+			want:        map[string]string{"A1>A2": "TCP/443", "A2>A4": "TCP/8080", "A3>A4": "TCP/22"},
+			wantRemoved: 1,
+			wantInvalid: []string{"A3"},
+		},
+		{
+			name:        "connected row wins over a disconnected one",
+			csv:         "DMZ_WEB1;LAN_APP1;Z1;tcp/8080;0\nDMZ_WEB1;LAN_APP1;Z1;tcp/8080;1\n",
+			want:        unchanged,
+			wantInvalid: []string{},
+		},
+		{
+			name:        "disconnected pair without edges",
+			csv:         "LAN_DB1;DMZ_FW1;Z1;tcp/22;0\n",
+			want:        unchanged,
+			wantInvalid: []string{},
+		},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := graphstore.NewMemoryStore()
+			if err := m.Load(strings.NewReader(networkFixture)); err != nil {
+				t.Fatalf("load fixture: %v", err)
+			}
+			result, err := ImportNetwork(ctx, m, strings.NewReader(networkCSVHeader+tt.csv))
+			if err != nil {
+				t.Fatalf("ImportNetwork: %v", err)
+			}
+			if result.PairsRemoved != tt.wantRemoved {
+				t.Errorf("PairsRemoved = %d, want %d", result.PairsRemoved, tt.wantRemoved)
+			}
+			if tt.wantUnresolved == nil {
+				tt.wantUnresolved = []string{}
+			}
+			if !reflect.DeepEqual(result.UnresolvedHosts, tt.wantUnresolved) {
+				t.Errorf("UnresolvedHosts = %v, want %v", result.UnresolvedHosts, tt.wantUnresolved)
+			}
+			if !reflect.DeepEqual(result.InvalidatedAssets, tt.wantInvalid) {
+				t.Errorf("InvalidatedAssets = %v, want %v", result.InvalidatedAssets, tt.wantInvalid)
+			}
+
+			got := make(map[string]string)
+			for _, pair := range []string{"A1>A2", "A2>A3", "A2>A4", "A3>A4", "A3>A1"} {
+				src, dst, _ := strings.Cut(pair, ">")
+				conns, err := m.QueryEdgeConnections(ctx, src, dst)
+				if err != nil {
+					t.Fatalf("QueryEdgeConnections: %v", err)
+				}
+				for _, c := range conns {
+					got[pair] = c["connection_protocol"].(string) + "/" + c["connection_port"].(string)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("connects_to after import = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package importer
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ============================================================
+// Minimal XLSX reader — enough of SpreadsheetML (ECMA-376) to read
+// the cell values of one worksheet from the sources/*.xlsx workbooks.
+// ============================================================
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxRichText covers both <si> shared strings and <is> inline strings:
+// plain text lives in <t>, rich text in <r><t> runs.
+type xlsxRichText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (s xlsxRichText) text() string {
+	if len(s.Runs) == 0 {
+		return s.T
+	}
+	var b strings.Builder
+	b.WriteString(s.T)
+	for _, r := range s.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxRichText `xml:"si"`
+}
+
+type xlsxSheetData struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string        `xml:"r,attr"`
+			Type   string        `xml:"t,attr"`
+			Value  string        `xml:"v"`
+			Inline *xlsxRichText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// SpreadsheetML limits (ECMA-376 Part 1, 18.3.1.73): column XFD and row
+// 1048576. maxXLSXPartSize caps the decompressed size of each workbook part.
+const (
+	maxXLSXColumns  = 16384
+	maxXLSXRows     = 1048576
+	maxXLSXPartSize = 64 << 20
+)
+
+// XLSXRow is one non-empty worksheet row: its zero-based index (row 1 →
+// index 0) and its non-empty cells by zero-based column.
+type XLSXRow struct {
+	Index int
+	Cells map[int]string
+}
+
+// ReadXLSXSheet returns the non-empty rows of the named worksheet in row
+// order. Rows and cells are kept sparse, so the memory used follows the
+// cells present, not the highest reference. Formulas yield their cached
+// value.
+func ReadXLSXSheet(r io.ReaderAt, size int64, sheet string) ([]XLSXRow, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("open workbook: %w", err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var wb xlsxWorkbook
+	if err := decodeZipXML(files, "xl/workbook.xml", &wb); err != nil {
+		return nil, err
+	}
+	var rels xlsxRelationships
+	if err := decodeZipXML(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+
+	rid := ""
+	for _, s := range wb.Sheets {
+		if s.Name == sheet {
+			rid = s.RID
+		}
+	}
+	if rid == "" {
+		return nil, fmt.Errorf("sheet %q not found in workbook", sheet)
+	}
+	sheetPath := ""
+	for _, rel := range rels.Relationships {
+		if rel.ID == rid {
+			if strings.HasPrefix(rel.Target, "/") {
+				sheetPath = strings.TrimPrefix(rel.Target, "/")
+			} else {
+				sheetPath = path.Join("xl", rel.Target)
+			}
+		}
+	}
+	if sheetPath == "" {
+		return nil, fmt.Errorf("sheet %q: relationship %s not found", sheet, rid)
+	}
+
+	var shared xlsxSharedStrings
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeZipXML(files, "xl/sharedStrings.xml", &shared); err != nil {
+			return nil, err
+		}
+	}
+
+	var data xlsxSheetData
+	if err := decodeZipXML(files, sheetPath, &data); err != nil {
+		return nil, err
+	}
+
+	var rows []XLSXRow
+	for _, row := range data.Rows {
+		rowIdx := -1
+		cells := make(map[int]string)
+		for _, c := range row.Cells {
+			col, rIdx, err := parseCellRef(c.Ref)
+			if err != nil {
+				return nil, fmt.Errorf("sheet %q: %w", sheet, err)
+			}
+			if rowIdx >= 0 && rIdx != rowIdx {
+				return nil, fmt.Errorf("sheet %q: cell %s outside its row %d", sheet, c.Ref, rowIdx+1)
+			}
+			rowIdx = rIdx
+			var v string
+			switch c.Type {
+			case "s":
+				i, err := strconv.Atoi(c.Value)
+				if err != nil || i < 0 || i >= len(shared.Items) {
+					return nil, fmt.Errorf("sheet %q cell %s: bad shared string index %q", sheet, c.Ref, c.Value)
+				}
+				v = shared.Items[i].text()
+			case "inlineStr":
+				if c.Inline != nil {
+					v = c.Inline.text()
+				}
+			default:
+				v = c.Value
+			}
+			cells[col] = v
+		}
+		if len(cells) == 0 {
+			continue
+		}
+		rows = append(rows, XLSXRow{Index: rowIdx, Cells: cells})
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Index < rows[j].Index })
+	return rows, nil
+}
+
+func decodeZipXML(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("workbook part %s missing", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("open %s: %w", name, err)
+	}
+	defer rc.Close()
+	if f.UncompressedSize64 > maxXLSXPartSize {
+		return fmt.Errorf("workbook part %s larger than %d bytes", name, maxXLSXPartSize)
+	}
+	// The declared size may lie; the limit holds regardless.
+	if err := xml.NewDecoder(io.LimitReader(rc, maxXLSXPartSize)).Decode(v); err != nil {
+		return fmt.Errorf("decode %s: %w", name, err)
+	}
+	return nil
+}
+
+// parseCellRef converts an A1-style reference into zero-based column and
+// row, rejecting references beyond XFD1048576.
+func parseCellRef(ref string) (int, int, error) {
+	i := 0
+	col := 0
+	for i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z' {
+		col = col*26 + int(ref[i]-'A'+1)
+		if col > maxXLSXColumns {
+			return 0, 0, fmt.Errorf("cell reference %q beyond column XFD", ref)
+		}
+		i++
+	}
+	digits := ref[i:]
+	if i == 0 || digits == "" || len(digits) > 7 || strings.Trim(digits, "0123456789") != "" {
+		return 0, 0, fmt.Errorf("bad cell reference %q", ref)
+	}
+	row, _ := strconv.Atoi(digits)
+	if row < 1 || row > maxXLSXRows {
+		return 0, 0, fmt.Errorf("bad cell reference %q", ref)
+	}
+	return col - 1, row - 1, nil
+}
@@ -0,0 +1,37 @@
+package importer
+
+import "testing"
+
+func TestParseCellRef(t *testing.T) {
+	tests := []struct {
+		ref      string
+		col, row int
+		wantErr  bool
+	}{
+		{ref: "A1", col: 0, row: 0},
+		{ref: "Z10", col: 25, row: 9},
+		{ref: "AA2", col: 26, row: 1},
+		{ref: "XFD1048576", col: 16383, row: 1048575},
+		{ref: "XFE1", wantErr: true},
+		{ref: "AAAAAAAAAAAAAAAAAAAA1", wantErr: true},
+		{ref: "A1048577", wantErr: true},
+		{ref: "A99999999", wantErr: true},
+		{ref: "A0", wantErr: true},
+		{ref: "A", wantErr: true},
+		{ref: "12", wantErr: true},
+		{ref: "a1", wantErr: true},
+		{ref: "A1B", wantErr: true},
+		{ref: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			col, row, err := parseCellRef(tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCellRef(%q) error = %v, wantErr %v", tt.ref, err, tt.wantErr)
+			}
+			if !tt.wantErr && (col != tt.col || row != tt.row) {
+				t.Errorf("parseCellRef(%q) = (%d, %d), want (%d, %d)", tt.ref, col, row, tt.col, tt.row)
+			}
+		})
+	}
+}
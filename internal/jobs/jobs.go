@@ -0,0 +1,345 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// Background jobs — long-running operations run outside the HTTP
+// request with progress, per-item events and cancellation (REQ-040)
+// ============================================================
+
+// State is the lifecycle state of a job.
+type State string
+
+const (
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	StateCancelled State = "cancelled"
+)
+
+// Item statuses reported by Event.Status.
+const (
+	StatusRecalculated = "recalculated"
+	StatusUnchanged    = "unchanged"
+	StatusFailed       = "failed"
+)
+
+// finishedJobsKept bounds how many finished jobs stay queryable.
+const finishedJobsKept = 20
+
+// ErrBusy is returned by Start while a job of the same kind is running.
+var ErrBusy = errors.New("jobs: a job of this kind is already running")
+
+// ErrShuttingDown is returned by Start once Shutdown has been called.
+var ErrShuttingDown = errors.New("jobs: shutting down")
+
+// Event is one per-asset progress update. Seq starts at 1 and doubles as the
+// SSE event ID.
+type Event struct {
+	Seq     int      `json:"seq"`
+	AssetID string   `json:"asset_id"`
+	Status  string   `json:"status"`
+	TTB     *float64 `json:"ttb,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	Done    int      `json:"done"`
+	Total   int      `json:"total"`
+	Failed  int      `json:"failed"`
+}
+
+// Failure records one asset the job could not process.
+type Failure struct {
+	AssetID string `json:"asset_id"`
+	Error   string `json:"error"`
+}
+
+// Snapshot is the GET /api/jobs/{id} response body.
+type Snapshot struct {
+	ID         string      `json:"id"`
+	Kind       string      `json:"kind"`
+	State      State       `json:"state"`
+	Done       int         `json:"done"`
+	Total      int         `json:"total"`
+	Failed     int         `json:"failed"`
+	Failures   []Failure   `json:"failures"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	Result     interface{} `json:"result,omitempty"`
+}
+
+// RunFunc performs the work of a job. It reports progress through j and
+// should return promptly once ctx is cancelled; returning ctx.Err() marks the
+// job cancelled. The result is kept even for failed or cancelled jobs.
+type RunFunc func(ctx context.Context, j *Job) (interface{}, error)
+
+// Job is one background run. All methods are safe for concurrent use.
+type Job struct {
+	ID   string
+	Kind string
+
+	cancel context.CancelFunc
+
+	mu         sync.Mutex
+	state      State
+	total      int
+	done       int
+	failures   []Failure
+	events     []Event
+	changed    chan struct{} // closed and replaced on every update
+	startedAt  time.Time
+	finishedAt time.Time
+	err        string
+	result     interface{}
+}
+
+// SetTotal sets the number of assets the job will process.
+func (j *Job) SetTotal(n int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.total = n
+	j.notifyLocked()
+}
+
+// Report records the outcome for one asset and publishes it as an event.
+// A non-nil err marks the asset failed.
+func (j *Job) Report(assetID, status string, ttb *float64, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.done++
+	ev := Event{Seq: len(j.events) + 1, AssetID: assetID, Status: status, TTB: ttb}
+	if err != nil {
+		ev.Status = StatusFailed
+		ev.Error = err.Error()
+		j.failures = append(j.failures, Failure{AssetID: assetID, Error: ev.Error})
+	}
+	ev.Done, ev.Total, ev.Failed = j.done, j.total, len(j.failures)
+	j.events = append(j.events, ev)
+	j.notifyLocked()
+}
+
+// Cancel asks a running job to stop. It reports false if the job had
+// already finished.
+func (j *Job) Cancel() bool {
+	j.mu.Lock()
+	running := j.state == StateRunning
+	j.mu.Unlock()
+	if running {
+		j.cancel()
+	}
+	return running
+}
+
+// Snapshot returns the job's current progress.
+func (j *Job) Snapshot() Snapshot {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	s := Snapshot{
+		ID:        j.ID,
+		Kind:      j.Kind,
+		State:     j.state,
+		Done:      j.done,
+		Total:     j.total,
+		Failed:    len(j.failures),
+		Failures:  append([]Failure{}, j.failures...),
+		StartedAt: j.startedAt,
+		Error:     j.err,
+		Result:    j.result,
+	}
+	if !j.finishedAt.IsZero() {
+		finished := j.finishedAt
+		s.FinishedAt = &finished
+	}
+	return s
+}
+
+// EventsSince returns the events after sequence number seq, whether the job
+// has finished, and a channel closed at the next update. A finished job
+// publishes no further events.
+func (j *Job) EventsSince(seq int) ([]Event, bool, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if seq < 0 {
+		seq = 0
+	}
+	var events []Event
+	if seq < len(j.events) {
+		events = append(events, j.events[seq:]...)
+	}
+	return events, j.state != StateRunning, j.changed
+}
+
+// notifyLocked wakes EventsSince waiters. j.mu must be held.
+func (j *Job) notifyLocked() {
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// finish records the outcome of run.
+func (j *Job) finish(result interface{}, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.result = result
+	j.finishedAt = time.Now()
+	switch {
+	case err == nil:
+		j.state = StateSucceeded
+	case errors.Is(err, context.Canceled):
+		j.state = StateCancelled
+	default:
+		j.state = StateFailed
+		j.err = err.Error()
+	}
+	j.notifyLocked()
+}
+
+// Manager runs jobs and keeps the most recent ones queryable. At most one job
+// of each kind runs at a time.
+type Manager struct {
+	mu       sync.Mutex
+	seq      int
+	jobs     map[string]*Job
+	order    []string        // job IDs, oldest first
+	running  map[string]*Job // by kind
+	stopping bool            // set by Shutdown; Start refuses new jobs
+	wg       sync.WaitGroup  // one per job whose run has not returned
+}
+
+// NewManager returns an empty Manager.
+func NewManager() *Manager {
+	return &Manager{
+		jobs:    make(map[string]*Job),
+		running: make(map[string]*Job),
+	}
+}
+
+// Start runs fn in a new goroutine as a job of the given kind. If a job of
+// that kind is already running, Start returns it together with ErrBusy.
+// The job's context keeps the values of ctx, such as the request ID, but
+// not its deadline or cancellation.
+func (m *Manager) Start(ctx context.Context, kind string, fn RunFunc) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stopping {
+		return nil, ErrShuttingDown
+	}
+	if j, ok := m.running[kind]; ok {
+		return j, ErrBusy
+	}
+
+	m.seq++
+	jobCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	j := &Job{
+		ID:        fmt.Sprintf("%s-%d", kind, m.seq),
+		Kind:      kind,
+		cancel:    cancel,
+		state:     StateRunning,
+		changed:   make(chan struct{}),
+		startedAt: time.Now(),
+	}
+	m.jobs[j.ID] = j
+	m.order = append(m.order, j.ID)
+	m.running[kind] = j
+	m.pruneLocked()
+
+	m.wg.Add(1)
+	go m.run(jobCtx, j, fn)
+	return j, nil
+}
+
+// Shutdown refuses new jobs, cancels the running ones and waits until they
+// have returned or ctx is done, in which case it returns ctx.Err(). Their
+// event streams end with the final "done" event.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.stopping = true
+	running := make([]*Job, 0, len(m.running))
+	for _, j := range m.running {
+		running = append(running, j)
+	}
+	m.mu.Unlock()
+
+	for _, j := range running {
+		if j.Cancel() {
+			slog.InfoContext(ctx, "jobs: cancelling job for shutdown", "job", j.ID)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Get returns the job with the given ID.
+func (m *Manager) Get(id string) (*Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	return j, ok
+}
+
+// run executes fn, converting a panic into a failed job.
+func (m *Manager) run(ctx context.Context, j *Job, fn RunFunc) {
+	var (
+		result interface{}
+		err    error
+	)
+	defer m.wg.Done()
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+			slog.ErrorContext(ctx, "jobs: job panicked", "job", j.ID, "panic", p)
+		}
+		m.mu.Lock()
+		j.finish(result, err)
+		if m.running[j.Kind] == j {
+			delete(m.running, j.Kind)
+		}
+		m.mu.Unlock()
+		j.cancel()
+
+		s := j.Snapshot()
+		slog.InfoContext(ctx, "jobs: job finished", "job", j.ID, "state", s.State, "done", s.Done,
+			"total", s.Total, "failed", s.Failed, "elapsed", s.FinishedAt.Sub(s.StartedAt))
+	}()
+
+	slog.InfoContext(ctx, "jobs: job started", "job", j.ID)
+	result, err = fn(ctx, j)
+}
+
+// pruneLocked drops the oldest finished jobs beyond finishedJobsKept.
+// m.mu must be held.
+func (m *Manager) pruneLocked() {
+	finished := 0
+	for _, id := range m.order {
+		if m.running[m.jobs[id].Kind] != m.jobs[id] {
+			finished++
+		}
+	}
+	kept := m.order[:0]
+	for _, id := range m.order {
+		j := m.jobs[id]
+		if finished > finishedJobsKept && m.running[j.Kind] != j {
+			delete(m.jobs, id)
+			finished--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	m.order = kept
+}
@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// ============================================================
+// Structured logging — log/slog setup and request ID propagation
+// ============================================================
+
+// Log formats accepted by Setup (LOG_FORMAT).
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// RequestIDKey is the attribute under which the request ID is logged.
+const RequestIDKey = "request_id"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying id. Every record logged with
+// that context (or one derived from it, context.WithoutCancel included)
+// gets a request_id attribute.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID returns a random 16-character hex ID.
+func NewRequestID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "0000000000000000"
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// ParseLevel maps debug, info, warn or error (any case) to a slog.Level.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return slog.LevelInfo, fmt.Errorf("logging: invalid level %q", s)
+	}
+	return level, nil
+}
+
+// NewHandler returns a text or JSON handler writing to w at level, which
+// adds the request ID of the record's context.
+func NewHandler(w io.Writer, format string, level slog.Level) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(format) {
+	case FormatText:
+		return contextHandler{slog.NewTextHandler(w, opts)}, nil
+	case FormatJSON:
+		return contextHandler{slog.NewJSONHandler(w, opts)}, nil
+	}
+	return nil, fmt.Errorf("logging: invalid format %q (expected %s or %s)", format, FormatText, FormatJSON)
+}
+
+// Setup installs a NewHandler logger as the slog default. The standard log
+// package is routed through it too, at info level.
+func Setup(w io.Writer, format string, level slog.Level) error {
+	h, err := NewHandler(w, format, level)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// contextHandler adds the context's request ID to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String(RequestIDKey, id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,70 @@
+package metrics
+
+// ============================================================
+// ESP metric families, registered on Default and served at /metrics
+// ============================================================
+
+// Default is the registry served at /metrics.
+var Default = NewRegistry()
+
+var (
+	// GraphQuerySeconds times each nGQL round trip by operation, e.g.
+	// "QueryPaths" or "computeBatchTTT Q1".
+	GraphQuerySeconds = Default.NewHistogramVec("esp_graph_query_duration_seconds",
+		"Duration of nGQL statements against NebulaGraph.", "op")
+	// GraphQueryErrors counts nGQL statements that failed to execute or
+	// returned an error result.
+	GraphQueryErrors = Default.NewCounterVec("esp_graph_query_errors_total",
+		"nGQL statements that failed.", "op")
+
+	// HTTPRequestSeconds times API requests by registered route, method and
+	// status code.
+	HTTPRequestSeconds = Default.NewHistogramVec("esp_http_request_duration_seconds",
+		"Duration of HTTP requests.", "route", "method", "code")
+
+	// PathPhaseSeconds times the phases of /api/paths: query, recalc,
+	// ttb_endpoints and json.
+	PathPhaseSeconds = Default.NewHistogramVec("esp_paths_phase_duration_seconds",
+		"Duration of /api/paths phases.", "phase")
+	// PathsReturned counts paths returned by /api/paths per mode.
+	PathsReturned = Default.NewCounterVec("esp_paths_returned_total",
+		"Paths returned by /api/paths.", "mode")
+
+	// TTBComputations counts TTB tasks run by the TTB executor per chain
+	// position and result: computed, cache_hit or failed (ALG-REQ-070).
+	TTBComputations = Default.NewCounterVec("esp_ttb_computations_total",
+		"TTB computations by chain position and result.", "position", "result")
+	// TTBComputeSeconds times TTB tasks per chain position, cache hits included.
+	TTBComputeSeconds = Default.NewHistogramVec("esp_ttb_compute_duration_seconds",
+		"Duration of TTB computations.", "position")
+	// MitreSnapshotLoads counts loads of the in-memory MITRE snapshot used
+	// by ComputeTTB, by result: loaded or failed.
+	MitreSnapshotLoads = Default.NewCounterVec("esp_mitre_snapshot_loads_total",
+		"MITRE snapshot loads by result.", "result")
+	// TTBCacheLookups counts entry/target TTB cache lookups per tier
+	// (memory LRU or rdbms asset_ttb_cache) and result, hit or miss (ALG-REQ-053).
+	TTBCacheLookups = Default.NewCounterVec("esp_ttb_cache_lookups_total",
+		"Entry/target TTB cache lookups by tier and result.", "tier", "result")
+
+	// AssetsRecalculated counts assets whose TTB and hash were rewritten, by
+	// trigger: path (path-scoped, ALG-REQ-046) or bulk (REQ-040).
+	AssetsRecalculated = Default.NewCounterVec("esp_assets_recalculated_total",
+		"Assets whose TTB was recalculated and persisted.", "trigger")
+
+	// AuditFlushes counts FlushBatch transactions by result: committed,
+	// rolled_back, or failed when the transaction could not begin (ADR-REQ-031).
+	AuditFlushes = Default.NewCounterVec("esp_audit_flush_total",
+		"Audit buffer flushes to MariaDB by result.", "result")
+	// AuditFlushRetries counts failed FlushBatch attempts the write-behind
+	// queue retried after a backoff.
+	AuditFlushRetries = Default.NewCounterVec("esp_audit_flush_retries_total",
+		"Audit batch flushes retried after a failure.")
+	// AuditBatchesDropped counts audit batches never written, by reason:
+	// queue_full, retries_exhausted, shutdown or journal_error.
+	AuditBatchesDropped = Default.NewCounterVec("esp_audit_batches_dropped_total",
+		"Audit batches dropped without reaching MariaDB.", "reason")
+	// AuditJournalBatches counts audit batches spilled to the local journal
+	// while MariaDB was down, and replayed from it.
+	AuditJournalBatches = Default.NewCounterVec("esp_audit_journal_batches_total",
+		"Audit batches spilled to or replayed from the journal.", "op")
+)
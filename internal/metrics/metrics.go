@@ -0,0 +1,293 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// Prometheus metrics — counters, histograms and scrape-time gauges
+// served in the Prometheus text exposition format (version 0.0.4)
+// ============================================================
+
+// DefaultBuckets are the histogram upper bounds in seconds, from a single
+// nGQL round trip up to a bulk recalculation.
+var DefaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// collector is one metric family.
+type collector interface {
+	name() string
+	write(ctx context.Context, w *bufio.Writer)
+}
+
+// Registry holds metric families and renders them on scrape.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.collectors {
+		if existing.name() == c.name() {
+			panic("metrics: duplicate metric " + c.name())
+		}
+	}
+	r.collectors = append(r.collectors, c)
+}
+
+// Handler serves every registered family, sorted by name.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		collectors := append([]collector(nil), r.collectors...)
+		r.mu.Unlock()
+		sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		for _, c := range collectors {
+			c.write(req.Context(), bw)
+		}
+		if err := bw.Flush(); err != nil {
+			slog.WarnContext(req.Context(), "metrics: scrape write failed", "err", err)
+		}
+	})
+}
+
+// series is the state of one label combination.
+type series struct {
+	labelValues []string
+	value       float64  // counter
+	counts      []uint64 // histogram, per bucket (not cumulative)
+	sum         float64
+	count       uint64
+}
+
+// family is the label bookkeeping shared by CounterVec and HistogramVec.
+type family struct {
+	metricName string
+	help       string
+	labelNames []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func (f *family) name() string { return f.metricName }
+
+// get returns the series for labelValues, creating it with newSeries.
+// The caller holds f.mu.
+func (f *family) get(labelValues []string, newSeries func() *series) *series {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", f.metricName, len(f.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = newSeries()
+		s.labelValues = append([]string(nil), labelValues...)
+		f.series[key] = s
+	}
+	return s
+}
+
+// sorted returns the series ordered by label values. The caller holds f.mu.
+func (f *family) sorted() []*series {
+	out := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return strings.Join(out[i].labelValues, "\xff") < strings.Join(out[j].labelValues, "\xff")
+	})
+	return out
+}
+
+func (f *family) header(w *bufio.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.metricName, escapeHelp(f.help), f.metricName, kind)
+}
+
+// ------------------------------------------------------------
+// Counters
+// ------------------------------------------------------------
+
+// CounterVec is a monotonically increasing value per label combination.
+type CounterVec struct {
+	family
+}
+
+// NewCounterVec registers a counter family on r.
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{family{metricName: name, help: help, labelNames: labelNames, series: make(map[string]*series)}}
+	r.register(c)
+	return c
+}
+
+// Add increases the counter of labelValues by v (v must not be negative).
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counter " + c.metricName + " cannot decrease")
+	}
+	c.mu.Lock()
+	c.get(labelValues, func() *series { return &series{} }).value += v
+	c.mu.Unlock()
+}
+
+// Inc increases the counter of labelValues by one.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) write(_ context.Context, w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(w, "counter")
+	for _, s := range c.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, labels(c.labelNames, s.labelValues, "", ""), formatFloat(s.value))
+	}
+}
+
+// ------------------------------------------------------------
+// Histograms
+// ------------------------------------------------------------
+
+// HistogramVec counts observations into fixed buckets per label combination.
+type HistogramVec struct {
+	family
+	buckets []float64
+}
+
+// NewHistogramVec registers a histogram family on r with DefaultBuckets.
+func (r *Registry) NewHistogramVec(name, help string, labelNames ...string) *HistogramVec {
+	h := &HistogramVec{
+		family:  family{metricName: name, help: help, labelNames: labelNames, series: make(map[string]*series)},
+		buckets: DefaultBuckets,
+	}
+	r.register(h)
+	return h
+}
+
+// Observe records v for labelValues.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.get(labelValues, func() *series { return &series{counts: make([]uint64, len(h.buckets))} })
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+// Since records the seconds elapsed since start for labelValues.
+func (h *HistogramVec) Since(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func (h *HistogramVec) write(_ context.Context, w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w, "histogram")
+	for _, s := range h.sorted() {
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, labels(h.labelNames, s.labelValues, "le", formatFloat(le)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, labels(h.labelNames, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, labels(h.labelNames, s.labelValues, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, labels(h.labelNames, s.labelValues, "", ""), s.count)
+	}
+}
+
+// ------------------------------------------------------------
+// Scrape-time gauges
+// ------------------------------------------------------------
+
+// GaugeFunc is a single gauge read by calling fn on every scrape. A failing
+// fn is logged and the sample is left out of that scrape.
+type GaugeFunc struct {
+	metricName string
+	help       string
+	fn         func(ctx context.Context) (float64, error)
+}
+
+// NewGaugeFunc registers a scrape-time gauge on r.
+func (r *Registry) NewGaugeFunc(name, help string, fn func(ctx context.Context) (float64, error)) *GaugeFunc {
+	g := &GaugeFunc{metricName: name, help: help, fn: fn}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeFunc) name() string { return g.metricName }
+
+func (g *GaugeFunc) write(ctx context.Context, w *bufio.Writer) {
+	v, err := g.fn(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "metrics: gauge unavailable", "metric", g.metricName, "err", err)
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n",
+		g.metricName, escapeHelp(g.help), g.metricName, g.metricName, formatFloat(v))
+}
+
+// ------------------------------------------------------------
+// Text format helpers
+// ------------------------------------------------------------
+
+// labels renders {name="value",...}, with an optional extra pair (le).
+func labels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", n, escapeLabel(values[i]))
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", extraName, escapeLabel(extraValue))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,170 @@
+package montecarlo
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"sort"
+)
+
+// ============================================================
+// Monte Carlo TTA — TTT sampled per technique between execution_min and
+// execution_max instead of the single ALG-REQ-060 point, summed over the
+// techniques of a path for N seeded trials, reported as p10/p50/p90
+// ============================================================
+
+// TTT distributions.
+const (
+	Uniform    = "uniform"
+	Triangular = "triangular"
+	PERT       = "pert"
+)
+
+// pertLambda is the weight of the mode in the PERT (modified beta) distribution.
+const pertLambda = 4
+
+// ValidDistribution reports whether name is one of Uniform, Triangular or PERT.
+func ValidDistribution(name string) bool {
+	switch name {
+	case Uniform, Triangular, PERT:
+		return true
+	}
+	return false
+}
+
+// Config selects how a simulation samples. Seed makes it reproducible: the
+// same seed, distribution, trials and inputs give the same quantiles.
+type Config struct {
+	Distribution string
+	Trials       int
+	Seed         uint64
+}
+
+// Validate checks the distribution name and the number of trials.
+func (c Config) Validate() error {
+	if !ValidDistribution(c.Distribution) {
+		return fmt.Errorf("distribution must be %q, %q or %q", Uniform, Triangular, PERT)
+	}
+	if c.Trials < 1 {
+		return fmt.Errorf("trials must be positive")
+	}
+	return nil
+}
+
+// Technique is one selected technique of a TTB log: its execution bounds
+// and the ALG-REQ-060 TTT, which places it between them according to the
+// maturity of the applied mitigations.
+type Technique struct {
+	ExecMin float64
+	ExecMax float64
+	TTT     float64
+}
+
+// variable reports whether t has a range to sample from; a technique
+// without bounds, or with the 999999 failure value, keeps its TTT.
+func (t Technique) variable() bool {
+	return t.ExecMax > t.ExecMin && t.TTT >= t.ExecMin && t.TTT <= t.ExecMax
+}
+
+// Sample draws one TTT for t. The mitigated TTT is the mode of the
+// triangular and PERT distributions over [ExecMin, ExecMax]; the uniform
+// distribution spans [TTT, ExecMax], so mitigations raise its floor. An
+// unmitigated technique therefore peaks at ExecMin and a fully covered one
+// is pinned at ExecMax, as in ALG-REQ-060.
+func (c Config) Sample(rng *rand.Rand, t Technique) float64 {
+	if !t.variable() {
+		return t.TTT
+	}
+	lo, mode, hi := t.ExecMin, t.TTT, t.ExecMax
+	switch c.Distribution {
+	case Uniform:
+		return mode + rng.Float64()*(hi-mode)
+	case Triangular:
+		u := rng.Float64()
+		split := (mode - lo) / (hi - lo)
+		if u < split {
+			return lo + math.Sqrt(u*(hi-lo)*(mode-lo))
+		}
+		return hi - math.Sqrt((1-u)*(hi-lo)*(hi-mode))
+	default:
+		alpha := 1 + pertLambda*(mode-lo)/(hi-lo)
+		beta := 1 + pertLambda*(hi-mode)/(hi-lo)
+		x := gamma(rng, alpha)
+		return lo + x/(x+gamma(rng, beta))*(hi-lo)
+	}
+}
+
+// gamma draws from Gamma(shape, 1) for shape >= 1 (Marsaglia and Tsang).
+func gamma(rng *rand.Rand, shape float64) float64 {
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rng.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rng.Float64()
+		if u < 1-0.0331*x*x*x*x || math.Log(u) < 0.5*x*x+d*(1-v+math.Log(v)) {
+			return d * v
+		}
+	}
+}
+
+// Quantiles summarises the simulated TTA of one path, in hours.
+type Quantiles struct {
+	P10  float64 `json:"p10"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	Mean float64 `json:"mean"`
+}
+
+// PathTTA simulates the TTA of one path: base, the deterministic TTA, with
+// each technique's ALG-REQ-060 TTT replaced by a sample in every trial. The
+// random stream is derived from the seed and key (the host chain), so a
+// path's result does not depend on which other paths were simulated.
+func (c Config) PathTTA(key string, base float64, techniques []Technique) Quantiles {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	rng := rand.New(rand.NewPCG(c.Seed, h.Sum64()))
+
+	var variable []Technique
+	for _, t := range techniques {
+		if t.variable() {
+			variable = append(variable, t)
+		}
+	}
+	if len(variable) == 0 {
+		return Quantiles{P10: base, P50: base, P90: base, Mean: base}
+	}
+
+	trials := make([]float64, c.Trials)
+	var sum float64
+	for i := range trials {
+		tta := base
+		for _, t := range variable {
+			tta += c.Sample(rng, t) - t.TTT
+		}
+		trials[i] = tta
+		sum += tta
+	}
+	sort.Float64s(trials)
+	return Quantiles{
+		P10:  quantile(trials, 0.10),
+		P50:  quantile(trials, 0.50),
+		P90:  quantile(trials, 0.90),
+		Mean: sum / float64(len(trials)),
+	}
+}
+
+// quantile returns the q-quantile of sorted by linear interpolation.
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	i := int(pos)
+	if i+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (pos-float64(i))*(sorted[i+1]-sorted[i])
+}
@@ -0,0 +1,157 @@
+package montecarlo
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestSampleStaysInRange(t *testing.T) {
+	techniques := []struct {
+		name string
+		t    Technique
+		lo   float64
+	}{
+		{"unmitigated", Technique{ExecMin: 1, ExecMax: 9, TTT: 1}, 1},
+		{"partly mitigated", Technique{ExecMin: 1, ExecMax: 9, TTT: 5}, 1},
+		{"fully covered", Technique{ExecMin: 1, ExecMax: 9, TTT: 9}, 1},
+	}
+	for _, dist := range []string{Uniform, Triangular, PERT} {
+		c := Config{Distribution: dist, Trials: 1}
+		for _, tt := range techniques {
+			t.Run(dist+"/"+tt.name, func(t *testing.T) {
+				rng := rand.New(rand.NewPCG(1, 2))
+				lo := tt.lo
+				if dist == Uniform {
+					lo = tt.t.TTT
+				}
+				for i := 0; i < 10000; i++ {
+					v := c.Sample(rng, tt.t)
+					if v < lo || v > tt.t.ExecMax {
+						t.Fatalf("sample %g outside [%g, %g]", v, lo, tt.t.ExecMax)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestSampleFixedTechniques(t *testing.T) {
+	tests := []struct {
+		name string
+		t    Technique
+	}{
+		{"no bounds", Technique{TTT: 3}},
+		{"empty range", Technique{ExecMin: 2, ExecMax: 2, TTT: 2}},
+		{"failure value", Technique{ExecMin: 1, ExecMax: 9, TTT: 999999}},
+	}
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, dist := range []string{Uniform, Triangular, PERT} {
+				c := Config{Distribution: dist, Trials: 1}
+				if v := c.Sample(rng, tt.t); v != tt.t.TTT {
+					t.Errorf("%s: Sample = %g, want TTT %g", dist, v, tt.t.TTT)
+				}
+			}
+		})
+	}
+}
+
+// TestSampleMean checks each distribution against its analytic mean over
+// [1, 9] with mode 3.
+func TestSampleMean(t *testing.T) {
+	tech := Technique{ExecMin: 1, ExecMax: 9, TTT: 3}
+	tests := []struct {
+		dist string
+		want float64
+	}{
+		{Uniform, (3 + 9) / 2.0},
+		{Triangular, (1 + 3 + 9) / 3.0},
+		{PERT, (1 + pertLambda*3 + 9) / (pertLambda + 2.0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dist, func(t *testing.T) {
+			c := Config{Distribution: tt.dist, Trials: 1}
+			rng := rand.New(rand.NewPCG(7, 11))
+			const n = 200000
+			var sum float64
+			for i := 0; i < n; i++ {
+				sum += c.Sample(rng, tech)
+			}
+			if mean := sum / n; math.Abs(mean-tt.want) > 0.02 {
+				t.Errorf("mean %g, want %g", mean, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuantile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5}
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{0, 1},
+		{0.1, 1.4},
+		{0.5, 3},
+		{0.9, 4.6},
+		{1, 5},
+	}
+	for _, tt := range tests {
+		if got := quantile(sorted, tt.q); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("quantile(%g) = %g, want %g", tt.q, got, tt.want)
+		}
+	}
+	if got := quantile([]float64{7}, 0.9); got != 7 {
+		t.Errorf("quantile of one trial = %g, want 7", got)
+	}
+}
+
+func TestPathTTA(t *testing.T) {
+	c := Config{Distribution: Triangular, Trials: 2000, Seed: 42}
+	techniques := []Technique{
+		{ExecMin: 1, ExecMax: 4, TTT: 1},
+		{ExecMin: 2, ExecMax: 10, TTT: 6},
+		{TTT: 0.5},
+	}
+	base := 10.0
+
+	q := c.PathTTA("A1|A2", base, techniques)
+	if !(q.P10 <= q.P50 && q.P50 <= q.P90) {
+		t.Errorf("quantiles out of order: %+v", q)
+	}
+	// Each variable technique moves at most to its bounds.
+	lo, hi := base+(1-1)+(2-6), base+(4-1)+(10-6)
+	if q.P10 < lo || q.P90 > hi || q.Mean < lo || q.Mean > hi {
+		t.Errorf("quantiles %+v outside [%g, %g]", q, lo, hi)
+	}
+	if again := c.PathTTA("A1|A2", base, techniques); again != q {
+		t.Errorf("same seed and key gave %+v, then %+v", q, again)
+	}
+	if other := c.PathTTA("A1|A3", base, techniques); other == q {
+		t.Errorf("different keys gave identical quantiles %+v", q)
+	}
+
+	fixed := c.PathTTA("A1|A2", base, []Technique{{TTT: 3}})
+	if want := (Quantiles{P10: base, P50: base, P90: base, Mean: base}); fixed != want {
+		t.Errorf("fixed techniques gave %+v, want %+v", fixed, want)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		c       Config
+		wantErr bool
+	}{
+		{Config{Distribution: PERT, Trials: 1}, false},
+		{Config{Distribution: Uniform, Trials: 1000}, false},
+		{Config{Distribution: "normal", Trials: 1000}, true},
+		{Config{Distribution: Triangular}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.c.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%+v: Validate() = %v, wantErr %v", tt.c, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package nebula
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"ESP-data/config"
+)
+
+// ============================================================
+// MITRE ATT&CK catalog — tMitreTactic (TA007), tMitreTechnique (TA008),
+// tMitreMitigation (TA005), MitrePlatform (TA011) and the part_of (ED010),
+// mitigates (ED009), can_be_executed_on (ED003), has_subtechnique (ED005) edges
+// ============================================================
+
+// AttackTactic is one tMitreTactic vertex; the VID equals TacticID.
+type AttackTactic struct {
+	TacticID   string
+	TacticName string
+}
+
+// AttackTechnique is one tMitreTechnique vertex (technique or subtechnique)
+// with its outgoing part_of / can_be_executed_on edges and, for
+// subtechniques, the parent of the incoming has_subtechnique edge.
+// Only MITRE-sourced properties are carried: priority, execution_min/max
+// and rcelpe are curated in the graph and never overwritten.
+type AttackTechnique struct {
+	TechniqueID   string
+	TechniqueName string
+	TacticIDs     []string
+	PlatformIDs   []string
+	ParentID      string
+}
+
+// AttackMitigationUse is one mitigates edge (ED009).
+type AttackMitigationUse struct {
+	TechniqueID    string
+	UseDescription string
+}
+
+// AttackMitigation is one tMitreMitigation vertex with its mitigates edges.
+type AttackMitigation struct {
+	MitigationID   string
+	MitigationName string
+	Description    string
+	Version        string
+	Uses           []AttackMitigationUse
+}
+
+// AttackPlatform is one MitrePlatform vertex (VID "PLTFnnn").
+type AttackPlatform struct {
+	PlatformID   string
+	PlatformName string
+}
+
+// AttackRelease is the content of one ATT&CK release to be upserted.
+type AttackRelease struct {
+	Version     string
+	Tactics     []AttackTactic
+	Techniques  []AttackTechnique
+	Mitigations []AttackMitigation
+	Platforms   []AttackPlatform
+}
+
+// AttackInventory lists what the graph already holds: VID sets for tactics,
+// techniques and mitigations, and platform name → VID.
+type AttackInventory struct {
+	TacticIDs     map[string]bool
+	TechniqueIDs  map[string]bool
+	MitigationIDs map[string]bool
+	Platforms     map[string]string
+}
+
+// attackEdgeBatch caps the number of VALUES per INSERT EDGE statement.
+const attackEdgeBatch = 200
+
+// QueryAttackInventory fetches the IDs of the ATT&CK vertices already loaded.
+// Uses pure nGQL LOOKUP per REQ-243.
+func QueryAttackInventory(ctx context.Context, pool *Pool, cfg *config.Config) (*AttackInventory, error) {
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Release()
+
+	inv := &AttackInventory{
+		TacticIDs:     make(map[string]bool),
+		TechniqueIDs:  make(map[string]bool),
+		MitigationIDs: make(map[string]bool),
+		Platforms:     make(map[string]string),
+	}
+
+	queryStart := time.Now()
+	slog.DebugContext(ctx, "nebula: QueryAttackInventory executing LOOKUP queries")
+
+	idSets := []struct {
+		query  string
+		target map[string]bool
+	}{
+		{`LOOKUP ON tMitreTactic YIELD id(vertex) AS vid;`, inv.TacticIDs},
+		{`LOOKUP ON tMitreTechnique YIELD id(vertex) AS vid;`, inv.TechniqueIDs},
+		{`LOOKUP ON tMitreMitigation YIELD id(vertex) AS vid;`, inv.MitigationIDs},
+	}
+	for _, l := range idSets {
+		resultSet, err := execute(ctx, session, "QueryAttackInventory ids", l.query)
+		if err != nil {
+			return nil, fmt.Errorf("query execution failed: %w", err)
+		}
+		if !resultSet.IsSucceed() {
+			return nil, fmt.Errorf("query failed: %s", resultSet.GetErrorMsg())
+		}
+		for i := 0; i < resultSet.GetRowSize(); i++ {
+			record, err := resultSet.GetRowValuesByIndex(i)
+			if err != nil {
+				slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
+				continue
+			}
+			l.target[safeString(record, 0)] = true
+		}
+	}
+
+	resultSet, err := execute(ctx, session, "QueryAttackInventory platforms", `LOOKUP ON MitrePlatform
+YIELD id(vertex) AS vid, MitrePlatform.platform_name AS platform_name;`)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	if !resultSet.IsSucceed() {
+		return nil, fmt.Errorf("query failed: %s", resultSet.GetErrorMsg())
+	}
+	for i := 0; i < resultSet.GetRowSize(); i++ {
+		record, err := resultSet.GetRowValuesByIndex(i)
+		if err != nil {
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
+			continue
+		}
+		inv.Platforms[safeString(record, 1)] = safeString(record, 0)
+	}
+
+	slog.InfoContext(ctx, "nebula: QueryAttackInventory completed", "elapsed", time.Since(queryStart),
+		"tactics", len(inv.TacticIDs), "techniques", len(inv.TechniqueIDs),
+		"mitigations", len(inv.MitigationIDs), "platforms", len(inv.Platforms))
+	return inv, nil
+}
+
+// UpsertAttackRelease writes an ATT&CK release. Vertices use UPSERT so that
+// properties not set here — the curated technique fields in particular —
+// keep their stored values (or take the schema defaults for new vertices).
+// Edges are inserted with IF NOT EXISTS except mitigates, whose
+// Use_Description follows the release. Afterwards the part_of and
+// can_be_executed_on edges of every technique in the release, its incoming
+// has_subtechnique and mitigates edges, are diffed against the release and
+// the ones it no longer lists are deleted at their rank.
+func UpsertAttackRelease(ctx context.Context, pool *Pool, cfg *config.Config, rel *AttackRelease) error {
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return err
+	}
+	defer session.Release()
+
+	queryStart := time.Now()
+	slog.DebugContext(ctx, "nebula: UpsertAttackRelease executing", "version", rel.Version,
+		"tactics", len(rel.Tactics), "techniques", len(rel.Techniques),
+		"mitigations", len(rel.Mitigations), "platforms", len(rel.Platforms))
+
+	exec := func(stmt string) error {
+		rs, err := execute(ctx, session, "UpsertAttackRelease", stmt)
+		if err != nil {
+			return fmt.Errorf("query execution failed: %w", err)
+		}
+		if !rs.IsSucceed() {
+			return fmt.Errorf("query failed: %s", rs.GetErrorMsg())
+		}
+		return nil
+	}
+
+	for _, p := range rel.Platforms {
+		if err := exec(fmt.Sprintf(`UPSERT VERTEX ON MitrePlatform %s SET platform_id = %s, platform_name = %s;`,
+			Literal(p.PlatformID), Literal(p.PlatformID), Literal(p.PlatformName))); err != nil {
+			return fmt.Errorf("platform %s: %w", p.PlatformID, err)
+		}
+	}
+	for _, t := range rel.Tactics {
+		if err := exec(fmt.Sprintf(`UPSERT VERTEX ON tMitreTactic %s SET Tactic_ID = %s, Tactic_Name = %s, Mitre_Attack_Version = %s;`,
+			Literal(t.TacticID), Literal(t.TacticID), Literal(t.TacticName), Literal(rel.Version))); err != nil {
+			return fmt.Errorf("tactic %s: %w", t.TacticID, err)
+		}
+	}
+	for _, t := range rel.Techniques {
+		if err := exec(fmt.Sprintf(`UPSERT VERTEX ON tMitreTechnique %s SET Technique_ID = %s, Technique_Name = %s, Mitre_Attack_Version = %s;`,
+			Literal(t.TechniqueID), Literal(t.TechniqueID), Literal(t.TechniqueName), Literal(rel.Version))); err != nil {
+			return fmt.Errorf("technique %s: %w", t.TechniqueID, err)
+		}
+	}
+	for _, m := range rel.Mitigations {
+		if err := exec(fmt.Sprintf(`UPSERT VERTEX ON tMitreMitigation %s
+SET Mitigation_ID = %s, Mitigation_Name = %s, Matrix = "Enterprise", Description = %s, Mitigation_Version = %s;`,
+			Literal(m.MitigationID), Literal(m.MitigationID), Literal(m.MitigationName), Literal(m.Description), Literal(m.Version))); err != nil {
+			return fmt.Errorf("mitigation %s: %w", m.MitigationID, err)
+		}
+	}
+
+	var partOf, canExec, subtech, mitigates []string
+	listed := make(map[string]bool) // "edge_type src dst" of every edge in the release
+	for _, t := range rel.Techniques {
+		for _, tactic := range t.TacticIDs {
+			partOf = append(partOf, fmt.Sprintf(`%s->%s:()`, Literal(t.TechniqueID), Literal(tactic)))
+			listed["part_of "+t.TechniqueID+" "+tactic] = true
+		}
+		for _, p := range t.PlatformIDs {
+			canExec = append(canExec, fmt.Sprintf(`%s->%s:()`, Literal(t.TechniqueID), Literal(p)))
+			listed["can_be_executed_on "+t.TechniqueID+" "+p] = true
+		}
+		if t.ParentID != "" {
+			subtech = append(subtech, fmt.Sprintf(`%s->%s:()`, Literal(t.ParentID), Literal(t.TechniqueID)))
+			listed["has_subtechnique "+t.ParentID+" "+t.TechniqueID] = true
+		}
+	}
+	for _, m := range rel.Mitigations {
+		for _, u := range m.Uses {
+			mitigates = append(mitigates, fmt.Sprintf(`%s->%s:(%s, "Enterprise")`, Literal(m.MitigationID), Literal(u.TechniqueID), Literal(u.UseDescription)))
+			listed["mitigates "+m.MitigationID+" "+u.TechniqueID] = true
+		}
+	}
+
+	edgeSets := []struct {
+		prefix string
+		values []string
+	}{
+		{`INSERT EDGE IF NOT EXISTS part_of() VALUES `, partOf},
+		{`INSERT EDGE IF NOT EXISTS can_be_executed_on() VALUES `, canExec},
+		{`INSERT EDGE IF NOT EXISTS has_subtechnique() VALUES `, subtech},
+		{`INSERT EDGE mitigates(Use_Description, Domain) VALUES `, mitigates},
+	}
+	for _, set := range edgeSets {
+		for start := 0; start < len(set.values); start += attackEdgeBatch {
+			end := start + attackEdgeBatch
+			if end > len(set.values) {
+				end = len(set.values)
+			}
+			if err := exec(set.prefix + strings.Join(set.values[start:end], ", ") + ";"); err != nil {
+				return fmt.Errorf("edge batch: %w", err)
+			}
+		}
+	}
+
+	// Edges of the release's techniques that the release no longer lists
+	techniqueIDs := make([]string, len(rel.Techniques))
+	for i, t := range rel.Techniques {
+		techniqueIDs[i] = t.TechniqueID
+	}
+	stale := make(map[string][]string) // edge type → "src->dst@rank"
+	staleCount := 0
+	for start := 0; start < len(techniqueIDs); start += attackEdgeBatch {
+		end := min(start+attackEdgeBatch, len(techniqueIDs))
+		ids := LiteralList(techniqueIDs[start:end])
+		for _, query := range []string{
+			`GO FROM ` + ids + ` OVER part_of, can_be_executed_on
+YIELD type(edge) AS edge_type, src(edge) AS src_id, dst(edge) AS dst_id, rank(edge) AS edge_rank;`,
+			`GO FROM ` + ids + ` OVER has_subtechnique, mitigates REVERSELY
+YIELD type(edge) AS edge_type, src(edge) AS src_id, dst(edge) AS dst_id, rank(edge) AS edge_rank;`,
+		} {
+			rs, err := execute(ctx, session, "UpsertAttackRelease edges", query)
+			if err != nil {
+				return fmt.Errorf("query execution failed: %w", err)
+			}
+			if !rs.IsSucceed() {
+				return fmt.Errorf("query failed: %s", rs.GetErrorMsg())
+			}
+			for i := 0; i < rs.GetRowSize(); i++ {
+				record, err := rs.GetRowValuesByIndex(i)
+				if err != nil {
+					slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
+					continue
+				}
+				edgeType, src, dst := safeString(record, 0), safeString(record, 1), safeString(record, 2)
+				if listed[edgeType+" "+src+" "+dst] {
+					continue
+				}
+				stale[edgeType] = append(stale[edgeType],
+					fmt.Sprintf(`%s->%s@%d`, Literal(src), Literal(dst), safeInt(record, 3, 0)))
+				staleCount++
+			}
+		}
+	}
+	for _, edgeType := range []string{"part_of", "can_be_executed_on", "has_subtechnique", "mitigates"} {
+		edges := stale[edgeType]
+		for start := 0; start < len(edges); start += attackEdgeBatch {
+			end := min(start+attackEdgeBatch, len(edges))
+			if err := exec(`DELETE EDGE ` + edgeType + ` ` + strings.Join(edges[start:end], ", ") + ";"); err != nil {
+				return fmt.Errorf("stale edge batch: %w", err)
+			}
+		}
+	}
+
+	slog.InfoContext(ctx, "nebula: UpsertAttackRelease completed", "version", rel.Version, "elapsed", time.Since(queryStart),
+		"part_of", len(partOf), "can_be_executed_on", len(canExec), "has_subtechnique", len(subtech), "mitigates", len(mitigates),
+		"stale_deleted", staleCount)
+	return nil
+}
@@ -0,0 +1,424 @@
+package nebula
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"ESP-data/config"
+	"ESP-data/internal/store"
+)
+
+// ============================================================
+// Tactic chains — TacticChain (TA010) with ranked chain_includes edges
+// (ED013), and ChainRule (TA013) vertices selecting the chain of an
+// asset by position, asset type and segment (ALG-REQ-051)
+// ============================================================
+
+// Chain positions of an asset on an attack path (ALG-REQ-051). They are
+// defined by store, which records them with each TTB breakdown.
+const (
+	PositionEntrance     = store.PositionEntrance
+	PositionIntermediate = store.PositionIntermediate
+	PositionTarget       = store.PositionTarget
+)
+
+// defaultChains are the TacticChain vertices of the initial dataset, used
+// for a position when no ChainRule matches.
+var defaultChains = map[string]string{
+	PositionEntrance:     "CHAIN_ENTRANCE",
+	PositionIntermediate: "CHAIN_INTERMEDIATE",
+	PositionTarget:       "CHAIN_TARGET",
+}
+
+// ValidPosition reports whether position is one of the chain positions.
+func ValidPosition(position string) bool {
+	_, ok := defaultChains[position]
+	return ok
+}
+
+// IsDefaultChain reports whether chainID is the default chain of a position.
+func IsDefaultChain(chainID string) bool {
+	for _, c := range defaultChains {
+		if c == chainID {
+			return true
+		}
+	}
+	return false
+}
+
+// TacticChain is a TA010 vertex with its tactics (tMitreTactic VIDs) in
+// chain_includes rank order.
+type TacticChain struct {
+	ChainID     string   `json:"chain_id"`
+	ChainName   string   `json:"chain_name"`
+	Description string   `json:"description,omitempty"`
+	Tactics     []string `json:"tactics"`
+}
+
+// ChainRule is a TA013 vertex: assets matching every non-empty criterion
+// (Position, TypeID, SegmentID) use ChainID at that position.
+type ChainRule struct {
+	RuleID    string `json:"rule_id"`
+	ChainID   string `json:"chain_id"`
+	Position  string `json:"position,omitempty"`
+	TypeID    string `json:"type_id,omitempty"`
+	SegmentID string `json:"segment_id,omitempty"`
+	Priority  int    `json:"priority"`
+}
+
+// criteria counts the non-empty criteria of r: the more, the more specific.
+func (r ChainRule) criteria() int {
+	n := 0
+	for _, c := range []string{r.Position, r.TypeID, r.SegmentID} {
+		if c != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// ChainAssignments resolves the TacticChain of an asset at a position. A
+// nil *ChainAssignments is valid and always resolves to the default chains.
+type ChainAssignments struct {
+	rules    []ChainRule       // in precedence order
+	types    map[string]string // asset -> Asset_Type VID
+	segments map[string]string // asset -> Network_Segment VID
+}
+
+// NewChainAssignments orders rules by precedence — the most specific rule
+// first, then by ascending priority, then by rule ID — and matches them
+// against the types and segments of assets.
+func NewChainAssignments(rules []ChainRule, assets []AssetRecord) *ChainAssignments {
+	c := &ChainAssignments{
+		rules:    append([]ChainRule(nil), rules...),
+		types:    make(map[string]string, len(assets)),
+		segments: make(map[string]string, len(assets)),
+	}
+	sort.SliceStable(c.rules, func(i, j int) bool {
+		a, b := c.rules[i], c.rules[j]
+		if a.criteria() != b.criteria() {
+			return a.criteria() > b.criteria()
+		}
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return a.RuleID < b.RuleID
+	})
+	for _, a := range assets {
+		c.types[a.AssetID] = a.TypeID
+		c.segments[a.AssetID] = a.SegmentID
+	}
+	return c
+}
+
+// NeedsAssets reports whether any rule matches on asset type or segment,
+// i.e. whether the rules must be combined with the asset inventory.
+func NeedsAssets(rules []ChainRule) bool {
+	for _, r := range rules {
+		if r.TypeID != "" || r.SegmentID != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Chain returns the TacticChain VID for assetID at position: that of the
+// first matching rule, or the default chain of the position.
+func (c *ChainAssignments) Chain(assetID, position string) string {
+	if c != nil {
+		for _, r := range c.rules {
+			if r.Position != "" && r.Position != position {
+				continue
+			}
+			if r.TypeID != "" && r.TypeID != c.types[assetID] {
+				continue
+			}
+			if r.SegmentID != "" && r.SegmentID != c.segments[assetID] {
+				continue
+			}
+			return r.ChainID
+		}
+	}
+	return defaultChains[position]
+}
+
+// ChainAt returns the TacticChain VID for assetID at index on a path of
+// pathLength nodes.
+func (c *ChainAssignments) ChainAt(assetID string, index, pathLength int) string {
+	return c.Chain(assetID, store.PositionAt(index, pathLength))
+}
+
+// QueryTacticChains returns every tactic chain with its tactics, sorted by
+// ID. LOOKUP uses idx_tactic_chain_any.
+func QueryTacticChains(ctx context.Context, pool *Pool, cfg *config.Config) ([]TacticChain, error) {
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Release()
+
+	queryStart := time.Now()
+
+	const chainQuery = `LOOKUP ON TacticChain
+YIELD id(vertex) AS vid,
+  TacticChain.chain_name AS chain_name,
+  TacticChain.description AS description;`
+
+	rs, err := execute(ctx, session, "QueryTacticChains", chainQuery)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	if !rs.IsSucceed() {
+		return nil, fmt.Errorf("query failed: %s", rs.GetErrorMsg())
+	}
+
+	chains := make([]TacticChain, 0, rs.GetRowSize())
+	vids := make([]string, 0, rs.GetRowSize())
+	for i := 0; i < rs.GetRowSize(); i++ {
+		record, err := rs.GetRowValuesByIndex(i)
+		if err != nil {
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
+			continue
+		}
+		chains = append(chains, TacticChain{
+			ChainID:     safeString(record, 0),
+			ChainName:   safeString(record, 1),
+			Description: safeString(record, 2),
+			Tactics:     []string{},
+		})
+		vids = append(vids, safeString(record, 0))
+	}
+	sort.Slice(chains, func(i, j int) bool { return chains[i].ChainID < chains[j].ChainID })
+	if len(chains) == 0 {
+		return chains, nil
+	}
+
+	edgeQuery := `GO FROM ` + LiteralList(vids) + ` OVER chain_includes ` +
+		`YIELD src(edge) AS chain, rank(edge) AS rank, dst(edge) AS tactic;`
+	ers, err := execute(ctx, session, "QueryTacticChains tactics", edgeQuery)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	if !ers.IsSucceed() {
+		return nil, fmt.Errorf("query failed: %s", ers.GetErrorMsg())
+	}
+	type ranked struct {
+		rank   int
+		tactic string
+	}
+	edges := make(map[string][]ranked)
+	for i := 0; i < ers.GetRowSize(); i++ {
+		record, err := ers.GetRowValuesByIndex(i)
+		if err != nil {
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
+			continue
+		}
+		chain := safeString(record, 0)
+		edges[chain] = append(edges[chain], ranked{safeInt(record, 1, 0), safeString(record, 2)})
+	}
+	for i := range chains {
+		list := edges[chains[i].ChainID]
+		sort.SliceStable(list, func(a, b int) bool { return list[a].rank < list[b].rank })
+		for _, e := range list {
+			chains[i].Tactics = append(chains[i].Tactics, e.tactic)
+		}
+	}
+
+	slog.InfoContext(ctx, "nebula: QueryTacticChains completed", "chains", len(chains),
+		"elapsed", time.Since(queryStart))
+	return chains, nil
+}
+
+// UpsertTacticChain writes a chain vertex and replaces its chain_includes
+// edges with chain.Tactics, ranked 0, 1, ... in order. Edges whose tactic
+// keeps its rank are rewritten in place, so a reader never sees the
+// chain without them.
+func UpsertTacticChain(ctx context.Context, pool *Pool, cfg *config.Config, chain TacticChain) error {
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return err
+	}
+	defer session.Release()
+
+	queryStart := time.Now()
+	slog.DebugContext(ctx, "nebula: UpsertTacticChain executing", "chain", chain.ChainID,
+		"tactics", len(chain.Tactics))
+
+	upsertQuery := fmt.Sprintf(`UPSERT VERTEX ON TacticChain %s
+SET chain_id = %s, chain_name = %s, description = %s;`,
+		Literal(chain.ChainID), Literal(chain.ChainID), Literal(chain.ChainName), Literal(chain.Description))
+	rs, err := execute(ctx, session, "UpsertTacticChain upsert", upsertQuery)
+	if err != nil {
+		return fmt.Errorf("upsert execution failed: %w", err)
+	}
+	if !rs.IsSucceed() {
+		return fmt.Errorf("upsert failed: %s", rs.GetErrorMsg())
+	}
+
+	ranks := make(map[string]int, len(chain.Tactics))
+	for i, tactic := range chain.Tactics {
+		ranks[tactic] = i
+	}
+	edgeQuery := fmt.Sprintf(`GO FROM %s OVER chain_includes YIELD rank(edge) AS rank, dst(edge) AS tactic;`,
+		Literal(chain.ChainID))
+	ers, err := execute(ctx, session, "UpsertTacticChain edges", edgeQuery)
+	if err != nil {
+		return fmt.Errorf("query execution failed: %w", err)
+	}
+	if !ers.IsSucceed() {
+		return fmt.Errorf("query failed: %s", ers.GetErrorMsg())
+	}
+	var stale []string
+	for i := 0; i < ers.GetRowSize(); i++ {
+		record, err := ers.GetRowValuesByIndex(i)
+		if err != nil {
+			continue
+		}
+		rank, tactic := safeInt(record, 0, 0), safeString(record, 1)
+		if r, ok := ranks[tactic]; !ok || r != rank {
+			stale = append(stale, fmt.Sprintf(`%s -> %s @%d`, Literal(chain.ChainID), Literal(tactic), rank))
+		}
+	}
+	if len(stale) > 0 {
+		drs, err := execute(ctx, session, "UpsertTacticChain delete",
+			fmt.Sprintf(`DELETE EDGE chain_includes %s;`, strings.Join(stale, ", ")))
+		if err != nil {
+			return fmt.Errorf("delete execution failed: %w", err)
+		}
+		if !drs.IsSucceed() {
+			return fmt.Errorf("delete failed: %s", drs.GetErrorMsg())
+		}
+	}
+
+	if len(chain.Tactics) > 0 {
+		values := make([]string, len(chain.Tactics))
+		for i, tactic := range chain.Tactics {
+			values[i] = fmt.Sprintf(`%s->%s@%d:()`, Literal(chain.ChainID), Literal(tactic), i)
+		}
+		irs, err := execute(ctx, session, "UpsertTacticChain insert",
+			fmt.Sprintf(`INSERT EDGE chain_includes() VALUES %s;`, strings.Join(values, ", ")))
+		if err != nil {
+			return fmt.Errorf("insert execution failed: %w", err)
+		}
+		if !irs.IsSucceed() {
+			return fmt.Errorf("insert failed: %s", irs.GetErrorMsg())
+		}
+	}
+
+	slog.InfoContext(ctx, "nebula: UpsertTacticChain completed", "chain", chain.ChainID,
+		"tactics", len(chain.Tactics), "elapsed", time.Since(queryStart))
+	return nil
+}
+
+// DeleteTacticChain removes a chain vertex with its chain_includes edges.
+func DeleteTacticChain(ctx context.Context, pool *Pool, cfg *config.Config, chainID string) error {
+	return deleteVertex(ctx, pool, cfg, "DeleteTacticChain", chainID)
+}
+
+// QueryChainRules returns every chain rule, sorted by ID. LOOKUP uses
+// idx_chain_rule_any.
+func QueryChainRules(ctx context.Context, pool *Pool, cfg *config.Config) ([]ChainRule, error) {
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Release()
+
+	queryStart := time.Now()
+
+	const query = `LOOKUP ON ChainRule
+YIELD id(vertex) AS vid,
+  ChainRule.Chain_ID AS chain_id,
+  ChainRule.Position AS position,
+  ChainRule.Type_ID AS type_id,
+  ChainRule.Segment_ID AS segment_id,
+  ChainRule.Priority AS priority;`
+
+	rs, err := execute(ctx, session, "QueryChainRules", query)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	if !rs.IsSucceed() {
+		return nil, fmt.Errorf("query failed: %s", rs.GetErrorMsg())
+	}
+
+	rules := make([]ChainRule, 0, rs.GetRowSize())
+	for i := 0; i < rs.GetRowSize(); i++ {
+		record, err := rs.GetRowValuesByIndex(i)
+		if err != nil {
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
+			continue
+		}
+		rules = append(rules, ChainRule{
+			RuleID:    safeString(record, 0),
+			ChainID:   safeString(record, 1),
+			Position:  safeString(record, 2),
+			TypeID:    safeString(record, 3),
+			SegmentID: safeString(record, 4),
+			Priority:  safeInt(record, 5, 0),
+		})
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].RuleID < rules[j].RuleID })
+
+	slog.InfoContext(ctx, "nebula: QueryChainRules completed", "rules", len(rules),
+		"elapsed", time.Since(queryStart))
+	return rules, nil
+}
+
+// UpsertChainRule writes a chain rule vertex.
+func UpsertChainRule(ctx context.Context, pool *Pool, cfg *config.Config, rule ChainRule) error {
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return err
+	}
+	defer session.Release()
+
+	queryStart := time.Now()
+
+	query := fmt.Sprintf(`UPSERT VERTEX ON ChainRule %s
+SET Rule_ID = %s, Chain_ID = %s, Position = %s, Type_ID = %s, Segment_ID = %s, Priority = %d;`,
+		Literal(rule.RuleID), Literal(rule.RuleID), Literal(rule.ChainID), Literal(rule.Position),
+		Literal(rule.TypeID), Literal(rule.SegmentID), rule.Priority)
+	rs, err := execute(ctx, session, "UpsertChainRule", query)
+	if err != nil {
+		return fmt.Errorf("upsert execution failed: %w", err)
+	}
+	if !rs.IsSucceed() {
+		return fmt.Errorf("upsert failed: %s", rs.GetErrorMsg())
+	}
+
+	slog.InfoContext(ctx, "nebula: UpsertChainRule completed", "rule", rule.RuleID, "chain", rule.ChainID,
+		"elapsed", time.Since(queryStart))
+	return nil
+}
+
+// DeleteChainRule removes a chain rule vertex.
+func DeleteChainRule(ctx context.Context, pool *Pool, cfg *config.Config, ruleID string) error {
+	return deleteVertex(ctx, pool, cfg, "DeleteChainRule", ruleID)
+}
+
+// deleteVertex removes vid with all its edges.
+func deleteVertex(ctx context.Context, pool *Pool, cfg *config.Config, op, vid string) error {
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return err
+	}
+	defer session.Release()
+
+	queryStart := time.Now()
+
+	rs, err := execute(ctx, session, op, fmt.Sprintf(`DELETE VERTEX %s WITH EDGE;`, Literal(vid)))
+	if err != nil {
+		return fmt.Errorf("delete execution failed: %w", err)
+	}
+	if !rs.IsSucceed() {
+		return fmt.Errorf("delete failed: %s", rs.GetErrorMsg())
+	}
+
+	slog.InfoContext(ctx, "nebula: vertex deleted", "op", op, "vid", vid, "elapsed", time.Since(queryStart))
+	return nil
+}
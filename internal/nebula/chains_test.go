@@ -0,0 +1,55 @@
+package nebula
+
+import "testing"
+
+func TestChainAssignments(t *testing.T) {
+	rules := []ChainRule{
+		{RuleID: "R1", ChainID: "CHAIN_DMZ", SegmentID: "SEG_DMZ", Priority: 5},
+		{RuleID: "R2", ChainID: "CHAIN_DMZ_ENTRY", Position: PositionEntrance, SegmentID: "SEG_DMZ", Priority: 9},
+		{RuleID: "R3", ChainID: "CHAIN_SERVER", TypeID: "TYPE_SRV", Priority: 2},
+		{RuleID: "R4", ChainID: "CHAIN_SERVER_ALT", TypeID: "TYPE_SRV", Priority: 1},
+		{RuleID: "R5", ChainID: "CHAIN_TARGET_ANY", Position: PositionTarget, Priority: 3},
+		{RuleID: "R0", ChainID: "CHAIN_TARGET_TIE", Position: PositionTarget, Priority: 3},
+	}
+	assets := []AssetRecord{
+		{AssetID: "A1", TypeID: "TYPE_WS", SegmentID: "SEG_DMZ"},
+		{AssetID: "A2", TypeID: "TYPE_SRV", SegmentID: "SEG_DMZ"},
+		{AssetID: "A3", TypeID: "TYPE_SRV", SegmentID: "SEG_LAN"},
+		{AssetID: "A4", TypeID: "TYPE_WS", SegmentID: "SEG_LAN"},
+	}
+	c := NewChainAssignments(rules, assets)
+
+	tests := []struct {
+		name     string
+		c        *ChainAssignments
+		asset    string
+		position string
+		want     string
+	}{
+		{"more criteria win over priority", c, "A1", PositionEntrance, "CHAIN_DMZ_ENTRY"},
+		{"segment rule off its position", c, "A1", PositionIntermediate, "CHAIN_DMZ"},
+		{"equal criteria, lower priority first", c, "A3", PositionIntermediate, "CHAIN_SERVER_ALT"},
+		{"lowest priority across criteria kinds", c, "A3", PositionTarget, "CHAIN_SERVER_ALT"},
+		{"equal priority, rule ID decides", c, "A4", PositionTarget, "CHAIN_TARGET_TIE"},
+		{"no rule matches", c, "A4", PositionIntermediate, "CHAIN_INTERMEDIATE"},
+		{"unknown asset", c, "A9", PositionEntrance, "CHAIN_ENTRANCE"},
+		{"nil assignments", nil, "A1", PositionTarget, "CHAIN_TARGET"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.c.Chain(tt.asset, tt.position); got != tt.want {
+				t.Errorf("Chain(%s, %s) = %s, want %s", tt.asset, tt.position, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChainAt(t *testing.T) {
+	c := NewChainAssignments([]ChainRule{{RuleID: "R1", ChainID: "CHAIN_MID", Position: PositionIntermediate}}, nil)
+	want := []string{"CHAIN_ENTRANCE", "CHAIN_MID", "CHAIN_MID", "CHAIN_TARGET"}
+	for i, w := range want {
+		if got := c.ChainAt("A1", i, len(want)); got != w {
+			t.Errorf("ChainAt(index %d of %d) = %s, want %s", i, len(want), got, w)
+		}
+	}
+}
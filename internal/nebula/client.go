@@ -1,10 +1,15 @@
 package nebula
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"sync"
+	"time"
 
 	"ESP-data/config"
+	"ESP-data/internal/metrics"
 
 	nebula "github.com/vesoft-inc/nebula-go/v3"
 )
@@ -28,38 +33,127 @@ type AssetRow struct {
 	DstAssetType        string
 }
 
-// NewPool creates and initializes a Nebula ConnectionPool.
-// The caller is responsible for calling pool.Close() when done.
+// reconnectInterval is the minimum time between attempts to create the
+// connection pool while NebulaGraph is unreachable.
+const reconnectInterval = 5 * time.Second
+
+// ErrNotConnected is returned while the connection pool cannot be created.
+var ErrNotConnected = errors.New("nebula: not connected")
+
+// Pool is a Nebula ConnectionPool that can be created while the graph is
+// down. nebula-go refuses to build a pool without a reachable host, so the
+// underlying pool is built on first use instead, retried at most once per
+// reconnectInterval; once built, nebula-go reconnects its own connections.
+// The caller is responsible for calling Close() when done.
 // This satisfies REQ-121: use Vesoft's Go client libraries.
+type Pool struct {
+	cfg   *config.Config
+	hosts []nebula.HostAddress
+	conf  nebula.PoolConfig
 
-func NewPool(cfg *config.Config) *nebula.ConnectionPool {
-	hostAddress := nebula.HostAddress{
-		Host: cfg.NebulaHost,
-		Port: cfg.NebulaPort,
-	}
+	mu          sync.Mutex
+	pool        *nebula.ConnectionPool
+	closed      bool
+	lastAttempt time.Time
+	lastErr     error
+}
 
-	hostList := []nebula.HostAddress{hostAddress}
+// NewPool returns a Pool for cfg and makes the first connection attempt. An
+// unreachable graph is logged, not fatal.
+func NewPool(cfg *config.Config) *Pool {
 	poolConfig := nebula.GetDefaultConf()
-	logger := nebula.DefaultLogger{}
-	pool, err := nebula.NewConnectionPool(hostList, poolConfig, logger)
+	// Connections held by the TTB session pool come on top of the default
+	// budget so parallel TTB work cannot starve other queries.
+	poolConfig.MaxConnPoolSize += cfg.TTBWorkers
+
+	p := &Pool{
+		cfg:   cfg,
+		hosts: []nebula.HostAddress{{Host: cfg.NebulaHost, Port: cfg.NebulaPort}},
+		conf:  poolConfig,
+	}
+	p.mu.Lock()
+	p.connectLocked()
+	p.mu.Unlock()
+	return p
+}
+
+// connectLocked returns the connection pool, creating it if no attempt was
+// made in the last reconnectInterval. p.mu must be held.
+func (p *Pool) connectLocked() (*nebula.ConnectionPool, error) {
+	if p.pool != nil {
+		return p.pool, nil
+	}
+	if p.closed {
+		return nil, fmt.Errorf("%w: pool closed", ErrNotConnected)
+	}
+	if !p.lastAttempt.IsZero() && time.Since(p.lastAttempt) < reconnectInterval {
+		return nil, fmt.Errorf("%w: %v", ErrNotConnected, p.lastErr)
+	}
+
+	p.lastAttempt = time.Now()
+	pool, err := nebula.NewConnectionPool(p.hosts, p.conf, nebula.DefaultLogger{})
 	if err != nil {
-		log.Fatalf("nebula: failed to create pool: %v", err)
+		p.lastErr = err
+		slog.Warn("nebula: pool unavailable, retrying on demand", "host", p.cfg.NebulaHost, "port", p.cfg.NebulaPort,
+			"retry_after", reconnectInterval, "err", err)
+		return nil, fmt.Errorf("%w: %v", ErrNotConnected, err)
 	}
+	p.pool, p.lastErr = pool, nil
+	slog.Info("nebula: pool created", "host", p.cfg.NebulaHost, "port", p.cfg.NebulaPort)
+	return pool, nil
+}
 
-	log.Printf("nebula: pool created for %s:%d", cfg.NebulaHost, cfg.NebulaPort)
-	return pool
+// GetSession authenticates a new session, creating the connection pool
+// first if the graph was unreachable until now.
+func (p *Pool) GetSession(username, password string) (*nebula.Session, error) {
+	p.mu.Lock()
+	pool, err := p.connectLocked()
+	p.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return pool.GetSession(username, password)
+}
+
+// Close closes the connection pool; later sessions fail with ErrNotConnected.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	if p.pool != nil {
+		p.pool.Close()
+		p.pool = nil
+	}
+}
+
+// Ping opens a session and switches to cfg.Space, the check behind /readyz.
+func Ping(ctx context.Context, pool *Pool, cfg *config.Config) error {
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return err
+	}
+	session.Release()
+	return nil
 }
 
 // openSession is a small helper that obtains a session and switches to
 
-func openSession(pool *nebula.ConnectionPool, cfg *config.Config) (*nebula.Session, error) {
+func openSession(ctx context.Context, pool *Pool, cfg *config.Config) (*nebula.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer metrics.GraphQuerySeconds.Since(time.Now(), "openSession")
 	session, err := pool.GetSession(cfg.NebulaUser, cfg.NebulaPwd)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
 
-	useStmt := fmt.Sprintf("USE %s;", cfg.Space)
-	res, err := session.Execute(useStmt)
+	space, err := Ident(cfg.Space)
+	if err != nil {
+		session.Release()
+		return nil, fmt.Errorf("failed to USE space: %w", err)
+	}
+	res, err := session.Execute("USE " + space + ";")
 	if err != nil {
 		session.Release()
 		return nil, fmt.Errorf("failed to USE space: %w", err)
@@ -71,6 +165,106 @@ func openSession(pool *nebula.ConnectionPool, cfg *config.Config) (*nebula.Sessi
 	return session, nil
 }
 
+// execute runs stmt unless ctx is done. nebula-go cannot interrupt a running
+// statement, so cancellation takes effect between round trips. The round trip
+// is timed under op in esp_graph_query_duration_seconds.
+func execute(ctx context.Context, session *nebula.Session, op, stmt string) (*nebula.ResultSet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	rs, err := session.Execute(stmt)
+	observeQuery(op, start, rs, err)
+	return rs, err
+}
+
+// executeWithParameter is execute for a parameterised statement (see Params).
+func executeWithParameter(ctx context.Context, session *nebula.Session, op, stmt string, params Params) (*nebula.ResultSet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	rs, err := session.ExecuteWithParameter(stmt, params)
+	observeQuery(op, start, rs, err)
+	return rs, err
+}
+
+// observeQuery records the duration of one statement and counts it as an
+// error if it failed to run or returned an error result.
+func observeQuery(op string, start time.Time, rs *nebula.ResultSet, err error) {
+	metrics.GraphQuerySeconds.Since(start, op)
+	if err != nil || !rs.IsSucceed() {
+		metrics.GraphQueryErrors.Inc(op)
+	}
+}
+
+// SessionPool keeps up to size authenticated sessions already switched to
+// cfg.Space, so concurrent ComputeTTB calls skip the login and USE round trips.
+// Acquire blocks while all sessions are in use.
+type SessionPool struct {
+	pool  *Pool
+	cfg   *config.Config
+	slots chan struct{}
+	idle  chan *nebula.Session
+}
+
+// NewSessionPool returns a SessionPool over pool; sessions are opened lazily.
+func NewSessionPool(pool *Pool, cfg *config.Config, size int) *SessionPool {
+	if size < 1 {
+		size = 1
+	}
+	return &SessionPool{
+		pool:  pool,
+		cfg:   cfg,
+		slots: make(chan struct{}, size),
+		idle:  make(chan *nebula.Session, size),
+	}
+}
+
+// Acquire returns an idle session or opens a new one, giving up when ctx is
+// done.
+func (p *SessionPool) Acquire(ctx context.Context) (*nebula.Session, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case session := <-p.idle:
+		return session, nil
+	default:
+	}
+	session, err := openSession(ctx, p.pool, p.cfg)
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+	return session, nil
+}
+
+// Put returns a session from Acquire. Sessions that saw an error are
+// released rather than reused.
+func (p *SessionPool) Put(session *nebula.Session, healthy bool) {
+	if healthy {
+		p.idle <- session
+	} else {
+		session.Release()
+	}
+	<-p.slots
+}
+
+// Close releases all idle sessions. Call it before closing the connection pool.
+func (p *SessionPool) Close() {
+	for {
+		select {
+		case session := <-p.idle:
+			session.Release()
+		default:
+			return
+		}
+	}
+}
+
 func safeString(record *nebula.Record, idx int) string {
 	val, err := record.GetValueByIndex(idx)
 	if err != nil {
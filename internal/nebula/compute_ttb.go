@@ -1,11 +1,10 @@
 package nebula
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"strings"
+	"log/slog"
 
-	"ESP-data/config"
 	"ESP-data/internal/store"
 
 	nebula "github.com/vesoft-inc/nebula-go/v3"
@@ -15,11 +14,31 @@ import (
 // TTB Calculation — ALG-REQ-070 through ALG-REQ-080
 // ======================================================================================================
 
+// Technique selection modes of the TTB calculation.
+const (
+	// TTBSelectionFastest picks the minimum-TTT candidate per tactic (ALG-REQ-077).
+	TTBSelectionFastest = "fastest"
+	// TTBSelectionWeighted weights the candidates of each tactic by
+	// patterns_to.probability (ED012) and priority and returns the expected
+	// TTB (ALG-REQ-076 design note 4).
+	TTBSelectionWeighted = "weighted"
+)
+
 // TTBParams holds configurable parameters for the TTB calculation (ALG-REQ-071, 072, 075).
 type TTBParams struct {
 	OrientationTime   float64
 	SwitchoverTime    float64
 	PriorityTolerance int
+
+	// Selection is TTBSelectionFastest (also when empty) or TTBSelectionWeighted.
+	Selection string
+	// Distribution adds the TTB distribution to a weighted result.
+	Distribution bool
+}
+
+// Weighted reports whether p selects techniques by weight rather than by minimum TTT.
+func (p TTBParams) Weighted() bool {
+	return p.Selection == TTBSelectionWeighted
 }
 
 // TTBLogEntry records one step of the tactic chain traversal (ALG-REQ-079).
@@ -30,31 +49,58 @@ type TTBLogEntry struct {
 	TechniqueName   *string `json:"technique_name"`
 	TTT             float64 `json:"ttt"`
 	CandidatesCount int     `json:"candidates_count"`
+
+	// Execution bounds of the selected technique (TA008), the range of a
+	// Monte Carlo TTT sample.
+	ExecMin float64 `json:"exec_min,omitempty"`
+	ExecMax float64 `json:"exec_max,omitempty"`
+
+	// Probability of TechniqueID at this tactic in weighted selection, where
+	// the entry names the most likely technique and TTT is the expected TTT.
+	Probability *float64 `json:"probability,omitempty"`
 }
 
-// TTBResult is the output of ComputeTTB (ALG-REQ-070).
+// TTBOutcome is one possible TTB of a weighted calculation and its probability.
+type TTBOutcome struct {
+	TTB         float64 `json:"ttb"`
+	Probability float64 `json:"probability"`
+}
+
+// TTBResult is the output of ComputeTTB (ALG-REQ-070). In weighted
+// selection TTB is the expected value and Distribution, when requested,
+// lists the possible TTBs in ascending order.
 type TTBResult struct {
-	TTB float64       `json:"ttb"`
-	Log []TTBLogEntry `json:"log"`
+	TTB          float64       `json:"ttb"`
+	Log          []TTBLogEntry `json:"log"`
+	Distribution []TTBOutcome  `json:"distribution,omitempty"`
 }
 
-// techniqueCandidate holds one technique row returned by the selection queries.
-type techniqueCandidate struct {
+// TechniqueCandidate holds one technique row returned by the selection queries.
+type TechniqueCandidate struct {
 	TechniqueID    string
 	TechniqueName  string
 	Priority       int
 	VulnApplicable bool
 	TTT            float64
+	ExecMin        float64 // set with TTT by ApplyTTTFormula
+	ExecMax        float64
+	Probability    float64 // patterns_to.probability (ED012); 0 for tactic-first candidates
+}
+
+// TacticRef identifies one tactic of a TacticChain in chain_includes rank order (ALG-REQ-050).
+type TacticRef struct {
+	VID        string
+	TacticID   string
+	TacticName string
 }
 
 // getOrderedTactics returns the tactic VIDs for a chain, ordered by chain_includes rank.
-func getOrderedTactics(session *nebula.Session, chainVid string) ([]struct{ VID, TacticID, TacticName string }, error) {
-	query := fmt.Sprintf(
-		`GO FROM "%s" OVER chain_includes `+
-			`YIELD chain_includes._rank AS rank, id($$) AS tactic_vid `+
-			`| ORDER BY $-.rank ASC;`, chainVid)
+func getOrderedTactics(ctx context.Context, session *nebula.Session, chainVid string) ([]TacticRef, error) {
+	query := `GO FROM ` + Literal(chainVid) + ` OVER chain_includes ` +
+		`YIELD chain_includes._rank AS rank, id($$) AS tactic_vid ` +
+		`| ORDER BY $-.rank ASC;`
 
-	rs, err := session.Execute(query)
+	rs, err := execute(ctx, session, "getOrderedTactics GO", query)
 	if err != nil {
 		return nil, fmt.Errorf("getOrderedTactics GO: %w", err)
 	}
@@ -62,8 +108,7 @@ func getOrderedTactics(session *nebula.Session, chainVid string) ([]struct{ VID,
 		return nil, fmt.Errorf("getOrderedTactics GO: %s", rs.GetErrorMsg())
 	}
 
-	type tacticRef struct{ VID, TacticID, TacticName string }
-	var tactics []tacticRef
+	var tactics []TacticRef
 
 	for i := 0; i < rs.GetRowSize(); i++ {
 		record, _ := rs.GetRowValuesByIndex(i)
@@ -71,7 +116,7 @@ func getOrderedTactics(session *nebula.Session, chainVid string) ([]struct{ VID,
 		if vid == "" {
 			continue
 		}
-		tactics = append(tactics, tacticRef{VID: vid})
+		tactics = append(tactics, TacticRef{VID: vid})
 	}
 
 	if len(tactics) == 0 {
@@ -80,14 +125,12 @@ func getOrderedTactics(session *nebula.Session, chainVid string) ([]struct{ VID,
 
 	var vids []string
 	for _, t := range tactics {
-		vids = append(vids, fmt.Sprintf(`"%s"`, t.VID))
+		vids = append(vids, t.VID)
 	}
-	fetchQ := fmt.Sprintf(
-		`FETCH PROP ON tMitreTactic %s `+
-			`YIELD tMitreTactic.Tactic_ID AS tid, tMitreTactic.Tactic_Name AS tname;`,
-		strings.Join(vids, ","))
+	fetchQ := `FETCH PROP ON tMitreTactic ` + LiteralList(vids) + ` ` +
+		`YIELD tMitreTactic.Tactic_ID AS tid, tMitreTactic.Tactic_Name AS tname;`
 
-	fs, err := session.Execute(fetchQ)
+	fs, err := execute(ctx, session, "getOrderedTactics FETCH", fetchQ)
 	if err != nil {
 		return nil, fmt.Errorf("getOrderedTactics FETCH: %w", err)
 	}
@@ -95,54 +138,48 @@ func getOrderedTactics(session *nebula.Session, chainVid string) ([]struct{ VID,
 		return nil, fmt.Errorf("getOrderedTactics FETCH: %s", fs.GetErrorMsg())
 	}
 
-	info := make(map[string]tacticRef)
+	info := make(map[string]TacticRef)
 	for i := 0; i < fs.GetRowSize(); i++ {
 		record, _ := fs.GetRowValuesByIndex(i)
 		//here it was updated to fix tactic name getting into tactic id column
 		tacticID := safeString(record, 0)
-		info[tacticID] = tacticRef{
+		info[tacticID] = TacticRef{
 			VID:        tacticID,
 			TacticID:   tacticID,              // ← "TA0001" ✓
 			TacticName: safeString(record, 1), // ← "Initial Access" ✓
 		}
 	}
 
-	result := make([]struct{ VID, TacticID, TacticName string }, 0, len(tactics))
+	result := make([]TacticRef, 0, len(tactics))
 	for _, t := range tactics {
 		if inf, ok := info[t.VID]; ok {
-			result = append(result, struct{ VID, TacticID, TacticName string }{
-				VID: inf.VID, TacticID: inf.TacticID, TacticName: inf.TacticName,
-			})
+			result = append(result, inf)
 		} else {
-			result = append(result, struct{ VID, TacticID, TacticName string }{
-				VID: t.VID, TacticID: t.VID, TacticName: t.VID,
-			})
+			result = append(result, TacticRef{VID: t.VID, TacticID: t.VID, TacticName: t.VID})
 		}
 	}
 	return result, nil
 }
 
 // selectFirstTacticTechniques implements ALG-REQ-073.
-func selectFirstTacticTechniques(session *nebula.Session, assetVid, tacticVid string) ([]techniqueCandidate, error) {
-	query := fmt.Sprintf(
-		`MATCH (a:Asset)-[:runs_on]->(os:OS_Type)-[:represents]->(p:MitrePlatform)`+
-			`<-[:can_be_executed_on]-(t:tMitreTechnique)-[:part_of]->(tac:tMitreTactic) `+
-			`WHERE id(a) == "%s" AND id(tac) == "%s" `+
-			`WITH collect({ `+
-			`  tid: t.tMitreTechnique.Technique_ID, `+
-			`  tname: t.tMitreTechnique.Technique_Name, `+
-			`  pri: t.tMitreTechnique.priority, `+
-			`  rcelpe: t.tMitreTechnique.rcelpe `+
-			`}) AS rows `+
-			`UNWIND rows AS r `+
-			`RETURN DISTINCT r.tid AS technique_id, `+
-			`       r.tname AS technique_name, `+
-			`       r.pri AS technique_priority, `+
-			`       r.rcelpe AS vuln_applicable `+
-			`ORDER BY technique_priority DESC, technique_id;`,
-		assetVid, tacticVid)
-
-	rs, err := session.Execute(query)
+func selectFirstTacticTechniques(ctx context.Context, session *nebula.Session, assetVid, tacticVid string) ([]TechniqueCandidate, error) {
+	const query = `MATCH (a:Asset)-[:runs_on]->(os:OS_Type)-[:represents]->(p:MitrePlatform)` +
+		`<-[:can_be_executed_on]-(t:tMitreTechnique)-[:part_of]->(tac:tMitreTactic) ` +
+		`WHERE id(a) == $asset AND id(tac) == $tactic ` +
+		`WITH collect({ ` +
+		`  tid: t.tMitreTechnique.Technique_ID, ` +
+		`  tname: t.tMitreTechnique.Technique_Name, ` +
+		`  pri: t.tMitreTechnique.priority, ` +
+		`  rcelpe: t.tMitreTechnique.rcelpe ` +
+		`}) AS rows ` +
+		`UNWIND rows AS r ` +
+		`RETURN DISTINCT r.tid AS technique_id, ` +
+		`       r.tname AS technique_name, ` +
+		`       r.pri AS technique_priority, ` +
+		`       r.rcelpe AS vuln_applicable ` +
+		`ORDER BY technique_priority DESC, technique_id;`
+
+	rs, err := executeWithParameter(ctx, session, "selectFirstTacticTechniques", query, Params{"asset": assetVid, "tactic": tacticVid})
 	if err != nil {
 		return nil, fmt.Errorf("selectFirstTacticTechniques: %w", err)
 	}
@@ -154,25 +191,24 @@ func selectFirstTacticTechniques(session *nebula.Session, assetVid, tacticVid st
 }
 
 // selectPatternTechniques implements ALG-REQ-076.
-func selectPatternTechniques(session *nebula.Session, previousTacticID, fastestTechniqueID, currentTacticID string) ([]techniqueCandidate, error) {
+func selectPatternTechniques(ctx context.Context, session *nebula.Session, previousTacticID, fastestTechniqueID, currentTacticID string) ([]TechniqueCandidate, error) {
 	stateID := previousTacticID + "|" + fastestTechniqueID
-	query := fmt.Sprintf(
-		`MATCH (src_state:tMitreState)-[:patterns_to]->(dst_state:tMitreState) `+
-			`WHERE id(src_state) == "%s" `+
-			`WITH dst_state.tMitreState.state_id AS dst_id `+
-			`WITH dst_id, split(dst_id, "|") AS parts `+
-			`WHERE size(parts) == 2 AND parts[0] == "%s" `+
-			`WITH parts[1] AS technique_vid `+
-			`MATCH (t:tMitreTechnique) `+
-			`WHERE id(t) == technique_vid `+
-			`RETURN t.tMitreTechnique.Technique_ID AS technique_id, `+
-			`       t.tMitreTechnique.Technique_Name AS technique_name, `+
-			`       t.tMitreTechnique.priority AS technique_priority, `+
-			`       t.tMitreTechnique.rcelpe AS vuln_applicable `+
-			`ORDER BY technique_priority DESC, technique_id;`,
-		stateID, currentTacticID)
-
-	rs, err := session.Execute(query)
+	const query = `MATCH (src_state:tMitreState)-[pt:patterns_to]->(dst_state:tMitreState) ` +
+		`WHERE id(src_state) == $state ` +
+		`WITH dst_state.tMitreState.state_id AS dst_id, pt.probability AS probability ` +
+		`WITH dst_id, probability, split(dst_id, "|") AS parts ` +
+		`WHERE size(parts) == 2 AND parts[0] == $tactic ` +
+		`WITH parts[1] AS technique_vid, probability ` +
+		`MATCH (t:tMitreTechnique) ` +
+		`WHERE id(t) == technique_vid ` +
+		`RETURN t.tMitreTechnique.Technique_ID AS technique_id, ` +
+		`       t.tMitreTechnique.Technique_Name AS technique_name, ` +
+		`       t.tMitreTechnique.priority AS technique_priority, ` +
+		`       t.tMitreTechnique.rcelpe AS vuln_applicable, ` +
+		`       probability ` +
+		`ORDER BY technique_priority DESC, technique_id;`
+
+	rs, err := executeWithParameter(ctx, session, "selectPatternTechniques", query, Params{"state": stateID, "tactic": currentTacticID})
 	if err != nil {
 		return nil, fmt.Errorf("selectPatternTechniques: %w", err)
 	}
@@ -184,18 +220,17 @@ func selectPatternTechniques(session *nebula.Session, previousTacticID, fastestT
 }
 
 // filterByOS applies ALG-REQ-062 OS platform filter to pattern-derived candidates.
-func filterByOS(session *nebula.Session, candidates []techniqueCandidate, assetVid string) ([]techniqueCandidate, error) {
+func filterByOS(ctx context.Context, session *nebula.Session, candidates []TechniqueCandidate, assetVid string) ([]TechniqueCandidate, error) {
 	if len(candidates) == 0 {
 		return candidates, nil
 	}
 
-	query := fmt.Sprintf(
-		`MATCH (a:Asset)-[:runs_on]->(os:OS_Type)-[:represents]->(p:MitrePlatform)`+
-			`<-[:can_be_executed_on]-(t:tMitreTechnique) `+
-			`WHERE id(a) == "%s" `+
-			`RETURN DISTINCT t.tMitreTechnique.Technique_ID AS technique_id;`, assetVid)
+	const query = `MATCH (a:Asset)-[:runs_on]->(os:OS_Type)-[:represents]->(p:MitrePlatform)` +
+		`<-[:can_be_executed_on]-(t:tMitreTechnique) ` +
+		`WHERE id(a) == $asset ` +
+		`RETURN DISTINCT t.tMitreTechnique.Technique_ID AS technique_id;`
 
-	rs, err := session.Execute(query)
+	rs, err := executeWithParameter(ctx, session, "filterByOS", query, Params{"asset": assetVid})
 	if err != nil {
 		return nil, fmt.Errorf("filterByOS: %w", err)
 	}
@@ -209,7 +244,7 @@ func filterByOS(session *nebula.Session, candidates []techniqueCandidate, assetV
 		allowed[safeString(record, 0)] = true
 	}
 
-	var filtered []techniqueCandidate
+	var filtered []TechniqueCandidate
 	for _, c := range candidates {
 		if allowed[c.TechniqueID] {
 			filtered = append(filtered, c)
@@ -218,12 +253,59 @@ func filterByOS(session *nebula.Session, candidates []techniqueCandidate, assetV
 	return filtered, nil
 }
 
+// tacticCandidates selects the candidate techniques of the i-th tactic of the
+// chain: patterns_to from the previous state filtered by OS, falling back to
+// the tactic-first selection (ALG-REQ-076, ALG-REQ-062, ALG-REQ-073), then
+// the vulnerability and priority filters (ALG-REQ-074, ALG-REQ-075).
+// previousTechID is nil on the first tactic and after a tactic without a
+// technique. fromPatterns reports that the candidates came from patterns_to.
+func tacticCandidates(ctx context.Context, src TTBSource, assetVid string, i int, tactic TacticRef, previousTacticID string,
+	previousTechID *string, hasVuln bool, tolerance int) (candidates []TechniqueCandidate, fromPatterns bool) {
+
+	var err error
+	if i == 0 || previousTechID == nil {
+		candidates, err = src.FirstTacticTechniques(ctx, assetVid, tactic.VID)
+		if err != nil {
+			slog.WarnContext(ctx, "nebula: ComputeTTB selectFirstTacticTechniques failed",
+				"asset", assetVid, "tactic", tactic.TacticID, "err", err)
+			candidates = nil
+		}
+	} else {
+		candidates, err = src.PatternTechniques(ctx, previousTacticID, *previousTechID, tactic.TacticID)
+		if err != nil {
+			slog.WarnContext(ctx, "nebula: ComputeTTB selectPatternTechniques failed", "asset", assetVid,
+				"previous_tactic", previousTacticID, "technique", *previousTechID, "tactic", tactic.TacticID, "err", err)
+			candidates = nil
+		}
+
+		if len(candidates) > 0 {
+			candidates, err = src.FilterByOS(ctx, candidates, assetVid)
+			if err != nil {
+				slog.WarnContext(ctx, "nebula: ComputeTTB filterByOS failed", "asset", assetVid, "err", err)
+			}
+		}
+		fromPatterns = len(candidates) > 0
+
+		if len(candidates) == 0 {
+			candidates, err = src.FirstTacticTechniques(ctx, assetVid, tactic.VID)
+			if err != nil {
+				slog.WarnContext(ctx, "nebula: ComputeTTB fallback selectFirstTacticTechniques failed",
+					"asset", assetVid, "tactic", tactic.TacticID, "err", err)
+				candidates = nil
+			}
+		}
+	}
+
+	candidates = filterByVulnerability(candidates, hasVuln)
+	return filterByPriority(candidates, tolerance), fromPatterns
+}
+
 // filterByVulnerability implements ALG-REQ-074.
-func filterByVulnerability(candidates []techniqueCandidate, hasVulnerability bool) []techniqueCandidate {
+func filterByVulnerability(candidates []TechniqueCandidate, hasVulnerability bool) []TechniqueCandidate {
 	if !hasVulnerability {
 		return candidates
 	}
-	var vulnCandidates []techniqueCandidate
+	var vulnCandidates []TechniqueCandidate
 	for _, c := range candidates {
 		if c.VulnApplicable {
 			vulnCandidates = append(vulnCandidates, c)
@@ -236,7 +318,7 @@ func filterByVulnerability(candidates []techniqueCandidate, hasVulnerability boo
 }
 
 // filterByPriority implements ALG-REQ-075.
-func filterByPriority(candidates []techniqueCandidate, tolerance int) []techniqueCandidate {
+func filterByPriority(candidates []TechniqueCandidate, tolerance int) []TechniqueCandidate {
 	if len(candidates) == 0 {
 		return candidates
 	}
@@ -250,7 +332,7 @@ func filterByPriority(candidates []techniqueCandidate, tolerance int) []techniqu
 	if threshold < 1 {
 		threshold = 1
 	}
-	var filtered []techniqueCandidate
+	var filtered []TechniqueCandidate
 	for _, c := range candidates {
 		if c.Priority >= threshold {
 			filtered = append(filtered, c)
@@ -260,7 +342,7 @@ func filterByPriority(candidates []techniqueCandidate, tolerance int) []techniqu
 }
 
 // selectFastest implements ALG-REQ-077 (argmin TTT with deterministic tie-breaking).
-func selectFastest(candidates []techniqueCandidate) *techniqueCandidate {
+func selectFastest(candidates []TechniqueCandidate) *TechniqueCandidate {
 	if len(candidates) == 0 {
 		return nil
 	}
@@ -280,29 +362,31 @@ func selectFastest(candidates []techniqueCandidate) *techniqueCandidate {
 	return best
 }
 
-// parseTechniqueCandidates converts a ResultSet into techniqueCandidate slices.
-func parseTechniqueCandidates(rs *nebula.ResultSet) ([]techniqueCandidate, error) {
-	var candidates []techniqueCandidate
+// parseTechniqueCandidates converts a ResultSet into TechniqueCandidate slices;
+// the optional fifth column is the patterns_to probability.
+func parseTechniqueCandidates(rs *nebula.ResultSet) ([]TechniqueCandidate, error) {
+	var candidates []TechniqueCandidate
 	for i := 0; i < rs.GetRowSize(); i++ {
 		record, _ := rs.GetRowValuesByIndex(i)
 		tid := safeString(record, 0)
 		if tid == "" {
 			continue
 		}
-		candidates = append(candidates, techniqueCandidate{
+		candidates = append(candidates, TechniqueCandidate{
 			TechniqueID:    tid,
 			TechniqueName:  safeString(record, 1),
 			Priority:       safeInt(record, 2, 4),
 			VulnApplicable: safeBool(record, 3),
+			Probability:    safeFloat64(record, 4, 0),
 		})
 	}
 	return candidates, nil
 }
 
 // queryAssetHasVulnerability fetches the has_vulnerability flag for an asset.
-func queryAssetHasVulnerability(session *nebula.Session, assetVid string) (bool, error) {
-	query := fmt.Sprintf(`FETCH PROP ON Asset "%s" YIELD Asset.has_vulnerability AS hv;`, assetVid)
-	rs, err := session.Execute(query)
+func queryAssetHasVulnerability(ctx context.Context, session *nebula.Session, assetVid string) (bool, error) {
+	query := `FETCH PROP ON Asset ` + Literal(assetVid) + ` YIELD Asset.has_vulnerability AS hv;`
+	rs, err := execute(ctx, session, "queryAssetHasVulnerability", query)
 	if err != nil {
 		return false, fmt.Errorf("queryAssetHasVulnerability: %w", err)
 	}
@@ -316,23 +400,85 @@ func queryAssetHasVulnerability(session *nebula.Session, assetVid string) (bool,
 	return safeBool(record, 1), nil
 }
 
-// ComputeTTB implements the full TTB calculation algorithm (ALG-REQ-070).
+// TTBSource supplies the graph reads the TTB algorithm needs (ALG-REQ-070 through ALG-REQ-080).
+// The Nebula implementation issues nGQL on a single session; other graph backends
+// implement it over their own data so that every backend shares one algorithm.
+type TTBSource interface {
+	// OrderedTactics returns the chain's tactics in chain_includes rank order (ALG-REQ-050).
+	OrderedTactics(ctx context.Context, chainVid string) ([]TacticRef, error)
+	// AssetHasVulnerability returns the Asset.has_vulnerability flag (ALG-REQ-074).
+	AssetHasVulnerability(ctx context.Context, assetVid string) (bool, error)
+	// FirstTacticTechniques selects OS-valid techniques of a tactic (ALG-REQ-073).
+	FirstTacticTechniques(ctx context.Context, assetVid, tacticVid string) ([]TechniqueCandidate, error)
+	// PatternTechniques follows patterns_to from the previous state (ALG-REQ-076).
+	PatternTechniques(ctx context.Context, previousTacticID, fastestTechniqueID, currentTacticID string) ([]TechniqueCandidate, error)
+	// FilterByOS drops candidates not executable on the asset's platform (ALG-REQ-062).
+	FilterByOS(ctx context.Context, candidates []TechniqueCandidate, assetVid string) ([]TechniqueCandidate, error)
+	// TTTInputs returns the ALG-REQ-060 inputs per technique VID and the
+	// active-applied mitigation maturities on the asset.
+	TTTInputs(ctx context.Context, assetVid string, techniqueIDs []string) (map[string]TechniqueTTTInput, map[string]int, error)
+}
+
+// sessionSource is the Nebula TTBSource — all reads share one session (Strategy A).
+type sessionSource struct {
+	session *nebula.Session
+}
+
+func (s sessionSource) OrderedTactics(ctx context.Context, chainVid string) ([]TacticRef, error) {
+	return getOrderedTactics(ctx, s.session, chainVid)
+}
+
+func (s sessionSource) AssetHasVulnerability(ctx context.Context, assetVid string) (bool, error) {
+	return queryAssetHasVulnerability(ctx, s.session, assetVid)
+}
+
+func (s sessionSource) FirstTacticTechniques(ctx context.Context, assetVid, tacticVid string) ([]TechniqueCandidate, error) {
+	return selectFirstTacticTechniques(ctx, s.session, assetVid, tacticVid)
+}
 
-func ComputeTTB(pool *nebula.ConnectionPool, cfg *config.Config, assetVid, chainVid string, params TTBParams, audit *store.AuditBuffer) (*TTBResult, error) {
-	session, err := openSession(pool, cfg)
+func (s sessionSource) PatternTechniques(ctx context.Context, previousTacticID, fastestTechniqueID, currentTacticID string) ([]TechniqueCandidate, error) {
+	return selectPatternTechniques(ctx, s.session, previousTacticID, fastestTechniqueID, currentTacticID)
+}
+
+func (s sessionSource) FilterByOS(ctx context.Context, candidates []TechniqueCandidate, assetVid string) ([]TechniqueCandidate, error) {
+	return filterByOS(ctx, s.session, candidates, assetVid)
+}
+
+func (s sessionSource) TTTInputs(ctx context.Context, assetVid string, techniqueIDs []string) (map[string]TechniqueTTTInput, map[string]int, error) {
+	return queryBatchTTTInputs(ctx, s.session, assetVid, techniqueIDs)
+}
+
+// ComputeTTB implements the full TTB calculation algorithm (ALG-REQ-070) against
+// NebulaGraph on a session from sessions. The MITRE side is read from the
+// snapshot of mitre when one is given and loads. It is safe for concurrent use.
+func ComputeTTB(ctx context.Context, sessions *SessionPool, mitre *MitreCache, assetVid, chainVid string, params TTBParams, audit *store.AuditBuffer) (*TTBResult, error) {
+	session, err := sessions.Acquire(ctx)
 	if err != nil {
 		return nil, err
 	}
-	defer session.Release()
+	healthy := false
+	defer func() { sessions.Put(session, healthy) }()
+
+	result, err := RunTTB(ctx, snapshotOrSession(ctx, mitre, session, assetVid, chainVid), assetVid, chainVid, params, audit)
+	healthy = err == nil
+	return result, err
+}
+
+// RunTTB runs the TTB tactic-chain traversal (ALG-REQ-070) over any TTBSource.
+// With weighted selection it computes the expected TTB instead (runWeightedTTB).
+func RunTTB(ctx context.Context, src TTBSource, assetVid, chainVid string, params TTBParams, audit *store.AuditBuffer) (*TTBResult, error) {
+	if params.Weighted() {
+		return runWeightedTTB(ctx, src, assetVid, chainVid, params, audit)
+	}
 
-	tactics, err := getOrderedTactics(session, chainVid)
+	tactics, err := src.OrderedTactics(ctx, chainVid)
 	if err != nil {
 		return nil, fmt.Errorf("ComputeTTB: %w", err)
 	}
 
-	hasVuln, err := queryAssetHasVulnerability(session, assetVid)
+	hasVuln, err := src.AssetHasVulnerability(ctx, assetVid)
 	if err != nil {
-		log.Printf("nebula: ComputeTTB warning — could not fetch has_vulnerability for %s: %v", assetVid, err)
+		slog.WarnContext(ctx, "nebula: ComputeTTB could not fetch has_vulnerability", "asset", assetVid, "err", err)
 	}
 
 	ttb := params.OrientationTime
@@ -354,50 +500,17 @@ func ComputeTTB(pool *nebula.ConnectionPool, cfg *config.Config, assetVid, chain
 	}
 
 	for i, tactic := range tactics {
-		var candidates []techniqueCandidate
-		usedFallback := false
-
-		if i == 0 || fastestTechID == nil {
-			candidates, err = selectFirstTacticTechniques(session, assetVid, tactic.VID)
-			if err != nil {
-				log.Printf("nebula: ComputeTTB selectFirstTacticTechniques failed for tactic %s: %v", tactic.TacticID, err)
-				candidates = nil
-			}
-			if i > 0 {
-				usedFallback = true
-			}
-		} else {
-			candidates, err = selectPatternTechniques(session, previousTacticID, *fastestTechID, tactic.TacticID)
-			if err != nil {
-				log.Printf("nebula: ComputeTTB selectPatternTechniques failed for %s|%s -> %s: %v",
-					previousTacticID, *fastestTechID, tactic.TacticID, err)
-				candidates = nil
-			}
-
-			if len(candidates) > 0 {
-				candidates, err = filterByOS(session, candidates, assetVid)
-				if err != nil {
-					log.Printf("nebula: ComputeTTB filterByOS failed: %v", err)
-				}
-			}
-
-			if len(candidates) == 0 && !usedFallback {
-				candidates, err = selectFirstTacticTechniques(session, assetVid, tactic.VID)
-				if err != nil {
-					log.Printf("nebula: ComputeTTB fallback selectFirstTacticTechniques failed for tactic %s: %v", tactic.TacticID, err)
-					candidates = nil
-				}
-				usedFallback = true
-			}
+		// Stop between tactics once the caller has gone away or its deadline passed.
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("ComputeTTB %s: %w", assetVid, err)
 		}
 
-		candidates = filterByVulnerability(candidates, hasVuln)
-		candidates = filterByPriority(candidates, params.PriorityTolerance)
+		candidates, _ := tacticCandidates(ctx, src, assetVid, i, tactic, previousTacticID, fastestTechID, hasVuln, params.PriorityTolerance)
 		candidatesCount := len(candidates)
 
 		if candidatesCount == 0 {
-			log.Printf("nebula: ComputeTTB — empty technique set for tactic %s (%s) on asset %s",
-				tactic.TacticID, tactic.TacticName, assetVid)
+			slog.DebugContext(ctx, "nebula: ComputeTTB empty technique set",
+				"asset", assetVid, "tactic", tactic.TacticID, "tactic_name", tactic.TacticName)
 			ttbLog = append(ttbLog, TTBLogEntry{
 				TacticID:        tactic.TacticID,
 				TacticName:      tactic.TacticName,
@@ -428,8 +541,9 @@ func ComputeTTB(pool *nebula.ConnectionPool, cfg *config.Config, assetVid, chain
 		if audit != nil {
 			pendingStepIdx = len(audit.TacticSteps)
 		}
-		if err := computeBatchTTT(session, assetVid, candidates, audit, pendingStepIdx); err != nil {
-			log.Printf("nebula: ComputeTTB computeBatchTTT failed for tactic %s: %v", tactic.TacticID, err)
+		if err := computeBatchTTT(ctx, src, assetVid, candidates, audit, pendingStepIdx); err != nil {
+			slog.WarnContext(ctx, "nebula: ComputeTTB computeBatchTTT failed", "asset", assetVid,
+				"tactic", tactic.TacticID, "err", err)
 			for j := range candidates {
 				candidates[j].TTT = 999999.0
 			}
@@ -477,6 +591,8 @@ func ComputeTTB(pool *nebula.ConnectionPool, cfg *config.Config, assetVid, chain
 			TechniqueName:   &tname,
 			TTT:             fastest.TTT,
 			CandidatesCount: candidatesCount,
+			ExecMin:         fastest.ExecMin,
+			ExecMax:         fastest.ExecMax,
 		})
 		if audit != nil {
 			audit.TacticSteps = append(audit.TacticSteps, store.TacticStepRecord{
@@ -1,9 +1,9 @@
 package nebula
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"strings"
+	"log/slog"
 
 	"ESP-data/config"
 	"ESP-data/internal/store"
@@ -28,18 +28,17 @@ type TTTResult struct {
 // When osPreChecked is true, the ALG-REQ-062 OS platform query is skipped
 // because the caller has already guaranteed OS validity — see
 // selectFirstTacticTechniques (ALG-REQ-073) and filterByOS (ALG-REQ-062).
-func computeTTTWithSession(session *nebula.Session, assetVid, techniqueVid string, osPreChecked bool) (*TTTResult, error) {
+func computeTTTWithSession(ctx context.Context, session *nebula.Session, assetVid, techniqueVid string, osPreChecked bool) (*TTTResult, error) {
 
 	// ALG-REQ-062: OS platform pre-check.
 	// Skipped when osPreChecked == true (caller already filtered by OS).
 	if !osPreChecked {
-		osCheck := fmt.Sprintf(
-			`MATCH (a:Asset)-[:runs_on]->(os:OS_Type)-[:represents]->(p:MitrePlatform)`+
-				`<-[:can_be_executed_on]-(t:tMitreTechnique) `+
-				`WHERE id(a) == "%s" AND id(t) == "%s" `+
-				`RETURN count(*) AS cnt;`, assetVid, techniqueVid)
+		const osCheck = `MATCH (a:Asset)-[:runs_on]->(os:OS_Type)-[:represents]->(p:MitrePlatform)` +
+			`<-[:can_be_executed_on]-(t:tMitreTechnique) ` +
+			`WHERE id(a) == $asset AND id(t) == $technique ` +
+			`RETURN count(*) AS cnt;`
 
-		osRS, err := session.Execute(osCheck)
+		osRS, err := executeWithParameter(ctx, session, "ComputeTTT os check", osCheck, Params{"asset": assetVid, "technique": techniqueVid})
 		if err != nil {
 			return nil, fmt.Errorf("ComputeTTT os check: %w", err)
 		}
@@ -59,19 +58,17 @@ func computeTTTWithSession(session *nebula.Session, assetVid, techniqueVid strin
 	// OPTIONAL MATCH ... WHERE which is not supported in nGQL 3.x.
 
 	// Query 1: Get technique properties and count of possible mitigations (P)
-	q1 := fmt.Sprintf(
-		`MATCH (t:tMitreTechnique) WHERE id(t) == "%s" `+
-			`OPTIONAL MATCH (m:tMitreMitigation)-[:mitigates]->(t) `+
-			`WITH t, count(m) AS P, collect(id(m)) AS mitigation_vids `+
-			`RETURN t.tMitreTechnique.Technique_ID AS technique_id, `+
-			`  t.tMitreTechnique.Technique_Name AS technique_name, `+
-			`  t.tMitreTechnique.execution_min AS exec_min, `+
-			`  t.tMitreTechnique.execution_max AS exec_max, `+
-			`  P AS possible_mitigations, `+
-			`  mitigation_vids AS mit_vids;`,
-		techniqueVid)
-
-	rs1, err := session.Execute(q1)
+	const q1 = `MATCH (t:tMitreTechnique) WHERE id(t) == $technique ` +
+		`OPTIONAL MATCH (m:tMitreMitigation)-[:mitigates]->(t) ` +
+		`WITH t, count(m) AS P, collect(id(m)) AS mitigation_vids ` +
+		`RETURN t.tMitreTechnique.Technique_ID AS technique_id, ` +
+		`  t.tMitreTechnique.Technique_Name AS technique_name, ` +
+		`  t.tMitreTechnique.execution_min AS exec_min, ` +
+		`  t.tMitreTechnique.execution_max AS exec_max, ` +
+		`  P AS possible_mitigations, ` +
+		`  mitigation_vids AS mit_vids;`
+
+	rs1, err := executeWithParameter(ctx, session, "ComputeTTT Q1", q1, Params{"technique": techniqueVid})
 	if err != nil {
 		return nil, fmt.Errorf("ComputeTTT query1: %w", err)
 	}
@@ -96,24 +93,16 @@ func computeTTTWithSession(session *nebula.Session, assetVid, techniqueVid strin
 
 	// Query 2: Count active-applied mitigations on this asset from the P set.
 	if len(mitVids) > 0 {
-		quotedVids := make([]string, len(mitVids))
-		for i, v := range mitVids {
-			quotedVids[i] = fmt.Sprintf(`"%s"`, v)
-		}
-		vidListStr := strings.Join(quotedVids, ",")
-
-		q2 := fmt.Sprintf(
-			`MATCH (m2:tMitreMitigation)-[ap:applied_to]->(a:Asset) `+
-				`WHERE id(a) == "%s" AND id(m2) IN [%s] AND ap.Active == true `+
-				`RETURN count(m2) AS A, `+
-				`  CASE WHEN count(m2) > 0 THEN sum(ap.Maturity) ELSE 0 END AS maturity_sum;`,
-			assetVid, vidListStr)
+		const q2 = `MATCH (m2:tMitreMitigation)-[ap:applied_to]->(a:Asset) ` +
+			`WHERE id(a) == $asset AND id(m2) IN $mitigations AND ap.Active == true ` +
+			`RETURN count(m2) AS A, ` +
+			`  CASE WHEN count(m2) > 0 THEN sum(ap.Maturity) ELSE 0 END AS maturity_sum;`
 
-		rs2, err := session.Execute(q2)
+		rs2, err := executeWithParameter(ctx, session, "ComputeTTT Q2", q2, Params{"asset": assetVid, "mitigations": List(mitVids)})
 		if err != nil {
-			log.Printf("nebula: ComputeTTT query2 failed: %v", err)
+			slog.WarnContext(ctx, "nebula: ComputeTTT query2 failed", "asset", assetVid, "err", err)
 		} else if !rs2.IsSucceed() {
-			log.Printf("nebula: ComputeTTT query2: %s", rs2.GetErrorMsg())
+			slog.WarnContext(ctx, "nebula: ComputeTTT query2 failed", "asset", assetVid, "err", rs2.GetErrorMsg())
 		} else if rs2.GetRowSize() > 0 {
 			rec2, _ := rs2.GetRowValuesByIndex(0)
 			result.A = safeInt(rec2, 0, 0)
@@ -140,68 +129,80 @@ func computeTTTWithSession(session *nebula.Session, assetVid, techniqueVid strin
 // Returns (nil, nil) when the technique is not executable on the asset's OS platform (ALG-REQ-062).
 // This public wrapper opens its own session and performs the full OS pre-check,
 // preserving backward compatibility for standalone callers.
-func ComputeTTT(pool *nebula.ConnectionPool, cfg *config.Config, assetVid, techniqueVid string) (*TTTResult, error) {
-	session, err := openSession(pool, cfg)
+func ComputeTTT(ctx context.Context, pool *Pool, cfg *config.Config, assetVid, techniqueVid string) (*TTTResult, error) {
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return nil, err
 	}
 	defer session.Release()
-	return computeTTTWithSession(session, assetVid, techniqueVid, false)
+	return computeTTTWithSession(ctx, session, assetVid, techniqueVid, false)
+}
+
+// TechniqueTTTInput holds the per-technique inputs of the ALG-REQ-060 formula:
+// execution bounds, the number of possible mitigations (P) and their VIDs.
+type TechniqueTTTInput struct {
+	ExecMin float64
+	ExecMax float64
+	P       int
+	MitVids []string
 }
 
-// computeBatchTTT computes TTT for ALL technique candidates in a single batch
-// using exactly 2 nGQL queries (regardless of candidate count).
+// computeBatchTTT computes TTT for ALL technique candidates in a single batch.
 // Strategy C: Batch ComputeTTT per Tactic.
 //
-// Query 1 fetches technique properties (exec_min, exec_max) and possible
-// mitigation VIDs for every candidate technique in one round-trip.
-// Query 2 fetches active-applied mitigations on the asset for ALL unique
-// mitigation VIDs collected from Q1.
-//
-// The APP layer then maps Q2 results back to each technique and applies
-// the ALG-REQ-060 formula in-process.
+// The inputs are fetched through the TTBSource (2 nGQL queries for the Nebula
+// source, regardless of candidate count) and the APP layer then applies the
+// ALG-REQ-060 formula in-process via ApplyTTTFormula.
 //
 // Precondition: all candidates have already passed OS filtering (ALG-REQ-062)
 // so no OS pre-check is needed here.
-func computeBatchTTT(session *nebula.Session, assetVid string, candidates []techniqueCandidate, audit *store.AuditBuffer, pendingStepIdx int) error {
+func computeBatchTTT(ctx context.Context, src TTBSource, assetVid string, candidates []TechniqueCandidate, audit *store.AuditBuffer, pendingStepIdx int) error {
 	if len(candidates) == 0 {
 		return nil
 	}
 
-	// Build the IN list of technique VIDs for Q1
-	techVids := make([]string, len(candidates))
+	techIDs := make([]string, len(candidates))
 	for i, c := range candidates {
-		techVids[i] = fmt.Sprintf(`"%s"`, c.TechniqueID)
+		techIDs[i] = c.TechniqueID
 	}
 
-	q1 := fmt.Sprintf(
-		`MATCH (t:tMitreTechnique) `+
-			`WHERE id(t) IN [%s] `+
-			`OPTIONAL MATCH (t)<-[:mitigates]-(m_all:tMitreMitigation) `+
-			`WITH t, count(m_all) AS P, collect(id(m_all)) AS mit_vids `+
-			`RETURN id(t) AS technique_vid, `+
-			`  t.tMitreTechnique.execution_min AS exec_min, `+
-			`  t.tMitreTechnique.execution_max AS exec_max, `+
-			`  P AS possible_count, `+
-			`  mit_vids AS mitigation_vids;`,
-		strings.Join(techVids, ", "))
-
-	rs1, err := session.Execute(q1)
+	inputs, activeMitMap, err := src.TTTInputs(ctx, assetVid, techIDs)
 	if err != nil {
-		return fmt.Errorf("computeBatchTTT Q1: %w", err)
+		return err
+	}
+
+	ApplyTTTFormula(candidates, inputs, activeMitMap, audit, pendingStepIdx)
+	return nil
+}
+
+// queryBatchTTTInputs fetches the ALG-REQ-060 inputs for a set of techniques
+// using exactly 2 nGQL queries.
+//
+// Query 1 fetches technique properties (exec_min, exec_max) and possible
+// mitigation VIDs for every candidate technique in one round-trip.
+// Query 2 fetches active-applied mitigations on the asset for ALL unique
+// mitigation VIDs collected from Q1.
+func queryBatchTTTInputs(ctx context.Context, session *nebula.Session, assetVid string, techniqueIDs []string) (map[string]TechniqueTTTInput, map[string]int, error) {
+	const q1 = `MATCH (t:tMitreTechnique) ` +
+		`WHERE id(t) IN $techniques ` +
+		`OPTIONAL MATCH (t)<-[:mitigates]-(m_all:tMitreMitigation) ` +
+		`WITH t, count(m_all) AS P, collect(id(m_all)) AS mit_vids ` +
+		`RETURN id(t) AS technique_vid, ` +
+		`  t.tMitreTechnique.execution_min AS exec_min, ` +
+		`  t.tMitreTechnique.execution_max AS exec_max, ` +
+		`  P AS possible_count, ` +
+		`  mit_vids AS mitigation_vids;`
+
+	rs1, err := executeWithParameter(ctx, session, "computeBatchTTT Q1", q1, Params{"techniques": List(techniqueIDs)})
+	if err != nil {
+		return nil, nil, fmt.Errorf("computeBatchTTT Q1: %w", err)
 	}
 	if !rs1.IsSucceed() {
-		return fmt.Errorf("computeBatchTTT Q1: %s", rs1.GetErrorMsg())
+		return nil, nil, fmt.Errorf("computeBatchTTT Q1: %s", rs1.GetErrorMsg())
 	}
 
 	// Parse Q1 results into a map keyed by technique VID
-	type techInfo struct {
-		ExecMin float64
-		ExecMax float64
-		P       int
-		MitVids []string
-	}
-	techMap := make(map[string]*techInfo)
+	techMap := make(map[string]TechniqueTTTInput)
 	allMitVidsSet := make(map[string]bool)
 
 	for i := 0; i < rs1.GetRowSize(); i++ {
@@ -210,14 +211,13 @@ func computeBatchTTT(session *nebula.Session, assetVid string, candidates []tech
 		if vid == "" {
 			continue
 		}
-		info := &techInfo{
+		mitVids, _ := extractStringList(rec, 4)
+		techMap[vid] = TechniqueTTTInput{
 			ExecMin: safeFloat64(rec, 1, 0.1667),
 			ExecMax: safeFloat64(rec, 2, 120.0),
 			P:       safeInt(rec, 3, 0),
+			MitVids: mitVids,
 		}
-		mitVids, _ := extractStringList(rec, 4)
-		info.MitVids = mitVids
-		techMap[vid] = info
 
 		for _, mv := range mitVids {
 			allMitVidsSet[mv] = true
@@ -229,23 +229,21 @@ func computeBatchTTT(session *nebula.Session, assetVid string, candidates []tech
 	activeMitMap := make(map[string]int)
 
 	if len(allMitVidsSet) > 0 {
-		quotedMitVids := make([]string, 0, len(allMitVidsSet))
+		allMitVids := make([]string, 0, len(allMitVidsSet))
 		for mv := range allMitVidsSet {
-			quotedMitVids = append(quotedMitVids, fmt.Sprintf(`"%s"`, mv))
+			allMitVids = append(allMitVids, mv)
 		}
 
-		q2 := fmt.Sprintf(
-			`MATCH (m:tMitreMitigation)-[ap:applied_to]->(a:Asset) `+
-				`WHERE id(a) == "%s" AND id(m) IN [%s] AND ap.Active == true `+
-				`RETURN id(m) AS mit_vid, ap.Maturity AS maturity;`,
-			assetVid, strings.Join(quotedMitVids, ", "))
+		const q2 = `MATCH (m:tMitreMitigation)-[ap:applied_to]->(a:Asset) ` +
+			`WHERE id(a) == $asset AND id(m) IN $mitigations AND ap.Active == true ` +
+			`RETURN id(m) AS mit_vid, ap.Maturity AS maturity;`
 
-		rs2, err := session.Execute(q2)
+		rs2, err := executeWithParameter(ctx, session, "computeBatchTTT Q2", q2, Params{"asset": assetVid, "mitigations": List(allMitVids)})
 		if err != nil {
-			return fmt.Errorf("computeBatchTTT Q2: %w", err)
+			return nil, nil, fmt.Errorf("computeBatchTTT Q2: %w", err)
 		}
 		if !rs2.IsSucceed() {
-			return fmt.Errorf("computeBatchTTT Q2: %s", rs2.GetErrorMsg())
+			return nil, nil, fmt.Errorf("computeBatchTTT Q2: %s", rs2.GetErrorMsg())
 		}
 
 		for i := 0; i < rs2.GetRowSize(); i++ {
@@ -258,9 +256,16 @@ func computeBatchTTT(session *nebula.Session, assetVid string, candidates []tech
 		}
 	}
 
-	// Apply ALG-REQ-060 formula to each candidate in-place
+	return techMap, activeMitMap, nil
+}
+
+// ApplyTTTFormula applies the ALG-REQ-060 formula to each candidate in-place and
+// records one TTTDetailRecord per candidate (ADR-REQ-014) when audit is non-nil.
+// activeMaturity maps each active-applied mitigation VID on the asset to its Maturity.
+// Candidates missing from inputs get the unreachable sentinel TTT.
+func ApplyTTTFormula(candidates []TechniqueCandidate, inputs map[string]TechniqueTTTInput, activeMaturity map[string]int, audit *store.AuditBuffer, pendingStepIdx int) {
 	for j := range candidates {
-		info, ok := techMap[candidates[j].TechniqueID]
+		info, ok := inputs[candidates[j].TechniqueID]
 		if !ok {
 			candidates[j].TTT = 999999.0
 			continue
@@ -269,6 +274,7 @@ func computeBatchTTT(session *nebula.Session, assetVid string, candidates []tech
 		P := info.P
 		execMin := info.ExecMin
 		execMax := info.ExecMax
+		candidates[j].ExecMin, candidates[j].ExecMax = execMin, execMax
 
 		if P == 0 {
 			candidates[j].TTT = execMin
@@ -292,7 +298,7 @@ func computeBatchTTT(session *nebula.Session, assetVid string, candidates []tech
 		A := 0
 		maturityFactor := 0.0
 		for _, mv := range info.MitVids {
-			if mat, found := activeMitMap[mv]; found {
+			if mat, found := activeMaturity[mv]; found {
 				A++
 				maturityFactor += 0.01 * float64(mat)
 			}
@@ -323,6 +329,4 @@ func computeBatchTTT(session *nebula.Session, assetVid string, candidates []tech
 			})
 		}
 	}
-
-	return nil
 }
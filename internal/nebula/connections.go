@@ -0,0 +1,87 @@
+package nebula
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"ESP-data/config"
+)
+
+// ============================================================
+// Topology writes — connects_to (SCHEMA ED006)
+// ============================================================
+
+// Connection is one protocol/port combination of a connects_to edge (ED006).
+type Connection struct {
+	Protocol string `json:"protocol"`
+	Port     string `json:"port"`
+}
+
+// ReplaceConnections rewrites every connects_to edge from srcID to dstID.
+// Existing ranks are deleted first, then conns are inserted with ranks
+// 0..n-1 following the ED006 rank convention. An empty conns removes the link.
+func ReplaceConnections(ctx context.Context, pool *Pool, cfg *config.Config, srcID, dstID string, conns []Connection) error {
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return err
+	}
+	defer session.Release()
+
+	queryStart := time.Now()
+	slog.DebugContext(ctx, "nebula: ReplaceConnections executing",
+		"src", srcID, "dst", dstID, "connections", len(conns))
+
+	rankQuery := fmt.Sprintf(`GO FROM %s OVER connects_to
+WHERE dst(edge) == %s
+YIELD rank(edge) AS edge_rank;`, Literal(srcID), Literal(dstID))
+
+	rs, err := execute(ctx, session, "ReplaceConnections rank", rankQuery)
+	if err != nil {
+		return fmt.Errorf("query execution failed: %w", err)
+	}
+	if !rs.IsSucceed() {
+		return fmt.Errorf("query failed: %s", rs.GetErrorMsg())
+	}
+
+	if rs.GetRowSize() > 0 {
+		edges := make([]string, 0, rs.GetRowSize())
+		for i := 0; i < rs.GetRowSize(); i++ {
+			record, err := rs.GetRowValuesByIndex(i)
+			if err != nil {
+				continue
+			}
+			edges = append(edges, fmt.Sprintf(`%s -> %s @%d`, Literal(srcID), Literal(dstID), safeInt(record, 0, 0)))
+		}
+		deleteQuery := fmt.Sprintf(`DELETE EDGE connects_to %s;`, strings.Join(edges, ", "))
+		drs, err := execute(ctx, session, "ReplaceConnections delete", deleteQuery)
+		if err != nil {
+			return fmt.Errorf("delete execution failed: %w", err)
+		}
+		if !drs.IsSucceed() {
+			return fmt.Errorf("delete failed: %s", drs.GetErrorMsg())
+		}
+	}
+
+	if len(conns) > 0 {
+		values := make([]string, len(conns))
+		for rank, c := range conns {
+			values[rank] = fmt.Sprintf(`%s->%s@%d:(%s, %s)`, Literal(srcID), Literal(dstID), rank, Literal(c.Protocol), Literal(c.Port))
+		}
+		insertQuery := fmt.Sprintf(`INSERT EDGE connects_to(Connection_Protocol, Connection_Port) VALUES %s;`,
+			strings.Join(values, ", "))
+		irs, err := execute(ctx, session, "ReplaceConnections insert", insertQuery)
+		if err != nil {
+			return fmt.Errorf("insert execution failed: %w", err)
+		}
+		if !irs.IsSucceed() {
+			return fmt.Errorf("insert failed: %s", irs.GetErrorMsg())
+		}
+	}
+
+	slog.InfoContext(ctx, "nebula: ReplaceConnections completed",
+		"src", srcID, "dst", dstID, "elapsed", time.Since(queryStart))
+	return nil
+}
@@ -0,0 +1,335 @@
+package nebula
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"ESP-data/config"
+)
+
+// ============================================================
+// Detection controls — DetectionControl (TA012) with per-technique
+// coverage (detects, ED015), deployed on assets (monitors, ED016)
+// ============================================================
+
+// DetectionControl is a TA012 vertex with its detects edges: the percent
+// chance that one execution of a technique is detected, per technique.
+// DetectionTime is the hours from the end of a detected execution to the
+// alert.
+type DetectionControl struct {
+	ControlID     string         `json:"control_id"`
+	ControlName   string         `json:"control_name"`
+	Description   string         `json:"description,omitempty"`
+	DetectionTime float64        `json:"detection_time"`
+	Coverage      map[string]int `json:"coverage"`
+}
+
+// AssetDetection is one monitors edge of an asset.
+type AssetDetection struct {
+	ControlID   string `json:"control_id"`
+	ControlName string `json:"control_name"`
+	Active      bool   `json:"active"`
+}
+
+// DetectionCoverage is one technique detected by an active control on an
+// asset, as used by the time-to-detect calculation.
+type DetectionCoverage struct {
+	ControlID     string
+	TechniqueID   string
+	Coverage      int
+	DetectionTime float64
+}
+
+// QueryDetectionControls returns every detection control with its coverage,
+// sorted by ID. LOOKUP uses idx_detection_control_any; MATCH is used for
+// the detects edges, whose source tag has no property filter.
+func QueryDetectionControls(ctx context.Context, pool *Pool, cfg *config.Config) ([]DetectionControl, error) {
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Release()
+
+	queryStart := time.Now()
+
+	const controlQuery = `LOOKUP ON DetectionControl
+YIELD id(vertex) AS vid,
+  DetectionControl.Control_Name AS control_name,
+  DetectionControl.Description AS description,
+  DetectionControl.Detection_Time AS detection_time;`
+
+	rs, err := execute(ctx, session, "QueryDetectionControls", controlQuery)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	if !rs.IsSucceed() {
+		return nil, fmt.Errorf("query failed: %s", rs.GetErrorMsg())
+	}
+
+	byID := make(map[string]*DetectionControl, rs.GetRowSize())
+	controls := make([]DetectionControl, 0, rs.GetRowSize())
+	for i := 0; i < rs.GetRowSize(); i++ {
+		record, err := rs.GetRowValuesByIndex(i)
+		if err != nil {
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
+			continue
+		}
+		controls = append(controls, DetectionControl{
+			ControlID:     safeString(record, 0),
+			ControlName:   safeString(record, 1),
+			Description:   safeString(record, 2),
+			DetectionTime: safeFloat64(record, 3, 0),
+			Coverage:      make(map[string]int),
+		})
+	}
+	sort.Slice(controls, func(i, j int) bool { return controls[i].ControlID < controls[j].ControlID })
+	for i := range controls {
+		byID[controls[i].ControlID] = &controls[i]
+	}
+
+	const coverageQuery = `MATCH (d:DetectionControl)-[e:detects]->(t:tMitreTechnique)
+RETURN id(d) AS control_vid, id(t) AS technique_vid, e.Coverage AS coverage;`
+
+	crs, err := execute(ctx, session, "QueryDetectionControls coverage", coverageQuery)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	if !crs.IsSucceed() {
+		return nil, fmt.Errorf("query failed: %s", crs.GetErrorMsg())
+	}
+	for i := 0; i < crs.GetRowSize(); i++ {
+		record, err := crs.GetRowValuesByIndex(i)
+		if err != nil {
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
+			continue
+		}
+		if c, ok := byID[safeString(record, 0)]; ok {
+			c.Coverage[safeString(record, 1)] = safeInt(record, 2, 100)
+		}
+	}
+
+	slog.InfoContext(ctx, "nebula: QueryDetectionControls completed", "controls", len(controls),
+		"elapsed", time.Since(queryStart))
+	return controls, nil
+}
+
+// UpsertDetectionControl writes a control vertex and replaces its detects
+// edges with ctl.Coverage.
+func UpsertDetectionControl(ctx context.Context, pool *Pool, cfg *config.Config, ctl DetectionControl) error {
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return err
+	}
+	defer session.Release()
+
+	queryStart := time.Now()
+	slog.DebugContext(ctx, "nebula: UpsertDetectionControl executing", "control", ctl.ControlID,
+		"techniques", len(ctl.Coverage))
+
+	upsertQuery := fmt.Sprintf(`UPSERT VERTEX ON DetectionControl %s
+SET Control_ID = %s, Control_Name = %s, Description = %s, Detection_Time = %f;`,
+		Literal(ctl.ControlID), Literal(ctl.ControlID), Literal(ctl.ControlName), Literal(ctl.Description), ctl.DetectionTime)
+	rs, err := execute(ctx, session, "UpsertDetectionControl upsert", upsertQuery)
+	if err != nil {
+		return fmt.Errorf("upsert execution failed: %w", err)
+	}
+	if !rs.IsSucceed() {
+		return fmt.Errorf("upsert failed: %s", rs.GetErrorMsg())
+	}
+
+	edgeQuery := fmt.Sprintf(`GO FROM %s OVER detects YIELD dst(edge) AS technique_vid;`, Literal(ctl.ControlID))
+	ers, err := execute(ctx, session, "UpsertDetectionControl edges", edgeQuery)
+	if err != nil {
+		return fmt.Errorf("query execution failed: %w", err)
+	}
+	if !ers.IsSucceed() {
+		return fmt.Errorf("query failed: %s", ers.GetErrorMsg())
+	}
+	var stale []string
+	for i := 0; i < ers.GetRowSize(); i++ {
+		record, err := ers.GetRowValuesByIndex(i)
+		if err != nil {
+			continue
+		}
+		if tech := safeString(record, 0); ctl.Coverage[tech] == 0 {
+			stale = append(stale, fmt.Sprintf(`%s -> %s`, Literal(ctl.ControlID), Literal(tech)))
+		}
+	}
+	if len(stale) > 0 {
+		drs, err := execute(ctx, session, "UpsertDetectionControl delete",
+			fmt.Sprintf(`DELETE EDGE detects %s;`, strings.Join(stale, ", ")))
+		if err != nil {
+			return fmt.Errorf("delete execution failed: %w", err)
+		}
+		if !drs.IsSucceed() {
+			return fmt.Errorf("delete failed: %s", drs.GetErrorMsg())
+		}
+	}
+
+	if len(ctl.Coverage) > 0 {
+		techniques := make([]string, 0, len(ctl.Coverage))
+		for tech := range ctl.Coverage {
+			techniques = append(techniques, tech)
+		}
+		sort.Strings(techniques)
+		values := make([]string, len(techniques))
+		for i, tech := range techniques {
+			values[i] = fmt.Sprintf(`%s->%s:(%d)`, Literal(ctl.ControlID), Literal(tech), ctl.Coverage[tech])
+		}
+		irs, err := execute(ctx, session, "UpsertDetectionControl insert",
+			fmt.Sprintf(`INSERT EDGE detects(Coverage) VALUES %s;`, strings.Join(values, ", ")))
+		if err != nil {
+			return fmt.Errorf("insert execution failed: %w", err)
+		}
+		if !irs.IsSucceed() {
+			return fmt.Errorf("insert failed: %s", irs.GetErrorMsg())
+		}
+	}
+
+	slog.InfoContext(ctx, "nebula: UpsertDetectionControl completed", "control", ctl.ControlID,
+		"techniques", len(ctl.Coverage), "elapsed", time.Since(queryStart))
+	return nil
+}
+
+// QueryAssetDetections returns the detection controls deployed on an asset.
+func QueryAssetDetections(ctx context.Context, pool *Pool, cfg *config.Config, assetID string) ([]AssetDetection, error) {
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Release()
+
+	const query = `MATCH (d:DetectionControl)-[e:monitors]->(a:Asset)
+WHERE id(a) == $asset
+RETURN id(d) AS control_id, d.DetectionControl.Control_Name AS control_name, e.Active AS active
+ORDER BY control_id;`
+
+	queryStart := time.Now()
+	rs, err := executeWithParameter(ctx, session, "QueryAssetDetections", query, Params{"asset": assetID})
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	if !rs.IsSucceed() {
+		return nil, fmt.Errorf("query failed: %s", rs.GetErrorMsg())
+	}
+
+	detections := make([]AssetDetection, 0, rs.GetRowSize())
+	for i := 0; i < rs.GetRowSize(); i++ {
+		record, err := rs.GetRowValuesByIndex(i)
+		if err != nil {
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
+			continue
+		}
+		detections = append(detections, AssetDetection{
+			ControlID:   safeString(record, 0),
+			ControlName: safeString(record, 1),
+			Active:      safeBool(record, 2),
+		})
+	}
+
+	slog.InfoContext(ctx, "nebula: QueryAssetDetections completed", "asset", assetID,
+		"detections", len(detections), "elapsed", time.Since(queryStart))
+	return detections, nil
+}
+
+// UpsertAssetDetection adds or updates the monitors edge from a control to
+// an asset. @0 rank as for applied_to (ED001).
+func UpsertAssetDetection(ctx context.Context, pool *Pool, cfg *config.Config, controlID, assetID string, active bool) error {
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return err
+	}
+	defer session.Release()
+
+	query := fmt.Sprintf(`UPSERT EDGE ON monitors %s -> %s @0 SET Active = %t;`,
+		Literal(controlID), Literal(assetID), active)
+
+	queryStart := time.Now()
+	rs, err := execute(ctx, session, "UpsertAssetDetection", query)
+	slog.InfoContext(ctx, "nebula: UpsertAssetDetection completed", "control", controlID, "asset", assetID,
+		"active", active, "elapsed", time.Since(queryStart))
+	if err != nil {
+		return fmt.Errorf("upsert execution failed: %w", err)
+	}
+	if !rs.IsSucceed() {
+		return fmt.Errorf("upsert failed: %s", rs.GetErrorMsg())
+	}
+	return nil
+}
+
+// DeleteAssetDetection removes the monitors edge from a control to an asset.
+func DeleteAssetDetection(ctx context.Context, pool *Pool, cfg *config.Config, controlID, assetID string) error {
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return err
+	}
+	defer session.Release()
+
+	query := `DELETE EDGE monitors ` + Literal(controlID) + ` -> ` + Literal(assetID) + ` @0;`
+
+	queryStart := time.Now()
+	rs, err := execute(ctx, session, "DeleteAssetDetection", query)
+	slog.InfoContext(ctx, "nebula: DeleteAssetDetection completed", "control", controlID, "asset", assetID,
+		"elapsed", time.Since(queryStart))
+	if err != nil {
+		return fmt.Errorf("delete execution failed: %w", err)
+	}
+	if !rs.IsSucceed() {
+		return fmt.Errorf("delete failed: %s", rs.GetErrorMsg())
+	}
+	return nil
+}
+
+// QueryDetectionCoverage returns, per asset of assetIDs, the techniques
+// detected by the active controls deployed on it. Assets without an active
+// control are absent from the map.
+func QueryDetectionCoverage(ctx context.Context, pool *Pool, cfg *config.Config, assetIDs []string) (map[string][]DetectionCoverage, error) {
+	result := make(map[string][]DetectionCoverage)
+	if len(assetIDs) == 0 {
+		return result, nil
+	}
+
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Release()
+
+	const query = `MATCH (t:tMitreTechnique)<-[e:detects]-(d:DetectionControl)-[m:monitors]->(a:Asset)
+WHERE id(a) IN $assets AND (m.Active IS NULL OR m.Active == true)
+RETURN id(a) AS asset_vid, id(d) AS control_vid, id(t) AS technique_vid,
+  e.Coverage AS coverage, d.DetectionControl.Detection_Time AS detection_time
+ORDER BY asset_vid, control_vid, technique_vid;`
+
+	queryStart := time.Now()
+	rs, err := executeWithParameter(ctx, session, "QueryDetectionCoverage", query, Params{"assets": List(assetIDs)})
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	if !rs.IsSucceed() {
+		return nil, fmt.Errorf("query failed: %s", rs.GetErrorMsg())
+	}
+
+	for i := 0; i < rs.GetRowSize(); i++ {
+		record, err := rs.GetRowValuesByIndex(i)
+		if err != nil {
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
+			continue
+		}
+		asset := safeString(record, 0)
+		result[asset] = append(result[asset], DetectionCoverage{
+			ControlID:     safeString(record, 1),
+			TechniqueID:   safeString(record, 2),
+			Coverage:      safeInt(record, 3, 100),
+			DetectionTime: safeFloat64(record, 4, 0),
+		})
+	}
+
+	slog.DebugContext(ctx, "nebula: QueryDetectionCoverage completed", "assets", len(assetIDs),
+		"covered", len(result), "elapsed", time.Since(queryStart))
+	return result, nil
+}
@@ -1,14 +1,12 @@
 package nebula
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"strings"
+	"log/slog"
 	"time"
 
 	"ESP-data/config"
-
-	nebula "github.com/vesoft-inc/nebula-go/v3"
 )
 
 // ============================================================
@@ -29,8 +27,8 @@ type StaleAssetHash struct {
 // QueryStaleHashes executes the hash computation query (ALG-REQ-042) for all
 // assets with hash_valid == false. Hash is computed entirely in the database
 // using hash() + concat_ws() + collect() + reduce() to minimise data transfer.
-func QueryStaleHashes(pool *nebula.ConnectionPool, cfg *config.Config) ([]StaleAssetHash, error) {
-	session, err := openSession(pool, cfg)
+func QueryStaleHashes(ctx context.Context, pool *Pool, cfg *config.Config) ([]StaleAssetHash, error) {
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -66,13 +64,10 @@ RETURN
   )) AS computed_hash;`
 
 	queryStart := time.Now()
-	log.Printf("[%s] nebula: QueryStaleHashes executing hash computation query",
-		queryStart.Format("15:04:05.000"))
+	slog.DebugContext(ctx, "nebula: QueryStaleHashes executing hash computation query")
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := execute(ctx, session, "QueryStaleHashes", query)
 	queryDuration := time.Since(queryStart)
-	log.Printf("[%s] nebula: QueryStaleHashes completed in %.3f seconds",
-		time.Now().Format("15:04:05.000"), queryDuration.Seconds())
 
 	if err != nil {
 		return nil, fmt.Errorf("query execution failed: %w", err)
@@ -85,7 +80,7 @@ RETURN
 	for i := 0; i < resultSet.GetRowSize(); i++ {
 		record, err := resultSet.GetRowValuesByIndex(i)
 		if err != nil {
-			log.Printf("nebula: skipping row %d: %v", i, err)
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
 			continue
 		}
 		results = append(results, StaleAssetHash{
@@ -96,31 +91,25 @@ RETURN
 		})
 	}
 
-	log.Printf("nebula: QueryStaleHashes returned %d stale assets", len(results))
+	slog.InfoContext(ctx, "nebula: QueryStaleHashes completed", "stale", len(results), "elapsed", queryDuration)
 	return results, nil
 }
 
 // QueryScopedStaleHashes runs the same hash computation as QueryStaleHashes
 // but scoped to a specific set of asset IDs (ALG-REQ-046 step 4).
-func QueryScopedStaleHashes(pool *nebula.ConnectionPool, cfg *config.Config, assetIDs []string) ([]StaleAssetHash, error) {
+func QueryScopedStaleHashes(ctx context.Context, pool *Pool, cfg *config.Config, assetIDs []string) ([]StaleAssetHash, error) {
 	if len(assetIDs) == 0 {
 		return nil, nil
 	}
 
-	session, err := openSession(pool, cfg)
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return nil, err
 	}
 	defer session.Release()
 
-	quoted := make([]string, len(assetIDs))
-	for i, id := range assetIDs {
-		quoted[i] = fmt.Sprintf(`"%s"`, id)
-	}
-	inList := strings.Join(quoted, ", ")
-
-	query := fmt.Sprintf(`MATCH (a:Asset)
-WHERE a.Asset.Asset_ID IN [%s] AND a.Asset.hash_valid == false
+	const query = `MATCH (a:Asset)
+WHERE a.Asset.Asset_ID IN $assets AND a.Asset.hash_valid == false
 OPTIONAL MATCH (src:Asset)-[c:connects_to]->(a)
 WITH a, src, c,
   src.Asset.Asset_ID AS src_id,
@@ -146,16 +135,13 @@ RETURN
     toString(a.Asset.has_vulnerability),
     os.OS_Type.OS_Name,
     t.Asset_Type.Type_Name
-  )) AS computed_hash;`, inList)
+  )) AS computed_hash;`
 
 	queryStart := time.Now()
-	log.Printf("[%s] nebula: QueryScopedStaleHashes executing for %d assets",
-		queryStart.Format("15:04:05.000"), len(assetIDs))
+	slog.DebugContext(ctx, "nebula: QueryScopedStaleHashes executing", "assets", len(assetIDs))
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := executeWithParameter(ctx, session, "QueryScopedStaleHashes", query, Params{"assets": List(assetIDs)})
 	queryDuration := time.Since(queryStart)
-	log.Printf("[%s] nebula: QueryScopedStaleHashes completed in %.3f seconds",
-		time.Now().Format("15:04:05.000"), queryDuration.Seconds())
 
 	if err != nil {
 		return nil, fmt.Errorf("query execution failed: %w", err)
@@ -168,7 +154,7 @@ RETURN
 	for i := 0; i < resultSet.GetRowSize(); i++ {
 		record, err := resultSet.GetRowValuesByIndex(i)
 		if err != nil {
-			log.Printf("nebula: skipping row %d: %v", i, err)
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
 			continue
 		}
 		results = append(results, StaleAssetHash{
@@ -179,23 +165,24 @@ RETURN
 		})
 	}
 
-	log.Printf("nebula: QueryScopedStaleHashes returned %d stale assets", len(results))
+	slog.InfoContext(ctx, "nebula: QueryScopedStaleHashes completed", "assets", len(assetIDs),
+		"stale", len(results), "elapsed", queryDuration)
 	return results, nil
 }
 
 // UpdateAssetTTBAndHash writes the new TTB, hash, and sets hash_valid = true
 // for a single asset (ALG-REQ-045 step 2b).
-func UpdateAssetTTBAndHash(pool *nebula.ConnectionPool, cfg *config.Config, assetID string, newTTB float64, hashStr string) error {
-	session, err := openSession(pool, cfg)
+func UpdateAssetTTBAndHash(ctx context.Context, pool *Pool, cfg *config.Config, assetID string, newTTB float64, hashStr string) error {
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return err
 	}
 	defer session.Release()
 
-	query := fmt.Sprintf(`UPDATE VERTEX ON Asset "%s" SET TTB = %f, hash = "%s", hash_valid = true;`,
-		assetID, newTTB, hashStr)
+	query := fmt.Sprintf(`UPDATE VERTEX ON Asset %s SET TTB = %f, hash = %s, hash_valid = true;`,
+		Literal(assetID), newTTB, Literal(hashStr))
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := execute(ctx, session, "UpdateAssetTTBAndHash", query)
 	if err != nil {
 		return fmt.Errorf("update execution failed: %w", err)
 	}
@@ -209,13 +196,13 @@ func UpdateAssetTTBAndHash(pool *nebula.ConnectionPool, cfg *config.Config, asse
 // after path-scoped recalculation (ALG-REQ-046 cleanup, UI-REQ-112A).
 // Uses a WHEN guard to avoid negative values. Best-effort — errors are logged
 // but do not propagate to the caller.
-func DecrementStaleCount(pool *nebula.ConnectionPool, cfg *config.Config, count int) {
+func DecrementStaleCount(ctx context.Context, pool *Pool, cfg *config.Config, count int) {
 	if count <= 0 {
 		return
 	}
-	session, err := openSession(pool, cfg)
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
-		log.Printf("nebula: DecrementStaleCount failed to open session: %v", err)
+		slog.ErrorContext(ctx, "nebula: DecrementStaleCount failed to open session", "err", err)
 		return
 	}
 	defer session.Release()
@@ -227,63 +214,65 @@ func DecrementStaleCount(pool *nebula.ConnectionPool, cfg *config.Config, count
 			`WHEN stale_count >= %d;`,
 		count, count)
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := execute(ctx, session, "DecrementStaleCount", query)
 	if err != nil {
-		log.Printf("nebula: DecrementStaleCount failed: %v", err)
+		slog.ErrorContext(ctx, "nebula: DecrementStaleCount failed", "err", err)
 		return
 	}
 	if !resultSet.IsSucceed() {
 		// WHEN condition was false (stale_count < count) — floor to 0.
 		query2 := `UPDATE VERTEX ON SystemState "SYS001" SET stale_count = 0 WHEN stale_count > 0;`
-		if rs2, err2 := session.Execute(query2); err2 != nil {
-			log.Printf("nebula: DecrementStaleCount fallback failed: %v", err2)
+		if rs2, err2 := execute(ctx, session, "DecrementStaleCount floor", query2); err2 != nil {
+			slog.ErrorContext(ctx, "nebula: DecrementStaleCount fallback failed", "err", err2)
 		} else if !rs2.IsSucceed() {
-			log.Printf("nebula: DecrementStaleCount fallback failed: %s", rs2.GetErrorMsg())
+			slog.ErrorContext(ctx, "nebula: DecrementStaleCount fallback failed", "err", rs2.GetErrorMsg())
 		}
 		return
 	}
-	log.Printf("nebula: decremented stale_count by %d", count)
+	slog.InfoContext(ctx, "nebula: decremented stale_count", "by", count)
 }
 
 // InvalidateAssetHash sets hash_valid = false on an asset and increments
 // stale_count on SystemState (ALG-REQ-043). Best-effort — errors are logged
 // but do not propagate to the caller.
-func InvalidateAssetHash(pool *nebula.ConnectionPool, cfg *config.Config, assetID string) {
-	session, err := openSession(pool, cfg)
+func InvalidateAssetHash(ctx context.Context, pool *Pool, cfg *config.Config, assetID string) {
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
-		log.Printf("nebula: InvalidateAssetHash failed to open session: %v", err)
+		slog.ErrorContext(ctx, "nebula: InvalidateAssetHash failed to open session", "asset", assetID, "err", err)
 		return
 	}
 	defer session.Release()
 
-	query := fmt.Sprintf(`UPDATE VERTEX ON Asset "%s" SET hash_valid = false;`, assetID)
-	resultSet, err := session.Execute(query)
+	query := `UPDATE VERTEX ON Asset ` + Literal(assetID) + ` SET hash_valid = false;`
+	resultSet, err := execute(ctx, session, "InvalidateAssetHash asset", query)
 	if err != nil {
-		log.Printf("nebula: InvalidateAssetHash (asset) failed for %s: %v", assetID, err)
+		slog.ErrorContext(ctx, "nebula: InvalidateAssetHash (asset) failed", "asset", assetID, "err", err)
 		return
 	}
 	if !resultSet.IsSucceed() {
-		log.Printf("nebula: InvalidateAssetHash (asset) failed for %s: %s", assetID, resultSet.GetErrorMsg())
+		slog.ErrorContext(ctx, "nebula: InvalidateAssetHash (asset) failed", "asset", assetID,
+			"err", resultSet.GetErrorMsg())
 		return
 	}
 
 	query2 := `UPDATE VERTEX ON SystemState "SYS001" SET stale_count = stale_count + 1;`
-	resultSet2, err := session.Execute(query2)
+	resultSet2, err := execute(ctx, session, "InvalidateAssetHash SystemState", query2)
 	if err != nil {
-		log.Printf("nebula: InvalidateAssetHash (SystemState) failed: %v", err)
+		slog.ErrorContext(ctx, "nebula: InvalidateAssetHash (SystemState) failed", "asset", assetID, "err", err)
 		return
 	}
 	if !resultSet2.IsSucceed() {
-		log.Printf("nebula: InvalidateAssetHash (SystemState) failed: %s", resultSet2.GetErrorMsg())
+		slog.ErrorContext(ctx, "nebula: InvalidateAssetHash (SystemState) failed", "asset", assetID,
+			"err", resultSet2.GetErrorMsg())
 		return
 	}
 
-	log.Printf("nebula: invalidated hash for asset %s", assetID)
+	slog.InfoContext(ctx, "nebula: invalidated hash", "asset", assetID)
 }
 
 // QuerySystemState fetches the SystemState vertex (ALG-REQ-048).
-func QuerySystemState(pool *nebula.ConnectionPool, cfg *config.Config) (map[string]interface{}, error) {
-	session, err := openSession(pool, cfg)
+func QuerySystemState(ctx context.Context, pool *Pool, cfg *config.Config) (map[string]interface{}, error) {
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -296,7 +285,7 @@ YIELD SystemState.state_id AS state_id,
       SystemState.total_assets AS total_assets,
       SystemState.stale_count AS stale_count;`
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := execute(ctx, session, "QuerySystemState", query)
 	if err != nil {
 		return nil, fmt.Errorf("query execution failed: %w", err)
 	}
@@ -323,8 +312,8 @@ YIELD SystemState.state_id AS state_id,
 
 // UpdateSystemState writes the updated Merkle root and resets stale_count
 // after bulk recalculation (ALG-REQ-045 step 3).
-func UpdateSystemState(pool *nebula.ConnectionPool, cfg *config.Config, merkleRoot int64, totalAssets int) error {
-	session, err := openSession(pool, cfg)
+func UpdateSystemState(ctx context.Context, pool *Pool, cfg *config.Config, merkleRoot int64, totalAssets int) error {
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return err
 	}
@@ -336,7 +325,7 @@ SET merkle_root = %d,
     total_assets = %d,
     stale_count = 0;`, merkleRoot, totalAssets)
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := execute(ctx, session, "UpdateSystemState", query)
 	if err != nil {
 		return fmt.Errorf("update execution failed: %w", err)
 	}
@@ -350,8 +339,8 @@ SET merkle_root = %d,
 // (ALG-REQ-047). Returns the Merkle root and the total asset count.
 // All hashing is done by NebulaGraph's built-in hash() function —
 // no hashing libraries needed in the APP layer.
-func ComputeMerkleRoot(pool *nebula.ConnectionPool, cfg *config.Config) (int64, int, error) {
-	session, err := openSession(pool, cfg)
+func ComputeMerkleRoot(ctx context.Context, pool *Pool, cfg *config.Config) (int64, int, error) {
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -365,13 +354,10 @@ YIELD Asset.Asset_ID AS asset_id, Asset.hash AS hash
          $-.total AS total;`
 
 	queryStart := time.Now()
-	log.Printf("[%s] nebula: ComputeMerkleRoot executing",
-		queryStart.Format("15:04:05.000"))
+	slog.DebugContext(ctx, "nebula: ComputeMerkleRoot executing")
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := execute(ctx, session, "ComputeMerkleRoot", query)
 	queryDuration := time.Since(queryStart)
-	log.Printf("[%s] nebula: ComputeMerkleRoot completed in %.3f seconds",
-		time.Now().Format("15:04:05.000"), queryDuration.Seconds())
 
 	if err != nil {
 		return 0, 0, fmt.Errorf("query execution failed: %w", err)
@@ -391,35 +377,30 @@ YIELD Asset.Asset_ID AS asset_id, Asset.hash AS hash
 	merkleRoot := safeInt64(record, 0)
 	total := safeInt(record, 1, 0)
 
-	log.Printf("nebula: ComputeMerkleRoot = %d (total assets: %d)", merkleRoot, total)
+	slog.InfoContext(ctx, "nebula: ComputeMerkleRoot completed", "merkle_root", merkleRoot,
+		"total_assets", total, "elapsed", queryDuration)
 	return merkleRoot, total, nil
 }
 
 // QueryAssetHashValidity fetches hash_valid and TTB for a specific set of
 // asset IDs (ALG-REQ-046 step 3). Uses FETCH PROP for direct VID lookup.
-func QueryAssetHashValidity(pool *nebula.ConnectionPool, cfg *config.Config, assetIDs []string) (map[string]bool, map[string]float64, error) {
+func QueryAssetHashValidity(ctx context.Context, pool *Pool, cfg *config.Config, assetIDs []string) (map[string]bool, map[string]float64, error) {
 	if len(assetIDs) == 0 {
 		return nil, nil, nil
 	}
 
-	session, err := openSession(pool, cfg)
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return nil, nil, err
 	}
 	defer session.Release()
 
-	quoted := make([]string, len(assetIDs))
-	for i, id := range assetIDs {
-		quoted[i] = fmt.Sprintf(`"%s"`, id)
-	}
-	vidList := strings.Join(quoted, ", ")
-
-	query := fmt.Sprintf(`FETCH PROP ON Asset %s
+	query := `FETCH PROP ON Asset ` + LiteralList(assetIDs) + `
 YIELD Asset.Asset_ID AS asset_id,
       Asset.hash_valid AS hash_valid,
-      Asset.TTB AS ttb;`, vidList)
+      Asset.TTB AS ttb;`
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := execute(ctx, session, "QueryAssetHashValidity", query)
 	if err != nil {
 		return nil, nil, fmt.Errorf("query execution failed: %w", err)
 	}
@@ -441,3 +422,44 @@ YIELD Asset.Asset_ID AS asset_id,
 
 	return validity, ttbs, nil
 }
+
+// QueryAssetHashes fetches the stored hash of each asset whose hash_valid is
+// true (ALG-REQ-053 optional cache key). Assets with a stale or empty hash are
+// left out, so callers never key a cache on a hash that no longer describes
+// the asset.
+func QueryAssetHashes(ctx context.Context, pool *Pool, cfg *config.Config, assetIDs []string) (map[string]string, error) {
+	if len(assetIDs) == 0 {
+		return nil, nil
+	}
+
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Release()
+
+	query := `FETCH PROP ON Asset ` + LiteralList(assetIDs) + `
+YIELD Asset.Asset_ID AS asset_id,
+      Asset.hash_valid AS hash_valid,
+      Asset.hash AS hash;`
+
+	resultSet, err := execute(ctx, session, "QueryAssetHashes", query)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	if !resultSet.IsSucceed() {
+		return nil, fmt.Errorf("query failed: %s", resultSet.GetErrorMsg())
+	}
+
+	hashes := make(map[string]string, resultSet.GetRowSize())
+	for i := 0; i < resultSet.GetRowSize(); i++ {
+		record, err := resultSet.GetRowValuesByIndex(i)
+		if err != nil {
+			continue
+		}
+		if h := safeString(record, 2); safeBool(record, 1) && h != "" {
+			hashes[safeString(record, 0)] = h
+		}
+	}
+	return hashes, nil
+}
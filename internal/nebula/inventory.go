@@ -0,0 +1,265 @@
+package nebula
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"ESP-data/config"
+)
+
+// ============================================================
+// Asset inventory — Asset (TA001) with has_type (ED007),
+// belongs_to (ED002) and runs_on (ED011); invariants DI-01..DI-03
+// ============================================================
+
+// AssetRecord is the inventory view of one Asset: its own properties plus
+// the VIDs of the single has_type, belongs_to and runs_on targets.
+// When the graph violates DI-01..DI-03 the ID fields hold every target
+// joined with "," (or "" when the edge is missing).
+type AssetRecord struct {
+	AssetID          string `json:"asset_id"`
+	AssetName        string `json:"asset_name"`
+	Description      string `json:"asset_description"`
+	Note             string `json:"asset_note"`
+	IsEntrance       bool   `json:"is_entrance"`
+	IsTarget         bool   `json:"is_target"`
+	Priority         int    `json:"priority"`
+	HasVulnerability bool   `json:"has_vulnerability"`
+	TypeID           string `json:"type_id"`
+	SegmentID        string `json:"segment_id"`
+	OSID             string `json:"os_id"`
+}
+
+// InventoryCatalog maps reference names to VIDs for the vertices an Asset
+// points at: Asset_Type (TA002), Network_Segment (TA003) and OS_Type (TA004).
+type InventoryCatalog struct {
+	AssetTypes map[string]string `json:"asset_types"`
+	Segments   map[string]string `json:"segments"`
+	OSTypes    map[string]string `json:"os_types"`
+}
+
+// QueryInventory fetches every Asset with its has_type, belongs_to and
+// runs_on targets. OPTIONAL MATCH is used on purpose: unlike the REQ-043
+// read paths, the importer must also see assets that violate DI-01..DI-03.
+func QueryInventory(ctx context.Context, pool *Pool, cfg *config.Config) ([]AssetRecord, error) {
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Release()
+
+	query := `MATCH (a:Asset)
+OPTIONAL MATCH (a)-[:has_type]->(t:Asset_Type)
+WITH a, collect(DISTINCT id(t)) AS type_ids
+OPTIONAL MATCH (a)-[:belongs_to]->(s:Network_Segment)
+WITH a, type_ids, collect(DISTINCT id(s)) AS segment_ids
+OPTIONAL MATCH (a)-[:runs_on]->(os:OS_Type)
+WITH a, type_ids, segment_ids, collect(DISTINCT id(os)) AS os_ids
+RETURN
+  id(a)                       AS asset_id,
+  a.Asset.Asset_Name          AS asset_name,
+  a.Asset.Asset_Description   AS asset_description,
+  a.Asset.Asset_Note          AS asset_note,
+  a.Asset.is_entrance         AS is_entrance,
+  a.Asset.is_target           AS is_target,
+  a.Asset.priority            AS priority,
+  a.Asset.has_vulnerability   AS has_vulnerability,
+  type_ids,
+  segment_ids,
+  os_ids;`
+
+	queryStart := time.Now()
+	slog.DebugContext(ctx, "nebula: QueryInventory executing MATCH query")
+
+	resultSet, err := execute(ctx, session, "QueryInventory", query)
+	queryDuration := time.Since(queryStart)
+
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	if !resultSet.IsSucceed() {
+		return nil, fmt.Errorf("query failed: %s", resultSet.GetErrorMsg())
+	}
+
+	records := make([]AssetRecord, 0, resultSet.GetRowSize())
+	for i := 0; i < resultSet.GetRowSize(); i++ {
+		record, err := resultSet.GetRowValuesByIndex(i)
+		if err != nil {
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
+			continue
+		}
+		typeIDs, _ := extractStringList(record, 8)
+		segmentIDs, _ := extractStringList(record, 9)
+		osIDs, _ := extractStringList(record, 10)
+
+		records = append(records, AssetRecord{
+			AssetID:          safeString(record, 0),
+			AssetName:        safeString(record, 1),
+			Description:      safeString(record, 2),
+			Note:             safeString(record, 3),
+			IsEntrance:       safeBool(record, 4),
+			IsTarget:         safeBool(record, 5),
+			Priority:         safeInt(record, 6, 4),
+			HasVulnerability: safeBool(record, 7),
+			TypeID:           joinIDs(typeIDs),
+			SegmentID:        joinIDs(segmentIDs),
+			OSID:             joinIDs(osIDs),
+		})
+	}
+
+	slog.InfoContext(ctx, "nebula: QueryInventory completed", "assets", len(records), "elapsed", queryDuration)
+	return records, nil
+}
+
+// joinIDs renders a target VID list in a stable order.
+func joinIDs(ids []string) string {
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+// QueryInventoryCatalog fetches the name → VID maps for Asset_Type,
+// Network_Segment and OS_Type using the idx_*_any tag indexes.
+func QueryInventoryCatalog(ctx context.Context, pool *Pool, cfg *config.Config) (*InventoryCatalog, error) {
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Release()
+
+	catalog := &InventoryCatalog{
+		AssetTypes: make(map[string]string),
+		Segments:   make(map[string]string),
+		OSTypes:    make(map[string]string),
+	}
+	lookups := []struct {
+		query  string
+		target map[string]string
+	}{
+		{`LOOKUP ON Asset_Type YIELD id(vertex) AS vid, Asset_Type.Type_Name AS name;`, catalog.AssetTypes},
+		{`LOOKUP ON Network_Segment YIELD id(vertex) AS vid, Network_Segment.Segment_Name AS name;`, catalog.Segments},
+		{`LOOKUP ON OS_Type YIELD id(vertex) AS vid, OS_Type.OS_Name AS name;`, catalog.OSTypes},
+	}
+
+	queryStart := time.Now()
+	slog.DebugContext(ctx, "nebula: QueryInventoryCatalog executing LOOKUP queries")
+
+	for _, l := range lookups {
+		resultSet, err := execute(ctx, session, "QueryInventoryCatalog", l.query)
+		if err != nil {
+			return nil, fmt.Errorf("query execution failed: %w", err)
+		}
+		if !resultSet.IsSucceed() {
+			return nil, fmt.Errorf("query failed: %s", resultSet.GetErrorMsg())
+		}
+		for i := 0; i < resultSet.GetRowSize(); i++ {
+			record, err := resultSet.GetRowValuesByIndex(i)
+			if err != nil {
+				slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
+				continue
+			}
+			l.target[safeString(record, 1)] = safeString(record, 0)
+		}
+	}
+
+	slog.InfoContext(ctx, "nebula: QueryInventoryCatalog completed", "elapsed", time.Since(queryStart),
+		"types", len(catalog.AssetTypes), "segments", len(catalog.Segments), "os_types", len(catalog.OSTypes))
+	return catalog, nil
+}
+
+// UpsertAsset writes the Asset properties and re-points its has_type,
+// belongs_to and runs_on edges so that exactly one of each remains
+// (DI-01, DI-02, DI-03). UPSERT is used instead of INSERT so that TTB,
+// hash and hash_valid of an existing asset survive the update.
+func UpsertAsset(ctx context.Context, pool *Pool, cfg *config.Config, rec AssetRecord) error {
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return err
+	}
+	defer session.Release()
+
+	queryStart := time.Now()
+	slog.DebugContext(ctx, "nebula: UpsertAsset executing", "asset", rec.AssetID)
+
+	// Free-text properties are escaped with Literal so that quotes in CMDB
+	// descriptions cannot break the statement.
+	upsertQuery := fmt.Sprintf(`UPSERT VERTEX ON Asset %s
+SET Asset_ID = %s, Asset_Name = %s, Asset_Description = %s, Asset_Note = %s,
+    is_entrance = %t, is_target = %t, priority = %d, has_vulnerability = %t;`,
+		Literal(rec.AssetID), Literal(rec.AssetID), Literal(rec.AssetName), Literal(rec.Description), Literal(rec.Note),
+		rec.IsEntrance, rec.IsTarget, rec.Priority, rec.HasVulnerability)
+
+	rs, err := execute(ctx, session, "UpsertAsset upsert", upsertQuery)
+	if err != nil {
+		return fmt.Errorf("upsert execution failed: %w", err)
+	}
+	if !rs.IsSucceed() {
+		return fmt.Errorf("upsert failed: %s", rs.GetErrorMsg())
+	}
+
+	wanted := map[string]string{
+		"has_type":   rec.TypeID,
+		"belongs_to": rec.SegmentID,
+		"runs_on":    rec.OSID,
+	}
+
+	edgeQuery := fmt.Sprintf(`GO FROM %s OVER has_type, belongs_to, runs_on
+YIELD type(edge) AS edge_type, dst(edge) AS dst_id, rank(edge) AS edge_rank;`, Literal(rec.AssetID))
+
+	ers, err := execute(ctx, session, "UpsertAsset edges", edgeQuery)
+	if err != nil {
+		return fmt.Errorf("query execution failed: %w", err)
+	}
+	if !ers.IsSucceed() {
+		return fmt.Errorf("query failed: %s", ers.GetErrorMsg())
+	}
+
+	// Only the wanted edge at rank 0 is kept: any other edge of the three
+	// types, at any rank, would break DI-01..DI-03 (exactly one).
+	present := make(map[string]bool)
+	for i := 0; i < ers.GetRowSize(); i++ {
+		record, err := ers.GetRowValuesByIndex(i)
+		if err != nil {
+			continue
+		}
+		edgeType := safeString(record, 0)
+		dstID := safeString(record, 1)
+		rank := safeInt(record, 2, 0)
+		if wanted[edgeType] == dstID && rank == 0 {
+			present[edgeType] = true
+			continue
+		}
+		deleteQuery := fmt.Sprintf(`DELETE EDGE %s %s -> %s@%d;`, edgeType, Literal(rec.AssetID), Literal(dstID), rank)
+		drs, err := execute(ctx, session, "UpsertAsset delete", deleteQuery)
+		if err != nil {
+			return fmt.Errorf("delete execution failed: %w", err)
+		}
+		if !drs.IsSucceed() {
+			return fmt.Errorf("delete failed: %s", drs.GetErrorMsg())
+		}
+	}
+
+	inserts := []struct{ edgeType, stmt string }{
+		{"has_type", `INSERT EDGE has_type(assigned_date) VALUES %s->%s:(datetime());`},
+		{"belongs_to", `INSERT EDGE belongs_to() VALUES %s->%s:();`},
+		{"runs_on", `INSERT EDGE runs_on(installation_date) VALUES %s->%s:(datetime());`},
+	}
+	for _, ins := range inserts {
+		if present[ins.edgeType] {
+			continue
+		}
+		irs, err := execute(ctx, session, "UpsertAsset insert", fmt.Sprintf(ins.stmt, Literal(rec.AssetID), Literal(wanted[ins.edgeType])))
+		if err != nil {
+			return fmt.Errorf("insert execution failed: %w", err)
+		}
+		if !irs.IsSucceed() {
+			return fmt.Errorf("insert failed: %s", irs.GetErrorMsg())
+		}
+	}
+
+	slog.InfoContext(ctx, "nebula: UpsertAsset completed", "asset", rec.AssetID, "elapsed", time.Since(queryStart))
+	return nil
+}
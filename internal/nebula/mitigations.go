@@ -1,13 +1,12 @@
 package nebula
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"ESP-data/config"
-
-	nebula "github.com/vesoft-inc/nebula-go/v3"
 )
 
 // ============================================================
@@ -16,8 +15,8 @@ import (
 
 // QueryMitigations fetches all MITRE mitigations for the editor dropdown (REQ-033).
 // Uses pure nGQL LOOKUP per REQ-243.
-func QueryMitigations(pool *nebula.ConnectionPool, cfg *config.Config) ([]map[string]interface{}, error) {
-	session, err := openSession(pool, cfg)
+func QueryMitigations(ctx context.Context, pool *Pool, cfg *config.Config) ([]map[string]interface{}, error) {
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -31,11 +30,10 @@ YIELD
   tMitreMitigation.Mitigation_Name AS mitigation_name;`
 
 	queryStart := time.Now()
-	log.Printf("[%s] nebula: QueryMitigations executing LOOKUP query", queryStart.Format("15:04:05.000"))
+	slog.DebugContext(ctx, "nebula: QueryMitigations executing LOOKUP query")
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := execute(ctx, session, "QueryMitigations", query)
 	queryDuration := time.Since(queryStart)
-	log.Printf("[%s] nebula: QueryMitigations completed in %.3f seconds", time.Now().Format("15:04:05.000"), queryDuration.Seconds())
 
 	if err != nil {
 		return nil, fmt.Errorf("query execution failed: %w", err)
@@ -48,7 +46,7 @@ YIELD
 	for i := 0; i < resultSet.GetRowSize(); i++ {
 		record, err := resultSet.GetRowValuesByIndex(i)
 		if err != nil {
-			log.Printf("nebula: skipping row %d: %v", i, err)
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
 			continue
 		}
 
@@ -58,7 +56,8 @@ YIELD
 		})
 	}
 
-	log.Printf("nebula: QueryMitigations returned %d mitigations", len(mitigations))
+	slog.InfoContext(ctx, "nebula: QueryMitigations completed", "mitigations", len(mitigations),
+		"elapsed", queryDuration)
 	return mitigations, nil
 }
 
@@ -66,29 +65,26 @@ YIELD
 // MATCH is used because traversing applied_to edge from tMitreMitigation to Asset
 // with property retrieval on both the edge and the source vertex is cleaner with
 // MATCH than with chained GO/FETCH statements (REQ-244 justification).
-func QueryAssetMitigations(pool *nebula.ConnectionPool, cfg *config.Config, assetID string) ([]map[string]interface{}, error) {
-	session, err := openSession(pool, cfg)
+func QueryAssetMitigations(ctx context.Context, pool *Pool, cfg *config.Config, assetID string) ([]map[string]interface{}, error) {
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return nil, err
 	}
 	defer session.Release()
 
 	// REQ-034 query — MATCH per REQ-244 justification
-	query := fmt.Sprintf(`MATCH (m:tMitreMitigation)-[e:applied_to]->(a:Asset)
-WHERE a.Asset.Asset_ID == "%s"
+	const query = `MATCH (m:tMitreMitigation)-[e:applied_to]->(a:Asset)
+WHERE a.Asset.Asset_ID == $asset
 RETURN m.tMitreMitigation.Mitigation_ID AS mitigation_id,
   m.tMitreMitigation.Mitigation_Name AS mitigation_name,
   e.Maturity AS maturity,
-  e.Active AS active;`, assetID)
+  e.Active AS active;`
 
 	queryStart := time.Now()
-	log.Printf("[%s] nebula: QueryAssetMitigations executing MATCH query for asset %s",
-		queryStart.Format("15:04:05.000"), assetID)
+	slog.DebugContext(ctx, "nebula: QueryAssetMitigations executing MATCH query", "asset", assetID)
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := executeWithParameter(ctx, session, "QueryAssetMitigations", query, Params{"asset": assetID})
 	queryDuration := time.Since(queryStart)
-	log.Printf("[%s] nebula: QueryAssetMitigations completed in %.3f seconds",
-		time.Now().Format("15:04:05.000"), queryDuration.Seconds())
 
 	if err != nil {
 		return nil, fmt.Errorf("query execution failed: %w", err)
@@ -101,7 +97,7 @@ RETURN m.tMitreMitigation.Mitigation_ID AS mitigation_id,
 	for i := 0; i < resultSet.GetRowSize(); i++ {
 		record, err := resultSet.GetRowValuesByIndex(i)
 		if err != nil {
-			log.Printf("nebula: skipping row %d: %v", i, err)
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
 			continue
 		}
 
@@ -113,14 +109,15 @@ RETURN m.tMitreMitigation.Mitigation_ID AS mitigation_id,
 		})
 	}
 
-	log.Printf("nebula: QueryAssetMitigations returned %d mitigations for asset %s", len(mitigations), assetID)
+	slog.InfoContext(ctx, "nebula: QueryAssetMitigations completed", "asset", assetID,
+		"mitigations", len(mitigations), "elapsed", queryDuration)
 	return mitigations, nil
 }
 
 // UpsertMitigation adds or updates an applied_to edge between a mitigation and an asset (REQ-035).
 // Uses pure nGQL UPSERT EDGE per REQ-243.
-func UpsertMitigation(pool *nebula.ConnectionPool, cfg *config.Config, mitigationID, assetID string, maturity int, active bool) error {
-	session, err := openSession(pool, cfg)
+func UpsertMitigation(ctx context.Context, pool *Pool, cfg *config.Config, mitigationID, assetID string, maturity int, active bool) error {
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return err
 	}
@@ -129,17 +126,17 @@ func UpsertMitigation(pool *nebula.ConnectionPool, cfg *config.Config, mitigatio
 	// REQ-035 query — pure nGQL per REQ-243
 	// @0 rank is fixed per schema ED001
 	// Version is hardcoded to "1.0" — version-aware modelling is deferred
-	query := fmt.Sprintf(`UPSERT EDGE ON applied_to "%s" -> "%s" @0
-SET Version = "1.0", Maturity = %d, Active = %v;`, mitigationID, assetID, maturity, active)
+	query := fmt.Sprintf(`UPSERT EDGE ON applied_to %s -> %s @0
+SET Version = "1.0", Maturity = %d, Active = %t;`, Literal(mitigationID), Literal(assetID), maturity, active)
 
 	queryStart := time.Now()
-	log.Printf("[%s] nebula: UpsertMitigation executing for %s -> %s (maturity=%d, active=%v)",
-		queryStart.Format("15:04:05.000"), mitigationID, assetID, maturity, active)
+	slog.DebugContext(ctx, "nebula: UpsertMitigation executing", "mitigation", mitigationID, "asset", assetID,
+		"maturity", maturity, "active", active)
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := execute(ctx, session, "UpsertMitigation", query)
 	queryDuration := time.Since(queryStart)
-	log.Printf("[%s] nebula: UpsertMitigation completed in %.3f seconds",
-		time.Now().Format("15:04:05.000"), queryDuration.Seconds())
+	slog.InfoContext(ctx, "nebula: UpsertMitigation completed", "mitigation", mitigationID, "asset", assetID,
+		"elapsed", queryDuration)
 
 	if err != nil {
 		return fmt.Errorf("upsert execution failed: %w", err)
@@ -154,24 +151,23 @@ SET Version = "1.0", Maturity = %d, Active = %v;`, mitigationID, assetID, maturi
 // DeleteMitigation removes an applied_to edge between a mitigation and an asset (REQ-036).
 // Uses pure nGQL DELETE EDGE per REQ-243.
 // Caution: only deletes rank 0 — correct per current design (REQ-035 note).
-func DeleteMitigation(pool *nebula.ConnectionPool, cfg *config.Config, mitigationID, assetID string) error {
-	session, err := openSession(pool, cfg)
+func DeleteMitigation(ctx context.Context, pool *Pool, cfg *config.Config, mitigationID, assetID string) error {
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return err
 	}
 	defer session.Release()
 
 	// REQ-036 query — pure nGQL per REQ-243
-	query := fmt.Sprintf(`DELETE EDGE applied_to "%s" -> "%s" @0;`, mitigationID, assetID)
+	query := `DELETE EDGE applied_to ` + Literal(mitigationID) + ` -> ` + Literal(assetID) + ` @0;`
 
 	queryStart := time.Now()
-	log.Printf("[%s] nebula: DeleteMitigation executing for %s -> %s",
-		queryStart.Format("15:04:05.000"), mitigationID, assetID)
+	slog.DebugContext(ctx, "nebula: DeleteMitigation executing", "mitigation", mitigationID, "asset", assetID)
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := execute(ctx, session, "DeleteMitigation", query)
 	queryDuration := time.Since(queryStart)
-	log.Printf("[%s] nebula: DeleteMitigation completed in %.3f seconds",
-		time.Now().Format("15:04:05.000"), queryDuration.Seconds())
+	slog.InfoContext(ctx, "nebula: DeleteMitigation completed", "mitigation", mitigationID, "asset", assetID,
+		"elapsed", queryDuration)
 
 	if err != nil {
 		return fmt.Errorf("delete execution failed: %w", err)
@@ -182,3 +178,50 @@ func DeleteMitigation(pool *nebula.ConnectionPool, cfg *config.Config, mitigatio
 
 	return nil
 }
+
+// QueryTechniqueMitigations returns, per technique VID, the VIDs of the
+// mitigations with a mitigates edge (ED009) to it. Techniques without
+// mitigations are absent from the map.
+// MATCH is used for the IN filter on the destination, as in computeBatchTTT.
+func QueryTechniqueMitigations(ctx context.Context, pool *Pool, cfg *config.Config, techniqueIDs []string) (map[string][]string, error) {
+	result := make(map[string][]string)
+	if len(techniqueIDs) == 0 {
+		return result, nil
+	}
+
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Release()
+
+	const query = `MATCH (m:tMitreMitigation)-[:mitigates]->(t:tMitreTechnique)
+WHERE id(t) IN $techniques
+RETURN id(t) AS technique_vid, id(m) AS mitigation_vid
+ORDER BY technique_vid, mitigation_vid;`
+
+	queryStart := time.Now()
+	slog.DebugContext(ctx, "nebula: QueryTechniqueMitigations executing MATCH query", "techniques", len(techniqueIDs))
+
+	resultSet, err := executeWithParameter(ctx, session, "QueryTechniqueMitigations", query, Params{"techniques": List(techniqueIDs)})
+	slog.InfoContext(ctx, "nebula: QueryTechniqueMitigations completed", "techniques", len(techniqueIDs),
+		"elapsed", time.Since(queryStart))
+
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	if !resultSet.IsSucceed() {
+		return nil, fmt.Errorf("query failed: %s", resultSet.GetErrorMsg())
+	}
+
+	for i := 0; i < resultSet.GetRowSize(); i++ {
+		record, err := resultSet.GetRowValuesByIndex(i)
+		if err != nil {
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
+			continue
+		}
+		tech := safeString(record, 0)
+		result[tech] = append(result[tech], safeString(record, 1))
+	}
+	return result, nil
+}
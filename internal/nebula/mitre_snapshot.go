@@ -0,0 +1,556 @@
+package nebula
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ESP-data/internal/metrics"
+
+	nebula "github.com/vesoft-inc/nebula-go/v3"
+)
+
+// ============================================================
+// MITRE snapshot — the ATT&CK knowledge used by ComputeTTB (tactics,
+// techniques, part_of, can_be_executed_on, mitigates, chain_includes and
+// patterns_to) loaded once into memory, so ALG-REQ-070 runs in Go with two
+// graph reads per asset instead of 10+
+// ============================================================
+
+// SnapshotTechnique is one tMitreTechnique (TA008) with its MITRE edges.
+type SnapshotTechnique struct {
+	TechniqueID   string
+	TechniqueName string
+	Priority      int
+	Rcelpe        bool
+	ExecMin       float64
+	ExecMax       float64
+	Tactics       map[string]bool // part_of (ED010) tactic VIDs
+	Platforms     map[string]bool // can_be_executed_on (ED003) platform VIDs
+	Mitigations   []string        // VIDs of tMitreMitigation with mitigates (ED009) to it
+}
+
+// MitreSnapshot is an immutable copy of the MITRE knowledge ComputeTTB reads.
+// Version identifies the technique data it was loaded from (see MitreCache).
+type MitreSnapshot struct {
+	Version    string
+	LoadedAt   time.Time
+	Chains     map[string][]TacticRef        // TacticChain VID → tactics in chain_includes rank order
+	Techniques map[string]*SnapshotTechnique // by VID
+	Patterns   map[string][]PatternEdge      // tMitreState VID → outgoing patterns_to
+}
+
+// PatternEdge is one patterns_to (ED012) edge: the destination state_id and
+// the edge's probability.
+type PatternEdge struct {
+	State       string
+	Probability float64
+}
+
+// AssetProfile is what ComputeTTB needs to know about one asset: its
+// Asset.has_vulnerability flag, the MitrePlatforms its OS represents and the
+// maturity of each active applied_to mitigation.
+type AssetProfile struct {
+	HasVulnerability bool
+	Platforms        map[string]bool
+	ActiveMaturity   map[string]int
+}
+
+// ------------------------------------------------------------
+// TTBSource over a snapshot
+// ------------------------------------------------------------
+
+// snapshotSource answers every TTBSource read from a MitreSnapshot and the
+// profile of the one asset being computed; it makes no graph calls.
+type snapshotSource struct {
+	snap  *MitreSnapshot
+	asset *AssetProfile
+}
+
+// NewSnapshotSource returns the TTBSource that runs RunTTB for one asset
+// purely from snap and its profile.
+func NewSnapshotSource(snap *MitreSnapshot, asset *AssetProfile) TTBSource {
+	return snapshotSource{snap: snap, asset: asset}
+}
+
+// executable reports whether t runs on one of the asset's platforms (ALG-REQ-062).
+func (s snapshotSource) executable(t *SnapshotTechnique) bool {
+	for p := range t.Platforms {
+		if s.asset.Platforms[p] {
+			return true
+		}
+	}
+	return false
+}
+
+func snapshotCandidate(t *SnapshotTechnique) TechniqueCandidate {
+	return TechniqueCandidate{
+		TechniqueID:    t.TechniqueID,
+		TechniqueName:  t.TechniqueName,
+		Priority:       t.Priority,
+		VulnApplicable: t.Rcelpe,
+	}
+}
+
+// sortByPriority applies the ORDER BY technique_priority DESC, technique_id
+// of the selection queries.
+func sortByPriority(c []TechniqueCandidate) {
+	sort.SliceStable(c, func(i, j int) bool {
+		if c[i].Priority != c[j].Priority {
+			return c[i].Priority > c[j].Priority
+		}
+		return c[i].TechniqueID < c[j].TechniqueID
+	})
+}
+
+func (s snapshotSource) OrderedTactics(ctx context.Context, chainVid string) ([]TacticRef, error) {
+	tactics := s.snap.Chains[chainVid]
+	if len(tactics) == 0 {
+		return nil, fmt.Errorf("getOrderedTactics: chain %s has no tactics", chainVid)
+	}
+	return tactics, nil
+}
+
+func (s snapshotSource) AssetHasVulnerability(ctx context.Context, assetVid string) (bool, error) {
+	return s.asset.HasVulnerability, nil
+}
+
+func (s snapshotSource) FirstTacticTechniques(ctx context.Context, assetVid, tacticVid string) ([]TechniqueCandidate, error) {
+	var candidates []TechniqueCandidate
+	for _, t := range s.snap.Techniques {
+		if t.Tactics[tacticVid] && s.executable(t) {
+			candidates = append(candidates, snapshotCandidate(t))
+		}
+	}
+	sortByPriority(candidates)
+	return candidates, nil
+}
+
+func (s snapshotSource) PatternTechniques(ctx context.Context, previousTacticID, fastestTechniqueID, currentTacticID string) ([]TechniqueCandidate, error) {
+	var candidates []TechniqueCandidate
+	for _, e := range s.snap.Patterns[previousTacticID+"|"+fastestTechniqueID] {
+		parts := strings.Split(e.State, "|")
+		if len(parts) != 2 || parts[0] != currentTacticID {
+			continue
+		}
+		if t, ok := s.snap.Techniques[parts[1]]; ok {
+			c := snapshotCandidate(t)
+			c.Probability = e.Probability
+			candidates = append(candidates, c)
+		}
+	}
+	sortByPriority(candidates)
+	return candidates, nil
+}
+
+func (s snapshotSource) FilterByOS(ctx context.Context, candidates []TechniqueCandidate, assetVid string) ([]TechniqueCandidate, error) {
+	var filtered []TechniqueCandidate
+	for _, c := range candidates {
+		if t, ok := s.snap.Techniques[c.TechniqueID]; ok && s.executable(t) {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered, nil
+}
+
+func (s snapshotSource) TTTInputs(ctx context.Context, assetVid string, techniqueIDs []string) (map[string]TechniqueTTTInput, map[string]int, error) {
+	inputs := make(map[string]TechniqueTTTInput, len(techniqueIDs))
+	for _, id := range techniqueIDs {
+		t, ok := s.snap.Techniques[id]
+		if !ok {
+			continue
+		}
+		inputs[id] = TechniqueTTTInput{
+			ExecMin: t.ExecMin,
+			ExecMax: t.ExecMax,
+			P:       len(t.Mitigations),
+			MitVids: t.Mitigations,
+		}
+	}
+	return inputs, s.asset.ActiveMaturity, nil
+}
+
+// ------------------------------------------------------------
+// Loading
+// ------------------------------------------------------------
+
+// patternsBatch caps the state VIDs of one patterns_to GO statement.
+const patternsBatch = 500
+
+// techniqueRows reads every tMitreTechnique with the properties ComputeTTB
+// uses, and returns them with a fingerprint of those properties — the MITRE
+// data version. The defaults match the selection queries (priority 4,
+// execution bounds 0.1667 h and 120 h).
+func techniqueRows(ctx context.Context, session *nebula.Session) (map[string]*SnapshotTechnique, string, error) {
+	const query = `LOOKUP ON tMitreTechnique YIELD id(vertex) AS vid, ` +
+		`tMitreTechnique.Technique_ID AS tid, tMitreTechnique.Technique_Name AS tname, ` +
+		`tMitreTechnique.priority AS pri, tMitreTechnique.rcelpe AS rcelpe, ` +
+		`tMitreTechnique.execution_min AS exec_min, tMitreTechnique.execution_max AS exec_max, ` +
+		`tMitreTechnique.Mitre_Attack_Version AS version;`
+
+	rs, err := execute(ctx, session, "MitreSnapshot techniques", query)
+	if err != nil {
+		return nil, "", fmt.Errorf("MitreSnapshot techniques: %w", err)
+	}
+	if !rs.IsSucceed() {
+		return nil, "", fmt.Errorf("MitreSnapshot techniques: %s", rs.GetErrorMsg())
+	}
+
+	techniques := make(map[string]*SnapshotTechnique, rs.GetRowSize())
+	lines := make([]string, 0, rs.GetRowSize())
+	for i := 0; i < rs.GetRowSize(); i++ {
+		record, _ := rs.GetRowValuesByIndex(i)
+		vid := safeString(record, 0)
+		if vid == "" {
+			continue
+		}
+		t := &SnapshotTechnique{
+			TechniqueID:   safeString(record, 1),
+			TechniqueName: safeString(record, 2),
+			Priority:      safeInt(record, 3, 4),
+			Rcelpe:        safeBool(record, 4),
+			ExecMin:       safeFloat64(record, 5, 0.1667),
+			ExecMax:       safeFloat64(record, 6, 120.0),
+			Tactics:       make(map[string]bool),
+			Platforms:     make(map[string]bool),
+		}
+		techniques[vid] = t
+		lines = append(lines, fmt.Sprintf("%s|%s|%d|%t|%g|%g|%s", vid, t.TechniqueName, t.Priority, t.Rcelpe,
+			t.ExecMin, t.ExecMax, safeString(record, 7)))
+	}
+
+	sort.Strings(lines)
+	h := fnv.New64a()
+	for _, l := range lines {
+		h.Write([]byte(l))
+		h.Write([]byte{'\n'})
+	}
+	return techniques, fmt.Sprintf("%d-%016x", len(lines), h.Sum64()), nil
+}
+
+// LoadMitreSnapshot reads the MITRE knowledge into a new snapshot: six
+// statements plus one patterns_to round per hop of the state graph.
+func LoadMitreSnapshot(ctx context.Context, session *nebula.Session) (*MitreSnapshot, error) {
+	loadStart := time.Now()
+
+	techniques, version, err := techniqueRows(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	snap := &MitreSnapshot{
+		Version:    version,
+		Techniques: techniques,
+		Chains:     make(map[string][]TacticRef),
+		Patterns:   make(map[string][]PatternEdge),
+	}
+
+	rows := func(op, query string, each func(record *nebula.Record)) error {
+		rs, err := execute(ctx, session, op, query)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if !rs.IsSucceed() {
+			return fmt.Errorf("%s: %s", op, rs.GetErrorMsg())
+		}
+		for i := 0; i < rs.GetRowSize(); i++ {
+			record, err := rs.GetRowValuesByIndex(i)
+			if err != nil {
+				continue
+			}
+			each(record)
+		}
+		return nil
+	}
+
+	// tMitreTactic (TA007) — part_of and chain_includes lead to these
+	type tacticName struct{ id, name string }
+	tactics := make(map[string]tacticName)
+	err = rows("MitreSnapshot tactics", `LOOKUP ON tMitreTactic YIELD id(vertex) AS vid, `+
+		`tMitreTactic.Tactic_ID AS tid, tMitreTactic.Tactic_Name AS tname;`,
+		func(record *nebula.Record) {
+			tactics[safeString(record, 0)] = tacticName{safeString(record, 1), safeString(record, 2)}
+		})
+	if err != nil {
+		return nil, err
+	}
+	// part_of (ED010), to tagged tactics only, and can_be_executed_on (ED003)
+	err = rows("MitreSnapshot technique edges", `LOOKUP ON tMitreTechnique YIELD id(vertex) AS vid `+
+		`| GO FROM $-.vid OVER part_of, can_be_executed_on `+
+		`YIELD type(edge) AS kind, src(edge) AS technique, dst(edge) AS dst;`,
+		func(record *nebula.Record) {
+			t, ok := snap.Techniques[safeString(record, 1)]
+			if !ok {
+				return
+			}
+			dst := safeString(record, 2)
+			if safeString(record, 0) != "part_of" {
+				t.Platforms[dst] = true
+			} else if _, ok := tactics[dst]; ok {
+				t.Tactics[dst] = true
+			}
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	// mitigates (ED009)
+	err = rows("MitreSnapshot mitigates", `LOOKUP ON tMitreMitigation YIELD id(vertex) AS vid `+
+		`| GO FROM $-.vid OVER mitigates YIELD src(edge) AS mitigation, dst(edge) AS technique;`,
+		func(record *nebula.Record) {
+			if t, ok := snap.Techniques[safeString(record, 1)]; ok {
+				t.Mitigations = append(t.Mitigations, safeString(record, 0))
+			}
+		})
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range snap.Techniques {
+		sort.Strings(t.Mitigations)
+	}
+
+	type chainEdge struct {
+		rank   int
+		tactic string
+	}
+	chainEdges := make(map[string][]chainEdge)
+	// every TacticChain (TA010) with its chain_includes (ED013) edges
+	err = rows("MitreSnapshot chains", `LOOKUP ON TacticChain YIELD id(vertex) AS vid `+
+		`| GO FROM $-.vid OVER chain_includes `+
+		`YIELD src(edge) AS chain, rank(edge) AS rank, dst(edge) AS tactic;`,
+		func(record *nebula.Record) {
+			chain := safeString(record, 0)
+			chainEdges[chain] = append(chainEdges[chain], chainEdge{safeInt(record, 1, 0), safeString(record, 2)})
+		})
+	if err != nil {
+		return nil, err
+	}
+	for chain, edges := range chainEdges {
+		sort.SliceStable(edges, func(i, j int) bool { return edges[i].rank < edges[j].rank })
+		refs := make([]TacticRef, 0, len(edges))
+		for _, e := range edges {
+			if e.tactic == "" {
+				continue
+			}
+			if t, ok := tactics[e.tactic]; ok && t.id == e.tactic { // getOrderedTactics matches on Tactic_ID
+				refs = append(refs, TacticRef{VID: e.tactic, TacticID: t.id, TacticName: t.name})
+			} else {
+				refs = append(refs, TacticRef{VID: e.tactic, TacticID: e.tactic, TacticName: e.tactic})
+			}
+		}
+		snap.Chains[chain] = refs
+	}
+
+	// patterns_to (ED012): every state RunTTB can stand in is a part_of pair
+	// "tactic|technique" or a patterns_to destination, so the edges are read
+	// from the part_of pairs outwards until no new state turns up.
+	visited := make(map[string]bool)
+	var frontier []string
+	for vid, t := range snap.Techniques {
+		for tactic := range t.Tactics {
+			state := tactic + "|" + vid
+			if !visited[state] {
+				visited[state] = true
+				frontier = append(frontier, state)
+			}
+		}
+	}
+	for len(frontier) > 0 {
+		sort.Strings(frontier)
+		var next []string
+		for start := 0; start < len(frontier); start += patternsBatch {
+			end := min(start+patternsBatch, len(frontier))
+			err = rows("MitreSnapshot patterns_to", `GO FROM `+LiteralList(frontier[start:end])+` OVER patterns_to `+
+				`YIELD src(edge) AS src, $^.tMitreState.state_id AS src_state, $$.tMitreState.state_id AS dst_state, `+
+				`patterns_to.probability AS probability;`,
+				func(record *nebula.Record) {
+					src, dst := safeString(record, 0), safeString(record, 2)
+					if safeString(record, 1) == "" || dst == "" {
+						return // an end without the tMitreState tag, which the MATCH of ALG-REQ-076 skips
+					}
+					snap.Patterns[src] = append(snap.Patterns[src], PatternEdge{State: dst, Probability: safeFloat64(record, 3, 0)})
+					if !visited[dst] {
+						visited[dst] = true
+						next = append(next, dst)
+					}
+				})
+			if err != nil {
+				return nil, err
+			}
+		}
+		frontier = next
+	}
+
+	snap.LoadedAt = time.Now()
+	patterns := 0
+	for _, dsts := range snap.Patterns {
+		patterns += len(dsts)
+	}
+	slog.InfoContext(ctx, "nebula: MitreSnapshot loaded", "version", snap.Version, "elapsed", time.Since(loadStart),
+		"techniques", len(snap.Techniques), "chains", len(snap.Chains), "patterns_to", patterns)
+	return snap, nil
+}
+
+// QueryAssetProfile reads the asset side of ComputeTTB: has_vulnerability
+// with the platforms of runs_on -> represents (ALG-REQ-062, ALG-REQ-074), and
+// the active applied_to mitigations with their maturity (ALG-REQ-060).
+func QueryAssetProfile(ctx context.Context, session *nebula.Session, assetVid string) (*AssetProfile, error) {
+	profile := &AssetProfile{Platforms: make(map[string]bool), ActiveMaturity: make(map[string]int)}
+
+	const platformsQ = `MATCH (a:Asset)-[:runs_on]->(os:OS_Type)-[:represents]->(p:MitrePlatform) ` +
+		`WHERE id(a) == $asset ` +
+		`RETURN DISTINCT id(p) AS platform, a.Asset.has_vulnerability AS hv;`
+	rs, err := executeWithParameter(ctx, session, "QueryAssetProfile platforms", platformsQ, Params{"asset": assetVid})
+	if err != nil {
+		return nil, fmt.Errorf("QueryAssetProfile platforms: %w", err)
+	}
+	if !rs.IsSucceed() {
+		return nil, fmt.Errorf("QueryAssetProfile platforms: %s", rs.GetErrorMsg())
+	}
+	for i := 0; i < rs.GetRowSize(); i++ {
+		record, _ := rs.GetRowValuesByIndex(i)
+		profile.Platforms[safeString(record, 0)] = true
+		profile.HasVulnerability = safeBool(record, 1)
+	}
+
+	const appliedQ = `MATCH (m:tMitreMitigation)-[ap:applied_to]->(a:Asset) ` +
+		`WHERE id(a) == $asset AND ap.Active == true ` +
+		`RETURN id(m) AS mit_vid, ap.Maturity AS maturity;`
+	rs, err = executeWithParameter(ctx, session, "QueryAssetProfile applied_to", appliedQ, Params{"asset": assetVid})
+	if err != nil {
+		return nil, fmt.Errorf("QueryAssetProfile applied_to: %w", err)
+	}
+	if !rs.IsSucceed() {
+		return nil, fmt.Errorf("QueryAssetProfile applied_to: %s", rs.GetErrorMsg())
+	}
+	for i := 0; i < rs.GetRowSize(); i++ {
+		record, _ := rs.GetRowValuesByIndex(i)
+		if mv := safeString(record, 0); mv != "" {
+			profile.ActiveMaturity[mv] = safeInt(record, 1, 0)
+		}
+	}
+	return profile, nil
+}
+
+// ------------------------------------------------------------
+// Cache and refresh
+// ------------------------------------------------------------
+
+// MitreCache holds the current MitreSnapshot. At most once per check
+// interval a caller re-reads the technique data version and reloads the
+// snapshot if it changed; the others keep using the current one meanwhile.
+// Edge-only edits (patterns_to, mitigates, chain_includes) leave the version
+// unchanged and are picked up by Invalidate — called after an ATT&CK import
+// or a tactic chain change — or a restart.
+type MitreCache struct {
+	check time.Duration
+
+	snap    atomic.Pointer[MitreSnapshot]
+	stale   atomic.Bool
+	refresh sync.Mutex // held by the caller checking or loading
+	checked time.Time  // last version check; refresh must be held
+
+	onChange func(ctx context.Context, version string)
+}
+
+// NewMitreCache returns an empty cache that re-checks the version every check.
+func NewMitreCache(check time.Duration) *MitreCache {
+	return &MitreCache{check: check}
+}
+
+// OnVersionChange registers fn to run after a reload that replaced a
+// snapshot of another version, e.g. to drop TTBs cached under the old
+// ATT&CK data. It must be called before the first Get.
+func (c *MitreCache) OnVersionChange(fn func(ctx context.Context, version string)) {
+	c.onChange = fn
+}
+
+// Invalidate makes the next Get reload the snapshot.
+func (c *MitreCache) Invalidate() {
+	c.stale.Store(true)
+}
+
+// Get returns the current snapshot. It reads the graph on session to load
+// the snapshot on first use and to reload it when the MITRE data changed.
+func (c *MitreCache) Get(ctx context.Context, session *nebula.Session) (*MitreSnapshot, error) {
+	snap := c.snap.Load()
+	if snap != nil {
+		if !c.refresh.TryLock() {
+			return snap, nil // another caller is checking or loading
+		}
+	} else {
+		c.refresh.Lock()
+	}
+	defer c.refresh.Unlock()
+
+	snap = c.snap.Load()
+	stale := c.stale.Load()
+	if snap != nil && !stale && time.Since(c.checked) < c.check {
+		return snap, nil
+	}
+	if snap != nil && !stale {
+		_, version, err := techniqueRows(ctx, session)
+		if err != nil {
+			// Keep computing from the current snapshot; retry after the interval.
+			slog.WarnContext(ctx, "nebula: MITRE version check failed", "err", err)
+			c.checked = time.Now()
+			return snap, nil
+		}
+		c.checked = time.Now()
+		if version == snap.Version {
+			return snap, nil
+		}
+		slog.InfoContext(ctx, "nebula: MITRE data changed, reloading snapshot", "from", snap.Version, "to", version)
+	}
+
+	c.stale.Store(false)
+	loaded, err := LoadMitreSnapshot(ctx, session)
+	if err != nil {
+		metrics.MitreSnapshotLoads.Inc("failed")
+		if stale {
+			c.stale.Store(true)
+		}
+		if snap != nil {
+			slog.WarnContext(ctx, "nebula: MitreSnapshot reload failed, keeping the current one",
+				"version", snap.Version, "err", err)
+			return snap, nil
+		}
+		return nil, err
+	}
+	metrics.MitreSnapshotLoads.Inc("loaded")
+	c.snap.Store(loaded)
+	c.checked = time.Now()
+	if snap != nil && loaded.Version != snap.Version && c.onChange != nil {
+		c.onChange(ctx, loaded.Version)
+	}
+	return loaded, nil
+}
+
+// snapshotOrSession returns the TTBSource for one asset: the snapshot of
+// mitre when it covers chainVid, otherwise — no cache, a failed load or a
+// chain it does not hold — the live reads on session.
+func snapshotOrSession(ctx context.Context, mitre *MitreCache, session *nebula.Session, assetVid, chainVid string) TTBSource {
+	live := sessionSource{session: session}
+	if mitre == nil {
+		return live
+	}
+	snap, err := mitre.Get(ctx, session)
+	if err != nil {
+		slog.WarnContext(ctx, "nebula: MitreSnapshot unavailable, reading the graph", "err", err)
+		return live
+	}
+	if _, ok := snap.Chains[chainVid]; !ok {
+		return live
+	}
+	asset, err := QueryAssetProfile(ctx, session, assetVid)
+	if err != nil {
+		slog.WarnContext(ctx, "nebula: asset profile unavailable, reading the graph", "asset", assetVid, "err", err)
+		return live
+	}
+	return NewSnapshotSource(snap, asset)
+}
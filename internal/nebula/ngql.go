@@ -0,0 +1,70 @@
+package nebula
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ============================================================
+// nGQL statement building — no caller-supplied string is ever
+// spliced into a statement unescaped (REQ-121 hardening)
+// ============================================================
+//
+// Two mechanisms, chosen by clause:
+//
+//   - MATCH statements bind every value as a $parameter through
+//     Session.ExecuteWithParameter; the statement text is constant.
+//   - Clauses that take literal vertex IDs or property values — FETCH PROP ON,
+//     GO FROM, LOOKUP ... WHERE, INSERT, UPSERT, UPDATE, DELETE — render each
+//     value with Literal/LiteralList, which escape it as an nGQL string.
+//
+// Integers (hop bounds, ranks, maturities) are formatted with %d and never
+// come from strings.
+
+// Params are the $name values of one parameterised statement. Values must be
+// bool, int, int64, float64, string or []interface{} (see List), the types
+// nebula-go converts to nebula.Value.
+type Params map[string]interface{}
+
+// List converts a string slice to a list parameter value.
+func List(values []string) []interface{} {
+	list := make([]interface{}, len(values))
+	for i, v := range values {
+		list[i] = v
+	}
+	return list
+}
+
+// literalEscaper escapes the characters that could end or alter a
+// double-quoted nGQL string.
+var literalEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+)
+
+// Literal renders s as a double-quoted nGQL string literal.
+func Literal(s string) string {
+	return `"` + literalEscaper.Replace(s) + `"`
+}
+
+// LiteralList renders values as a comma-separated list of string literals,
+// e.g. for FETCH PROP ON Asset "A1", "A2".
+func LiteralList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = Literal(v)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// Ident renders a schema identifier (space, tag or edge name) in backticks.
+// Backticks cannot be escaped in nGQL, so names containing one are rejected.
+func Ident(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, "`\n\r") {
+		return "", fmt.Errorf("invalid nGQL identifier %q", name)
+	}
+	return "`" + name + "`", nil
+}
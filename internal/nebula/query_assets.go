@@ -1,18 +1,17 @@
 package nebula
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"ESP-data/config"
-
-	nebula "github.com/vesoft-inc/nebula-go/v3"
 )
 
 // (REQ-244 justification). OPTIONAL MATCH removed per REQ-043 (DI-01).
-func QueryAssets(pool *nebula.ConnectionPool, cfg *config.Config) ([]AssetRow, error) {
-	session, err := openSession(pool, cfg)
+func QueryAssets(ctx context.Context, pool *Pool, cfg *config.Config) ([]AssetRow, error) {
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -40,11 +39,10 @@ RETURN
 LIMIT 300;`
 
 	queryStart := time.Now()
-	log.Printf("[%s] nebula: QueryAssets executing MATCH query", queryStart.Format("15:04:05.000"))
+	slog.DebugContext(ctx, "nebula: QueryAssets executing MATCH query")
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := execute(ctx, session, "QueryAssets", query)
 	queryDuration := time.Since(queryStart)
-	log.Printf("[%s] nebula: QueryAssets completed in %.3f seconds", time.Now().Format("15:04:05.000"), queryDuration.Seconds())
 
 	if err != nil {
 		return nil, fmt.Errorf("query execution failed: %w", err)
@@ -57,7 +55,7 @@ LIMIT 300;`
 	for i := 0; i < resultSet.GetRowSize(); i++ {
 		record, err := resultSet.GetRowValuesByIndex(i)
 		if err != nil {
-			log.Printf("nebula: skipping row %d: %v", i, err)
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
 			continue
 		}
 
@@ -79,7 +77,7 @@ LIMIT 300;`
 		})
 	}
 
-	log.Printf("nebula: QueryAssets returned %d connectivity rows", len(rows))
+	slog.InfoContext(ctx, "nebula: QueryAssets completed", "rows", len(rows), "elapsed", queryDuration)
 	return rows, nil
 }
 
@@ -88,8 +86,8 @@ LIMIT 300;`
 // MATCH is used because multi-hop property retrieval is cleaner than
 // chained GO statements (REQ-244 justification). REQ-043: DI-01 guarantees
 // every asset has a has_type edge.
-func QueryAssetsWithDetails(pool *nebula.ConnectionPool, cfg *config.Config) ([]map[string]interface{}, error) {
-	session, err := openSession(pool, cfg)
+func QueryAssetsWithDetails(ctx context.Context, pool *Pool, cfg *config.Config) ([]map[string]interface{}, error) {
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -108,11 +106,10 @@ RETURN
   t.Asset_Type.Type_Name    AS asset_type;`
 
 	queryStart := time.Now()
-	log.Printf("[%s] nebula: QueryAssetsWithDetails executing MATCH query", queryStart.Format("15:04:05.000"))
+	slog.DebugContext(ctx, "nebula: QueryAssetsWithDetails executing MATCH query")
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := execute(ctx, session, "QueryAssetsWithDetails", query)
 	queryDuration := time.Since(queryStart)
-	log.Printf("[%s] nebula: QueryAssetsWithDetails completed in %.3f seconds", time.Now().Format("15:04:05.000"), queryDuration.Seconds())
 
 	if err != nil {
 		return nil, fmt.Errorf("query execution failed: %w", err)
@@ -125,7 +122,7 @@ RETURN
 	for i := 0; i < resultSet.GetRowSize(); i++ {
 		record, err := resultSet.GetRowValuesByIndex(i)
 		if err != nil {
-			log.Printf("nebula: skipping row %d: %v", i, err)
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
 			continue
 		}
 
@@ -140,7 +137,7 @@ RETURN
 		})
 	}
 
-	log.Printf("nebula: QueryAssetsWithDetails returned %d assets", len(assets))
+	slog.InfoContext(ctx, "nebula: QueryAssetsWithDetails completed", "assets", len(assets), "elapsed", queryDuration)
 	return assets, nil
 }
 
@@ -148,15 +145,15 @@ RETURN
 // MATCH is used because type/segment/OS property retrieval is significantly
 // cleaner than chained GO + FETCH statements (REQ-244 justification).
 // REQ-043: DI-01/02/03 guarantee has_type, belongs_to, runs_on edges.
-func QueryAssetDetail(pool *nebula.ConnectionPool, cfg *config.Config, assetID string) (map[string]interface{}, error) {
-	session, err := openSession(pool, cfg)
+func QueryAssetDetail(ctx context.Context, pool *Pool, cfg *config.Config, assetID string) (map[string]interface{}, error) {
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return nil, err
 	}
 	defer session.Release()
 
 	// REQ-022 query — uses parameterised WHERE on Asset_ID property (REQ-043: MATCH for type/segment/OS)
-	query := fmt.Sprintf(`MATCH (a:Asset) WHERE a.Asset.Asset_ID == "%s"
+	const query = `MATCH (a:Asset) WHERE a.Asset.Asset_ID == $asset
 MATCH (a)-[:has_type]->(t:Asset_Type)
 MATCH (a)-[:belongs_to]->(s:Network_Segment)
 MATCH (a)-[:runs_on]->(os:OS_Type)
@@ -172,14 +169,13 @@ RETURN
   a.Asset.TTB                 AS ttb,
   t.Asset_Type.Type_Name      AS asset_type,
   s.Network_Segment.Segment_Name AS segment_name,
-  os.OS_Type.OS_Name             AS os_name;`, assetID)
+  os.OS_Type.OS_Name             AS os_name;`
 
 	queryStart := time.Now()
-	log.Printf("[%s] nebula: QueryAssetDetail executing query for asset %s", queryStart.Format("15:04:05.000"), assetID)
+	slog.DebugContext(ctx, "nebula: QueryAssetDetail executing query", "asset", assetID)
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := executeWithParameter(ctx, session, "QueryAssetDetail", query, Params{"asset": assetID})
 	queryDuration := time.Since(queryStart)
-	log.Printf("[%s] nebula: QueryAssetDetail completed in %.3f seconds", time.Now().Format("15:04:05.000"), queryDuration.Seconds())
 
 	if err != nil {
 		return nil, fmt.Errorf("query execution failed: %w", err)
@@ -212,33 +208,33 @@ RETURN
 		"os_name":           safeString(record, 11),
 	}
 
-	log.Printf("nebula: QueryAssetDetail returned detail for %s", assetID)
+	slog.InfoContext(ctx, "nebula: QueryAssetDetail completed", "asset", assetID, "elapsed", queryDuration)
 	return detail, nil
 }
 
 // QueryNeighbors fetches immediate neighbors with direction for the
 // inspector panel (REQ-023). Uses pure nGQL with UNION as required
 // by REQ-243.
-func QueryNeighbors(pool *nebula.ConnectionPool, cfg *config.Config, assetID string) ([]map[string]interface{}, error) {
-	session, err := openSession(pool, cfg)
+func QueryNeighbors(ctx context.Context, pool *Pool, cfg *config.Config, assetID string) ([]map[string]interface{}, error) {
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return nil, err
 	}
 	defer session.Release()
 
 	// REQ-023 query — outbound UNION inbound
-	query := fmt.Sprintf(`GO FROM "%s" OVER connects_to
+	vid := Literal(assetID)
+	query := `GO FROM ` + vid + ` OVER connects_to
 YIELD dst(edge) AS neighbor_id, "outbound" AS direction
 UNION
-GO FROM "%s" OVER connects_to REVERSELY
-YIELD src(edge) AS neighbor_id, "inbound" AS direction;`, assetID, assetID)
+GO FROM ` + vid + ` OVER connects_to REVERSELY
+YIELD src(edge) AS neighbor_id, "inbound" AS direction;`
 
 	queryStart := time.Now()
-	log.Printf("[%s] nebula: QueryNeighbors executing query for asset %s", queryStart.Format("15:04:05.000"), assetID)
+	slog.DebugContext(ctx, "nebula: QueryNeighbors executing query", "asset", assetID)
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := execute(ctx, session, "QueryNeighbors", query)
 	queryDuration := time.Since(queryStart)
-	log.Printf("[%s] nebula: QueryNeighbors completed in %.3f seconds", time.Now().Format("15:04:05.000"), queryDuration.Seconds())
 
 	if err != nil {
 		return nil, fmt.Errorf("query execution failed: %w", err)
@@ -251,7 +247,7 @@ YIELD src(edge) AS neighbor_id, "inbound" AS direction;`, assetID, assetID)
 	for i := 0; i < resultSet.GetRowSize(); i++ {
 		record, err := resultSet.GetRowValuesByIndex(i)
 		if err != nil {
-			log.Printf("nebula: skipping row %d: %v", i, err)
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
 			continue
 		}
 
@@ -261,14 +257,15 @@ YIELD src(edge) AS neighbor_id, "inbound" AS direction;`, assetID, assetID)
 		})
 	}
 
-	log.Printf("nebula: QueryNeighbors returned %d neighbors for %s", len(neighbors), assetID)
+	slog.InfoContext(ctx, "nebula: QueryNeighbors completed", "asset", assetID, "neighbors", len(neighbors),
+		"elapsed", queryDuration)
 	return neighbors, nil
 }
 
 // QueryAssetTypes fetches distinct asset types for filter checkboxes (REQ-024).
 // Uses pure nGQL LOOKUP per REQ-243.
-func QueryAssetTypes(pool *nebula.ConnectionPool, cfg *config.Config) ([]map[string]interface{}, error) {
-	session, err := openSession(pool, cfg)
+func QueryAssetTypes(ctx context.Context, pool *Pool, cfg *config.Config) ([]map[string]interface{}, error) {
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -280,11 +277,10 @@ YIELD Asset_Type.Type_ID   AS type_id,
       Asset_Type.Type_Name AS type_name;`
 
 	queryStart := time.Now()
-	log.Printf("[%s] nebula: QueryAssetTypes executing query", queryStart.Format("15:04:05.000"))
+	slog.DebugContext(ctx, "nebula: QueryAssetTypes executing query")
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := execute(ctx, session, "QueryAssetTypes", query)
 	queryDuration := time.Since(queryStart)
-	log.Printf("[%s] nebula: QueryAssetTypes completed in %.3f seconds", time.Now().Format("15:04:05.000"), queryDuration.Seconds())
 
 	if err != nil {
 		return nil, fmt.Errorf("query execution failed: %w", err)
@@ -297,7 +293,7 @@ YIELD Asset_Type.Type_ID   AS type_id,
 	for i := 0; i < resultSet.GetRowSize(); i++ {
 		record, err := resultSet.GetRowValuesByIndex(i)
 		if err != nil {
-			log.Printf("nebula: skipping row %d: %v", i, err)
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
 			continue
 		}
 
@@ -307,33 +303,32 @@ YIELD Asset_Type.Type_ID   AS type_id,
 		})
 	}
 
-	log.Printf("nebula: QueryAssetTypes returned %d asset types", len(types))
+	slog.InfoContext(ctx, "nebula: QueryAssetTypes completed", "asset_types", len(types), "elapsed", queryDuration)
 	return types, nil
 }
 
 // QueryEdgeConnections fetches all connects_to edge properties between two
 // specific assets, for the edge inspector panel (REQ-026).
 // Uses pure nGQL GO statement per REQ-243.
-func QueryEdgeConnections(pool *nebula.ConnectionPool, cfg *config.Config, sourceID, targetID string) ([]map[string]interface{}, error) {
-	session, err := openSession(pool, cfg)
+func QueryEdgeConnections(ctx context.Context, pool *Pool, cfg *config.Config, sourceID, targetID string) ([]map[string]interface{}, error) {
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return nil, err
 	}
 	defer session.Release()
 
 	// REQ-026 query — pure nGQL per REQ-243
-	query := fmt.Sprintf(`GO FROM "%s" OVER connects_to
-WHERE dst(edge) == "%s"
+	query := `GO FROM ` + Literal(sourceID) + ` OVER connects_to
+WHERE dst(edge) == ` + Literal(targetID) + `
 YIELD
   connects_to.Connection_Protocol AS connection_protocol,
-  connects_to.Connection_Port     AS connection_port;`, sourceID, targetID)
+  connects_to.Connection_Port     AS connection_port;`
 
 	queryStart := time.Now()
-	log.Printf("[%s] nebula: QueryEdgeConnections executing query for %s -> %s", queryStart.Format("15:04:05.000"), sourceID, targetID)
+	slog.DebugContext(ctx, "nebula: QueryEdgeConnections executing query", "src", sourceID, "dst", targetID)
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := execute(ctx, session, "QueryEdgeConnections", query)
 	queryDuration := time.Since(queryStart)
-	log.Printf("[%s] nebula: QueryEdgeConnections completed in %.3f seconds", time.Now().Format("15:04:05.000"), queryDuration.Seconds())
 
 	if err != nil {
 		return nil, fmt.Errorf("query execution failed: %w", err)
@@ -346,7 +341,7 @@ YIELD
 	for i := 0; i < resultSet.GetRowSize(); i++ {
 		record, err := resultSet.GetRowValuesByIndex(i)
 		if err != nil {
-			log.Printf("nebula: skipping row %d: %v", i, err)
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
 			continue
 		}
 
@@ -356,6 +351,7 @@ YIELD
 		})
 	}
 
-	log.Printf("nebula: QueryEdgeConnections returned %d connections for %s -> %s", len(connections), sourceID, targetID)
+	slog.InfoContext(ctx, "nebula: QueryEdgeConnections completed", "src", sourceID, "dst", targetID,
+		"connections", len(connections), "elapsed", queryDuration)
 	return connections, nil
 }
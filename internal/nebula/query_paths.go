@@ -1,13 +1,12 @@
 package nebula
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"ESP-data/config"
-
-	nebula "github.com/vesoft-inc/nebula-go/v3"
 )
 
 type PathResult struct {
@@ -15,19 +14,6 @@ type PathResult struct {
 	TTBs []float64 // stored TTB per node (hours, float64 since v1.5)
 }
 
-// ChainVIDForPosition returns the TacticChain vertex ID for a node's
-// position in the attack path (ALG-REQ-051).
-func ChainVIDForPosition(index, pathLength int) string {
-	switch {
-	case index == 0:
-		return "CHAIN_ENTRANCE"
-	case index == pathLength-1:
-		return "CHAIN_TARGET"
-	default:
-		return "CHAIN_INTERMEDIATE"
-	}
-}
-
 // TTTResult holds the output of a single technique's TTT computation (ALG-REQ-065).
 
 // ======================================================================================================
@@ -36,8 +22,8 @@ func ChainVIDForPosition(index, pathLength int) string {
 
 // QueryEntryPoints fetches all assets where is_entrance == true (ALG-REQ-002, migrated from REQ-030).
 // Uses pure nGQL LOOKUP per REQ-243.
-func QueryEntryPoints(pool *nebula.ConnectionPool, cfg *config.Config) ([]map[string]interface{}, error) {
-	session, err := openSession(pool, cfg)
+func QueryEntryPoints(ctx context.Context, pool *Pool, cfg *config.Config) ([]map[string]interface{}, error) {
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -47,11 +33,10 @@ func QueryEntryPoints(pool *nebula.ConnectionPool, cfg *config.Config) ([]map[st
 YIELD id(vertex) AS vid, Asset.Asset_ID AS asset_id, Asset.Asset_Name AS asset_name;`
 
 	queryStart := time.Now()
-	log.Printf("[%s] nebula: QueryEntryPoints executing query", queryStart.Format("15:04:05.000"))
+	slog.DebugContext(ctx, "nebula: QueryEntryPoints executing query")
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := execute(ctx, session, "QueryEntryPoints", query)
 	queryDuration := time.Since(queryStart)
-	log.Printf("[%s] nebula: QueryEntryPoints completed in %.3f seconds", time.Now().Format("15:04:05.000"), queryDuration.Seconds())
 
 	if err != nil {
 		return nil, fmt.Errorf("query execution failed: %w", err)
@@ -64,7 +49,7 @@ YIELD id(vertex) AS vid, Asset.Asset_ID AS asset_id, Asset.Asset_Name AS asset_n
 	for i := 0; i < resultSet.GetRowSize(); i++ {
 		record, err := resultSet.GetRowValuesByIndex(i)
 		if err != nil {
-			log.Printf("nebula: skipping row %d: %v", i, err)
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
 			continue
 		}
 
@@ -74,14 +59,14 @@ YIELD id(vertex) AS vid, Asset.Asset_ID AS asset_id, Asset.Asset_Name AS asset_n
 		})
 	}
 
-	log.Printf("nebula: QueryEntryPoints returned %d entry points", len(entries))
+	slog.InfoContext(ctx, "nebula: QueryEntryPoints completed", "entry_points", len(entries), "elapsed", queryDuration)
 	return entries, nil
 }
 
 // QueryTargets fetches all assets where is_target == true (ALG-REQ-003, migrated from REQ-031).
 // Uses pure nGQL LOOKUP per REQ-243.
-func QueryTargets(pool *nebula.ConnectionPool, cfg *config.Config) ([]map[string]interface{}, error) {
-	session, err := openSession(pool, cfg)
+func QueryTargets(ctx context.Context, pool *Pool, cfg *config.Config) ([]map[string]interface{}, error) {
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -91,11 +76,10 @@ func QueryTargets(pool *nebula.ConnectionPool, cfg *config.Config) ([]map[string
 YIELD id(vertex) AS vid, Asset.Asset_ID AS asset_id, Asset.Asset_Name AS asset_name;`
 
 	queryStart := time.Now()
-	log.Printf("[%s] nebula: QueryTargets executing query", queryStart.Format("15:04:05.000"))
+	slog.DebugContext(ctx, "nebula: QueryTargets executing query")
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := execute(ctx, session, "QueryTargets", query)
 	queryDuration := time.Since(queryStart)
-	log.Printf("[%s] nebula: QueryTargets completed in %.3f seconds", time.Now().Format("15:04:05.000"), queryDuration.Seconds())
 
 	if err != nil {
 		return nil, fmt.Errorf("query execution failed: %w", err)
@@ -108,7 +92,7 @@ YIELD id(vertex) AS vid, Asset.Asset_ID AS asset_id, Asset.Asset_Name AS asset_n
 	for i := 0; i < resultSet.GetRowSize(); i++ {
 		record, err := resultSet.GetRowValuesByIndex(i)
 		if err != nil {
-			log.Printf("nebula: skipping row %d: %v", i, err)
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
 			continue
 		}
 
@@ -118,36 +102,35 @@ YIELD id(vertex) AS vid, Asset.Asset_ID AS asset_id, Asset.Asset_Name AS asset_n
 		})
 	}
 
-	log.Printf("nebula: QueryTargets returned %d targets", len(targets))
+	slog.InfoContext(ctx, "nebula: QueryTargets completed", "targets", len(targets), "elapsed", queryDuration)
 	return targets, nil
 }
 
 // QueryPaths executes the path discovery query (ALG-REQ-001 v1.3).
 // Returns per-path ordered ID lists and stored TTB values.
 // The APP layer builds host strings and computes position-aware TTA.
-func QueryPaths(pool *nebula.ConnectionPool, cfg *config.Config, entryID, targetID string, maxHops int) ([]PathResult, error) {
-	session, err := openSession(pool, cfg)
+func QueryPaths(ctx context.Context, pool *Pool, cfg *config.Config, entryID, targetID string, maxHops int) ([]PathResult, error) {
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return nil, err
 	}
 	defer session.Release()
 
+	// The hop bound is part of the pattern and cannot be a parameter.
 	query := fmt.Sprintf(`MATCH p = (a:Asset)-[e:connects_to*..%d]->(b:Asset)
-WHERE a.Asset.Asset_ID == "%s" AND b.Asset.Asset_ID == "%s"
+WHERE a.Asset.Asset_ID == $entry AND b.Asset.Asset_ID == $target
   AND ALL(n IN nodes(p) WHERE single(m IN nodes(p) WHERE m == n))
 WITH nodes(p) AS pathNodes
 WITH [n IN pathNodes | n.Asset.Asset_ID] AS ids,
      [n IN pathNodes | COALESCE(n.Asset.TTB, 10)] AS ttbs
-RETURN ids, ttbs;`, maxHops, entryID, targetID)
+RETURN ids, ttbs;`, maxHops)
 
 	queryStart := time.Now()
-	log.Printf("[%s] nebula: QueryPaths executing MATCH query (%s -> %s, max %d hops)",
-		queryStart.Format("15:04:05.000"), entryID, targetID, maxHops)
+	slog.DebugContext(ctx, "nebula: QueryPaths executing MATCH query",
+		"entry", entryID, "target", targetID, "max_hops", maxHops)
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := executeWithParameter(ctx, session, "QueryPaths", query, Params{"entry": entryID, "target": targetID})
 	queryDuration := time.Since(queryStart)
-	log.Printf("[%s] nebula: QueryPaths completed in %.3f seconds",
-		time.Now().Format("15:04:05.000"), queryDuration.Seconds())
 
 	if err != nil {
 		return nil, fmt.Errorf("query execution failed: %w", err)
@@ -160,43 +143,44 @@ RETURN ids, ttbs;`, maxHops, entryID, targetID)
 	for i := 0; i < resultSet.GetRowSize(); i++ {
 		record, err := resultSet.GetRowValuesByIndex(i)
 		if err != nil {
-			log.Printf("nebula: skipping row %d: %v", i, err)
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
 			continue
 		}
 
 		ids, err := extractStringList(record, 0)
 		if err != nil {
-			log.Printf("nebula: skipping row %d ids: %v", i, err)
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "column", "ids", "err", err)
 			continue
 		}
 
 		ttbs, err := extractFloatList(record, 1)
 		if err != nil {
-			log.Printf("nebula: skipping row %d ttbs: %v", i, err)
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "column", "ttbs", "err", err)
 			continue
 		}
 
 		paths = append(paths, PathResult{IDs: ids, TTBs: ttbs})
 	}
 
-	log.Printf("nebula: QueryPaths returned %d paths for %s -> %s", len(paths), entryID, targetID)
+	slog.InfoContext(ctx, "nebula: QueryPaths completed", "entry", entryID, "target", targetID,
+		"paths", len(paths), "elapsed", queryDuration)
 	return paths, nil
 }
 
 // QueryAssetTTB fetches the TTB value for a single asset by Asset_ID.
 // Used by the path calculator to subtract the entry point's TTB (ALG-REQ-010, migrated from REQ-032).
 // Uses pure nGQL LOOKUP per REQ-243.
-func QueryAssetTTB(pool *nebula.ConnectionPool, cfg *config.Config, assetID string) (int, error) {
-	session, err := openSession(pool, cfg)
+func QueryAssetTTB(ctx context.Context, pool *Pool, cfg *config.Config, assetID string) (int, error) {
+	session, err := openSession(ctx, pool, cfg)
 	if err != nil {
 		return 0, err
 	}
 	defer session.Release()
 
-	query := fmt.Sprintf(`LOOKUP ON Asset WHERE Asset.Asset_ID == "%s"
-YIELD Asset.TTB AS ttb;`, assetID)
+	query := `LOOKUP ON Asset WHERE Asset.Asset_ID == ` + Literal(assetID) + `
+YIELD Asset.TTB AS ttb;`
 
-	resultSet, err := session.Execute(query)
+	resultSet, err := execute(ctx, session, "QueryAssetTTB", query)
 	if err != nil {
 		return 0, fmt.Errorf("query execution failed: %w", err)
 	}
@@ -215,3 +199,79 @@ YIELD Asset.TTB AS ttb;`, assetID)
 
 	return safeInt(record, 0, 10), nil
 }
+
+// Topology is the whole connects_to adjacency with per-asset stored TTB and
+// hash validity, loaded once for in-process path search (ALG-REQ-001
+// shortest mode). Parallel ranks of a pair collapse to one neighbour entry.
+type Topology struct {
+	Adjacency map[string][]string
+	TTB       map[string]float64
+	HashValid map[string]bool
+}
+
+// QueryTopology fetches the connects_to adjacency and every asset's stored
+// TTB and hash_valid flag in two statements, independently of how many
+// paths exist between any pair.
+func QueryTopology(ctx context.Context, pool *Pool, cfg *config.Config) (*Topology, error) {
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Release()
+
+	queryStart := time.Now()
+	slog.DebugContext(ctx, "nebula: QueryTopology executing queries")
+
+	assetQuery := `LOOKUP ON Asset
+YIELD id(vertex) AS vid, Asset.TTB AS ttb, Asset.hash_valid AS hash_valid;`
+
+	resultSet, err := execute(ctx, session, "QueryTopology assets", assetQuery)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	if !resultSet.IsSucceed() {
+		return nil, fmt.Errorf("query failed: %s", resultSet.GetErrorMsg())
+	}
+
+	topo := &Topology{
+		Adjacency: make(map[string][]string),
+		TTB:       make(map[string]float64, resultSet.GetRowSize()),
+		HashValid: make(map[string]bool, resultSet.GetRowSize()),
+	}
+	for i := 0; i < resultSet.GetRowSize(); i++ {
+		record, err := resultSet.GetRowValuesByIndex(i)
+		if err != nil {
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
+			continue
+		}
+		id := safeString(record, 0)
+		topo.TTB[id] = safeFloat64(record, 1, 10)
+		topo.HashValid[id] = safeBool(record, 2)
+	}
+
+	edgeQuery := `MATCH (a:Asset)-[:connects_to]->(b:Asset)
+RETURN DISTINCT id(a) AS src, id(b) AS dst;`
+
+	resultSet, err = execute(ctx, session, "QueryTopology links", edgeQuery)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	if !resultSet.IsSucceed() {
+		return nil, fmt.Errorf("query failed: %s", resultSet.GetErrorMsg())
+	}
+	edges := 0
+	for i := 0; i < resultSet.GetRowSize(); i++ {
+		record, err := resultSet.GetRowValuesByIndex(i)
+		if err != nil {
+			slog.WarnContext(ctx, "nebula: skipping row", "row", i, "err", err)
+			continue
+		}
+		src := safeString(record, 0)
+		topo.Adjacency[src] = append(topo.Adjacency[src], safeString(record, 1))
+		edges++
+	}
+
+	slog.InfoContext(ctx, "nebula: QueryTopology completed", "assets", len(topo.TTB), "links", edges,
+		"elapsed", time.Since(queryStart))
+	return topo, nil
+}
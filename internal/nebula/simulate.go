@@ -0,0 +1,73 @@
+package nebula
+
+import (
+	"context"
+
+	"ESP-data/config"
+)
+
+// ============================================================
+// What-if TTB — the TTB algorithm over hypothetical applied_to
+// edges (ED001) layered on the stored graph; nothing is written
+// ============================================================
+
+// AppliedState is the hypothetical state of one applied_to edge.
+type AppliedState struct {
+	Maturity int
+	Active   bool
+}
+
+// MitigationOverlay replaces applied_to edges for a simulation:
+// Asset VID → Mitigation VID → edge state. A nil state removes the edge;
+// edges not named keep their stored state.
+type MitigationOverlay map[string]map[string]*AppliedState
+
+// overlaySource answers every TTBSource read from the wrapped source and
+// rewrites only the active-mitigation maturities of TTTInputs (ALG-REQ-060).
+type overlaySource struct {
+	TTBSource
+	overlay MitigationOverlay
+}
+
+// WithOverlay returns a TTBSource that sees the applied_to edges of src
+// with overlay applied on top.
+func WithOverlay(src TTBSource, overlay MitigationOverlay) TTBSource {
+	return overlaySource{TTBSource: src, overlay: overlay}
+}
+
+func (s overlaySource) TTTInputs(ctx context.Context, assetVid string, techniqueIDs []string) (map[string]TechniqueTTTInput, map[string]int, error) {
+	inputs, activeMaturity, err := s.TTBSource.TTTInputs(ctx, assetVid, techniqueIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	changes := s.overlay[assetVid]
+	if len(changes) == 0 {
+		return inputs, activeMaturity, nil
+	}
+	merged := make(map[string]int, len(activeMaturity)+len(changes))
+	for mv, mat := range activeMaturity {
+		merged[mv] = mat
+	}
+	for mv, state := range changes {
+		if state == nil || !state.Active {
+			delete(merged, mv)
+			continue
+		}
+		merged[mv] = state.Maturity
+	}
+	return inputs, merged, nil
+}
+
+// SimulateTTB runs ComputeTTB (ALG-REQ-070) against NebulaGraph with the
+// applied_to edges of overlay in place of the stored ones. It only reads;
+// Asset.TTB, hashes and the audit trail are left untouched.
+func SimulateTTB(ctx context.Context, pool *Pool, cfg *config.Config, mitre *MitreCache, assetVid, chainVid string, params TTBParams, overlay MitigationOverlay) (*TTBResult, error) {
+	session, err := openSession(ctx, pool, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Release()
+
+	src := snapshotOrSession(ctx, mitre, session, assetVid, chainVid)
+	return RunTTB(ctx, WithOverlay(src, overlay), assetVid, chainVid, params, nil)
+}
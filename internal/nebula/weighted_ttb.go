@@ -0,0 +1,375 @@
+package nebula
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+
+	"ESP-data/internal/store"
+)
+
+// ============================================================
+// Weighted TTB — expected TTB of an attacker who picks each tactic's
+// technique at random, weighted by patterns_to.probability and
+// priority, instead of always the fastest one (ALG-REQ-076 design note 4)
+// ============================================================
+
+// Distribution granularity: outcomes are kept to the nearest
+// distributionResolution hours while the chain is walked, at most
+// maxTTBOutcomes per branch after each tactic, and at most maxTTBOutcomes
+// are returned.
+const (
+	distributionResolution = 0.001
+	maxTTBOutcomes         = 64
+)
+
+// weightedState is what the next tactic's candidates depend on: the
+// technique chosen at the previous tactic ("" after a tactic without one)
+// and whether any technique was chosen yet, which decides the switchover
+// (ALG-REQ-072).
+type weightedState struct {
+	technique string
+	started   bool
+}
+
+// weightedBranch is the probability of one weightedState and the TTB
+// accumulated on the way there.
+type weightedBranch struct {
+	mass     float64
+	ttbSum   float64         // mass × expected TTB so far
+	outcomes map[int]float64 // TTB in distributionResolution units → probability; with Distribution only
+}
+
+// techniqueWeights returns the selection probability of each candidate:
+// priority (ALG-REQ-075) times the summed patterns_to.probability of the
+// candidate when the set came from patterns_to. A pattern set without
+// probabilities is weighted by priority alone. Duplicate techniques are
+// merged.
+func techniqueWeights(candidates []TechniqueCandidate, fromPatterns bool) ([]TechniqueCandidate, []float64) {
+	var merged []TechniqueCandidate
+	index := make(map[string]int)
+	for _, c := range candidates {
+		if j, ok := index[c.TechniqueID]; ok {
+			merged[j].Probability += c.Probability
+			continue
+		}
+		index[c.TechniqueID] = len(merged)
+		merged = append(merged, c)
+	}
+
+	usePatterns := false
+	if fromPatterns {
+		for _, c := range merged {
+			if c.Probability > 0 {
+				usePatterns = true
+				break
+			}
+		}
+	}
+
+	weights := make([]float64, len(merged))
+	var total float64
+	for i, c := range merged {
+		w := float64(max(c.Priority, 1))
+		if usePatterns {
+			w *= math.Max(c.Probability, 0)
+		}
+		weights[i] = w
+		total += w
+	}
+	for i := range weights {
+		if total > 0 {
+			weights[i] /= total
+		} else {
+			weights[i] = 1 / float64(len(weights))
+		}
+	}
+	return merged, weights
+}
+
+// runWeightedTTB walks the tactic chain like RunTTB, but follows every
+// weighted choice instead of the fastest one. Candidates depend on the
+// previous technique, so the walk carries the probability of each previous
+// technique from tactic to tactic; the result is exact, not sampled.
+//
+// The log names the most likely technique per tactic with its probability
+// and the expected TTT of the tactic; the audit breakdown records the same.
+func runWeightedTTB(ctx context.Context, src TTBSource, assetVid, chainVid string, params TTBParams, audit *store.AuditBuffer) (*TTBResult, error) {
+	tactics, err := src.OrderedTactics(ctx, chainVid)
+	if err != nil {
+		return nil, fmt.Errorf("ComputeTTB: %w", err)
+	}
+
+	hasVuln, err := src.AssetHasVulnerability(ctx, assetVid)
+	if err != nil {
+		slog.WarnContext(ctx, "nebula: ComputeTTB could not fetch has_vulnerability", "asset", assetVid, "err", err)
+	}
+
+	start := &weightedBranch{mass: 1}
+	if params.Distribution {
+		start.outcomes = map[int]float64{0: 1}
+	}
+	branches := map[weightedState]*weightedBranch{{}: start}
+
+	breakdownIdx := -1
+	if audit != nil {
+		breakdownIdx = len(audit.Breakdowns)
+		audit.Breakdowns = append(audit.Breakdowns, store.BreakdownRecord{
+			AssetVid:        assetVid,
+			ChainVid:        chainVid,
+			OrientationTime: params.OrientationTime,
+		})
+	}
+
+	ttt := make(map[string]float64) // TTT per technique; it does not depend on the branch
+	var ttbLog []TTBLogEntry
+	var previousTacticID string
+	techniqueCount := 0
+
+	for i, tactic := range tactics {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("ComputeTTB %s: %w", assetVid, err)
+		}
+
+		states := make([]weightedState, 0, len(branches))
+		for st := range branches {
+			states = append(states, st)
+		}
+		sort.Slice(states, func(a, b int) bool {
+			if states[a].technique != states[b].technique {
+				return states[a].technique < states[b].technique
+			}
+			return !states[a].started && states[b].started
+		})
+
+		next := make(map[weightedState]*weightedBranch)
+		chosen := make(map[string]float64) // technique → probability of being chosen here
+		names := make(map[string]string)
+		seen := make(map[string]bool)
+		var expectedTTT, switchoverMass float64
+
+		for _, st := range states {
+			b := branches[st]
+			var previousTechID *string
+			if st.technique != "" {
+				t := st.technique
+				previousTechID = &t
+			}
+			candidates, fromPatterns := tacticCandidates(ctx, src, assetVid, i, tactic, previousTacticID, previousTechID,
+				hasVuln, params.PriorityTolerance)
+			candidates, weights := techniqueWeights(candidates, fromPatterns)
+
+			if len(candidates) == 0 {
+				addBranch(next, weightedState{started: st.started}, b, 1, 0)
+				continue
+			}
+
+			var missing []TechniqueCandidate
+			for _, c := range candidates {
+				seen[c.TechniqueID] = true
+				if _, ok := ttt[c.TechniqueID]; !ok {
+					missing = append(missing, c)
+				}
+			}
+			if len(missing) > 0 {
+				if err := computeBatchTTT(ctx, src, assetVid, missing, nil, 0); err != nil {
+					slog.WarnContext(ctx, "nebula: ComputeTTB computeBatchTTT failed", "asset", assetVid,
+						"tactic", tactic.TacticID, "err", err)
+					for j := range missing {
+						missing[j].TTT = 999999.0
+					}
+				}
+				for _, c := range missing {
+					ttt[c.TechniqueID] = c.TTT
+				}
+			}
+
+			for j, c := range candidates {
+				q := weights[j]
+				if q == 0 {
+					continue
+				}
+				cost := ttt[c.TechniqueID]
+				expectedTTT += b.mass * q * cost
+				if st.started {
+					cost += params.SwitchoverTime
+					switchoverMass += b.mass * q
+				}
+				chosen[c.TechniqueID] += b.mass * q
+				names[c.TechniqueID] = c.TechniqueName
+				addBranch(next, weightedState{technique: c.TechniqueID, started: true}, b, q, cost)
+			}
+		}
+		branches = next
+		if params.Distribution {
+			compactBranches(branches)
+		}
+
+		entry := TTBLogEntry{
+			TacticID:        tactic.TacticID,
+			TacticName:      tactic.TacticName,
+			TTT:             expectedTTT,
+			CandidatesCount: len(seen),
+		}
+		step := store.TacticStepRecord{
+			BreakdownIdx:    breakdownIdx,
+			TacticSeq:       i,
+			TacticID:        tactic.TacticID,
+			TacticName:      tactic.TacticName,
+			TTTHours:        expectedTTT,
+			SwitchoverAdded: switchoverMass > 0,
+			CandidatesCount: len(seen),
+		}
+		if top, p := mostLikely(chosen); top != "" {
+			tid, tname, prob := top, names[top], p
+			entry.TechniqueID, entry.TechniqueName, entry.Probability = &tid, &tname, &prob
+			step.TechniqueID, step.TechniqueName = tid, tname
+			techniqueCount++
+		}
+		ttbLog = append(ttbLog, entry)
+		if audit != nil {
+			audit.TacticSteps = append(audit.TacticSteps, step)
+		}
+		previousTacticID = tactic.TacticID
+	}
+
+	ttb := params.OrientationTime
+	for _, b := range branches {
+		ttb += b.ttbSum
+	}
+	result := &TTBResult{TTB: ttb, Log: ttbLog}
+	if params.Distribution {
+		result.Distribution = ttbDistribution(branches, params.OrientationTime)
+	}
+
+	if audit != nil && breakdownIdx >= 0 {
+		audit.Breakdowns[breakdownIdx].TTBTotal = ttb
+		audit.Breakdowns[breakdownIdx].TacticCount = len(tactics)
+		audit.Breakdowns[breakdownIdx].TechniqueCount = techniqueCount
+	}
+	return result, nil
+}
+
+// addBranch moves probability q of branch b into state st of next, adding
+// cost hours to its TTB.
+func addBranch(next map[weightedState]*weightedBranch, st weightedState, b *weightedBranch, q, cost float64) {
+	nb, ok := next[st]
+	if !ok {
+		nb = &weightedBranch{}
+		if b.outcomes != nil {
+			nb.outcomes = make(map[int]float64)
+		}
+		next[st] = nb
+	}
+	nb.mass += b.mass * q
+	nb.ttbSum += q * (b.ttbSum + b.mass*cost)
+	if nb.outcomes != nil {
+		step := int(math.Round(cost / distributionResolution))
+		for v, p := range b.outcomes {
+			nb.outcomes[v+step] += p * q
+		}
+	}
+}
+
+// compactBranches bins the outcomes of every branch back to maxTTBOutcomes,
+// so that a long chain with many alternatives does not multiply them from
+// tactic to tactic.
+func compactBranches(branches map[weightedState]*weightedBranch) {
+	for _, b := range branches {
+		if len(b.outcomes) <= maxTTBOutcomes {
+			continue
+		}
+		values := sortedOutcomes(b.outcomes)
+		compacted := make(map[int]float64, maxTTBOutcomes)
+		binOutcomes(values, b.outcomes, func(mean, mass float64) {
+			compacted[int(math.Round(mean))] += mass
+		})
+		b.outcomes = compacted
+	}
+}
+
+// mostLikely returns the technique with the highest probability, the lowest
+// ID on a tie.
+func mostLikely(chosen map[string]float64) (string, float64) {
+	var top string
+	var best float64
+	for id, p := range chosen {
+		if p > best || (p == best && id < top) {
+			top, best = id, p
+		}
+	}
+	return top, best
+}
+
+// ttbDistribution merges the outcomes of every branch, shifted by the
+// orientation time (ALG-REQ-071), into ascending TTB outcomes. Beyond
+// maxTTBOutcomes values they are binned by binOutcomes.
+func ttbDistribution(branches map[weightedState]*weightedBranch, orientationTime float64) []TTBOutcome {
+	merged := make(map[int]float64)
+	for _, b := range branches {
+		for v, p := range b.outcomes {
+			merged[v] += p
+		}
+	}
+	values := sortedOutcomes(merged)
+
+	outcomes := make([]TTBOutcome, 0, min(len(values), maxTTBOutcomes))
+	if len(values) <= maxTTBOutcomes {
+		for _, v := range values {
+			outcomes = append(outcomes, TTBOutcome{
+				TTB:         orientationTime + float64(v)*distributionResolution,
+				Probability: merged[v],
+			})
+		}
+		return outcomes
+	}
+	binOutcomes(values, merged, func(mean, mass float64) {
+		outcomes = append(outcomes, TTBOutcome{
+			TTB:         orientationTime + mean*distributionResolution,
+			Probability: mass,
+		})
+	})
+	return outcomes
+}
+
+// sortedOutcomes returns the keys of outcomes in ascending order.
+func sortedOutcomes(outcomes map[int]float64) []int {
+	values := make([]int, 0, len(outcomes))
+	for v := range outcomes {
+		values = append(values, v)
+	}
+	sort.Ints(values)
+	return values
+}
+
+// binOutcomes splits the range of values (ascending, in
+// distributionResolution units) into maxTTBOutcomes equal-width bins and
+// calls emit for each non-empty bin, in order, with its probability-weighted
+// mean and its probability.
+func binOutcomes(values []int, probability map[int]float64, emit func(mean, mass float64)) {
+	lo, hi := values[0], values[len(values)-1]
+	width := float64(hi-lo) / maxTTBOutcomes
+	var bin int
+	var sum, mass float64
+	flush := func() {
+		if mass > 0 {
+			emit(sum/mass, mass)
+		}
+		sum, mass = 0, 0
+	}
+	for _, v := range values {
+		b := 0
+		if width > 0 {
+			b = min(int(float64(v-lo)/width), maxTTBOutcomes-1)
+		}
+		if b != bin {
+			flush()
+			bin = b
+		}
+		sum += float64(v) * probability[v]
+		mass += probability[v]
+	}
+	flush()
+}
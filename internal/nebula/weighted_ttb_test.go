@@ -0,0 +1,108 @@
+package nebula
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// TestCompactBranchesBoundsOutcomes walks a wide chain the way
+// runWeightedTTB does: every tactic offers the same techniques with distinct
+// costs, so without binning the outcomes of a branch multiply per tactic.
+func TestCompactBranchesBoundsOutcomes(t *testing.T) {
+	const tactics, techniques = 20, 9
+
+	branches := map[weightedState]*weightedBranch{{}: {mass: 1, outcomes: map[int]float64{0: 1}}}
+	for i := 0; i < tactics; i++ {
+		next := make(map[weightedState]*weightedBranch)
+		for _, b := range branches {
+			for j := 0; j < techniques; j++ {
+				cost := 0.5 + float64(j)*0.173 + float64(i)*0.0071
+				addBranch(next, weightedState{technique: fmt.Sprintf("T%d", j), started: true}, b, 1.0/techniques, cost)
+			}
+		}
+		branches = next
+		compactBranches(branches)
+
+		var mass float64
+		for st, b := range branches {
+			if len(b.outcomes) > maxTTBOutcomes {
+				t.Fatalf("tactic %d: branch %s holds %d outcomes, want at most %d", i, st.technique, len(b.outcomes), maxTTBOutcomes)
+			}
+			for _, p := range b.outcomes {
+				mass += p
+			}
+		}
+		if math.Abs(mass-1) > 1e-9 {
+			t.Fatalf("tactic %d: outcome probabilities sum to %g, want 1", i, mass)
+		}
+	}
+
+	var ttb, mean float64
+	for _, b := range branches {
+		ttb += b.ttbSum
+		for v, p := range b.outcomes {
+			mean += float64(v) * distributionResolution * p
+		}
+	}
+	if math.Abs(mean-ttb) > 0.01 {
+		t.Errorf("binned outcomes average %g, want the expected TTB %g", mean, ttb)
+	}
+}
+
+// TestWeightedDistributionWideChain runs RunTTB with a distribution over a
+// chain of many tactics with many equally weighted techniques each.
+func TestWeightedDistributionWideChain(t *testing.T) {
+	const tactics, techniques = 12, 8
+
+	snap := &MitreSnapshot{
+		Chains:     map[string][]TacticRef{"C1": nil},
+		Techniques: make(map[string]*SnapshotTechnique),
+	}
+	for i := 0; i < tactics; i++ {
+		tactic := fmt.Sprintf("TA%04d", i+1)
+		snap.Chains["C1"] = append(snap.Chains["C1"], TacticRef{VID: tactic, TacticID: tactic, TacticName: tactic})
+		for j := 0; j < techniques; j++ {
+			id := fmt.Sprintf("T%02d%02d", i, j)
+			min := 0.25 + float64(j)*0.31 + float64(i)*0.017
+			snap.Techniques[id] = &SnapshotTechnique{
+				TechniqueID:   id,
+				TechniqueName: id,
+				Priority:      1,
+				ExecMin:       min,
+				ExecMax:       min * 4,
+				Tactics:       map[string]bool{tactic: true},
+				Platforms:     map[string]bool{"PLTF001": true},
+			}
+		}
+	}
+	src := NewSnapshotSource(snap, &AssetProfile{Platforms: map[string]bool{"PLTF001": true}})
+
+	params := TTBParams{OrientationTime: 2, SwitchoverTime: 0.5, Selection: TTBSelectionWeighted, Distribution: true}
+	res, err := RunTTB(context.Background(), src, "A1", "C1", params, nil)
+	if err != nil {
+		t.Fatalf("RunTTB: %v", err)
+	}
+	if len(res.Log) != tactics {
+		t.Fatalf("%d log entries, want %d", len(res.Log), tactics)
+	}
+	if n := len(res.Distribution); n == 0 || n > maxTTBOutcomes {
+		t.Fatalf("%d outcomes, want 1..%d", n, maxTTBOutcomes)
+	}
+
+	var mass, mean float64
+	for i, o := range res.Distribution {
+		if i > 0 && o.TTB <= res.Distribution[i-1].TTB {
+			t.Errorf("outcome %d at %g does not follow %g", i, o.TTB, res.Distribution[i-1].TTB)
+		}
+		mass += o.Probability
+		mean += o.TTB * o.Probability
+	}
+	if math.Abs(mass-1) > 1e-9 {
+		t.Errorf("probabilities sum to %g, want 1", mass)
+	}
+	if math.Abs(mean-res.TTB) > 0.01 {
+		t.Errorf("distribution averages %g, want the TTB %g", mean, res.TTB)
+	}
+}
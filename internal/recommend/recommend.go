@@ -0,0 +1,610 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"ESP-data/internal/graph"
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/nebula"
+)
+
+// ============================================================
+// Mitigation recommender — budget-constrained applied_to additions
+// (ED001) that maximise the minimum TTA over entry/target pairs
+// (ALG-REQ-010, ALG-REQ-060, ALG-REQ-070)
+// ============================================================
+
+// Search strategies.
+const (
+	StrategyGreedy = "greedy"
+	StrategyExact  = "exact"
+)
+
+// MaxExactEvaluations caps the number of plans the exact strategy may score.
+const MaxExactEvaluations = 20000
+
+// ErrNoPaths is returned when no pair has a path within the hop limit.
+var ErrNoPaths = errors.New("no entry/target pair has a path within the hop limit")
+
+// Pair is one entry/target combination.
+type Pair struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Budget limits a plan by the number of new assignments, their total cost,
+// or both. Costs maps a mitigation ID to the cost of one assignment;
+// unlisted mitigations cost 1. A zero limit means "not limited".
+type Budget struct {
+	MaxMitigations int                `json:"max_mitigations"`
+	MaxCost        float64            `json:"max_cost"`
+	Costs          map[string]float64 `json:"costs"`
+}
+
+func (b Budget) cost(mitigationID string) float64 {
+	if c, ok := b.Costs[mitigationID]; ok {
+		return c
+	}
+	return 1
+}
+
+// Request describes one recommendation run.
+type Request struct {
+	Pairs      []Pair
+	MaxHops    int
+	Budget     Budget
+	Maturities []int
+	Strategy   string
+	Params     nebula.TTBParams
+	// Chains resolves the tactic chain of each asset per position; nil
+	// uses the default chains (ALG-REQ-051).
+	Chains *nebula.ChainAssignments
+}
+
+// Step is one assignment of the plan with the minimum TTA before and after
+// it is applied on top of the previous steps.
+type Step struct {
+	Rank         int     `json:"rank"`
+	Action       string  `json:"action"`
+	MitigationID string  `json:"mitigation_id"`
+	AssetID      string  `json:"asset_id"`
+	Maturity     int     `json:"maturity"`
+	Cost         float64 `json:"cost"`
+	MinTTABefore float64 `json:"min_tta_before"`
+	MinTTAAfter  float64 `json:"min_tta_after"`
+	Gain         float64 `json:"gain"`
+	Bottleneck   Pair    `json:"bottleneck"`
+}
+
+// PairResult is the fastest path of one pair before and after the plan.
+type PairResult struct {
+	From        string  `json:"from"`
+	To          string  `json:"to"`
+	Reachable   bool    `json:"reachable"`
+	TTABefore   float64 `json:"tta_before,omitempty"`
+	TTAAfter    float64 `json:"tta_after,omitempty"`
+	HostsBefore string  `json:"hosts_before,omitempty"`
+	HostsAfter  string  `json:"hosts_after,omitempty"`
+}
+
+// Plan is the recommender result.
+type Plan struct {
+	Strategy       string       `json:"strategy"`
+	BaselineMinTTA float64      `json:"baseline_min_tta"`
+	FinalMinTTA    float64      `json:"final_min_tta"`
+	TotalGain      float64      `json:"total_gain"`
+	TotalCost      float64      `json:"total_cost"`
+	Steps          []Step       `json:"steps"`
+	Pairs          []PairResult `json:"pairs"`
+	Candidates     int          `json:"candidates"`
+	Evaluations    int          `json:"evaluations"`
+}
+
+// assignment is one candidate applied_to edge at a given maturity.
+type assignment struct {
+	MitigationID string
+	AssetID      string
+	Maturity     int
+	Action       string
+	Cost         float64
+}
+
+func (a assignment) key() string {
+	return a.MitigationID + "->" + a.AssetID
+}
+
+// outcome is the fastest path per reachable pair under one overlay.
+type outcome struct {
+	minTTA     float64
+	sumTTA     float64
+	bottleneck Pair
+	tta        map[Pair]float64
+	paths      map[Pair][]string
+}
+
+// betterThan orders outcomes by minimum TTA, then by the sum over pairs so
+// that a step lifting a non-bottleneck pair still counts as progress.
+func (o *outcome) betterThan(p *outcome) bool {
+	const eps = 1e-9
+	if o.minTTA > p.minTTA+eps {
+		return true
+	}
+	if o.minTTA < p.minTTA-eps {
+		return false
+	}
+	return o.sumTTA > p.sumTTA+eps
+}
+
+// engine evaluates overlays with memoised per-asset TTB. Nothing it calls
+// writes to the graph: TTB comes from GraphStore.SimulateTTB.
+type engine struct {
+	ctx         context.Context // checked between evaluations
+	gs          graphstore.GraphStore
+	req         Request
+	topo        *nebula.Topology
+	ttbs        map[string]*nebula.TTBResult
+	stored      map[string]map[string]nebula.AppliedState
+	techMits    map[string][]string
+	evaluations int
+}
+
+// Recommend returns a ranked plan of applied_to assignments that raises the
+// minimum TTA over req.Pairs as far as the budget allows. The greedy strategy
+// adds, at each step, the assignment with the best gain per cost among the
+// mitigations of the techniques on the current fastest paths. The exact
+// strategy scores every combination of the candidates found on the baseline
+// fastest paths (at most MaxExactEvaluations) and ranks the best one by
+// marginal gain. The search stops with ctx.Err() once ctx is done.
+func Recommend(ctx context.Context, gs graphstore.GraphStore, req Request) (*Plan, error) {
+	runStart := time.Now()
+
+	topo, err := gs.QueryTopology(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load topology: %w", err)
+	}
+	e := &engine{
+		ctx:      ctx,
+		gs:       gs,
+		req:      req,
+		topo:     topo,
+		ttbs:     make(map[string]*nebula.TTBResult),
+		stored:   make(map[string]map[string]nebula.AppliedState),
+		techMits: make(map[string][]string),
+	}
+	base := e.evaluate(nil)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(base.tta) == 0 {
+		return nil, ErrNoPaths
+	}
+
+	var chosen []assignment
+	var candidates int
+	switch req.Strategy {
+	case StrategyExact:
+		chosen, candidates, err = e.exact(base)
+	default:
+		chosen, candidates, err = e.greedy(base)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		Strategy:       req.Strategy,
+		BaselineMinTTA: base.minTTA,
+		Steps:          []Step{},
+		Candidates:     candidates,
+	}
+	overlay := nebula.MitigationOverlay{}
+	cur := base
+	for i, a := range chosen {
+		overlay = withAssignment(overlay, a)
+		next := e.evaluate(overlay)
+		plan.Steps = append(plan.Steps, Step{
+			Rank:         i + 1,
+			Action:       a.Action,
+			MitigationID: a.MitigationID,
+			AssetID:      a.AssetID,
+			Maturity:     a.Maturity,
+			Cost:         a.Cost,
+			MinTTABefore: cur.minTTA,
+			MinTTAAfter:  next.minTTA,
+			Gain:         next.minTTA - cur.minTTA,
+			Bottleneck:   next.bottleneck,
+		})
+		plan.TotalCost += a.Cost
+		cur = next
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	plan.FinalMinTTA = cur.minTTA
+	plan.TotalGain = cur.minTTA - base.minTTA
+
+	for _, p := range req.Pairs {
+		r := PairResult{From: p.From, To: p.To}
+		if tta, ok := base.tta[p]; ok {
+			r.Reachable = true
+			r.TTABefore = tta
+			r.HostsBefore = strings.Join(base.paths[p], " -> ")
+			r.TTAAfter = cur.tta[p]
+			r.HostsAfter = strings.Join(cur.paths[p], " -> ")
+		}
+		plan.Pairs = append(plan.Pairs, r)
+	}
+	plan.Evaluations = e.evaluations
+
+	slog.InfoContext(ctx, "recommend: plan computed", "strategy", req.Strategy, "pairs", len(req.Pairs),
+		"steps", len(plan.Steps), "min_tta_before", plan.BaselineMinTTA, "min_tta_after", plan.FinalMinTTA,
+		"candidates", candidates, "evaluations", e.evaluations, "elapsed", time.Since(runStart))
+	return plan, nil
+}
+
+// greedy adds the best assignment per step until the budget is spent or no
+// candidate improves the outcome.
+func (e *engine) greedy(base *outcome) ([]assignment, int, error) {
+	var chosen []assignment
+	overlay := nebula.MitigationOverlay{}
+	planned := make(map[string]bool)
+	cur := base
+	spent := 0.0
+	seen := make(map[string]bool)
+
+	for e.req.Budget.MaxMitigations == 0 || len(chosen) < e.req.Budget.MaxMitigations {
+		cands, err := e.candidates(overlay, cur)
+		if err != nil {
+			return nil, 0, err
+		}
+		var best *assignment
+		var bestOut *outcome
+		var bestScore, bestSumScore float64
+		for i := range cands {
+			if err := e.ctx.Err(); err != nil {
+				return nil, 0, err
+			}
+			c := cands[i]
+			seen[fmt.Sprintf("%s@%d", c.key(), c.Maturity)] = true
+			if planned[c.key()] {
+				continue
+			}
+			if e.req.Budget.MaxCost > 0 && spent+c.Cost > e.req.Budget.MaxCost+1e-9 {
+				continue
+			}
+			out := e.evaluate(withAssignment(overlay, c))
+			if !out.betterThan(cur) {
+				continue
+			}
+			score := (out.minTTA - cur.minTTA) / c.Cost
+			sumScore := (out.sumTTA - cur.sumTTA) / c.Cost
+			if best == nil || score > bestScore+1e-9 ||
+				(score > bestScore-1e-9 && sumScore > bestSumScore+1e-9) {
+				best, bestOut, bestScore, bestSumScore = &cands[i], out, score, sumScore
+			}
+		}
+		if best == nil {
+			break
+		}
+		chosen = append(chosen, *best)
+		planned[best.key()] = true
+		overlay = withAssignment(overlay, *best)
+		spent += best.Cost
+		cur = bestOut
+	}
+	return chosen, len(seen), nil
+}
+
+// exact scores every budget-feasible combination of the baseline candidates
+// (at most one maturity per mitigation/asset) and orders the best
+// combination by marginal gain.
+func (e *engine) exact(base *outcome) ([]assignment, int, error) {
+	cands, err := e.candidates(nebula.MitigationOverlay{}, base)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Group the maturity options of each mitigation/asset.
+	var groups [][]assignment
+	idx := make(map[string]int)
+	for _, c := range cands {
+		i, ok := idx[c.key()]
+		if !ok {
+			i = len(groups)
+			idx[c.key()] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], c)
+	}
+
+	budget := e.req.Budget
+	var walk func(g int, count int, cost float64, pick []assignment, visit func([]assignment) bool) bool
+	walk = func(g int, count int, cost float64, pick []assignment, visit func([]assignment) bool) bool {
+		if g == len(groups) {
+			return visit(pick)
+		}
+		if !walk(g+1, count, cost, pick, visit) {
+			return false
+		}
+		if budget.MaxMitigations > 0 && count >= budget.MaxMitigations {
+			return true
+		}
+		for _, c := range groups[g] {
+			if budget.MaxCost > 0 && cost+c.Cost > budget.MaxCost+1e-9 {
+				continue
+			}
+			if !walk(g+1, count+1, cost+c.Cost, append(pick, c), visit) {
+				return false
+			}
+		}
+		return true
+	}
+
+	combos := 0
+	walk(0, 0, 0, nil, func([]assignment) bool {
+		combos++
+		return combos <= MaxExactEvaluations
+	})
+	if combos > MaxExactEvaluations {
+		return nil, 0, fmt.Errorf("exact search needs more than %d evaluations for %d candidates; use the greedy strategy or a smaller budget",
+			MaxExactEvaluations, len(cands))
+	}
+
+	var best []assignment
+	bestOut := base
+	bestCost := 0.0
+	walk(0, 0, 0, nil, func(pick []assignment) bool {
+		if len(pick) == 0 {
+			return true
+		}
+		if e.ctx.Err() != nil {
+			return false
+		}
+		overlay := nebula.MitigationOverlay{}
+		cost := 0.0
+		for _, a := range pick {
+			overlay = withAssignment(overlay, a)
+			cost += a.Cost
+		}
+		out := e.evaluate(overlay)
+		if out.betterThan(bestOut) || (best != nil && !bestOut.betterThan(out) && cost < bestCost-1e-9) {
+			best = append([]assignment(nil), pick...)
+			bestOut, bestCost = out, cost
+		}
+		return true
+	})
+
+	if err := e.ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// Rank the chosen assignments by marginal gain.
+	var ordered []assignment
+	overlay := nebula.MitigationOverlay{}
+	for len(best) > 0 {
+		bi := 0
+		var bo *outcome
+		for i, a := range best {
+			out := e.evaluate(withAssignment(overlay, a))
+			if bo == nil || out.betterThan(bo) {
+				bi, bo = i, out
+			}
+		}
+		ordered = append(ordered, best[bi])
+		overlay = withAssignment(overlay, best[bi])
+		best = append(best[:bi], best[bi+1:]...)
+	}
+	return ordered, len(cands), nil
+}
+
+// candidates lists the assignments that can change the TTB of an asset on a
+// current fastest path: mitigations of the techniques its TTB log selected,
+// at every allowed maturity above the edge's current active maturity.
+func (e *engine) candidates(overlay nebula.MitigationOverlay, out *outcome) ([]assignment, error) {
+	techsByAsset := make(map[string]map[string]bool)
+	for _, ids := range out.paths {
+		for i, id := range ids {
+			res := e.ttb(id, e.req.Chains.ChainAt(id, i, len(ids)), overlay)
+			for _, entry := range res.Log {
+				if entry.TechniqueID == nil {
+					continue
+				}
+				if techsByAsset[id] == nil {
+					techsByAsset[id] = make(map[string]bool)
+				}
+				techsByAsset[id][*entry.TechniqueID] = true
+			}
+		}
+	}
+
+	var missing []string
+	for _, techs := range techsByAsset {
+		for t := range techs {
+			if _, ok := e.techMits[t]; !ok {
+				missing = append(missing, t)
+				e.techMits[t] = nil
+			}
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		found, err := e.gs.QueryTechniqueMitigations(e.ctx, missing)
+		if err != nil {
+			return nil, fmt.Errorf("load technique mitigations: %w", err)
+		}
+		for t, mits := range found {
+			e.techMits[t] = mits
+		}
+	}
+
+	var result []assignment
+	assets := make([]string, 0, len(techsByAsset))
+	for id := range techsByAsset {
+		assets = append(assets, id)
+	}
+	sort.Strings(assets)
+	for _, assetID := range assets {
+		stored, err := e.storedEdges(assetID)
+		if err != nil {
+			return nil, err
+		}
+		mits := make(map[string]bool)
+		for t := range techsByAsset[assetID] {
+			for _, m := range e.techMits[t] {
+				mits[m] = true
+			}
+		}
+		mitIDs := make([]string, 0, len(mits))
+		for m := range mits {
+			mitIDs = append(mitIDs, m)
+		}
+		sort.Strings(mitIDs)
+
+		for _, m := range mitIDs {
+			cur, exists := stored[m]
+			if planned, ok := overlay[assetID][m]; ok {
+				exists = planned != nil
+				if planned != nil {
+					cur = *planned
+				}
+			}
+			action := "add"
+			if exists {
+				action = "update"
+			}
+			for _, level := range e.req.Maturities {
+				if exists && cur.Active && cur.Maturity >= level {
+					continue
+				}
+				result = append(result, assignment{
+					MitigationID: m,
+					AssetID:      assetID,
+					Maturity:     level,
+					Action:       action,
+					Cost:         e.req.Budget.cost(m),
+				})
+			}
+		}
+	}
+	return result, nil
+}
+
+// evaluate finds the fastest path of every pair under overlay. Entry and
+// target TTB use their position chains; intermediates use the intermediate
+// chain (ALG-REQ-051).
+func (e *engine) evaluate(overlay nebula.MitigationOverlay) *outcome {
+	e.evaluations++
+	out := &outcome{
+		tta:   make(map[Pair]float64),
+		paths: make(map[Pair][]string),
+	}
+	first := true
+	for _, p := range e.req.Pairs {
+		if p.From == p.To {
+			continue
+		}
+		weight := func(id string) float64 {
+			if id == p.From || id == p.To {
+				return 0
+			}
+			return e.ttb(id, e.req.Chains.Chain(id, nebula.PositionIntermediate), overlay).TTB
+		}
+		found := graph.KShortestPaths(e.topo.Adjacency, weight, p.From, p.To, 1, e.req.MaxHops)
+		if len(found) == 0 {
+			continue
+		}
+		tta := e.ttb(p.From, e.req.Chains.Chain(p.From, nebula.PositionEntrance), overlay).TTB +
+			found[0].Cost +
+			e.ttb(p.To, e.req.Chains.Chain(p.To, nebula.PositionTarget), overlay).TTB
+		out.tta[p] = tta
+		out.paths[p] = found[0].Nodes
+		out.sumTTA += tta
+		if first || tta < out.minTTA {
+			out.minTTA, out.bottleneck, first = tta, p, false
+		}
+	}
+	return out
+}
+
+// ttb returns the memoised TTB of assetID with chainVID under the part of
+// overlay that touches the asset. Failures fall back to the stored TTB.
+func (e *engine) ttb(assetID, chainVID string, overlay nebula.MitigationOverlay) *nebula.TTBResult {
+	key := assetID + "|" + chainVID + "|" + overlayKey(overlay[assetID])
+	if res, ok := e.ttbs[key]; ok {
+		return res
+	}
+	res, err := e.gs.SimulateTTB(e.ctx, assetID, chainVID, e.req.Params, overlay)
+	if err != nil && e.ctx.Err() != nil {
+		// Cancelled: the caller discards this outcome, so do not memoise it.
+		return &nebula.TTBResult{TTB: e.topo.TTB[assetID]}
+	}
+	if err != nil {
+		slog.WarnContext(e.ctx, "recommend: SimulateTTB failed, using stored TTB",
+			"chain", chainVID, "asset", assetID, "err", err)
+		ttb, ok := e.topo.TTB[assetID]
+		if !ok {
+			ttb = 10.0
+		}
+		res = &nebula.TTBResult{TTB: ttb}
+	}
+	e.ttbs[key] = res
+	return res
+}
+
+// storedEdges returns the applied_to edges of an asset as stored.
+func (e *engine) storedEdges(assetID string) (map[string]nebula.AppliedState, error) {
+	if edges, ok := e.stored[assetID]; ok {
+		return edges, nil
+	}
+	rows, err := e.gs.QueryAssetMitigations(e.ctx, assetID)
+	if err != nil {
+		return nil, fmt.Errorf("load mitigations of %s: %w", assetID, err)
+	}
+	edges := make(map[string]nebula.AppliedState, len(rows))
+	for _, r := range rows {
+		id, _ := r["mitigation_id"].(string)
+		maturity, _ := r["maturity"].(int)
+		active, _ := r["active"].(bool)
+		edges[id] = nebula.AppliedState{Maturity: maturity, Active: active}
+	}
+	e.stored[assetID] = edges
+	return edges, nil
+}
+
+// withAssignment returns a copy of overlay with a applied as an active edge.
+func withAssignment(overlay nebula.MitigationOverlay, a assignment) nebula.MitigationOverlay {
+	next := make(nebula.MitigationOverlay, len(overlay)+1)
+	for asset, edges := range overlay {
+		next[asset] = edges
+	}
+	edges := make(map[string]*nebula.AppliedState, len(overlay[a.AssetID])+1)
+	for m, s := range overlay[a.AssetID] {
+		edges[m] = s
+	}
+	edges[a.MitigationID] = &nebula.AppliedState{Maturity: a.Maturity, Active: true}
+	next[a.AssetID] = edges
+	return next
+}
+
+// overlayKey is a canonical form of one asset's overlay for memoisation.
+func overlayKey(edges map[string]*nebula.AppliedState) string {
+	if len(edges) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(edges))
+	for m, s := range edges {
+		if s == nil {
+			keys = append(keys, m+"=-")
+		} else {
+			keys = append(keys, fmt.Sprintf("%s=%d/%t", m, s.Maturity, s.Active))
+		}
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
@@ -0,0 +1,188 @@
+package recommend
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/nebula"
+)
+
+// recommendFixture has one entry E and one target T joined through two
+// intermediates, so a mitigation on an intermediate only lifts one of the
+// two paths. Every tactic has one technique, each with its own mitigation;
+// the target's privilege escalation has the widest execution range.
+const recommendFixture = `{
+  "Asset": [
+    {"Asset_ID": "E", "Asset_Name": "fw", "is_entrance": true},
+    {"Asset_ID": "M1", "Asset_Name": "web"},
+    {"Asset_ID": "M2", "Asset_Name": "vpn"},
+    {"Asset_ID": "T", "Asset_Name": "db", "is_target": true}
+  ],
+  "OS_Type": [{"OS_ID": "OS1", "OS_Name": "Linux"}],
+  "MitrePlatform": [{"platform_id": "PLTF001", "platform_name": "Linux"}],
+  "tMitreTactic": [
+    {"Tactic_ID": "TA0001", "Tactic_Name": "Initial Access"},
+    {"Tactic_ID": "TA0002", "Tactic_Name": "Execution"},
+    {"Tactic_ID": "TA0004", "Tactic_Name": "Privilege Escalation"}
+  ],
+  "tMitreTechnique": [
+    {"Technique_ID": "T1", "Technique_Name": "External Remote Services", "priority": 1, "execution_min": 1, "execution_max": 5},
+    {"Technique_ID": "T2", "Technique_Name": "Unix Shell", "priority": 1, "execution_min": 1, "execution_max": 9},
+    {"Technique_ID": "T3", "Technique_Name": "Sudo", "priority": 1, "execution_min": 2, "execution_max": 12}
+  ],
+  "tMitreMitigation": [
+    {"Mitigation_ID": "MA", "Mitigation_Name": "MFA"},
+    {"Mitigation_ID": "MB", "Mitigation_Name": "Execution Prevention"},
+    {"Mitigation_ID": "MC", "Mitigation_Name": "Privileged Account Management"}
+  ],
+  "tMitreState": [{"state_id": "TA0001|T1"}, {"state_id": "TA0002|T2"}, {"state_id": "TA0004|T3"}],
+  "TacticChain": [
+    {"chain_id": "CHAIN_ENTRANCE"}, {"chain_id": "CHAIN_INTERMEDIATE"}, {"chain_id": "CHAIN_TARGET"}
+  ],
+  "runs_on": [
+    {"src": "E", "dst": "OS1"}, {"src": "M1", "dst": "OS1"}, {"src": "M2", "dst": "OS1"}, {"src": "T", "dst": "OS1"}
+  ],
+  "represents": [{"src": "OS1", "dst": "PLTF001"}],
+  "connects_to": [
+    {"src": "E", "dst": "M1", "Connection_Protocol": "TCP", "Connection_Port": "443"},
+    {"src": "E", "dst": "M2", "Connection_Protocol": "TCP", "Connection_Port": "443"},
+    {"src": "M1", "dst": "T", "Connection_Protocol": "TCP", "Connection_Port": "5432"},
+    {"src": "M2", "dst": "T", "Connection_Protocol": "TCP", "Connection_Port": "5432"}
+  ],
+  "part_of": [
+    {"src": "T1", "dst": "TA0001"}, {"src": "T2", "dst": "TA0002"}, {"src": "T3", "dst": "TA0004"}
+  ],
+  "can_be_executed_on": [
+    {"src": "T1", "dst": "PLTF001"}, {"src": "T2", "dst": "PLTF001"}, {"src": "T3", "dst": "PLTF001"}
+  ],
+  "mitigates": [
+    {"src": "MA", "dst": "T1"}, {"src": "MB", "dst": "T2"}, {"src": "MC", "dst": "T3"}
+  ],
+  "patterns_to": [
+    {"src": "TA0001|T1", "dst": "TA0002|T2", "probability": 1.0},
+    {"src": "TA0002|T2", "dst": "TA0004|T3", "probability": 1.0}
+  ],
+  "chain_includes": [
+    {"src": "CHAIN_ENTRANCE", "dst": "TA0001"},
+    {"src": "CHAIN_ENTRANCE", "dst": "TA0002", "rank": 1},
+    {"src": "CHAIN_INTERMEDIATE", "dst": "TA0002"},
+    {"src": "CHAIN_TARGET", "dst": "TA0002"},
+    {"src": "CHAIN_TARGET", "dst": "TA0004", "rank": 1}
+  ]
+}`
+
+func loadFixture(t *testing.T) graphstore.GraphStore {
+	t.Helper()
+	m := graphstore.NewMemoryStore()
+	if err := m.Load(strings.NewReader(recommendFixture)); err != nil {
+		t.Fatalf("load fixture: %v", err)
+	}
+	return m
+}
+
+func request(strategy string, budget Budget) Request {
+	return Request{
+		Pairs:      []Pair{{From: "E", To: "T"}},
+		MaxHops:    3,
+		Budget:     budget,
+		Maturities: []int{50, 100},
+		Strategy:   strategy,
+		Params:     nebula.TTBParams{OrientationTime: 0.25, SwitchoverTime: 0.1},
+	}
+}
+
+func TestRecommendBudgets(t *testing.T) {
+	tests := []struct {
+		name   string
+		budget Budget
+	}{
+		{"one mitigation", Budget{MaxMitigations: 1}},
+		{"two mitigations", Budget{MaxMitigations: 2}},
+		{"cost limit", Budget{MaxCost: 3, Costs: map[string]float64{"MC": 2.5}}},
+		{"unlimited", Budget{}},
+	}
+	ctx := context.Background()
+	gs := loadFixture(t)
+	for _, tt := range tests {
+		for _, strategy := range []string{StrategyGreedy, StrategyExact} {
+			t.Run(tt.name+"/"+strategy, func(t *testing.T) {
+				plan, err := Recommend(ctx, gs, request(strategy, tt.budget))
+				if err != nil {
+					t.Fatalf("Recommend: %v", err)
+				}
+				if tt.budget.MaxMitigations > 0 && len(plan.Steps) > tt.budget.MaxMitigations {
+					t.Errorf("%d steps over a budget of %d", len(plan.Steps), tt.budget.MaxMitigations)
+				}
+				if tt.budget.MaxCost > 0 && plan.TotalCost > tt.budget.MaxCost+1e-9 {
+					t.Errorf("total cost %g over a budget of %g", plan.TotalCost, tt.budget.MaxCost)
+				}
+				if len(plan.Steps) == 0 || plan.FinalMinTTA <= plan.BaselineMinTTA {
+					t.Fatalf("plan does not raise the minimum TTA: %+v", plan)
+				}
+				var gain, cost float64
+				seen := make(map[string]bool)
+				for i, s := range plan.Steps {
+					if s.AssetID == "M1" || s.AssetID == "M2" {
+						t.Errorf("step %d mitigates %s, which lifts only one of two paths", i+1, s.AssetID)
+					}
+					if seen[s.MitigationID+"->"+s.AssetID] {
+						t.Errorf("step %d repeats %s on %s", i+1, s.MitigationID, s.AssetID)
+					}
+					seen[s.MitigationID+"->"+s.AssetID] = true
+					if s.Rank != i+1 || math.Abs(s.MinTTAAfter-s.MinTTABefore-s.Gain) > 1e-9 {
+						t.Errorf("step %d inconsistent: %+v", i+1, s)
+					}
+					gain += s.Gain
+					cost += s.Cost
+				}
+				if math.Abs(gain-plan.TotalGain) > 1e-9 || math.Abs(cost-plan.TotalCost) > 1e-9 {
+					t.Errorf("steps sum to gain %g and cost %g, plan reports %g and %g", gain, cost, plan.TotalGain, plan.TotalCost)
+				}
+				if len(plan.Pairs) != 1 || !plan.Pairs[0].Reachable || plan.Pairs[0].TTAAfter != plan.FinalMinTTA {
+					t.Errorf("pair results %+v do not match the plan", plan.Pairs)
+				}
+			})
+		}
+	}
+}
+
+// TestRecommendFirstStep checks that both strategies start with the
+// assignment that lifts the bottleneck most: T3 on the target has the
+// widest execution range.
+func TestRecommendFirstStep(t *testing.T) {
+	ctx := context.Background()
+	gs := loadFixture(t)
+	for _, strategy := range []string{StrategyGreedy, StrategyExact} {
+		plan, err := Recommend(ctx, gs, request(strategy, Budget{MaxMitigations: 1}))
+		if err != nil {
+			t.Fatalf("%s: Recommend: %v", strategy, err)
+		}
+		if len(plan.Steps) != 1 {
+			t.Fatalf("%s: %d steps, want 1", strategy, len(plan.Steps))
+		}
+		s := plan.Steps[0]
+		if s.MitigationID != "MC" || s.AssetID != "T" || s.Action != "add" {
+			t.Errorf("%s: first step %+v, want add MC to T", strategy, s)
+		}
+	}
+}
+
+func TestRecommendNoPaths(t *testing.T) {
+	req := request(StrategyGreedy, Budget{MaxMitigations: 1})
+	req.Pairs = []Pair{{From: "T", To: "E"}}
+	if _, err := Recommend(context.Background(), loadFixture(t), req); !errors.Is(err, ErrNoPaths) {
+		t.Errorf("Recommend = %v, want ErrNoPaths", err)
+	}
+}
+
+func TestRecommendCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Recommend(ctx, loadFixture(t), request(StrategyExact, Budget{})); !errors.Is(err, context.Canceled) {
+		t.Errorf("Recommend = %v, want context.Canceled", err)
+	}
+}
@@ -6,16 +6,24 @@ import "time"
 type SessionRecord struct {
 	SessionID          int64 // auto-generated by MariaDB
 	CreatedAt          time.Time
+	RequestID          string // X-Request-ID of the /api/paths request
+	BatchID            string // UUID set by Enqueue; a batch flushed twice is written once
 	EntryAssetID       string
 	TargetAssetID      string
 	MaxHops            int
 	OrientationTime    float64
 	SwitchoverTime     float64
 	PriorityTolerance  int
+	TTBSelection       string // nebula.TTBSelectionFastest or TTBSelectionWeighted
+	SimDistribution    string // Monte Carlo TTA run of the session; SimTrials is 0 without one
+	SimTrials          int
+	SimSeed            int64
 	PathsFound         int
 	AssetsRecalculated int
 	QueryTimeMs        int
 	TotalTimeMs        int
+	QueuedAt           time.Time // set by Enqueue
+	WrittenLate        bool      // set when the batch was retried or replayed from the journal
 }
 
 // PathRecord maps to calc_paths (ADR-REQ-011, Layer 2).
@@ -26,6 +34,34 @@ type PathRecord struct {
 	HostChain string
 	HopCount  int
 	TTAHours  float64
+	TTAP10    *float64 // Monte Carlo TTA quantiles; nil without a simulation
+	TTAP50    *float64
+	TTAP90    *float64
+
+	DetectionProbability *float64 // time-to-detect; nil without detection=true
+	TTDHours             *float64
+	AttackerWins         *float64
+}
+
+// Chain positions of an asset on an attack path (ALG-REQ-051), recorded in
+// BreakdownRecord.ChainPosition.
+const (
+	PositionEntrance     = "entrance"
+	PositionIntermediate = "intermediate"
+	PositionTarget       = "target"
+)
+
+// PositionAt returns the chain position of the node at index on a path of
+// pathLength nodes.
+func PositionAt(index, pathLength int) string {
+	switch {
+	case index == 0:
+		return PositionEntrance
+	case index == pathLength-1:
+		return PositionTarget
+	default:
+		return PositionIntermediate
+	}
 }
 
 // BreakdownRecord maps to calc_ttb_breakdown (ADR-REQ-012, Layer 3).
@@ -33,7 +69,7 @@ type BreakdownRecord struct {
 	BreakdownID     int64 // auto-generated
 	SessionID       int64
 	AssetVid        string
-	ChainPosition   string // "entrance", "intermediate", "target"
+	ChainPosition   string // PositionEntrance, PositionIntermediate or PositionTarget
 	ChainVid        string
 	TTBTotal        float64
 	OrientationTime float64
@@ -75,7 +111,7 @@ type TTTDetailRecord struct {
 type CacheEntry struct {
 	AssetVid        string
 	ChainPosition   string
-	ComputedAt      time.Time
+	ComputedAt      time.Time // start of the computation; rows older than the last purge are not written
 	NebulaHash      string
 	TTBTotal        float64
 	OrientationTime float64
@@ -95,6 +131,26 @@ type AuditBuffer struct {
 	CacheEntries []CacheEntry
 }
 
+// Merge appends the records of other to b, rebasing other's BreakdownIdx and
+// StepIdx back-links. An AuditBuffer is not safe for concurrent use: parallel TTB
+// computations each fill their own buffer and are merged in a fixed order.
+func (b *AuditBuffer) Merge(other *AuditBuffer) {
+	breakdownOffset := len(b.Breakdowns)
+	stepOffset := len(b.TacticSteps)
+
+	b.Paths = append(b.Paths, other.Paths...)
+	b.Breakdowns = append(b.Breakdowns, other.Breakdowns...)
+	for _, ts := range other.TacticSteps {
+		ts.BreakdownIdx += breakdownOffset
+		b.TacticSteps = append(b.TacticSteps, ts)
+	}
+	for _, td := range other.TTTDetails {
+		td.StepIdx += stepOffset
+		b.TTTDetails = append(b.TTTDetails, td)
+	}
+	b.CacheEntries = append(b.CacheEntries, other.CacheEntries...)
+}
+
 // ComputeContext is passed through the computation stack (ADR-REQ-041).
 // If Audit is nil, no audit records are generated (zero overhead).
 type ComputeContext struct {
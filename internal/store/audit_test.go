@@ -0,0 +1,66 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAuditBufferMerge(t *testing.T) {
+	b := &AuditBuffer{
+		Breakdowns:  []BreakdownRecord{{AssetVid: "A1"}, {AssetVid: "A2"}},
+		TacticSteps: []TacticStepRecord{{BreakdownIdx: 0, TacticID: "TA0001"}, {BreakdownIdx: 1, TacticID: "TA0002"}},
+		TTTDetails:  []TTTDetailRecord{{StepIdx: 1, TechniqueID: "T1"}},
+	}
+	other := &AuditBuffer{
+		Paths:        []PathRecord{{}},
+		Breakdowns:   []BreakdownRecord{{AssetVid: "A3"}},
+		TacticSteps:  []TacticStepRecord{{BreakdownIdx: 0, TacticID: "TA0004"}, {BreakdownIdx: 0, TacticID: "TA0005"}},
+		TTTDetails:   []TTTDetailRecord{{StepIdx: 0, TechniqueID: "T2"}, {StepIdx: 1, TechniqueID: "T3"}},
+		CacheEntries: []CacheEntry{{AssetVid: "A3"}},
+	}
+	b.Merge(other)
+
+	if len(b.Paths) != 1 || len(b.CacheEntries) != 1 || len(b.Breakdowns) != 3 {
+		t.Fatalf("merged %d paths, %d cache entries, %d breakdowns; want 1, 1, 3",
+			len(b.Paths), len(b.CacheEntries), len(b.Breakdowns))
+	}
+	var links []int
+	for _, ts := range b.TacticSteps {
+		if b.Breakdowns[ts.BreakdownIdx].AssetVid == "" {
+			t.Errorf("step %s links to breakdown %d", ts.TacticID, ts.BreakdownIdx)
+		}
+		links = append(links, ts.BreakdownIdx)
+	}
+	if want := []int{0, 1, 2, 2}; !reflect.DeepEqual(links, want) {
+		t.Errorf("step breakdown links = %v, want %v", links, want)
+	}
+	var steps []string
+	for _, td := range b.TTTDetails {
+		steps = append(steps, td.TechniqueID+"@"+b.TacticSteps[td.StepIdx].TacticID)
+	}
+	if want := []string{"T1@TA0002", "T2@TA0004", "T3@TA0005"}; !reflect.DeepEqual(steps, want) {
+		t.Errorf("technique steps = %v, want %v", steps, want)
+	}
+	if other.TacticSteps[0].BreakdownIdx != 0 || other.TTTDetails[1].StepIdx != 1 {
+		t.Error("Merge modified the merged buffer")
+	}
+}
+
+func TestPositionAt(t *testing.T) {
+	tests := []struct {
+		index, pathLength int
+		want              string
+	}{
+		{0, 2, PositionEntrance},
+		{1, 2, PositionTarget},
+		{0, 4, PositionEntrance},
+		{1, 4, PositionIntermediate},
+		{2, 4, PositionIntermediate},
+		{3, 4, PositionTarget},
+	}
+	for _, tt := range tests {
+		if got := PositionAt(tt.index, tt.pathLength); got != tt.want {
+			t.Errorf("PositionAt(%d, %d) = %s, want %s", tt.index, tt.pathLength, got, tt.want)
+		}
+	}
+}
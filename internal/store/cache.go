@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ============================================================
+// Asset TTB cache reads (ADR-REQ-020, ADR-REQ-021, ADR-REQ-052)
+// ============================================================
+
+// LoadCacheEntry returns the valid asset_ttb_cache row of an asset at a chain
+// position, or ErrNotFound. Callers compare NebulaHash with the asset's
+// current hash before reusing it (ADR-REQ-021 cache read logic).
+func (s *Store) LoadCacheEntry(ctx context.Context, assetVid, position string) (*CacheEntry, error) {
+	if !s.Enabled() {
+		return nil, fmt.Errorf("store: disabled")
+	}
+	ce := CacheEntry{AssetVid: assetVid, ChainPosition: position}
+	err := s.db.QueryRowContext(ctx, `SELECT computed_at, nebula_hash, ttb_total, orientation_time, breakdown_json, is_valid
+		FROM asset_ttb_cache
+		WHERE asset_vid = ? AND chain_position = ? AND is_valid = TRUE`, assetVid, position).
+		Scan(&ce.ComputedAt, &ce.NebulaHash, &ce.TTBTotal, &ce.OrientationTime, &ce.BreakdownJSON, &ce.IsValid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("store: cache query failed: %w", err)
+	}
+	return &ce, nil
+}
+
+// Steps decodes BreakdownJSON.
+func (ce *CacheEntry) Steps() ([]BreakdownStep, error) {
+	var steps []BreakdownStep
+	if err := json.Unmarshal([]byte(ce.BreakdownJSON), &steps); err != nil {
+		return nil, fmt.Errorf("store: cache breakdown for %s/%s is not valid JSON: %w", ce.AssetVid, ce.ChainPosition, err)
+	}
+	return steps, nil
+}
+
+// EncodeBreakdown renders steps in the breakdown_json format (ADR-REQ-020).
+func EncodeBreakdown(steps []BreakdownStep) (string, error) {
+	if steps == nil {
+		steps = []BreakdownStep{}
+	}
+	raw, err := json.Marshal(steps)
+	if err != nil {
+		return "", fmt.Errorf("store: encode breakdown: %w", err)
+	}
+	return string(raw), nil
+}
+
+// BufferedBreakdown assembles the breakdown_json steps of buf.Breakdowns[idx]
+// from the tactic step and TTT detail records collected during ComputeTTB.
+// Each step carries the TTT detail of its selected technique.
+func BufferedBreakdown(buf *AuditBuffer, idx int) []BreakdownStep {
+	if buf == nil || idx < 0 || idx >= len(buf.Breakdowns) {
+		return nil
+	}
+	steps := make([]BreakdownStep, 0)
+	for j, ts := range buf.TacticSteps {
+		if ts.BreakdownIdx != idx {
+			continue
+		}
+		st := BreakdownStep{
+			TacticSeq:       ts.TacticSeq,
+			TacticID:        ts.TacticID,
+			TacticName:      ts.TacticName,
+			TechniqueVID:    ts.TechniqueID,
+			TechniqueID:     ts.TechniqueID,
+			TechniqueName:   ts.TechniqueName,
+			TTTHours:        ts.TTTHours,
+			CandidatesCount: ts.CandidatesCount,
+		}
+		for _, td := range buf.TTTDetails {
+			if td.StepIdx == j && td.TechniqueID == ts.TechniqueID {
+				st.TTTDetail = &TTTDetail{
+					ExecMin:        td.ExecMin,
+					ExecMax:        td.ExecMax,
+					P:              td.PossibleCount,
+					A:              td.AppliedCount,
+					MaturityFactor: td.MaturityFactor,
+					FormulaCase:    td.FormulaCase,
+				}
+				break
+			}
+		}
+		steps = append(steps, st)
+	}
+	return steps
+}
+
+// AssetTTBDetail is the ADR-REQ-052 response body.
+type AssetTTBDetail struct {
+	AssetVid        string          `json:"asset_vid"`
+	ChainPosition   string          `json:"chain_position"`
+	ComputedAt      time.Time       `json:"computed_at"`
+	NebulaHash      string          `json:"nebula_hash"`
+	TTBHours        float64         `json:"ttb_hours"`
+	OrientationTime float64         `json:"orientation_time"`
+	Breakdown       []BreakdownStep `json:"breakdown"`
+}
+
+// AssetTTBDetail returns the valid cached breakdown of an asset at a chain
+// position (ADR-REQ-052), or ErrNotFound.
+func (s *Store) AssetTTBDetail(ctx context.Context, assetVid, position string) (*AssetTTBDetail, error) {
+	ce, err := s.LoadCacheEntry(ctx, assetVid, position)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := ce.Steps()
+	if err != nil {
+		return nil, err
+	}
+	return &AssetTTBDetail{
+		AssetVid:        ce.AssetVid,
+		ChainPosition:   ce.ChainPosition,
+		ComputedAt:      ce.ComputedAt,
+		NebulaHash:      ce.NebulaHash,
+		TTBHours:        ce.TTBTotal,
+		OrientationTime: ce.OrientationTime,
+		Breakdown:       steps,
+	}, nil
+}
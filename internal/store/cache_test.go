@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func cacheBuffer(computedAt time.Time, assets ...string) *AuditBuffer {
+	buf := &AuditBuffer{Session: SessionRecord{EntryAssetID: "A1", TargetAssetID: "A2"}}
+	for _, a := range assets {
+		buf.CacheEntries = append(buf.CacheEntries, CacheEntry{
+			AssetVid:      a,
+			ChainPosition: PositionEntrance,
+			ComputedAt:    computedAt,
+			NebulaHash:    "h-" + a,
+			TTBTotal:      4.5,
+			BreakdownJSON: "[]",
+			IsValid:       true,
+		})
+	}
+	return buf
+}
+
+// TestQueuedCacheEntriesAfterPurge queues batches, purges the cache and then
+// lets the queue flush: entries computed before the purge must not come back
+// as valid rows, entries computed after it must.
+func TestQueuedCacheEntriesAfterPurge(t *testing.T) {
+	ctx := context.Background()
+	s, fake := newFakeStore(t, "")
+	go s.runQueue()
+
+	purge := time.Now()
+	s.Enqueue(ctx, cacheBuffer(purge.Add(-time.Minute), "A1"))
+	s.Enqueue(ctx, cacheBuffer(purge.Add(-time.Millisecond/2), "A2"))
+	s.Enqueue(ctx, cacheBuffer(purge.Add(time.Second), "A3"))
+	if err := s.invalidateAllCache(ctx, purge); err != nil {
+		t.Fatalf("invalidateAllCache: %v", err)
+	}
+	close(s.connected)
+	waitForQueue(t, s)
+	drainCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := s.Drain(drainCtx); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+
+	if fake.sessions != 3 {
+		t.Errorf("%d sessions written, want 3", fake.sessions)
+	}
+	tests := []struct {
+		asset string
+		want  bool
+	}{
+		{"A1", false},
+		{"A2", false}, // same millisecond as the purge
+		{"A3", true},
+	}
+	for _, tt := range tests {
+		if _, ok := fake.cacheRow(tt.asset, PositionEntrance); ok != tt.want {
+			t.Errorf("cache row for %s written = %t, want %t", tt.asset, ok, tt.want)
+		}
+		_, err := s.LoadCacheEntry(ctx, tt.asset, PositionEntrance)
+		if tt.want && err != nil {
+			t.Errorf("LoadCacheEntry(%s) = %v, want the fresh row", tt.asset, err)
+		}
+		if !tt.want && !errors.Is(err, ErrNotFound) {
+			t.Errorf("LoadCacheEntry(%s) = %v, want ErrNotFound", tt.asset, err)
+		}
+	}
+}
+
+// TestInvalidateAllCacheInvalidatesWrittenRows checks that rows written
+// before a purge are no longer served and that the purge time only moves
+// forward.
+func TestInvalidateAllCacheInvalidatesWrittenRows(t *testing.T) {
+	ctx := context.Background()
+	s, fake := newFakeStore(t, "")
+	close(s.connected)
+
+	computed := time.Now()
+	if err := s.FlushBatch(ctx, cacheBuffer(computed, "A1")); err != nil {
+		t.Fatalf("FlushBatch: %v", err)
+	}
+	if _, err := s.LoadCacheEntry(ctx, "A1", PositionEntrance); err != nil {
+		t.Fatalf("LoadCacheEntry before purge: %v", err)
+	}
+
+	purge := computed.Add(time.Second)
+	if err := s.invalidateAllCache(ctx, purge); err != nil {
+		t.Fatalf("invalidateAllCache: %v", err)
+	}
+	if _, err := s.LoadCacheEntry(ctx, "A1", PositionEntrance); !errors.Is(err, ErrNotFound) {
+		t.Errorf("LoadCacheEntry after purge = %v, want ErrNotFound", err)
+	}
+
+	if err := s.invalidateAllCache(ctx, purge.Add(-time.Hour)); err != nil {
+		t.Fatalf("invalidateAllCache: %v", err)
+	}
+	if !fake.purgedAt.Equal(purge.Truncate(time.Millisecond)) {
+		t.Errorf("purge time moved back to %v, want %v", fake.purgedAt, purge)
+	}
+}
+
+// waitForQueue waits until the worker has taken every batch off the memory
+// queue, so that a following Drain does not race the worker's start.
+func waitForQueue(t *testing.T, s *Store) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.QueueDepth() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue still holds %d batches", s.QueueDepth())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
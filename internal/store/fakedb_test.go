@@ -0,0 +1,209 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDB is an in-memory stand-in for the MariaDB statements FlushBatch,
+// InvalidateAllCache and LoadCacheEntry run. Writes inside a transaction
+// take effect on commit.
+type fakeDB struct {
+	mu       sync.Mutex
+	nextID   int64
+	batches  map[string]bool // calc_sessions.batch_id
+	sessions int
+	cache    map[string]CacheEntry // asset_ttb_cache by asset_vid|chain_position
+	purgedAt *time.Time
+}
+
+func newFakeStore(t *testing.T, journalPath string) (*Store, *fakeDB) {
+	t.Helper()
+	fake := &fakeDB{nextID: 1, batches: make(map[string]bool), cache: make(map[string]CacheEntry)}
+	db := sql.OpenDB(fake)
+	t.Cleanup(func() { db.Close() })
+
+	s := &Store{
+		db:        db,
+		enabled:   true,
+		queue:     newWriteBehind(QueueConfig{MaxAttempts: 2, JournalPath: journalPath}),
+		autoInc:   autoIncrement{step: 1, chunkRows: insertChunkRows},
+		connected: make(chan struct{}),
+	}
+	if journalPath != "" {
+		var err error
+		if s.queue.journal, err = openJournal(journalPath); err != nil {
+			t.Fatalf("openJournal: %v", err)
+		}
+	}
+	return s, fake
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return nil }
+
+// exec runs one statement against the committed state; f.mu must be held.
+func (f *fakeDB) exec(query string, args []driver.Value) (driver.Result, error) {
+	switch {
+	case strings.HasPrefix(query, "INSERT INTO calc_sessions"):
+		if id, ok := args[1].(string); ok {
+			f.batches[id] = true
+		}
+		f.sessions++
+	case strings.HasPrefix(query, "INSERT INTO calc_"):
+	case strings.HasPrefix(query, "INSERT INTO asset_ttb_cache_purge"):
+		at := args[0].(time.Time).Truncate(time.Millisecond)
+		if f.purgedAt == nil || at.After(*f.purgedAt) {
+			f.purgedAt = &at
+		}
+	case strings.HasPrefix(query, "UPDATE asset_ttb_cache SET is_valid = FALSE"):
+		for k, ce := range f.cache {
+			if len(args) == 0 || ce.AssetVid == args[0] {
+				ce.IsValid = false
+				f.cache[k] = ce
+			}
+		}
+	case strings.HasPrefix(query, "REPLACE INTO asset_ttb_cache"):
+		for i := 0; i+8 <= len(args); i += 8 {
+			ce := CacheEntry{
+				AssetVid:        args[i].(string),
+				ChainPosition:   args[i+1].(string),
+				ComputedAt:      args[i+2].(time.Time).Truncate(time.Millisecond),
+				NebulaHash:      args[i+3].(string),
+				TTBTotal:        args[i+4].(float64),
+				OrientationTime: args[i+5].(float64),
+				BreakdownJSON:   args[i+6].(string),
+				IsValid:         args[i+7].(bool),
+			}
+			f.cache[ce.AssetVid+"|"+ce.ChainPosition] = ce
+		}
+	default:
+		return nil, fmt.Errorf("fakedb: unexpected statement %q", query)
+	}
+	id := f.nextID
+	f.nextID += int64(len(args)) + 1
+	return fakeResult(id), nil
+}
+
+// query answers one SELECT from the committed state; f.mu must be held.
+func (f *fakeDB) query(query string, args []driver.Value) (driver.Rows, error) {
+	switch {
+	case strings.HasPrefix(query, "SELECT COUNT(*) FROM calc_sessions WHERE batch_id"):
+		n := int64(0)
+		if f.batches[args[0].(string)] {
+			n = 1
+		}
+		return &fakeRows{cols: []string{"count"}, rows: [][]driver.Value{{n}}}, nil
+	case strings.HasPrefix(query, "SELECT purged_at FROM asset_ttb_cache_purge"):
+		rows := &fakeRows{cols: []string{"purged_at"}}
+		if f.purgedAt != nil {
+			rows.rows = [][]driver.Value{{*f.purgedAt}}
+		}
+		return rows, nil
+	case strings.HasPrefix(query, "SELECT computed_at, nebula_hash, ttb_total"):
+		rows := &fakeRows{cols: []string{"computed_at", "nebula_hash", "ttb_total", "orientation_time", "breakdown_json", "is_valid"}}
+		if ce, ok := f.cache[args[0].(string)+"|"+args[1].(string)]; ok && ce.IsValid {
+			rows.rows = [][]driver.Value{{ce.ComputedAt, ce.NebulaHash, ce.TTBTotal, ce.OrientationTime, ce.BreakdownJSON, ce.IsValid}}
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("fakedb: unexpected query %q", query)
+}
+
+// cacheRow returns the asset_ttb_cache row of an asset at a position.
+func (f *fakeDB) cacheRow(assetVid, position string) (CacheEntry, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ce, ok := f.cache[assetVid+"|"+position]
+	return ce, ok
+}
+
+type fakeConn struct {
+	db      *fakeDB
+	pending []func() // writes of the open transaction
+	inTx    bool
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: strings.TrimSpace(query)}, nil
+}
+func (c *fakeConn) Close() error                   { return nil }
+func (c *fakeConn) Ping(ctx context.Context) error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.inTx, c.pending = true, nil
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	for _, apply := range c.pending {
+		apply()
+	}
+	c.inTx, c.pending = false, nil
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.inTx, c.pending = false, nil
+	return nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	db := s.conn.db
+	if !s.conn.inTx {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		return db.exec(s.query, args)
+	}
+	db.mu.Lock()
+	id := db.nextID
+	db.nextID += int64(len(args)) + 1
+	db.mu.Unlock()
+	s.conn.pending = append(s.conn.pending, func() { db.exec(s.query, args) })
+	return fakeResult(id), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.conn.db.mu.Lock()
+	defer s.conn.db.mu.Unlock()
+	return s.conn.db.query(s.query, args)
+}
+
+type fakeResult int64
+
+func (r fakeResult) LastInsertId() (int64, error) { return int64(r), nil }
+func (r fakeResult) RowsAffected() (int64, error) { return 1, nil }
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,264 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// Audit trail reads — calculation history (ADR-REQ-051) and
+// path detail (ADR-REQ-050) from the calc_* tables and asset_ttb_cache
+// ============================================================
+
+// ErrNotFound is returned when the requested session, path or cache row does not exist.
+var ErrNotFound = errors.New("store: not found")
+
+// Path detail hop sources (ADR-REQ-050 data source priority).
+const (
+	SourceComputed    = "computed"
+	SourceCache       = "cache"
+	SourceUnavailable = "unavailable"
+)
+
+// SessionParams are the TTB parameters a session ran with (ALG-REQ-071, 072, 075).
+type SessionParams struct {
+	OrientationTime   float64 `json:"orientation_time"`
+	SwitchoverTime    float64 `json:"switchover_time"`
+	PriorityTolerance int     `json:"priority_tolerance"`
+	TTBSelection      string  `json:"ttb_selection"`
+}
+
+// SessionSimulation is the Monte Carlo TTA run of a session; with its seed
+// the quantiles can be reproduced.
+type SessionSimulation struct {
+	Distribution string `json:"distribution"`
+	Trials       int    `json:"trials"`
+	Seed         int64  `json:"seed"`
+}
+
+// SessionSummary is one calc_sessions row as listed by /api/calc-history.
+type SessionSummary struct {
+	SessionID          int64              `json:"session_id"`
+	CreatedAt          time.Time          `json:"created_at"`
+	RequestID          string             `json:"request_id,omitempty"`
+	EntryAssetID       string             `json:"entry_asset_id"`
+	TargetAssetID      string             `json:"target_asset_id"`
+	MaxHops            int                `json:"max_hops"`
+	PathsFound         int                `json:"paths_found"`
+	PathsStored        int                `json:"paths_stored"` // calc_paths rows; below paths_found when AUDIT_MAX_PATHS applied
+	AssetsRecalculated int                `json:"assets_recalculated"`
+	TotalTimeMs        int                `json:"total_time_ms"`
+	WrittenLate        bool               `json:"written_late"`
+	Params             SessionParams      `json:"params"`
+	Simulation         *SessionSimulation `json:"simulation,omitempty"`
+}
+
+// TTTDetail is the ALG-REQ-060 input set of a selected technique.
+type TTTDetail struct {
+	ExecMin        float64 `json:"exec_min"`
+	ExecMax        float64 `json:"exec_max"`
+	P              int     `json:"P"`
+	A              int     `json:"A"`
+	MaturityFactor float64 `json:"maturity_factor"`
+	FormulaCase    string  `json:"formula_case"`
+}
+
+// BreakdownStep is one tactic of a TTB breakdown. It is also the element
+// format of asset_ttb_cache.breakdown_json (ADR-REQ-020).
+type BreakdownStep struct {
+	TacticSeq       int        `json:"tactic_seq"`
+	TacticID        string     `json:"tactic_id"`
+	TacticName      string     `json:"tactic_name"`
+	TechniqueVID    string     `json:"technique_vid,omitempty"`
+	TechniqueID     string     `json:"technique_id,omitempty"`
+	TechniqueName   string     `json:"technique_name,omitempty"`
+	TTTHours        float64    `json:"ttt_hours"`
+	CandidatesCount int        `json:"candidates_count"`
+	TTTDetail       *TTTDetail `json:"ttt_detail,omitempty"`
+}
+
+// PathHop is one asset of a path with its TTB breakdown and where it came from.
+type PathHop struct {
+	AssetVid      string          `json:"asset_vid"`
+	AssetName     string          `json:"asset_name"`
+	ChainPosition string          `json:"chain_position"`
+	TTBHours      float64         `json:"ttb_hours"`
+	Source        string          `json:"source"`
+	Breakdown     []BreakdownStep `json:"breakdown,omitempty"`
+}
+
+// PathDetail is the ADR-REQ-050 response body.
+type PathDetail struct {
+	SessionID int64    `json:"session_id"`
+	PathSeq   int      `json:"path_seq"`
+	HostChain string   `json:"host_chain"`
+	TTAHours  float64  `json:"tta_hours"`
+	TTAP10    *float64 `json:"tta_p10,omitempty"` // Monte Carlo quantiles of the session, if it ran one
+	TTAP50    *float64 `json:"tta_p50,omitempty"`
+	TTAP90    *float64 `json:"tta_p90,omitempty"`
+
+	DetectionProbability *float64 `json:"detection_probability,omitempty"` // time-to-detect, if the session computed it
+	TTDHours             *float64 `json:"ttd_hours,omitempty"`
+	AttackerWins         *float64 `json:"attacker_wins,omitempty"`
+
+	Hops []PathHop `json:"hops"`
+}
+
+// CalcHistory returns the most recent sessions, newest first (ADR-REQ-051).
+func (s *Store) CalcHistory(ctx context.Context, limit int) ([]SessionSummary, error) {
+	if !s.Enabled() {
+		return nil, fmt.Errorf("store: disabled")
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT session_id, created_at, COALESCE(request_id, ''), entry_asset_id, target_asset_id,
+		max_hops, paths_found, COALESCE(paths_stored, paths_found), assets_recalculated, total_time_ms, written_late,
+		orientation_time, switchover_time, priority_tolerance, ttb_selection,
+		COALESCE(sim_distribution, ''), COALESCE(sim_trials, 0), COALESCE(sim_seed, 0)
+		FROM calc_sessions ORDER BY session_id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("store: CalcHistory query failed: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make([]SessionSummary, 0, limit)
+	for rows.Next() {
+		var ss SessionSummary
+		var sim SessionSimulation
+		if err := rows.Scan(&ss.SessionID, &ss.CreatedAt, &ss.RequestID, &ss.EntryAssetID, &ss.TargetAssetID,
+			&ss.MaxHops, &ss.PathsFound, &ss.PathsStored, &ss.AssetsRecalculated, &ss.TotalTimeMs, &ss.WrittenLate,
+			&ss.Params.OrientationTime, &ss.Params.SwitchoverTime, &ss.Params.PriorityTolerance,
+			&ss.Params.TTBSelection, &sim.Distribution, &sim.Trials, &sim.Seed); err != nil {
+			return nil, fmt.Errorf("store: CalcHistory scan failed: %w", err)
+		}
+		if sim.Trials > 0 {
+			ss.Simulation = &sim
+		}
+		sessions = append(sessions, ss)
+	}
+	return sessions, rows.Err()
+}
+
+// PathDetail returns one recorded path with a breakdown per hop
+// (ADR-REQ-050). Each hop is served from the session's calc_ttb_breakdown
+// rows when present, else from a valid asset_ttb_cache row for its chain
+// position, else with Source "unavailable" and no breakdown — the caller
+// fills in the stored TTB for those. AssetName is left to the caller.
+func (s *Store) PathDetail(ctx context.Context, sessionID int64, pathSeq int) (*PathDetail, error) {
+	if !s.Enabled() {
+		return nil, fmt.Errorf("store: disabled")
+	}
+
+	detail := &PathDetail{SessionID: sessionID, PathSeq: pathSeq}
+	err := s.db.QueryRowContext(ctx, `SELECT host_chain, tta_hours, tta_p10, tta_p50, tta_p90,
+		detection_probability, ttd_hours, attacker_wins FROM calc_paths
+		WHERE session_id = ? AND path_seq = ?`, sessionID, pathSeq).Scan(&detail.HostChain, &detail.TTAHours,
+		&detail.TTAP10, &detail.TTAP50, &detail.TTAP90, &detail.DetectionProbability, &detail.TTDHours, &detail.AttackerWins)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("store: PathDetail path query failed: %w", err)
+	}
+
+	ids := strings.Split(detail.HostChain, " -> ")
+	for i, id := range ids {
+		hop := PathHop{AssetVid: id, ChainPosition: PositionAt(i, len(ids)), Source: SourceUnavailable}
+
+		breakdownID, ttb, err := s.sessionBreakdown(ctx, sessionID, id, hop.ChainPosition)
+		switch {
+		case err == nil:
+			steps, err := s.breakdownSteps(ctx, breakdownID)
+			if err != nil {
+				return nil, err
+			}
+			hop.Source, hop.TTBHours, hop.Breakdown = SourceComputed, ttb, steps
+		case errors.Is(err, ErrNotFound):
+			cached, err := s.LoadCacheEntry(ctx, id, hop.ChainPosition)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return nil, err
+			}
+			if err == nil {
+				steps, err := cached.Steps()
+				if err != nil {
+					return nil, err
+				}
+				hop.Source, hop.TTBHours, hop.Breakdown = SourceCache, cached.TTBTotal, steps
+			}
+		default:
+			return nil, err
+		}
+		detail.Hops = append(detail.Hops, hop)
+	}
+	return detail, nil
+}
+
+// sessionBreakdown finds the breakdown recorded for an asset at a position
+// within a session; the latest one wins if several exist.
+func (s *Store) sessionBreakdown(ctx context.Context, sessionID int64, assetVid, position string) (int64, float64, error) {
+	var id int64
+	var ttb float64
+	err := s.db.QueryRowContext(ctx, `SELECT breakdown_id, ttb_total FROM calc_ttb_breakdown
+		WHERE session_id = ? AND asset_vid = ? AND chain_position = ?
+		ORDER BY breakdown_id DESC LIMIT 1`, sessionID, assetVid, position).Scan(&id, &ttb)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("store: breakdown query failed: %w", err)
+	}
+	return id, ttb, nil
+}
+
+// breakdownSteps loads the tactic steps of a breakdown with the TTT detail
+// of each selected technique (ADR-REQ-013, ADR-REQ-014).
+func (s *Store) breakdownSteps(ctx context.Context, breakdownID int64) ([]BreakdownStep, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT s.step_id, s.tactic_seq, s.tactic_id, s.tactic_name,
+		s.technique_id, s.technique_name, s.ttt_hours, s.candidates_count,
+		d.exec_min, d.exec_max, d.possible_count, d.applied_count, d.maturity_factor, d.formula_case
+		FROM calc_ttb_tactic_steps s
+		LEFT JOIN calc_ttt_detail d ON d.step_id = s.step_id AND d.technique_id = s.technique_id
+		WHERE s.breakdown_id = ?
+		ORDER BY s.tactic_seq, s.step_id, d.detail_id`, breakdownID)
+	if err != nil {
+		return nil, fmt.Errorf("store: tactic step query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var steps []BreakdownStep
+	lastStep := int64(-1)
+	for rows.Next() {
+		var stepID int64
+		var st BreakdownStep
+		var techID, techName, formulaCase sql.NullString
+		var execMin, execMax, maturityFactor sql.NullFloat64
+		var possible, applied sql.NullInt64
+		if err := rows.Scan(&stepID, &st.TacticSeq, &st.TacticID, &st.TacticName,
+			&techID, &techName, &st.TTTHours, &st.CandidatesCount,
+			&execMin, &execMax, &possible, &applied, &maturityFactor, &formulaCase); err != nil {
+			return nil, fmt.Errorf("store: tactic step scan failed: %w", err)
+		}
+		// One TTT detail per selected technique; extra join rows are ignored.
+		if stepID == lastStep {
+			continue
+		}
+		lastStep = stepID
+		st.TechniqueID = techID.String
+		st.TechniqueVID = techID.String
+		st.TechniqueName = techName.String
+		if formulaCase.Valid {
+			st.TTTDetail = &TTTDetail{
+				ExecMin:        execMin.Float64,
+				ExecMax:        execMax.Float64,
+				P:              int(possible.Int64),
+				A:              int(applied.Int64),
+				MaturityFactor: maturityFactor.Float64,
+				FormulaCase:    formulaCase.String,
+			}
+		}
+		steps = append(steps, st)
+	}
+	return steps, rows.Err()
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// ============================================================
+// Multi-row INSERTs — FlushBatch writes each layer in chunks of one
+// statement per insertChunkRows rows (ADR-REQ-032)
+// ============================================================
+
+// insertChunkRows bounds the rows of one multi-row statement, keeping the
+// placeholder count (9 columns at most) far below MariaDB's 65535.
+const insertChunkRows = 500
+
+// autoIncrement is how MariaDB numbers the rows of one multi-row INSERT,
+// read once at startup.
+type autoIncrement struct {
+	step int64 // @@auto_increment_increment
+	// chunkRows bounds statements whose IDs are needed: rows of one
+	// statement get consecutive IDs except with interleaved lock mode
+	// (innodb_autoinc_lock_mode = 2), where they are inserted one at a time.
+	chunkRows int
+}
+
+// readAutoIncrement reads the settings that decide whether the rows of a
+// multi-row INSERT get IDs LAST_INSERT_ID, +step, +2*step, ... On failure
+// it falls back to single-row inserts for parent tables.
+func readAutoIncrement(ctx context.Context, db *sql.DB) autoIncrement {
+	var step int64
+	var lockMode int
+	err := db.QueryRowContext(ctx, `SELECT @@auto_increment_increment, @@innodb_autoinc_lock_mode`).Scan(&step, &lockMode)
+	switch {
+	case err != nil:
+		slog.WarnContext(ctx, "store: auto-increment settings unavailable — parent rows inserted one at a time", "err", err)
+		return autoIncrement{step: 1, chunkRows: 1}
+	case lockMode >= 2:
+		slog.WarnContext(ctx, "store: interleaved auto-increment lock mode — parent rows inserted one at a time",
+			"innodb_autoinc_lock_mode", lockMode)
+		return autoIncrement{step: step, chunkRows: 1}
+	}
+	slog.DebugContext(ctx, "store: auto-increment settings", "increment", step, "innodb_autoinc_lock_mode", lockMode)
+	return autoIncrement{step: step, chunkRows: insertChunkRows}
+}
+
+// insertRows runs head ("INSERT INTO t (c1, ..., cN) VALUES") for n rows of
+// cols columns, with args(i) giving the values of row i, in chunks of
+// multi-row statements. With wantIDs it returns the auto-increment ID of
+// every row in order, derived from each chunk's LAST_INSERT_ID — the ID of
+// its first row.
+func (s *Store) insertRows(ctx context.Context, tx *sql.Tx, head string, cols, n int, wantIDs bool,
+	args func(i int) []interface{}) ([]int64, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	chunkRows := insertChunkRows
+	var ids []int64
+	if wantIDs {
+		chunkRows = s.autoInc.chunkRows
+		ids = make([]int64, 0, n)
+	}
+	group := "(" + strings.TrimSuffix(strings.Repeat("?, ", cols), ", ") + ")"
+
+	for start := 0; start < n; start += chunkRows {
+		end := min(start+chunkRows, n)
+		rows := end - start
+
+		var query strings.Builder
+		query.WriteString(head)
+		values := make([]interface{}, 0, rows*cols)
+		for i := start; i < end; i++ {
+			if i > start {
+				query.WriteByte(',')
+			}
+			query.WriteString("\n\t\t")
+			query.WriteString(group)
+			values = append(values, args(i)...)
+		}
+
+		res, err := tx.ExecContext(ctx, query.String(), values...)
+		if err != nil {
+			return nil, err
+		}
+		if !wantIDs {
+			continue
+		}
+		if affected, err := res.RowsAffected(); err == nil && affected != int64(rows) {
+			return nil, fmt.Errorf("store: inserted %d of %d rows", affected, rows)
+		}
+		first, err := res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		for k := 0; k < rows; k++ {
+			ids = append(ids, first+int64(k)*s.autoInc.step)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// Audit journal — a local JSON-lines file holding audit batches that could
+// not reach MariaDB, oldest first, replayed in order on reconnect
+// ============================================================
+
+// journalRecord is one line of the journal.
+type journalRecord struct {
+	SpilledAt time.Time    `json:"spilled_at"`
+	Attempts  int          `json:"attempts"` // failed replays while MariaDB was reachable
+	Buffer    *AuditBuffer `json:"buffer"`
+}
+
+func newJournalRecord(b queuedBatch) journalRecord {
+	return journalRecord{SpilledAt: time.Now(), Buffer: b.buf}
+}
+
+// journal is the spill file. Every write is synced before it returns; a
+// rewrite goes through a temporary file and a rename, so a crash leaves
+// either the old or the new journal.
+type journal struct {
+	path string
+
+	mu    sync.Mutex
+	count int // records in the file
+}
+
+// openJournal opens or creates the journal at path and counts the batches
+// left by a previous run.
+func openJournal(path string) (*journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("store: journal directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("store: open journal: %w", err)
+	}
+	f.Close()
+
+	j := &journal{path: path}
+	records, err := j.readLocked()
+	if err != nil {
+		return nil, err
+	}
+	j.count = len(records)
+	return j, nil
+}
+
+// len returns the number of journaled batches.
+func (j *journal) len() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.count
+}
+
+// read returns every journaled batch, oldest first.
+func (j *journal) read() ([]journalRecord, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.readLocked()
+}
+
+// append adds records at the end of the journal.
+func (j *journal) append(records ...journalRecord) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	data, err := encodeRecords(records)
+	if err != nil {
+		return err
+	}
+	if err := writeSynced(j.path, os.O_APPEND, data); err != nil {
+		return err
+	}
+	j.count += len(records)
+	return nil
+}
+
+// rewriteHead removes the first n records and puts head in front of the rest.
+func (j *journal) rewriteHead(n int, head ...journalRecord) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	records, err := j.readLocked()
+	if err != nil {
+		return err
+	}
+	if n > len(records) {
+		n = len(records)
+	}
+	records = append(append([]journalRecord{}, head...), records[n:]...)
+
+	data, err := encodeRecords(records)
+	if err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err := writeSynced(tmp, os.O_TRUNC, data); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return err
+	}
+	j.count = len(records)
+	return nil
+}
+
+// readLocked parses the journal. A line that cannot be parsed, such as one
+// cut short by a crash, is logged and skipped. j.mu must be held.
+func (j *journal) readLocked() ([]journalRecord, error) {
+	data, err := os.ReadFile(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("store: read journal: %w", err)
+	}
+
+	var records []journalRecord
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var rec journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil || rec.Buffer == nil {
+			slog.Warn("store: skipping unreadable journal line", "path", j.path, "line", line, "err", err)
+			continue
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+// encodeRecords renders records as JSON lines.
+func encodeRecords(records []journalRecord) ([]byte, error) {
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			return nil, fmt.Errorf("store: encode journal record: %w", err)
+		}
+	}
+	return data.Bytes(), nil
+}
+
+// writeSynced writes data to path, opened with mode (os.O_APPEND or
+// os.O_TRUNC), and syncs it to disk.
+func writeSynced(path string, mode int, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|mode, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
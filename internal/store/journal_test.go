@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func record(requestID string) journalRecord {
+	return journalRecord{Buffer: &AuditBuffer{Session: SessionRecord{RequestID: requestID}}}
+}
+
+func journalIDs(t *testing.T, j *journal) []string {
+	t.Helper()
+	records, err := j.read()
+	if err != nil {
+		t.Fatalf("read journal: %v", err)
+	}
+	var ids []string
+	for _, r := range records {
+		ids = append(ids, r.Buffer.Session.RequestID)
+	}
+	if j.len() != len(records) {
+		t.Errorf("len() = %d, journal holds %d records", j.len(), len(records))
+	}
+	return ids
+}
+
+func TestJournalRewriteHead(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		head []string
+		want []string
+	}{
+		{name: "drop replayed", n: 2, want: []string{"r3", "r4"}},
+		{name: "drop all", n: 4},
+		{name: "n beyond end", n: 9},
+		{name: "keep failed batch in front", n: 3, head: []string{"r3"}, want: []string{"r3", "r4"}},
+		{name: "nothing replayed", n: 0, want: []string{"r1", "r2", "r3", "r4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j, err := openJournal(filepath.Join(t.TempDir(), "audit", "journal.jsonl"))
+			if err != nil {
+				t.Fatalf("openJournal: %v", err)
+			}
+			if err := j.append(record("r1"), record("r2")); err != nil {
+				t.Fatalf("append: %v", err)
+			}
+			if err := j.append(record("r3"), record("r4")); err != nil {
+				t.Fatalf("append: %v", err)
+			}
+			var head []journalRecord
+			for _, id := range tt.head {
+				head = append(head, record(id))
+			}
+			if err := j.rewriteHead(tt.n, head...); err != nil {
+				t.Fatalf("rewriteHead: %v", err)
+			}
+			if got := journalIDs(t, j); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("journal = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestJournalSkipsTornLine checks that a line cut short by a crash is
+// skipped and that a reopened journal counts only the complete records.
+func TestJournalSkipsTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := openJournal(path)
+	if err != nil {
+		t.Fatalf("openJournal: %v", err)
+	}
+	if err := j.append(record("r1"), record("r2")); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"spilled_at":"2026-01-01T00:00:00Z","buf`)
+	f.Close()
+
+	reopened, err := openJournal(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if got, want := journalIDs(t, reopened), []string{"r1", "r2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("journal = %v, want %v", got, want)
+	}
+}
+
+// TestReplayJournalAfterPurge replays batches journaled before a cache purge,
+// one of them twice as after a crash before the journal rewrite: sessions are
+// written once and cache entries computed before the purge stay out.
+func TestReplayJournalAfterPurge(t *testing.T) {
+	ctx := context.Background()
+	s, fake := newFakeStore(t, filepath.Join(t.TempDir(), "journal.jsonl"))
+	close(s.connected)
+
+	purge := time.Now()
+	stale := cacheBuffer(purge.Add(-time.Minute), "A1")
+	stale.Session.BatchID = newBatchID()
+	unflushed := cacheBuffer(purge.Add(-time.Second), "A3")
+	unflushed.Session.BatchID = newBatchID()
+	fresh := cacheBuffer(purge.Add(time.Second), "A2")
+	fresh.Session.BatchID = newBatchID()
+	records := []journalRecord{{Buffer: stale}, {Buffer: unflushed}, {Buffer: fresh}}
+	if err := s.queue.journal.append(records...); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if err := s.FlushBatch(ctx, stale); err != nil {
+		t.Fatalf("FlushBatch: %v", err)
+	}
+	if err := s.invalidateAllCache(ctx, purge); err != nil {
+		t.Fatalf("invalidateAllCache: %v", err)
+	}
+
+	if err := s.replayJournal(); err != nil {
+		t.Fatalf("replayJournal: %v", err)
+	}
+	if fake.sessions != 3 {
+		t.Errorf("%d sessions written, want 3", fake.sessions)
+	}
+	if n := s.queue.journal.len(); n != 0 {
+		t.Errorf("journal holds %d batches after replay, want 0", n)
+	}
+	for _, asset := range []string{"A1", "A3"} {
+		if _, err := s.LoadCacheEntry(ctx, asset, PositionEntrance); err == nil {
+			t.Errorf("cache entry of %s computed before the purge is served after replay", asset)
+		}
+	}
+	if _, err := s.LoadCacheEntry(ctx, "A2", PositionEntrance); err != nil {
+		t.Errorf("LoadCacheEntry(A2) = %v, want the fresh row", err)
+	}
+}
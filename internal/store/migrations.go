@@ -1,9 +1,10 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 )
 
 // tables is the ordered list of CREATE TABLE statements (ADR-REQ-081).
@@ -17,18 +18,29 @@ var tables = []struct {
 		ddl: `CREATE TABLE IF NOT EXISTS calc_sessions (
     session_id        BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
     created_at        DATETIME(3)   NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    request_id        VARCHAR(64)   NULL,
+    batch_id          CHAR(36)      NULL,
     entry_asset_id    VARCHAR(64)   NOT NULL,
     target_asset_id   VARCHAR(64)   NOT NULL,
     max_hops          INT           NOT NULL,
     orientation_time  DOUBLE        NOT NULL,
     switchover_time   DOUBLE        NOT NULL,
     priority_tolerance INT          NOT NULL,
+    ttb_selection     VARCHAR(16)   NOT NULL DEFAULT 'fastest',
+    sim_distribution  VARCHAR(16)   NULL,
+    sim_trials        INT           NULL,
+    sim_seed          BIGINT UNSIGNED NULL,
     paths_found       INT           NOT NULL,
+    paths_stored      INT           NULL,
     assets_recalculated INT        NOT NULL DEFAULT 0,
     query_time_ms     INT           NOT NULL,
     total_time_ms     INT           NOT NULL,
+    queued_at         DATETIME(3)   NULL,
+    written_late      BOOLEAN       NOT NULL DEFAULT FALSE,
     INDEX idx_created (created_at),
-    INDEX idx_entry_target (entry_asset_id, target_asset_id)
+    INDEX idx_entry_target (entry_asset_id, target_asset_id),
+    INDEX idx_request (request_id),
+    UNIQUE INDEX idx_batch (batch_id)
 ) ENGINE=InnoDB`,
 	},
 	{
@@ -40,6 +52,12 @@ var tables = []struct {
     host_chain  TEXT           NOT NULL,
     hop_count   INT            NOT NULL,
     tta_hours   DOUBLE         NOT NULL,
+    tta_p10     DOUBLE         NULL,
+    tta_p50     DOUBLE         NULL,
+    tta_p90     DOUBLE         NULL,
+    detection_probability DOUBLE NULL,
+    ttd_hours   DOUBLE         NULL,
+    attacker_wins DOUBLE       NULL,
     FOREIGN KEY (session_id) REFERENCES calc_sessions(session_id) ON DELETE CASCADE,
     INDEX idx_session (session_id),
     INDEX idx_tta (tta_hours)
@@ -111,18 +129,96 @@ var tables = []struct {
     INDEX idx_valid (is_valid)
 ) ENGINE=InnoDB`,
 	},
+	{
+		// One row: when InvalidateAllCache last ran. Cache rows computed
+		// before it are stale even while the asset hash still matches.
+		name: "asset_ttb_cache_purge",
+		ddl: `CREATE TABLE IF NOT EXISTS asset_ttb_cache_purge (
+    id               TINYINT UNSIGNED NOT NULL PRIMARY KEY,
+    purged_at        DATETIME(3)    NOT NULL
+) ENGINE=InnoDB`,
+	},
+}
+
+// columns adds columns introduced after a table was first created, for
+// databases migrated by an earlier version. Each statement must be idempotent.
+var columns = []struct {
+	name string
+	ddl  string
+}{
+	{
+		name: "calc_sessions.request_id",
+		ddl:  `ALTER TABLE calc_sessions ADD COLUMN IF NOT EXISTS request_id VARCHAR(64) NULL AFTER created_at`,
+	},
+	{
+		name: "calc_sessions.idx_request",
+		ddl:  `CREATE INDEX IF NOT EXISTS idx_request ON calc_sessions (request_id)`,
+	},
+	{
+		name: "calc_sessions.batch_id",
+		ddl:  `ALTER TABLE calc_sessions ADD COLUMN IF NOT EXISTS batch_id CHAR(36) NULL AFTER request_id`,
+	},
+	{
+		name: "calc_sessions.idx_batch",
+		ddl:  `CREATE UNIQUE INDEX IF NOT EXISTS idx_batch ON calc_sessions (batch_id)`,
+	},
+	{
+		name: "calc_sessions.ttb_selection",
+		ddl:  `ALTER TABLE calc_sessions ADD COLUMN IF NOT EXISTS ttb_selection VARCHAR(16) NOT NULL DEFAULT 'fastest' AFTER priority_tolerance`,
+	},
+	{
+		name: "calc_sessions.sim_distribution",
+		ddl:  `ALTER TABLE calc_sessions ADD COLUMN IF NOT EXISTS sim_distribution VARCHAR(16) NULL AFTER ttb_selection`,
+	},
+	{
+		name: "calc_sessions.sim_trials",
+		ddl:  `ALTER TABLE calc_sessions ADD COLUMN IF NOT EXISTS sim_trials INT NULL AFTER sim_distribution`,
+	},
+	{
+		name: "calc_sessions.sim_seed",
+		ddl:  `ALTER TABLE calc_sessions ADD COLUMN IF NOT EXISTS sim_seed BIGINT UNSIGNED NULL AFTER sim_trials`,
+	},
+	{
+		name: "calc_paths.tta_quantiles",
+		ddl: `ALTER TABLE calc_paths ADD COLUMN IF NOT EXISTS tta_p10 DOUBLE NULL AFTER tta_hours,
+			ADD COLUMN IF NOT EXISTS tta_p50 DOUBLE NULL AFTER tta_p10,
+			ADD COLUMN IF NOT EXISTS tta_p90 DOUBLE NULL AFTER tta_p50`,
+	},
+	{
+		name: "calc_paths.detection",
+		ddl: `ALTER TABLE calc_paths ADD COLUMN IF NOT EXISTS detection_probability DOUBLE NULL AFTER tta_p90,
+			ADD COLUMN IF NOT EXISTS ttd_hours DOUBLE NULL AFTER detection_probability,
+			ADD COLUMN IF NOT EXISTS attacker_wins DOUBLE NULL AFTER ttd_hours`,
+	},
+	{
+		name: "calc_sessions.paths_stored",
+		ddl:  `ALTER TABLE calc_sessions ADD COLUMN IF NOT EXISTS paths_stored INT NULL AFTER paths_found`,
+	},
+	{
+		name: "calc_sessions.queued_at",
+		ddl:  `ALTER TABLE calc_sessions ADD COLUMN IF NOT EXISTS queued_at DATETIME(3) NULL AFTER total_time_ms`,
+	},
+	{
+		name: "calc_sessions.written_late",
+		ddl:  `ALTER TABLE calc_sessions ADD COLUMN IF NOT EXISTS written_late BOOLEAN NOT NULL DEFAULT FALSE AFTER queued_at`,
+	},
 }
 
-// RunMigrations executes CREATE TABLE IF NOT EXISTS for all ADR tables (ADR-REQ-081).
-// Idempotent — safe to call on every application startup.
-func RunMigrations(db *sql.DB) error {
+// RunMigrations executes CREATE TABLE IF NOT EXISTS for all ADR tables (ADR-REQ-081),
+// then the column additions. Idempotent — safe to call on every application startup.
+func RunMigrations(ctx context.Context, db *sql.DB) error {
 	for _, t := range tables {
-		_, err := db.Exec(t.ddl)
+		_, err := db.ExecContext(ctx, t.ddl)
 		if err != nil {
 			return fmt.Errorf("store: migration failed for %s: %w", t.name, err)
 		}
-		log.Printf("store: table %s — ready", t.name)
+		slog.DebugContext(ctx, "store: table ready", "table", t.name)
+	}
+	for _, c := range columns {
+		if _, err := db.ExecContext(ctx, c.ddl); err != nil {
+			return fmt.Errorf("store: migration failed for %s: %w", c.name, err)
+		}
 	}
-	log.Printf("store: all %d tables migrated", len(tables))
+	slog.InfoContext(ctx, "store: tables migrated", "tables", len(tables), "columns", len(columns))
 	return nil
 }
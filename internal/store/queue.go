@@ -0,0 +1,465 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"ESP-data/internal/logging"
+	"ESP-data/internal/metrics"
+)
+
+// ============================================================
+// Write-behind queue — audit buffers are flushed by a single background
+// worker in arrival order, retried with backoff, spilled to a local journal
+// while MariaDB is down, and drained before the pool closes (ADR-REQ-031)
+// ============================================================
+
+// QueueConfig sizes the write-behind queue.
+type QueueConfig struct {
+	Size        int    // batches held in memory (AUDIT_QUEUE_SIZE)
+	MaxAttempts int    // FlushBatch attempts per batch (AUDIT_MAX_ATTEMPTS)
+	JournalPath string // spill file (AUDIT_JOURNAL_PATH); "" disables spilling
+}
+
+const (
+	defaultQueueSize   = 256
+	defaultMaxAttempts = 5
+
+	// Backoff between attempts doubles from retryBaseDelay up to retryMaxDelay.
+	retryBaseDelay = time.Second
+	retryMaxDelay  = time.Minute
+
+	// flushAttemptTimeout bounds one FlushBatch transaction.
+	flushAttemptTimeout = 30 * time.Second
+)
+
+// Reasons a batch is dropped, the esp_audit_batches_dropped_total label.
+const (
+	dropQueueFull        = "queue_full"
+	dropRetriesExhausted = "retries_exhausted"
+	dropShutdown         = "shutdown"
+	dropJournalError     = "journal_error"
+)
+
+// queuedBatch is one audit buffer waiting for FlushBatch, with the context
+// (request ID, no cancellation) it was enqueued under.
+type queuedBatch struct {
+	ctx      context.Context
+	buf      *AuditBuffer
+	attempts int
+}
+
+// writeBehind is a bounded FIFO of audit buffers drained by Store.runQueue.
+// While the journal holds batches, it is replayed before the memory queue,
+// so batches reach MariaDB in the order they were enqueued.
+type writeBehind struct {
+	cfg     QueueConfig
+	journal *journal // nil when spilling is disabled
+
+	mu      sync.Mutex
+	pending []queuedBatch
+	closed  bool
+
+	wake        chan struct{}   // buffered(1): signals the worker that pending grew or closed was set
+	stop        chan struct{}   // closed by close
+	abort       context.Context // cancelled when Drain's deadline passes
+	cancelAbort context.CancelFunc
+	done        chan struct{} // closed when the worker returns
+}
+
+func newWriteBehind(cfg QueueConfig) *writeBehind {
+	if cfg.Size <= 0 {
+		cfg.Size = defaultQueueSize
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	abort, cancelAbort := context.WithCancel(context.Background())
+	return &writeBehind{
+		cfg:         cfg,
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		abort:       abort,
+		cancelAbort: cancelAbort,
+		done:        make(chan struct{}),
+	}
+}
+
+// push appends a batch. When the memory queue is full, the queue and the
+// batch are moved to the journal, or the batch is dropped without one.
+func (q *writeBehind) push(b queuedBatch) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	switch {
+	case q.closed:
+		dropBatch(b, dropShutdown)
+	case len(q.pending) < q.cfg.Size:
+		q.pending = append(q.pending, b)
+		q.signal()
+	case q.journal != nil:
+		q.pending = append(q.pending, b)
+		q.spillLocked()
+		q.signal()
+	default:
+		dropBatch(b, dropQueueFull)
+	}
+}
+
+// spillLocked moves every pending batch to the end of the journal, or drops
+// them if it cannot be written. q.mu must be held.
+func (q *writeBehind) spillLocked() {
+	if len(q.pending) == 0 {
+		return
+	}
+	records := make([]journalRecord, len(q.pending))
+	for i, b := range q.pending {
+		records[i] = newJournalRecord(b)
+	}
+	if err := q.journal.append(records...); err != nil {
+		slog.Error("store: audit journal write failed", "path", q.journal.path, "err", err)
+		for _, b := range q.pending {
+			dropBatch(b, dropJournalError)
+		}
+	} else {
+		metrics.AuditJournalBatches.Add(float64(len(records)), "spilled")
+		slog.Warn("store: audit batches spilled to journal", "batches", len(records), "journal", q.journal.len())
+	}
+	q.pending = nil
+}
+
+// next takes the oldest pending batch. It reports false if there is none.
+func (q *writeBehind) next() (queuedBatch, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return queuedBatch{}, false
+	}
+	b := q.pending[0]
+	q.pending[0] = queuedBatch{}
+	q.pending = q.pending[1:]
+	return b, true
+}
+
+// isClosed reports whether close has been called.
+func (q *writeBehind) isClosed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed
+}
+
+// close stops accepting batches; the worker returns once the memory queue
+// is empty.
+func (q *writeBehind) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		close(q.stop)
+	}
+	q.signal()
+}
+
+// depth returns the number of batches in the memory queue.
+func (q *writeBehind) depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// signal wakes the worker without blocking. q.mu must be held.
+func (q *writeBehind) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// backoff waits d before the next attempt. It reports false if the queue
+// was aborted, or closed when stopOnClose is set, before d elapsed.
+func (q *writeBehind) backoff(d time.Duration, stopOnClose bool) bool {
+	stop := q.stop
+	if !stopOnClose {
+		stop = nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-stop:
+		return false
+	case <-q.abort.Done():
+		return false
+	}
+}
+
+// retryDelay is the backoff after the given number of failed attempts.
+func retryDelay(failures int) time.Duration {
+	d := retryBaseDelay
+	for i := 1; i < failures && d < retryMaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, retryMaxDelay)
+}
+
+// dropBatch logs and counts a batch that will not be written.
+func dropBatch(b queuedBatch, reason string) {
+	metrics.AuditBatchesDropped.Inc(reason)
+	slog.ErrorContext(b.ctx, "store: audit batch dropped", "reason", reason, "attempts", b.attempts,
+		"entry", b.buf.Session.EntryAssetID, "target", b.buf.Session.TargetAssetID)
+}
+
+// ------------------------------------------------------------
+// Worker
+// ------------------------------------------------------------
+
+// runQueue is the write-behind worker. It replays the journal whenever it
+// holds batches, otherwise flushes the memory queue one batch at a time.
+// After close it returns once the memory queue is empty; batches still in
+// the journal are replayed on the next start. After an abort it returns at
+// once and Drain disposes of the memory queue. Until MariaDB is first
+// reached, batches wait in the memory queue and overflow to the journal.
+func (s *Store) runQueue() {
+	q := s.queue
+	defer close(q.done)
+
+	select {
+	case <-s.connected:
+	case <-q.stop:
+		// Closed before MariaDB was ever reached: keep what the journal can hold.
+		q.mu.Lock()
+		if q.journal != nil {
+			q.spillLocked()
+		} else {
+			for _, b := range q.pending {
+				dropBatch(b, dropShutdown)
+			}
+			q.pending = nil
+		}
+		q.mu.Unlock()
+		return
+	case <-q.abort.Done():
+		return
+	}
+
+	replayFailures := 0
+	for {
+		if q.abort.Err() != nil {
+			return
+		}
+		if q.journal != nil && q.journal.len() > 0 {
+			if q.isClosed() {
+				q.mu.Lock()
+				q.spillLocked()
+				q.mu.Unlock()
+				slog.Info("store: audit batches kept in journal for next start",
+					"path", q.journal.path, "batches", q.journal.len())
+				return
+			}
+			if err := s.replayJournal(); err == nil {
+				replayFailures = 0
+				continue
+			}
+			replayFailures++
+			q.backoff(retryDelay(replayFailures), true)
+			continue
+		}
+
+		b, ok := q.next()
+		if !ok {
+			if q.isClosed() {
+				return
+			}
+			select {
+			case <-q.wake:
+			case <-q.abort.Done():
+			}
+			continue
+		}
+		s.deliver(b)
+	}
+}
+
+// deliver flushes b, retrying with backoff up to MaxAttempts. A batch that
+// still fails is written to the head of the journal — it is older than
+// anything spilled there meanwhile — or dropped without one.
+func (s *Store) deliver(b queuedBatch) {
+	q := s.queue
+	for {
+		b.attempts++
+		err := s.flushAttempt(b.ctx, b.buf, b.attempts > 1)
+		if err == nil {
+			return
+		}
+		if b.attempts >= q.cfg.MaxAttempts {
+			s.spillOrDrop(b, dropRetriesExhausted)
+			return
+		}
+		delay := retryDelay(b.attempts)
+		metrics.AuditFlushRetries.Inc()
+		slog.WarnContext(b.ctx, "store: audit batch flush failed, retrying", "attempt", b.attempts,
+			"max_attempts", q.cfg.MaxAttempts, "retry_in", delay, "err", err)
+		// With a journal there is no reason to keep retrying once closing.
+		if !q.backoff(delay, q.journal != nil) {
+			s.spillOrDrop(b, dropShutdown)
+			return
+		}
+	}
+}
+
+// spillOrDrop puts b at the head of the journal, or drops it for reason.
+func (s *Store) spillOrDrop(b queuedBatch, reason string) {
+	q := s.queue
+	if q.journal == nil {
+		dropBatch(b, reason)
+		return
+	}
+	if err := q.journal.rewriteHead(0, newJournalRecord(b)); err != nil {
+		slog.ErrorContext(b.ctx, "store: audit journal write failed", "path", q.journal.path, "err", err)
+		dropBatch(b, dropJournalError)
+		return
+	}
+	metrics.AuditJournalBatches.Inc("spilled")
+	slog.WarnContext(b.ctx, "store: audit batch spilled to journal", "attempts", b.attempts, "journal", q.journal.len())
+}
+
+// replayJournal writes journaled batches in order once MariaDB answers a
+// ping, then removes the committed ones with a single rewrite. A batch that
+// fails while MariaDB is reachable counts an attempt and is dropped after
+// MaxAttempts, so one bad batch cannot block the journal. A crash before the
+// rewrite replays committed batches again; their batch_id makes FlushBatch
+// skip them. Cache entries of a batch journaled before a cache purge were
+// computed against the old graph; FlushBatch leaves them out, as for batches
+// from the memory queue. It returns the first error.
+func (s *Store) replayJournal() error {
+	q := s.queue
+	pingCtx, cancel := context.WithTimeout(q.abort, flushAttemptTimeout)
+	err := s.db.PingContext(pingCtx)
+	cancel()
+	if err != nil {
+		slog.Debug("store: MariaDB unreachable, journal replay deferred", "batches", q.journal.len(), "err", err)
+		return err
+	}
+
+	records, err := q.journal.read()
+	if err != nil {
+		slog.Error("store: audit journal read failed", "path", q.journal.path, "err", err)
+		return err
+	}
+	slog.Info("store: replaying audit journal", "batches", len(records))
+	replayStart := time.Now()
+
+	for i, rec := range records {
+		ctx := logging.WithRequestID(context.Background(), rec.Buffer.Session.RequestID)
+		rec.Attempts++
+		if err := s.flushAttempt(ctx, rec.Buffer, true); err != nil {
+			if rec.Attempts >= q.cfg.MaxAttempts {
+				dropBatch(queuedBatch{ctx: ctx, buf: rec.Buffer, attempts: rec.Attempts}, dropRetriesExhausted)
+				err = q.journal.rewriteHead(i + 1)
+			} else {
+				err = q.journal.rewriteHead(i+1, rec)
+			}
+			if err != nil {
+				slog.Error("store: audit journal write failed", "path", q.journal.path, "err", err)
+			}
+			return err
+		}
+		metrics.AuditJournalBatches.Inc("replayed")
+	}
+	if err := q.journal.rewriteHead(len(records)); err != nil {
+		slog.Error("store: audit journal write failed", "path", q.journal.path, "err", err)
+		return err
+	}
+	slog.Info("store: audit journal replayed", "batches", len(records), "elapsed", time.Since(replayStart))
+	return nil
+}
+
+// flushAttempt runs one FlushBatch under flushAttemptTimeout, cancelled early
+// if the drain is aborted. late marks the calc_sessions row written_late.
+func (s *Store) flushAttempt(ctx context.Context, buf *AuditBuffer, late bool) error {
+	ctx, cancel := context.WithTimeout(ctx, flushAttemptTimeout)
+	defer cancel()
+	stop := context.AfterFunc(s.queue.abort, cancel)
+	defer stop()
+
+	buf.Session.WrittenLate = late
+	return s.FlushBatch(ctx, buf)
+}
+
+// ------------------------------------------------------------
+// Store API
+// ------------------------------------------------------------
+
+// Enqueue hands an audit buffer to the write-behind queue and returns at once.
+// Batches are written by FlushBatch in the order they were enqueued; ctx
+// should outlive the request (context.WithoutCancel) so the request ID is
+// kept. After Close has begun, the batch is dropped and logged.
+func (s *Store) Enqueue(ctx context.Context, buf *AuditBuffer) {
+	if !s.Enabled() || buf == nil {
+		return
+	}
+	buf.Session.QueuedAt = time.Now()
+	buf.Session.BatchID = newBatchID()
+	s.queue.push(queuedBatch{ctx: ctx, buf: buf})
+}
+
+// newBatchID returns a random (version 4) UUID for calc_sessions.batch_id.
+func newBatchID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// QueueDepth returns the number of audit batches waiting in memory.
+func (s *Store) QueueDepth() int {
+	if !s.Enabled() {
+		return 0
+	}
+	return s.queue.depth()
+}
+
+// JournalDepth returns the number of audit batches waiting in the journal.
+func (s *Store) JournalDepth() int {
+	if !s.Enabled() || s.queue.journal == nil {
+		return 0
+	}
+	return s.queue.journal.len()
+}
+
+// Drain stops accepting new batches and waits until the memory queue has
+// been flushed, or spilled to the journal, or until ctx is done. On timeout
+// the running flush is cancelled and what is left goes to the journal, or
+// is dropped without one; Drain then returns ctx.Err().
+func (s *Store) Drain(ctx context.Context) error {
+	if !s.Enabled() {
+		return nil
+	}
+	s.queue.close()
+	select {
+	case <-s.queue.done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.queue.cancelAbort()
+	<-s.queue.done
+	q := s.queue
+	q.mu.Lock()
+	if q.journal != nil {
+		q.spillLocked()
+	} else {
+		for _, b := range q.pending {
+			dropBatch(b, dropShutdown)
+		}
+		q.pending = nil
+	}
+	q.mu.Unlock()
+	slog.ErrorContext(ctx, "store: audit queue not drained in time", "err", ctx.Err())
+	return ctx.Err()
+}
@@ -1,25 +1,37 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
+	"ESP-data/internal/metrics"
+
 	_ "github.com/go-sql-driver/mysql"
 )
 
 // Store wraps the MariaDB connection pool and provides audit/cache operations.
-// All write operations are designed for async (fire-and-forget) use (ADR-REQ-031).
+// All write operations are designed for async (fire-and-forget) use (ADR-REQ-031);
+// audit buffers go through the write-behind queue (Enqueue) and are drained by Close.
 type Store struct {
 	db      *sql.DB
 	enabled bool
+	queue   *writeBehind
+	autoInc autoIncrement // set before connected is closed
+
+	connected chan struct{} // closed once MariaDB was reached and migrated
 }
 
 // New creates a Store and runs schema migrations (ADR-REQ-003, ADR-REQ-081).
-// If the connection fails and MARIA_ENABLED is true, returns an error.
-// The caller may choose to proceed without the store (graceful degradation, ADR-REQ-033).
-func New(host string, port int, user, pass, dbname string) (*Store, error) {
+// A MariaDB that does not answer the first ping is not an error: the store
+// keeps connecting in the background, audit batches wait in the queue and
+// the journal meanwhile, and reads fail like they do during a later outage.
+// An invalid DSN or a failed migration returns an error; the caller may
+// choose to proceed without the store (graceful degradation, ADR-REQ-033).
+func New(ctx context.Context, host string, port int, user, pass, dbname string, queue QueueConfig) (*Store, error) {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&charset=utf8mb4",
 		user, pass, host, port, dbname)
 
@@ -32,19 +44,74 @@ func New(host string, port int, user, pass, dbname string) (*Store, error) {
 	db.SetMaxIdleConns(2)
 	db.SetConnMaxLifetime(5 * time.Minute)
 
-	if err := db.Ping(); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("store: failed to ping MariaDB at %s:%d: %w", host, port, err)
+	s := &Store{db: db, enabled: true, queue: newWriteBehind(queue), connected: make(chan struct{})}
+	if queue.JournalPath != "" {
+		// An unusable journal disables spilling, not the store (ADR-REQ-033).
+		if s.queue.journal, err = openJournal(queue.JournalPath); err != nil {
+			slog.WarnContext(ctx, "store: audit journal unavailable — batches are dropped while MariaDB is down",
+				"path", queue.JournalPath, "err", err)
+		} else if n := s.queue.journal.len(); n > 0 {
+			slog.InfoContext(ctx, "store: audit journal holds batches from a previous run", "path", queue.JournalPath,
+				"batches", n)
+		}
 	}
 
-	log.Printf("store: connected to MariaDB %s:%d/%s", host, port, dbname)
+	if err := db.PingContext(ctx); err != nil {
+		slog.WarnContext(ctx, "store: MariaDB unreachable — connecting in the background", "host", host,
+			"port", port, "err", err)
+		go s.connect(host, port, dbname)
+	} else {
+		slog.InfoContext(ctx, "store: connected to MariaDB", "host", host, "port", port, "db", dbname)
+		if err := s.setup(ctx); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	go s.runQueue()
+	return s, nil
+}
 
-	if err := RunMigrations(db); err != nil {
-		db.Close()
-		return nil, err
+// setup runs the migrations on a reachable MariaDB, reads the auto-increment
+// settings and releases the write-behind worker.
+func (s *Store) setup(ctx context.Context) error {
+	if err := RunMigrations(ctx, s.db); err != nil {
+		return err
+	}
+	s.autoInc = readAutoIncrement(ctx, s.db)
+	close(s.connected)
+	return nil
+}
+
+// connect retries the first ping and setup with backoff until one succeeds
+// or the store is closed.
+func (s *Store) connect(host string, port int, dbname string) {
+	q := s.queue
+	for failures := 1; ; failures++ {
+		if !q.backoff(retryDelay(failures), true) {
+			return
+		}
+		ctx, cancel := context.WithTimeout(q.abort, flushAttemptTimeout)
+		err := s.db.PingContext(ctx)
+		if err == nil {
+			err = s.setup(ctx)
+		}
+		cancel()
+		if err == nil {
+			slog.Info("store: connected to MariaDB", "host", host, "port", port, "db", dbname, "attempts", failures+1)
+			return
+		}
+		slog.Debug("store: MariaDB still unreachable", "attempts", failures+1, "err", err)
 	}
+}
 
-	return &Store{db: db, enabled: true}, nil
+// isConnected reports whether MariaDB was reached and migrated.
+func (s *Store) isConnected() bool {
+	select {
+	case <-s.connected:
+		return true
+	default:
+		return false
+	}
 }
 
 // Enabled returns whether the store is available for use.
@@ -52,157 +119,273 @@ func (s *Store) Enabled() bool {
 	return s != nil && s.enabled
 }
 
-// Close shuts down the connection pool.
-func (s *Store) Close() {
-	if s != nil && s.db != nil {
-		s.db.Close()
-		log.Printf("store: connection closed")
+// Ping checks the MariaDB connection (/readyz).
+func (s *Store) Ping(ctx context.Context) error {
+	if !s.Enabled() {
+		return fmt.Errorf("store: disabled")
+	}
+	if !s.isConnected() {
+		return fmt.Errorf("store: not connected yet")
+	}
+	return s.db.PingContext(ctx)
+}
+
+// Close drains the write-behind queue, waiting until ctx is done at most, and
+// then shuts down the connection pool.
+func (s *Store) Close(ctx context.Context) {
+	if s == nil || s.db == nil {
+		return
+	}
+	drainStart := time.Now()
+	if err := s.Drain(ctx); err == nil {
+		slog.InfoContext(ctx, "store: audit queue drained", "elapsed", time.Since(drainStart))
 	}
+	s.db.Close()
+	slog.InfoContext(ctx, "store: connection closed")
 }
 
 // FlushBatch writes the entire audit buffer to MariaDB in a single transaction (ADR-REQ-031).
-// Designed to be called as: go store.FlushBatch(buf)
-// If any step fails, the transaction is rolled back and the error is logged.
-// No retry — the data is rebuildable (ADR-REQ-033).
-func (s *Store) FlushBatch(buf *AuditBuffer) {
+// It is run by the write-behind queue (Enqueue) with a ctx that outlives the
+// request (context.WithoutCancel).
+// If any step fails, the transaction is rolled back and the error is logged
+// and returned. FlushBatch does not retry; the queue does (ADR-REQ-033).
+func (s *Store) FlushBatch(ctx context.Context, buf *AuditBuffer) (err error) {
 	if !s.Enabled() || buf == nil {
-		return
+		return nil
 	}
 
 	flushStart := time.Now()
 
-	tx, err := s.db.Begin()
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		log.Printf("store: FlushBatch failed to begin tx: %v", err)
-		return
+		slog.ErrorContext(ctx, "store: FlushBatch failed to begin tx", "err", err)
+		metrics.AuditFlushes.Inc("failed")
+		return err
 	}
 
 	defer func() {
 		if err != nil {
 			tx.Rollback()
-			log.Printf("store: FlushBatch rolled back after %.3fs: %v",
-				time.Since(flushStart).Seconds(), err)
+			metrics.AuditFlushes.Inc("rolled_back")
+			slog.ErrorContext(ctx, "store: FlushBatch rolled back", "elapsed", time.Since(flushStart), "err", err)
 		}
 	}()
 
+	// A retried or replayed batch may have been committed by an attempt
+	// whose outcome was lost; batch_id is unique, so it is written once.
+	if buf.Session.BatchID != "" {
+		var written int
+		err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM calc_sessions WHERE batch_id = ?`,
+			buf.Session.BatchID).Scan(&written)
+		if err != nil {
+			return
+		}
+		if written > 0 {
+			tx.Rollback()
+			slog.InfoContext(ctx, "store: audit batch already written", "batch_id", buf.Session.BatchID)
+			return nil
+		}
+	}
+
 	// Layer 1: session
-	res, err := tx.Exec(`INSERT INTO calc_sessions
-		(entry_asset_id, target_asset_id, max_hops, orientation_time,
-		 switchover_time, priority_tolerance, paths_found,
-		 assets_recalculated, query_time_ms, total_time_ms)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	res, err := tx.ExecContext(ctx, `INSERT INTO calc_sessions
+		(request_id, batch_id, entry_asset_id, target_asset_id, max_hops, orientation_time,
+		 switchover_time, priority_tolerance, ttb_selection, sim_distribution, sim_trials, sim_seed,
+		 paths_found, paths_stored, assets_recalculated, query_time_ms, total_time_ms, queued_at, written_late)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sql.NullString{String: buf.Session.RequestID, Valid: buf.Session.RequestID != ""},
+		sql.NullString{String: buf.Session.BatchID, Valid: buf.Session.BatchID != ""},
 		buf.Session.EntryAssetID, buf.Session.TargetAssetID,
 		buf.Session.MaxHops, buf.Session.OrientationTime,
-		buf.Session.SwitchoverTime, buf.Session.PriorityTolerance,
-		buf.Session.PathsFound, buf.Session.AssetsRecalculated,
-		buf.Session.QueryTimeMs, buf.Session.TotalTimeMs)
+		buf.Session.SwitchoverTime, buf.Session.PriorityTolerance, sessionSelection(buf.Session.TTBSelection),
+		sql.NullString{String: buf.Session.SimDistribution, Valid: buf.Session.SimTrials > 0},
+		sql.NullInt64{Int64: int64(buf.Session.SimTrials), Valid: buf.Session.SimTrials > 0},
+		sql.NullInt64{Int64: buf.Session.SimSeed, Valid: buf.Session.SimTrials > 0},
+		buf.Session.PathsFound, len(buf.Paths), buf.Session.AssetsRecalculated,
+		buf.Session.QueryTimeMs, buf.Session.TotalTimeMs,
+		sql.NullTime{Time: buf.Session.QueuedAt, Valid: !buf.Session.QueuedAt.IsZero()},
+		buf.Session.WrittenLate)
 	if err != nil {
 		return
 	}
 	sessionID, _ := res.LastInsertId()
 
 	// Layer 2: paths (ADR-REQ-032 batch insert)
-	for _, p := range buf.Paths {
-		_, err = tx.Exec(`INSERT INTO calc_paths
-			(session_id, path_seq, host_chain, hop_count, tta_hours)
-			VALUES (?, ?, ?, ?, ?)`,
-			sessionID, p.PathSeq, p.HostChain, p.HopCount, p.TTAHours)
-		if err != nil {
-			return
-		}
+	_, err = s.insertRows(ctx, tx, `INSERT INTO calc_paths
+		(session_id, path_seq, host_chain, hop_count, tta_hours, tta_p10, tta_p50, tta_p90,
+		 detection_probability, ttd_hours, attacker_wins) VALUES`, 11, len(buf.Paths), false,
+		func(i int) []interface{} {
+			p := buf.Paths[i]
+			return []interface{}{sessionID, p.PathSeq, p.HostChain, p.HopCount, p.TTAHours, p.TTAP10, p.TTAP50, p.TTAP90,
+				p.DetectionProbability, p.TTDHours, p.AttackerWins}
+		})
+	if err != nil {
+		return
 	}
 
 	// Layer 3: one breakdown per ComputeTTB call (one per asset per request) (ADR-REQ-012)
-	breakdownIDs := make([]int64, len(buf.Breakdowns))
-	for i, bd := range buf.Breakdowns {
-		res, err = tx.Exec(`INSERT INTO calc_ttb_breakdown
-			(session_id, asset_vid, chain_position, chain_vid,
-			 ttb_total, orientation_time, tactic_count, technique_count)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-			sessionID, bd.AssetVid, bd.ChainPosition, bd.ChainVid,
-			bd.TTBTotal, bd.OrientationTime, bd.TacticCount, bd.TechniqueCount)
-		if err != nil {
-			return
-		}
-		breakdownIDs[i], _ = res.LastInsertId()
+	breakdownIDs, err := s.insertRows(ctx, tx, `INSERT INTO calc_ttb_breakdown
+		(session_id, asset_vid, chain_position, chain_vid,
+		 ttb_total, orientation_time, tactic_count, technique_count) VALUES`, 8, len(buf.Breakdowns), true,
+		func(i int) []interface{} {
+			bd := buf.Breakdowns[i]
+			return []interface{}{sessionID, bd.AssetVid, bd.ChainPosition, bd.ChainVid,
+				bd.TTBTotal, bd.OrientationTime, bd.TacticCount, bd.TechniqueCount}
+		})
+	if err != nil {
+		return
 	}
 
 	// Layer 3A: tactic steps — resolve BreakdownIdx → real breakdown_id (ADR-REQ-013)
-	stepIDs := make([]int64, len(buf.TacticSteps))
-	for j, ts := range buf.TacticSteps {
-		var bdID int64
-		if ts.BreakdownIdx >= 0 && ts.BreakdownIdx < len(breakdownIDs) {
-			bdID = breakdownIDs[ts.BreakdownIdx]
-		}
-		res, err = tx.Exec(`INSERT INTO calc_ttb_tactic_steps
-			(breakdown_id, tactic_seq, tactic_id, tactic_name,
-			 technique_id, technique_name,
-			 ttt_hours, switchover_added, candidates_count)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-			bdID, ts.TacticSeq, ts.TacticID, ts.TacticName,
-			sql.NullString{String: ts.TechniqueID, Valid: ts.TechniqueID != ""},
-			sql.NullString{String: ts.TechniqueName, Valid: ts.TechniqueName != ""},
-			ts.TTTHours, ts.SwitchoverAdded, ts.CandidatesCount)
-		if err != nil {
-			return
-		}
-		stepIDs[j], _ = res.LastInsertId()
+	stepIDs, err := s.insertRows(ctx, tx, `INSERT INTO calc_ttb_tactic_steps
+		(breakdown_id, tactic_seq, tactic_id, tactic_name,
+		 technique_id, technique_name,
+		 ttt_hours, switchover_added, candidates_count) VALUES`, 9, len(buf.TacticSteps), true,
+		func(i int) []interface{} {
+			ts := buf.TacticSteps[i]
+			var bdID int64
+			if ts.BreakdownIdx >= 0 && ts.BreakdownIdx < len(breakdownIDs) {
+				bdID = breakdownIDs[ts.BreakdownIdx]
+			}
+			return []interface{}{bdID, ts.TacticSeq, ts.TacticID, ts.TacticName,
+				sql.NullString{String: ts.TechniqueID, Valid: ts.TechniqueID != ""},
+				sql.NullString{String: ts.TechniqueName, Valid: ts.TechniqueName != ""},
+				ts.TTTHours, ts.SwitchoverAdded, ts.CandidatesCount}
+		})
+	if err != nil {
+		return
 	}
 
 	// Layer 4: TTT detail — resolve StepIdx → real step_id (ADR-REQ-014)
-	for _, td := range buf.TTTDetails {
-		var sID int64
-		if td.StepIdx >= 0 && td.StepIdx < len(stepIDs) {
-			sID = stepIDs[td.StepIdx]
-		}
-		_, err = tx.Exec(`INSERT INTO calc_ttt_detail
-			(step_id, technique_id, exec_min, exec_max,
-			 possible_count, applied_count, maturity_factor,
-			 formula_case, ttt_hours)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-			sID, td.TechniqueID,
-			td.ExecMin, td.ExecMax,
-			td.PossibleCount, td.AppliedCount, td.MaturityFactor,
-			td.FormulaCase, td.TTTHours)
-		if err != nil {
-			return
-		}
+	_, err = s.insertRows(ctx, tx, `INSERT INTO calc_ttt_detail
+		(step_id, technique_id, exec_min, exec_max,
+		 possible_count, applied_count, maturity_factor,
+		 formula_case, ttt_hours) VALUES`, 9, len(buf.TTTDetails), false,
+		func(i int) []interface{} {
+			td := buf.TTTDetails[i]
+			var sID int64
+			if td.StepIdx >= 0 && td.StepIdx < len(stepIDs) {
+				sID = stepIDs[td.StepIdx]
+			}
+			return []interface{}{sID, td.TechniqueID,
+				td.ExecMin, td.ExecMax,
+				td.PossibleCount, td.AppliedCount, td.MaturityFactor,
+				td.FormulaCase, td.TTTHours}
+		})
+	if err != nil {
+		return
 	}
 
-	// Cache entries (ADR-REQ-022 — UPSERT via REPLACE)
-	for _, ce := range buf.CacheEntries {
-		_, err = tx.Exec(`REPLACE INTO asset_ttb_cache
-			(asset_vid, chain_position, computed_at, nebula_hash,
-			 ttb_total, orientation_time, breakdown_json, is_valid)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-			ce.AssetVid, ce.ChainPosition, ce.ComputedAt, ce.NebulaHash,
-			ce.TTBTotal, ce.OrientationTime, ce.BreakdownJSON, ce.IsValid)
-		if err != nil {
-			return
-		}
+	// Cache entries (ADR-REQ-022 — UPSERT via REPLACE), except those a purge
+	// made stale after they were computed
+	var cacheEntries []CacheEntry
+	cacheEntries, err = s.freshCacheEntries(ctx, tx, buf.CacheEntries)
+	if err != nil {
+		return
+	}
+	_, err = s.insertRows(ctx, tx, `REPLACE INTO asset_ttb_cache
+		(asset_vid, chain_position, computed_at, nebula_hash,
+		 ttb_total, orientation_time, breakdown_json, is_valid) VALUES`, 8, len(cacheEntries), false,
+		func(i int) []interface{} {
+			ce := cacheEntries[i]
+			return []interface{}{ce.AssetVid, ce.ChainPosition, ce.ComputedAt, ce.NebulaHash,
+				ce.TTBTotal, ce.OrientationTime, ce.BreakdownJSON, ce.IsValid}
+		})
+	if err != nil {
+		return
 	}
 
 	err = tx.Commit()
 	if err != nil {
 		return
 	}
+	metrics.AuditFlushes.Inc("committed")
 
-	log.Printf("store: FlushBatch completed in %.3fs — session=%d paths=%d breakdowns=%d steps=%d details=%d cache=%d",
-		time.Since(flushStart).Seconds(), sessionID,
-		len(buf.Paths), len(buf.Breakdowns), len(buf.TacticSteps),
-		len(buf.TTTDetails), len(buf.CacheEntries))
+	slog.InfoContext(ctx, "store: FlushBatch completed", "elapsed", time.Since(flushStart), "session", sessionID,
+		"paths", len(buf.Paths), "breakdowns", len(buf.Breakdowns), "steps", len(buf.TacticSteps),
+		"details", len(buf.TTTDetails), "cache", len(cacheEntries), "cache_stale", len(buf.CacheEntries)-len(cacheEntries),
+		"written_late", buf.Session.WrittenLate)
+	return nil
+}
+
+// freshCacheEntries returns the entries computed after the last
+// InvalidateAllCache. The purge row is read with a shared lock, so a purge
+// running concurrently waits for this transaction and then invalidates what
+// it wrote. computed_at is stored to the millisecond: an entry computed in
+// the millisecond of the purge counts as stale.
+func (s *Store) freshCacheEntries(ctx context.Context, tx *sql.Tx, entries []CacheEntry) ([]CacheEntry, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	var purgedAt time.Time
+	err := tx.QueryRowContext(ctx, `SELECT purged_at FROM asset_ttb_cache_purge WHERE id = 1 LOCK IN SHARE MODE`).Scan(&purgedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	fresh := make([]CacheEntry, 0, len(entries))
+	for _, ce := range entries {
+		if ce.ComputedAt.Truncate(time.Millisecond).After(purgedAt) {
+			fresh = append(fresh, ce)
+		}
+	}
+	return fresh, nil
+}
+
+// sessionSelection records a session without a TTB selection mode, such as
+// one journaled by an earlier version, as "fastest" — the only mode then.
+func sessionSelection(selection string) string {
+	if selection == "" {
+		return "fastest"
+	}
+	return selection
 }
 
 // InvalidateCache marks cached TTB breakdowns as stale for an asset (ADR-REQ-021).
 // Called alongside InvalidateAssetHash when mitigations change.
-func (s *Store) InvalidateCache(assetVid string) {
+func (s *Store) InvalidateCache(ctx context.Context, assetVid string) {
 	if !s.Enabled() {
 		return
 	}
-	_, err := s.db.Exec(
+	_, err := s.db.ExecContext(ctx,
 		`UPDATE asset_ttb_cache SET is_valid = FALSE WHERE asset_vid = ?`,
 		assetVid)
 	if err != nil {
-		log.Printf("store: InvalidateCache failed for %s: %v", assetVid, err)
+		slog.ErrorContext(ctx, "store: InvalidateCache failed", "asset", assetVid, "err", err)
+	}
+}
+
+// InvalidateAllCache marks every cached TTB breakdown as stale (ADR-REQ-021)
+// and records the time of the purge, so that FlushBatch does not write cache
+// entries computed before it from batches still queued or journaled.
+// Called when a tactic chain or chain rule changes — the cache key holds the
+// chain position, not the chain — and after an ATT&CK import, which leaves
+// asset hashes unchanged.
+func (s *Store) InvalidateAllCache(ctx context.Context) {
+	if !s.Enabled() {
+		return
+	}
+	if err := s.invalidateAllCache(ctx, time.Now()); err != nil {
+		slog.ErrorContext(ctx, "store: InvalidateAllCache failed", "err", err)
+	}
+}
+
+// invalidateAllCache moves the purge time forward to purgedAt and clears
+// is_valid in one transaction.
+func (s *Store) invalidateAllCache(ctx context.Context, purgedAt time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `INSERT INTO asset_ttb_cache_purge (id, purged_at) VALUES (1, ?)
+		ON DUPLICATE KEY UPDATE purged_at = GREATEST(purged_at, VALUES(purged_at))`, purgedAt); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE asset_ttb_cache SET is_valid = FALSE WHERE is_valid = TRUE`); err != nil {
+		return err
 	}
+	return tx.Commit()
 }
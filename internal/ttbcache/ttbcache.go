@@ -0,0 +1,263 @@
+package ttbcache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/metrics"
+	"ESP-data/internal/nebula"
+	"ESP-data/internal/store"
+)
+
+// ============================================================
+// Position TTB cache — ComputeTTB results keyed by
+// (asset_vid, chain_position, nebula_hash) (ALG-REQ-053 optional
+// optimisation, ADR-REQ-020 through ADR-REQ-022)
+// ============================================================
+
+// Cache is an in-process LRU in front of the asset_ttb_cache table. Both
+// layers are consulted only while the asset's hash is valid: a mitigation
+// change invalidates the hash (ALG-REQ-043, ADR-REQ-021), so the next call
+// recomputes. The table has no column for switchover time or priority
+// tolerance, so it is only read and written for the configured default TTB
+// parameters; the LRU keys on the full parameter set.
+//
+// A nil *Cache is valid and always recomputes.
+type Cache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // front = most recently used
+	items    map[key]*list.Element
+	db       *store.Store
+	defaults nebula.TTBParams
+	purged   time.Time // last Purge; results computed before it are not kept
+}
+
+type key struct {
+	assetVid string
+	position string
+	hash     string
+	params   nebula.TTBParams
+}
+
+type entry struct {
+	key          key
+	ttb          float64
+	log          []nebula.TTBLogEntry
+	distribution []nebula.TTBOutcome
+}
+
+// New returns a Cache holding up to capacity results in memory (0 disables
+// the LRU) backed by db, which may be nil or disabled.
+func New(capacity int, db *store.Store, defaults nebula.TTBParams) *Cache {
+	if capacity < 0 {
+		capacity = 0
+	}
+	return &Cache{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[key]*list.Element),
+		db:       db,
+		defaults: defaults,
+	}
+}
+
+// ComputeTTB returns the TTB of assetVid with chainVid at position
+// ("entrance", "intermediate" or "target") and reports whether it came from
+// the cache. On a miss it runs gs.ComputeTTB, labels the resulting audit
+// breakdown with position and, for default parameters, queues the breakdown
+// for asset_ttb_cache in audit.CacheEntries (ADR-REQ-022). A hit adds nothing
+// to audit; path detail then serves that hop from the cache (ADR-REQ-050).
+func (c *Cache) ComputeTTB(ctx context.Context, gs graphstore.GraphStore, assetVid, chainVid, position string, params nebula.TTBParams, audit *store.AuditBuffer) (*nebula.TTBResult, bool, error) {
+	var hash string
+	if c != nil {
+		hashes, err := gs.QueryAssetHashes(ctx, []string{assetVid})
+		if err != nil {
+			slog.WarnContext(ctx, "ttbcache: QueryAssetHashes failed, computing uncached", "asset", assetVid,
+				"err", err)
+		}
+		hash = hashes[assetVid]
+	}
+
+	k := key{assetVid: assetVid, position: position, hash: hash, params: params}
+	if hash != "" {
+		if result, ok := c.lookup(ctx, k); ok {
+			return result, true, nil
+		}
+	}
+
+	breakdownIdx := -1
+	if audit != nil {
+		breakdownIdx = len(audit.Breakdowns)
+	}
+	computedAt := time.Now()
+	result, err := gs.ComputeTTB(ctx, assetVid, chainVid, params, audit)
+	if audit != nil && len(audit.Breakdowns) > breakdownIdx {
+		audit.Breakdowns[breakdownIdx].ChainPosition = position
+	}
+	if err != nil || hash == "" {
+		return result, false, err
+	}
+
+	c.Record(assetVid, position, hash, params, result, audit, breakdownIdx, computedAt)
+	return result, false, nil
+}
+
+// Record stores a TTB computed outside ComputeTTB — e.g. a path-scoped
+// intermediate recalculation whose new hash is known (ALG-REQ-046 step 4) —
+// and, for default parameters, queues audit.Breakdowns[breakdownIdx] for
+// asset_ttb_cache (ADR-REQ-022). computedAt is when the computation started:
+// a result that a Purge overtook is dropped here, and its cache row is
+// dropped by store.FlushBatch if the purge comes after the queueing.
+func (c *Cache) Record(assetVid, position, hash string, params nebula.TTBParams, result *nebula.TTBResult, audit *store.AuditBuffer, breakdownIdx int, computedAt time.Time) {
+	if c == nil || hash == "" || result == nil {
+		return
+	}
+	if !c.add(key{assetVid: assetVid, position: position, hash: hash, params: params}, result, computedAt) {
+		slog.Debug("ttbcache: result computed before the last purge not cached", "asset", assetVid, "position", position)
+		return
+	}
+	if audit == nil || params != c.defaults {
+		return
+	}
+	breakdownJSON, err := store.EncodeBreakdown(store.BufferedBreakdown(audit, breakdownIdx))
+	if err != nil {
+		slog.Warn("ttbcache: breakdown not cached", "asset", assetVid, "position", position, "err", err)
+		return
+	}
+	audit.CacheEntries = append(audit.CacheEntries, store.CacheEntry{
+		AssetVid:        assetVid,
+		ChainPosition:   position,
+		ComputedAt:      computedAt,
+		NebulaHash:      hash,
+		TTBTotal:        result.TTB,
+		OrientationTime: params.OrientationTime,
+		BreakdownJSON:   breakdownJSON,
+		IsValid:         true,
+	})
+}
+
+// lookup checks the LRU, then asset_ttb_cache for default parameters
+// (ADR-REQ-021 cache read logic: is_valid and matching hash).
+func (c *Cache) lookup(ctx context.Context, k key) (*nebula.TTBResult, bool) {
+	c.mu.Lock()
+	if el, ok := c.items[k]; ok {
+		c.order.MoveToFront(el)
+		e := el.Value.(*entry)
+		c.mu.Unlock()
+		metrics.TTBCacheLookups.Inc("memory", "hit")
+		return &nebula.TTBResult{
+			TTB:          e.ttb,
+			Log:          append([]nebula.TTBLogEntry(nil), e.log...),
+			Distribution: append([]nebula.TTBOutcome(nil), e.distribution...),
+		}, true
+	}
+	c.mu.Unlock()
+	metrics.TTBCacheLookups.Inc("memory", "miss")
+
+	if k.params != c.defaults || !c.db.Enabled() {
+		return nil, false
+	}
+	ce, err := c.db.LoadCacheEntry(ctx, k.assetVid, k.position)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			slog.WarnContext(ctx, "ttbcache: cache row unreadable", "asset", k.assetVid,
+				"position", k.position, "err", err)
+		}
+		metrics.TTBCacheLookups.Inc("rdbms", "miss")
+		return nil, false
+	}
+	if ce.NebulaHash != k.hash || ce.OrientationTime != k.params.OrientationTime {
+		metrics.TTBCacheLookups.Inc("rdbms", "miss")
+		return nil, false
+	}
+	steps, err := ce.Steps()
+	if err != nil {
+		slog.WarnContext(ctx, "ttbcache: cache row unreadable", "asset", k.assetVid, "position", k.position, "err", err)
+		metrics.TTBCacheLookups.Inc("rdbms", "miss")
+		return nil, false
+	}
+	metrics.TTBCacheLookups.Inc("rdbms", "hit")
+	result := &nebula.TTBResult{TTB: ce.TTBTotal, Log: logFromBreakdown(steps)}
+	c.add(k, result, ce.ComputedAt)
+	return result, true
+}
+
+// Purge drops every cached result: the LRU and, through
+// store.InvalidateAllCache, the asset_ttb_cache rows. A tactic chain or
+// chain rule change, or a new ATT&CK version, calls it, as these change
+// TTBs without changing hashes. Results computed before the purge but
+// recorded after it, in this process or in audit batches still queued or
+// journaled, are not cached.
+func (c *Cache) Purge(ctx context.Context) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.order.Init()
+	clear(c.items)
+	c.purged = time.Now()
+	c.mu.Unlock()
+	c.db.InvalidateAllCache(ctx)
+	slog.InfoContext(ctx, "ttbcache: purged")
+}
+
+// add stores result under k, evicting the least recently used entry when
+// full. It reports false, storing nothing, for a result computed before the
+// last Purge.
+func (c *Cache) add(k key, result *nebula.TTBResult, computedAt time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !computedAt.After(c.purged) {
+		return false
+	}
+	if c.capacity == 0 {
+		return true
+	}
+
+	e := &entry{
+		key:          k,
+		ttb:          result.TTB,
+		log:          append([]nebula.TTBLogEntry(nil), result.Log...),
+		distribution: append([]nebula.TTBOutcome(nil), result.Distribution...),
+	}
+	if el, ok := c.items[k]; ok {
+		el.Value = e
+		c.order.MoveToFront(el)
+		return true
+	}
+	c.items[k] = c.order.PushFront(e)
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry).key)
+	}
+	return true
+}
+
+// logFromBreakdown rebuilds the ALG-REQ-079 TTB log from cached steps.
+func logFromBreakdown(steps []store.BreakdownStep) []nebula.TTBLogEntry {
+	entries := make([]nebula.TTBLogEntry, 0, len(steps))
+	for _, st := range steps {
+		le := nebula.TTBLogEntry{
+			TacticID:        st.TacticID,
+			TacticName:      st.TacticName,
+			TTT:             st.TTTHours,
+			CandidatesCount: st.CandidatesCount,
+		}
+		if st.TechniqueID != "" {
+			id, name := st.TechniqueID, st.TechniqueName
+			le.TechniqueID, le.TechniqueName = &id, &name
+		}
+		if st.TTTDetail != nil {
+			le.ExecMin, le.ExecMax = st.TTTDetail.ExecMin, st.TTTDetail.ExecMax
+		}
+		entries = append(entries, le)
+	}
+	return entries
+}
@@ -0,0 +1,50 @@
+package ttbcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ESP-data/internal/nebula"
+	"ESP-data/internal/store"
+)
+
+// TestRecordAfterPurge checks that a result whose computation started before
+// a Purge is neither kept in the LRU nor queued for asset_ttb_cache.
+func TestRecordAfterPurge(t *testing.T) {
+	ctx := context.Background()
+	defaults := nebula.TTBParams{OrientationTime: 0.25}
+	result := &nebula.TTBResult{TTB: 3.5}
+
+	tests := []struct {
+		name       string
+		capacity   int
+		before     bool // computation started before the purge
+		wantCached bool
+	}{
+		{"started before the purge", 10, true, false},
+		{"started after the purge", 10, false, true},
+		{"no LRU, started before the purge", 0, true, false},
+		{"no LRU, started after the purge", 0, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(tt.capacity, nil, defaults)
+			started := time.Now()
+			c.Purge(ctx)
+			if !tt.before {
+				started = time.Now().Add(time.Millisecond)
+			}
+			audit := &store.AuditBuffer{Breakdowns: []store.BreakdownRecord{{AssetVid: "A1"}}}
+			c.Record("A1", store.PositionEntrance, "hash", defaults, result, audit, 0, started)
+
+			k := key{assetVid: "A1", position: store.PositionEntrance, hash: "hash", params: defaults}
+			if _, ok := c.lookup(ctx, k); ok != tt.wantCached {
+				t.Errorf("lookup hit = %t, want %t", ok, tt.wantCached)
+			}
+			if queued := len(audit.CacheEntries) == 1; queued == tt.before {
+				t.Errorf("cache entry queued = %t, want %t", queued, !tt.before)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package ttbexec
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"ESP-data/internal/graphstore"
+	"ESP-data/internal/metrics"
+	"ESP-data/internal/nebula"
+	"ESP-data/internal/store"
+	"ESP-data/internal/ttbcache"
+)
+
+// ============================================================
+// Parallel TTB executor — ComputeTTB for many assets on a bounded
+// number of workers (ALG-REQ-070, ADR-REQ-030)
+// ============================================================
+
+// Task is one TTB computation.
+type Task struct {
+	AssetID  string
+	ChainVID string
+	Position string // "entrance", "intermediate" or "target"; labels the audit breakdown
+
+	// Cached looks the result up in the TTB cache first (entry and target,
+	// ALG-REQ-053). Otherwise the TTB is always computed.
+	Cached bool
+	// Hash, for an uncached task, is the asset's new hash: the result is
+	// recorded in the TTB cache under it (ALG-REQ-046 step 4, ADR-REQ-022).
+	Hash string
+}
+
+// Result is the outcome of one Task.
+type Result struct {
+	TTB      *nebula.TTBResult
+	CacheHit bool
+	Err      error
+}
+
+// Executor runs TTB computations concurrently. The worker limit holds across
+// all Run calls, so concurrent requests share it; with the Nebula backend it
+// matches the size of the ComputeTTB session pool.
+type Executor struct {
+	slots chan struct{}
+	cache *ttbcache.Cache
+}
+
+// New returns an Executor running at most workers computations at a time,
+// with cached tasks served through cache (which may be nil).
+func New(workers int, cache *ttbcache.Cache) *Executor {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Executor{slots: make(chan struct{}, workers), cache: cache}
+}
+
+// Run computes tasks concurrently and returns their results in task order.
+// Each task fills a private audit buffer; once all tasks finish, the buffers
+// are merged into audit (if not nil) in task order, so audit records do not
+// depend on scheduling.
+//
+// onDone, if not nil, is called as each task finishes, one call at a time.
+// Tasks not started before ctx is cancelled are skipped: their Err is
+// ctx.Err() and onDone is not called.
+func (e *Executor) Run(ctx context.Context, gs graphstore.GraphStore, tasks []Task, params nebula.TTBParams,
+	audit *store.AuditBuffer, onDone func(i int, r Result)) []Result {
+
+	results := make([]Result, len(tasks))
+	buffers := make([]*store.AuditBuffer, len(tasks))
+
+	workers := cap(e.slots)
+	if workers > len(tasks) {
+		workers = len(tasks)
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	var doneMu sync.Mutex
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if !e.acquire(ctx) {
+					results[i] = Result{Err: ctx.Err()}
+					continue
+				}
+				if audit != nil {
+					buffers[i] = &store.AuditBuffer{}
+				}
+				results[i] = e.compute(ctx, gs, tasks[i], params, buffers[i])
+				<-e.slots
+
+				if onDone != nil {
+					doneMu.Lock()
+					onDone(i, results[i])
+					doneMu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range tasks {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	if audit != nil {
+		for _, buf := range buffers {
+			if buf != nil {
+				audit.Merge(buf)
+			}
+		}
+	}
+	return results
+}
+
+// acquire takes a worker slot, reporting false if ctx is cancelled first.
+func (e *Executor) acquire(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	select {
+	case e.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// compute runs one task against its private audit buffer.
+func (e *Executor) compute(ctx context.Context, gs graphstore.GraphStore, t Task, params nebula.TTBParams, audit *store.AuditBuffer) Result {
+	start := time.Now()
+	var r Result
+	defer func() {
+		metrics.TTBComputeSeconds.Since(start, t.Position)
+		switch {
+		case r.Err != nil:
+			metrics.TTBComputations.Inc(t.Position, "failed")
+		case r.CacheHit:
+			metrics.TTBComputations.Inc(t.Position, "cache_hit")
+		default:
+			metrics.TTBComputations.Inc(t.Position, "computed")
+		}
+	}()
+	if t.Cached {
+		r.TTB, r.CacheHit, r.Err = e.cache.ComputeTTB(ctx, gs, t.AssetID, t.ChainVID, t.Position, params, audit)
+	} else {
+		r.TTB, r.Err = gs.ComputeTTB(ctx, t.AssetID, t.ChainVID, params, audit)
+		if audit != nil && len(audit.Breakdowns) > 0 {
+			audit.Breakdowns[0].ChainPosition = t.Position
+		}
+		if r.Err == nil && t.Hash != "" {
+			e.cache.Record(t.AssetID, t.Position, t.Hash, params, r.TTB, audit, 0, start)
+		}
+	}
+	return r
+}
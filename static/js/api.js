@@ -97,10 +97,42 @@ const API = {
         return await response.json();
     },
 
-    // REQ-040: Trigger bulk TTB recalculation (ALG-REQ-045)
+    // REQ-040: Start bulk TTB recalculation job (ALG-REQ-045)
+    // Resolves to { job_id, status_url, events_url }; a 409 (already running)
+    // resolves to the running job so the caller can follow it instead.
     async recalculateTTB() {
         const response = await fetch('/api/recalculate-ttb', { method: 'POST' });
-        if (!response.ok) throw new Error('Failed to recalculate TTB');
+        if (response.status === 409) {
+            const body = await response.json();
+            return {
+                job_id: body.job_id,
+                status_url: `/api/jobs/${body.job_id}`,
+                events_url: `/api/jobs/${body.job_id}/events`
+            };
+        }
+        if (!response.ok) throw new Error('Failed to start TTB recalculation');
         return await response.json();
+    },
+
+    // REQ-040: Follow a job's SSE progress stream. onProgress receives each
+    // per-asset event; resolves to the final job snapshot.
+    watchJob(eventsUrl, onProgress = null) {
+        return new Promise((resolve, reject) => {
+            const source = new EventSource(eventsUrl);
+            source.addEventListener('asset', (e) => {
+                if (onProgress) onProgress(JSON.parse(e.data));
+            });
+            source.addEventListener('done', (e) => {
+                source.close();
+                resolve(JSON.parse(e.data));
+            });
+            source.onerror = () => {
+                // EventSource reconnects on its own while the stream is open;
+                // a closed stream means the job is gone.
+                if (source.readyState === EventSource.CLOSED) {
+                    reject(new Error('Job progress stream closed'));
+                }
+            };
+        });
     }
 };
@@ -72,17 +72,30 @@ async function handleRecalculateTTB() {
     btn.classList.add('btn-loading');
 
     try {
-        const result = await API.recalculateTTB();
-        showToast(
-            `Recalculated TTB for ${result.recalculated} asset(s). ${result.unchanged} unchanged.`,
-            'success'
-        );
+        const job = await API.recalculateTTB();
+        const snapshot = await API.watchJob(job.events_url, (ev) => {
+            btn.title = `Recalculating TTBs: ${ev.done}/${ev.total}` +
+                (ev.failed > 0 ? ` (${ev.failed} failed)` : '');
+        });
+        const result = snapshot.result || {};
+        if (snapshot.state === 'succeeded') {
+            showToast(
+                `Recalculated TTB for ${result.recalculated} asset(s). ${result.unchanged} unchanged.` +
+                    (result.failed > 0 ? ` ${result.failed} failed.` : ''),
+                result.failed > 0 ? 'error' : 'success'
+            );
+        } else if (snapshot.state === 'cancelled') {
+            showToast(`TTB recalculation cancelled after ${snapshot.done}/${snapshot.total} asset(s)`, 'error');
+        } else {
+            showToast('TTB recalculation failed', 'error');
+        }
     } catch (err) {
         console.error('TTB recalculation failed:', err);
         showToast('TTB recalculation failed', 'error');
     } finally {
         btn.disabled = false;
         btn.classList.remove('btn-loading');
+        btn.title = 'Recalculate TTBs';
         await refreshSystemState();
     }
 }